@@ -3,11 +3,15 @@ package main
 import (
 	"context"
 	"fmt"
+
+	"github.com/jorkle/brightcards/backend/components/services"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 // App struct
 type App struct {
-	ctx context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewApp creates a new App application struct
@@ -16,9 +20,53 @@ func NewApp() *App {
 }
 
 // startup is called when the app starts. The context is saved
-// so we can call the runtime methods
+// so we can call the runtime methods, and is cancelled at shutdown
 func (a *App) startup(ctx context.Context) {
-	a.ctx = ctx
+	a.ctx, a.cancel = context.WithCancel(ctx)
+
+	// Forward backend events such as recording levels to the frontend
+	services.SetEventEmitter(func(eventName string, data ...interface{}) {
+		runtime.EventsEmit(a.ctx, eventName, data...)
+	})
+
+	// Record what AI requests use and hold them to the monthly budget
+	services.TrackAIUsage()
+
+	// Reuse the answers of repeated AI requests
+	if err := services.CacheAIResponses(); err != nil {
+		println("Warning:", err.Error())
+	}
+
+	// Remove media files left behind by deleted cards
+	go func() {
+		if _, err := services.CollectOrphanedMedia(); err != nil {
+			println("Warning: media garbage collection failed:", err.Error())
+		}
+	}()
+
+	// Resume AI jobs left over from the last run
+	if err := services.StartAIJobs(a.ctx); err != nil {
+		println("Warning: failed to start AI jobs:", err.Error())
+	}
+
+	// Give mature cards of auto-rephrase decks the variants they are missing
+	go func() {
+		if err := services.QueueMatureCardsForRephrase(a.ctx); err != nil {
+			println("Warning: failed to queue cards for rephrasing:", err.Error())
+		}
+	}()
+}
+
+// shutdown is called when the app is closing. It cancels the AI requests and background
+// jobs still running; interrupted jobs are resumed at the next start.
+func (a *App) shutdown(ctx context.Context) {
+	a.cancel()
+}
+
+// requestContext returns the context of an AI request the UI is waiting on. It is cancelled when the app
+// shuts down or the UI calls CancelAIRequests.
+func (a *App) requestContext() (context.Context, context.CancelFunc) {
+	return services.RequestContext(a.ctx)
 }
 
 // Greet returns a greeting for the given name
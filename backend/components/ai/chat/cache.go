@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ResponseCache stores the content of chat completions by a hash of their request
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (string, bool)
+	Put(ctx context.Context, key string, operation string, content string)
+}
+
+var (
+	responseCache ResponseCache
+	cacheMutex    sync.RWMutex
+)
+
+// SetResponseCache registers the cache used by completeCached, or turns caching off when nil
+func SetResponseCache(c ResponseCache) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	responseCache = c
+}
+
+// cacheKey hashes everything that shapes a response: the model, the prompt and input messages and the parameters
+func cacheKey(req openai.ChatCompletionRequest) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// completeCached is complete for requests whose answer may be reused when the same request is made again.
+// Responses aren't deterministic, even at temperature 0, so a cached response is just one earlier answer that is
+// reused until it expires; callers opt in only where that is good enough, such as generating flashcards from notes.
+// A new response is only cached once keep is called, so one that couldn't be used is asked for again next time.
+// Cached responses cost nothing, so they aren't reported as usage.
+func completeCached(ctx context.Context, operation string, req openai.ChatCompletionRequest) (content string, keep func(), err error) {
+	cacheMutex.RLock()
+	cache := responseCache
+	cacheMutex.RUnlock()
+
+	noop := func() {}
+	if cache == nil {
+		content, err = complete(ctx, operation, req)
+		return content, noop, err
+	}
+
+	key, err := cacheKey(req)
+	if err != nil {
+		content, err = complete(ctx, operation, req)
+		return content, noop, err
+	}
+	if content, ok := cache.Get(ctx, key); ok {
+		return content, noop, nil
+	}
+
+	content, err = complete(ctx, operation, req)
+	if err != nil {
+		return "", noop, err
+	}
+	return content, func() { cache.Put(ctx, key, operation, content) }, nil
+}
@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// mapCache is a ResponseCache kept in memory
+type mapCache map[string]string
+
+func (c mapCache) Get(_ context.Context, key string) (string, bool) {
+	content, ok := c[key]
+	return content, ok
+}
+
+func (c mapCache) Put(_ context.Context, key string, _ string, content string) {
+	c[key] = content
+}
+
+// useTestServer answers chat completions with answer for the rest of the test and returns how many requests it got
+func useTestServer(t *testing.T, answer string) *int {
+	t.Helper()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model:   openai.GPT4Turbo0125,
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test")
+	config.BaseURL = server.URL + "/v1"
+	previous := openaiClient
+	openaiClient = openai.NewClientWithConfig(config)
+	t.Cleanup(func() { openaiClient = previous })
+	return &requests
+}
+
+// useCache registers cache for the rest of the test
+func useCache(t *testing.T, cache ResponseCache) {
+	t.Helper()
+
+	SetResponseCache(cache)
+	t.Cleanup(func() { SetResponseCache(nil) })
+}
+
+func TestCacheKey(t *testing.T) {
+	base := func() openai.ChatCompletionRequest {
+		return openai.ChatCompletionRequest{
+			Model:    openai.GPT4Turbo0125,
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "Prompt"}, {Role: openai.ChatMessageRoleUser, Content: "Notes"}},
+		}
+	}
+	key, err := cacheKey(base())
+	if err != nil {
+		t.Fatalf("Failed to hash request: %v", err)
+	}
+	if again, _ := cacheKey(base()); again != key {
+		t.Errorf("Expected the same request to hash the same, got %s and %s", key, again)
+	}
+
+	changes := map[string]func(req *openai.ChatCompletionRequest){
+		"model":       func(req *openai.ChatCompletionRequest) { req.Model = openai.GPT4o },
+		"prompt":      func(req *openai.ChatCompletionRequest) { req.Messages[0].Content = "Other prompt" },
+		"input":       func(req *openai.ChatCompletionRequest) { req.Messages[1].Content = "Other notes" },
+		"temperature": func(req *openai.ChatCompletionRequest) { req.Temperature = 0.7 },
+		"response format": func(req *openai.ChatCompletionRequest) {
+			req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		},
+	}
+	for name, change := range changes {
+		req := base()
+		change(&req)
+		if changed, _ := cacheKey(req); changed == key {
+			t.Errorf("Expected a different %s to change the key", name)
+		}
+	}
+}
+
+func TestCompleteCached(t *testing.T) {
+	requests := useTestServer(t, "Answer")
+	cache := mapCache{}
+	useCache(t, cache)
+	req := openai.ChatCompletionRequest{Model: openai.GPT4Turbo0125, Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Notes"}}}
+
+	// A response that wasn't kept is asked for again
+	if _, _, err := completeCached(context.Background(), "test", req); err != nil {
+		t.Fatalf("Failed to complete: %v", err)
+	}
+	content, keep, err := completeCached(context.Background(), "test", req)
+	if err != nil || content != "Answer" {
+		t.Fatalf("Expected the answer, got %q (%v)", content, err)
+	}
+	if *requests != 2 || len(cache) != 0 {
+		t.Fatalf("Expected 2 requests and nothing cached, got %d requests and %d cached", *requests, len(cache))
+	}
+
+	// Once kept, it is reused without a request
+	keep()
+	content, _, err = completeCached(context.Background(), "test", req)
+	if err != nil || content != "Answer" || *requests != 2 {
+		t.Errorf("Expected the cached answer without a request, got %q (%v) after %d requests", content, err, *requests)
+	}
+
+	// Without a cache every call is a request
+	SetResponseCache(nil)
+	if _, _, err := completeCached(context.Background(), "test", req); err != nil || *requests != 3 {
+		t.Errorf("Expected a request without a cache, got %d requests (%v)", *requests, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/jorkle/brightcards/backend/components/ai/usage"
 	"github.com/jorkle/brightcards/backend/components/models"
 	"github.com/sashabaranov/go-openai"
 )
@@ -42,11 +43,41 @@ func InitChatCompletion(apiKey string) error {
 	return nil
 }
 
+// complete makes a chat completion request, unless new requests are refused, reports the tokens it used
+// and returns the content of the first choice
+func complete(ctx context.Context, operation string, req openai.ChatCompletionRequest) (string, error) {
+	if err := usage.Allow(); err != nil {
+		return "", err
+	}
+
+	resp, err := openaiClient.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get chat completion: %w", err)
+	}
+	usage.Add(usage.Record{
+		Operation:        operation,
+		Model:            resp.Model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	})
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("chat completion returned no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
 // Replace this with your desired JSON schema for structured output
 
 // Replace this with your system prompt
 
+// RephraseFlashcard asks for variations of a flashcard that test the same memory target in other words
 func RephraseFlashcard(flashcard *models.FlashcardModel, initialismAcronymExpansion bool, maxCards ...int) ([]models.FlashcardModel, error) {
+	return RephraseFlashcardContext(context.Background(), flashcard, initialismAcronymExpansion, maxCards...)
+}
+
+// RephraseFlashcardContext is RephraseFlashcard with a context that can cancel the request
+func RephraseFlashcardContext(ctx context.Context, flashcard *models.FlashcardModel, initialismAcronymExpansion bool, maxCards ...int) ([]models.FlashcardModel, error) {
 	if !initialized {
 		return nil, fmt.Errorf("chat completion not initialized, call InitChatCompletion first")
 	}
@@ -151,9 +182,9 @@ func RephraseFlashcard(flashcard *models.FlashcardModel, initialismAcronymExpans
 	}
 
 	// Call OpenAI API
-	resp, err := openaiClient.CreateChatCompletion(context.Background(), req)
+	content, err := complete(ctx, usage.OperationRephraseFlashcard, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get chat completion: %v", err)
+		return nil, err
 	}
 
 	// Parse response
@@ -167,7 +198,7 @@ func RephraseFlashcard(flashcard *models.FlashcardModel, initialismAcronymExpans
 	}
 
 	var flashcardsResponse generatedFlashcards
-	err = json.Unmarshal([]byte(resp.Choices[0].Message.Content), &flashcardsResponse)
+	err = json.Unmarshal([]byte(content), &flashcardsResponse)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal generated flashcards: %v", err)
 	}
@@ -204,7 +235,13 @@ func RephraseFlashcard(flashcard *models.FlashcardModel, initialismAcronymExpans
 	return rephrasedCards, nil
 }
 
+// GenerateFlashcards turns text into at most maxCards flashcards relevant to the purpose
 func GenerateFlashcards(inputText string, purpose string, maxCards int) ([]Flashcard, error) {
+	return GenerateFlashcardsContext(context.Background(), inputText, purpose, maxCards)
+}
+
+// GenerateFlashcardsContext is GenerateFlashcards with a context that can cancel the request
+func GenerateFlashcardsContext(ctx context.Context, inputText string, purpose string, maxCards int) ([]Flashcard, error) {
 	if !initialized {
 		return nil, fmt.Errorf("chat completion not initialized, call InitChatCompletion first")
 	}
@@ -284,9 +321,9 @@ OR
 		},
 	}
 
-	resp, err := openaiClient.CreateChatCompletion(context.Background(), req)
+	content, keep, err := completeCached(ctx, usage.OperationGenerateFlashcards, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get chat completion: %v", err)
+		return nil, err
 	}
 
 	type generatedFlashcard struct {
@@ -299,11 +336,11 @@ OR
 	}
 
 	var flashcardsResponse generatedFlashcards
-	err = json.Unmarshal([]byte(resp.Choices[0].Message.Content), &flashcardsResponse)
+	err = json.Unmarshal([]byte(content), &flashcardsResponse)
 	if err != nil || len(flashcardsResponse.Flashcards) == 0 {
 		// Try alternate format - the response might be an array of flashcards directly
 		var directFlashcards []generatedFlashcard
-		err = json.Unmarshal([]byte(resp.Choices[0].Message.Content), &directFlashcards)
+		err = json.Unmarshal([]byte(content), &directFlashcards)
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal generated flashcards: %v", err)
 		}
@@ -317,6 +354,7 @@ OR
 					Back:  card.Back,
 				}
 			}
+			keep()
 			return result, nil
 		}
 
@@ -332,10 +370,17 @@ OR
 		}
 	}
 
+	keep()
 	return result, nil
 }
 
+// ProcessText analyzes the transcript of a Feynman explanation
 func ProcessText(inputText string) (*AnalysisResponse, error) {
+	return ProcessTextContext(context.Background(), inputText)
+}
+
+// ProcessTextContext is ProcessText with a context that can cancel the request
+func ProcessTextContext(ctx context.Context, inputText string) (*AnalysisResponse, error) {
 	const systemPrompt = `The user will provide you with the text transcript of them explaining a concept to a imaginary child. This requires the user to be able to explain the concept in a way that is easy to understand for a child. The purpose of this is for two reasons:
 1, to help the user improve at explaining the concept in a way that is easy to understand.
 2, to identify the user's strongspots and weakspots.
@@ -381,21 +426,22 @@ Ensure the response is always valid JSON matching this schema.`
 		},
 	}
 
-	resp, err := openaiClient.CreateChatCompletion(context.Background(), req)
-	if err != nil {
+	content, keep, err := completeCached(ctx, usage.OperationProcessText, req)
+	if err != nil && ctx.Err() == nil {
 		// If we get an error, try without the response format
 		req.ResponseFormat = nil
-		resp, err = openaiClient.CreateChatCompletion(context.Background(), req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get chat completion: %v", err)
-		}
+		content, keep, err = completeCached(ctx, usage.OperationProcessText, req)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	// Decode the JSON response into our struct
 	var analysis AnalysisResponse
-	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &analysis); err != nil {
+	if err := json.Unmarshal([]byte(content), &analysis); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
+	keep()
 
 	return &analysis, nil
 }
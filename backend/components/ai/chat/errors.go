@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// IsRetryable reports whether a failed request is worth trying again: the API was rate limited (429) or had
+// a server error (5xx), the API couldn't be reached, or the request timed out. Other errors, such as a bad key,
+// an invalid request or a cancelled one, fail the same way every time.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.HTTPStatusCode)
+	}
+
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) && requestErr.HTTPStatusCode != 0 {
+		return retryableStatus(requestErr.HTTPStatusCode)
+	}
+
+	return isNetworkError(err)
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// isNetworkError reports whether a request failed to connect, lost its connection or timed out
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
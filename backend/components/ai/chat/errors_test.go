@@ -0,0 +1,55 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestIsRetryable(t *testing.T) {
+	// requestFailed wraps err the way the HTTP client reports a request that didn't get a response
+	requestFailed := func(err error) error {
+		return fmt.Errorf("failed to get chat completion: %w", &url.Error{Op: "Post", URL: "https://api.openai.com/v1/chat/completions", Err: err})
+	}
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"rate limited", &openai.APIError{HTTPStatusCode: 429}, true},
+		{"server error", fmt.Errorf("failed: %w", &openai.APIError{HTTPStatusCode: 500}), true},
+		{"unavailable", &openai.RequestError{HTTPStatusCode: 503}, true},
+		{"bad request", &openai.APIError{HTTPStatusCode: 400}, false},
+		{"bad key", &openai.RequestError{HTTPStatusCode: 401}, false},
+		{"connection refused", requestFailed(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), true},
+		{"connection reset", requestFailed(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), true},
+		{"offline", requestFailed(&net.DNSError{Err: "no such host", Name: "api.openai.com", IsNotFound: true}), true},
+		{"deadline", fmt.Errorf("failed to get chat completion: %w", context.DeadlineExceeded), true},
+		{"client timeout", requestFailed(timeoutError{}), true},
+		{"cancelled", requestFailed(context.Canceled), false},
+		{"certificate", requestFailed(errors.New("x509: certificate signed by unknown authority")), false},
+		{"other", errors.New("no flashcards found in response"), false},
+	}
+
+	for _, tc := range cases {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+// timeoutError is a network error that timed out, like the one the HTTP client returns when its Timeout passes
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "Client.Timeout exceeded while awaiting headers" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
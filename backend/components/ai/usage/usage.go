@@ -0,0 +1,128 @@
+// Package usage lets the packages that call the OpenAI API report what each request used,
+// and lets the app refuse requests, for example once a budget has been spent.
+package usage
+
+import (
+	"strings"
+	"sync"
+)
+
+// Operations reported by the API packages
+const (
+	OperationGenerateFlashcards = "generate_flashcards"
+	OperationRephraseFlashcard  = "rephrase_flashcard"
+	OperationProcessText        = "process_text"
+	OperationTranscription      = "transcription"
+	OperationSpeech             = "speech"
+)
+
+// Record is what a single API request used
+type Record struct {
+	Operation        string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	AudioSeconds     float64 // audio transcribed
+	Characters       int     // text synthesized into speech
+}
+
+// Recorder stores a usage record
+type Recorder func(record Record)
+
+// Guard is asked before every request and refuses it by returning an error. It is asked without any lock held,
+// so requests made at the same time may all be let through.
+type Guard func() error
+
+var (
+	recorder Recorder
+	guard    Guard
+	mutex    sync.RWMutex
+)
+
+// SetRecorder registers the function that stores usage records
+func SetRecorder(r Recorder) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	recorder = r
+}
+
+// SetGuard registers the function that decides whether new requests may be made
+func SetGuard(g Guard) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	guard = g
+}
+
+// Allow returns the guard's error if new requests are refused
+func Allow() error {
+	mutex.RLock()
+	g := guard
+	mutex.RUnlock()
+
+	if g == nil {
+		return nil
+	}
+	return g()
+}
+
+// Add reports the usage of a request that was made
+func Add(record Record) {
+	mutex.RLock()
+	r := recorder
+	mutex.RUnlock()
+
+	if r != nil {
+		r(record)
+	}
+}
+
+// Prices in US dollars, per million tokens for chat models, per minute of audio for transcription
+// and per million characters for speech. They are estimates and may be out of date.
+var (
+	tokenPrices = map[string]struct{ prompt, completion float64 }{
+		"gpt-4-turbo":   {10, 30},
+		"gpt-4-0125":    {10, 30},
+		"gpt-4-1106":    {10, 30},
+		"gpt-4o-mini":   {0.15, 0.6},
+		"gpt-4o":        {2.5, 10},
+		"gpt-4":         {30, 60},
+		"gpt-3.5-turbo": {0.5, 1.5},
+	}
+	transcriptionPricePerMinute = map[string]float64{
+		"whisper-1": 0.006,
+	}
+	speechPricePerMillionCharacters = map[string]float64{
+		"tts-1-hd": 30,
+		"tts-1":    15,
+	}
+)
+
+// matchPrice finds the price of a model, which may carry a date suffix such as gpt-4o-2024-08-06.
+// The longest matching prefix wins, so gpt-4o-mini isn't priced as gpt-4o.
+func matchPrice[T any](prices map[string]T, model string) (T, bool) {
+	var price T
+	best := ""
+	for prefix, p := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, price = prefix, p
+		}
+	}
+	return price, best != ""
+}
+
+// EstimateCost returns the estimated cost of a request in US dollars, or 0 for an unknown model
+func EstimateCost(record Record) float64 {
+	cost := 0.0
+	if price, ok := matchPrice(tokenPrices, record.Model); ok {
+		cost += (float64(record.PromptTokens)*price.prompt + float64(record.CompletionTokens)*price.completion) / 1e6
+	}
+	if price, ok := matchPrice(transcriptionPricePerMinute, record.Model); ok {
+		cost += record.AudioSeconds / 60 * price
+	}
+	if price, ok := matchPrice(speechPricePerMillionCharacters, record.Model); ok {
+		cost += float64(record.Characters) * price / 1e6
+	}
+	return cost
+}
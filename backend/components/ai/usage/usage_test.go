@@ -0,0 +1,52 @@
+package usage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMatchPrice(t *testing.T) {
+	cases := []struct {
+		model  string
+		prompt float64
+		ok     bool
+	}{
+		{"gpt-4o", 2.5, true},
+		// Dated snapshots are priced as their model
+		{"gpt-4o-2024-08-06", 2.5, true},
+		// The longest prefix wins
+		{"gpt-4o-mini", 0.15, true},
+		{"gpt-4o-mini-2024-07-18", 0.15, true},
+		{"gpt-4-turbo-preview", 10, true},
+		{"gpt-4-0613", 30, true},
+		{"o1-preview", 0, false},
+		{"", 0, false},
+	}
+	for _, tc := range cases {
+		price, ok := matchPrice(tokenPrices, tc.model)
+		if ok != tc.ok || price.prompt != tc.prompt {
+			t.Errorf("%q: expected a prompt price of %v (%v), got %v (%v)", tc.model, tc.prompt, tc.ok, price.prompt, ok)
+		}
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	cases := []struct {
+		name   string
+		record Record
+		cost   float64
+	}{
+		{"chat", Record{Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 500}, 0.0075},
+		{"dated chat", Record{Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1e6, CompletionTokens: 1e6}, 0.75},
+		{"transcription", Record{Model: "whisper-1", AudioSeconds: 90}, 0.009},
+		{"speech", Record{Model: "tts-1", Characters: 2000}, 0.03},
+		{"hd speech", Record{Model: "tts-1-hd", Characters: 2000}, 0.06},
+		{"unknown model", Record{Model: "o1-preview", PromptTokens: 1000, CompletionTokens: 1000}, 0},
+		{"nothing used", Record{Model: "gpt-4o"}, 0},
+	}
+	for _, tc := range cases {
+		if cost := EstimateCost(tc.record); math.Abs(cost-tc.cost) > 1e-9 {
+			t.Errorf("%s: expected a cost of %v, got %v", tc.name, tc.cost, cost)
+		}
+	}
+}
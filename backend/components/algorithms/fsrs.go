@@ -8,10 +8,10 @@ import (
 )
 
 const (
-	GradeAgain = 1 // 'Again'
-	GradeHard  = 2 // 'Hard'
-	GradeGood  = 3 // 'Good'
-	GradeEasy  = 4 // 'Easy'
+	GradeAgain = models.GradeAgain
+	GradeHard  = models.GradeHard
+	GradeGood  = models.GradeGood
+	GradeEasy  = models.GradeEasy
 )
 
 // FSRS v5 Algorithm implementation
@@ -34,8 +34,8 @@ var defaultParams = []float64{
 	0.11,     // w[12] - Used in stability after forgetting formula
 	0.29605,  // w[13] - Used in stability after forgetting formula
 	2.2698,   // w[14] - Used in stability after forgetting formula
-	0.2315,   // w[15] - Not used in v5 formula
-	2.9898,   // w[16] - Not used in v5 formula
+	0.2315,   // w[15] - Hard penalty in stability after recall formula
+	2.9898,   // w[16] - Easy bonus in stability after recall formula
 	0.51655,  // w[17] - Used in same-day review formula
 	0.6621,   // w[18] - Used in same-day review formula
 }
@@ -46,33 +46,34 @@ const (
 	FACTOR = 19.0 / 81.0
 )
 
+// minStability keeps stability positive, as in the reference implementations
+const minStability = 0.01
+
 // InitialStability calculates the initial stability after the first rating
+// S_0(G) = w_(G-1)
 func initialStability(rating int) float64 {
-	switch rating {
-	case GradeAgain:
-		return defaultParams[0]
-	case GradeHard:
-		return defaultParams[1]
-	case GradeGood:
-		return defaultParams[2]
-	case GradeEasy:
-		return defaultParams[3]
-	default:
-		return defaultParams[2] // Default to Good if invalid rating
+	if rating < GradeAgain || rating > GradeEasy {
+		rating = GradeGood // Default to Good if invalid rating
 	}
+	return math.Max(defaultParams[rating-1], minStability)
 }
 
-// InitialDifficulty calculates the initial difficulty after the first rating
-// D_0(G) = w_4 - e^(w_5 * (G - 1)) + 1
-func initialDifficulty(rating int) float64 {
+// rawInitialDifficulty is D_0(G) = w_4 - e^(w_5 * (G - 1)) + 1 without clamping
+func rawInitialDifficulty(rating int) float64 {
 	w4 := defaultParams[4]
 	w5 := defaultParams[5]
 	g := float64(rating)
 
-	d0 := w4 - math.Exp(w5*(g-1)) + 1
+	return w4 - math.Exp(w5*(g-1)) + 1
+}
 
-	// Clamp difficulty between 1 and 10
-	return math.Max(1.0, math.Min(10.0, d0))
+// InitialDifficulty calculates the initial difficulty after the first rating, clamped between 1 and 10
+func initialDifficulty(rating int) float64 {
+	return clampDifficulty(rawInitialDifficulty(rating))
+}
+
+func clampDifficulty(difficulty float64) float64 {
+	return math.Max(1.0, math.Min(10.0, difficulty))
 }
 
 // CalculateRetrievability calculates probability of recall after elapsed time
@@ -96,84 +97,77 @@ func calculateInterval(stability float64, requestedRetention float64) float64 {
 	return math.Max(1.0, math.Round(interval))
 }
 
-// UpdateDifficulty updates the card's difficulty using the FSRS v5 formula
-// Linear Damping: ∆D(G) = -w_6 * (G - 3)
-// D' = D + ∆D * (10 - D)/9
+// UpdateDifficulty updates the card's difficulty using the FSRS v5 formula as py-fsrs and ts-fsrs apply it,
+// without the linear damping some write-ups of FSRS-5 describe, so intervals after a lapse match theirs
+// D' = D - w_6 * (G - 3)
 // Mean reversion: D” = w_7 * D_0(4) + (1 - w_7) * D'
+// The mean reversion target D_0(4) is not clamped.
 func updateDifficulty(difficulty float64, rating int) float64 {
 	w6 := defaultParams[6]
 	w7 := defaultParams[7]
 	g := float64(rating)
 
-	// Calculate target for mean reversion (D_0(4))
-	meanReversionTarget := initialDifficulty(GradeEasy)
+	meanReversionTarget := rawInitialDifficulty(GradeEasy)
 
-	// Linear damping
-	deltaD := -w6 * (g - 3.0)
-	dPrime := difficulty + deltaD*(10.0-difficulty)/9.0
+	dPrime := difficulty - w6*(g-3.0)
 
 	// Mean reversion
-	newDifficulty := w7*meanReversionTarget + (1.0-w7)*dPrime
-
-	// Clamp between 1 and 10
-	return math.Max(1.0, math.Min(10.0, newDifficulty))
+	return clampDifficulty(w7*meanReversionTarget + (1.0-w7)*dPrime)
 }
 
 // CalculateStabilityAfterRecall calculates stability after a successful review
-// S'_r(S,D,R,G) = S * (1 + exp(w_8) * (exp(w_9 * (1-R)) - 1) * (exp(w_10 * (D-5)) - 1) * exp(w_11 * (G-3)))
+// S'_r(D,S,R,G) = S * (1 + e^w_8 * (11 - D) * S^(-w_9) * (e^(w_10 * (1-R)) - 1) * w_15(if G = 2) * w_16(if G = 4))
 func calculateStabilityAfterRecall(stability, difficulty, retrievability float64, rating int) float64 {
 	w8 := defaultParams[8]
 	w9 := defaultParams[9]
 	w10 := defaultParams[10]
-	g := float64(rating)
 
-	// FSRS v4 formula as specified in documentation
-	newStability := stability
-
-	// Different formulas based on rating
-	if rating == GradeAgain {
-		// Again rating - this should not happen in successful recall, but included for completeness
-		return stability * 0.5 // Typically stability is reduced for "again" ratings
-	} else if rating == GradeHard {
-		// Hard rating - use retrievability-adjusted formula
-		newStability = stability * (1.0 + math.Exp(w8)*(math.Exp(w9*(1.0-retrievability))-1.0)*math.Exp(w10*(g-3.0)))
-	} else if rating == GradeGood {
-		// Good rating - standard formula
-		newStability = stability * (1.0 + math.Exp(w8)*(math.Exp(w9*(1.0-retrievability))-1.0))
-	} else { // GradeEasy
-		// Easy rating - increased stability gain
-		newStability = stability * (1.0 + math.Exp(w8)*(math.Exp(w9*(1.0-retrievability))-1.0)*math.Exp(w10))
+	hardPenalty := 1.0
+	if rating == GradeHard {
+		hardPenalty = defaultParams[15]
+	}
+	easyBonus := 1.0
+	if rating == GradeEasy {
+		easyBonus = defaultParams[16]
 	}
 
-	return newStability
+	return stability * (1.0 +
+		math.Exp(w8)*
+			(11.0-difficulty)*
+			math.Pow(stability, -w9)*
+			(math.Exp(w10*(1.0-retrievability))-1.0)*
+			hardPenalty*
+			easyBonus)
 }
 
-// CalculateStabilityAfterForgetting calculates stability after a failed review
-// S'_f(D,S,R) = w_11 * D^(-w_12) * ((S+1)^(w_13) - 1) * e^(w_14 * (1-R))
+// CalculateStabilityAfterForgetting calculates stability after a failed review. It can't exceed the
+// stability a same-day lapse would give.
+// S'_f(D,S,R) = min(w_11 * D^(-w_12) * ((S+1)^(w_13) - 1) * e^(w_14 * (1-R)), S / e^(w_17 * w_18))
 func calculateStabilityAfterForgetting(stability, difficulty, retrievability float64) float64 {
 	w11 := defaultParams[11]
 	w12 := defaultParams[12]
 	w13 := defaultParams[13]
 	w14 := defaultParams[14]
+	w17 := defaultParams[17]
+	w18 := defaultParams[18]
 
-	// Calculate new stability after forgetting
-	newStability := w11 *
+	longTerm := w11 *
 		math.Pow(difficulty, -w12) *
 		(math.Pow(stability+1.0, w13) - 1.0) *
 		math.Exp(w14*(1.0-retrievability))
+	shortTerm := stability / math.Exp(w17*w18)
 
-	return math.Max(1.0, newStability)
+	return math.Max(math.Min(longTerm, shortTerm), minStability)
 }
 
-// CalculateStabilityAfterSameDayReview calculates stability after a same-day review
+// CalculateStabilityAfterSameDayReview calculates the short-term stability after a review less than a day after the last one
 // S'(S,G) = S * e^(w_17 * (G - 3 + w_18))
 func calculateStabilityAfterSameDayReview(stability float64, rating int) float64 {
 	w17 := defaultParams[17]
 	w18 := defaultParams[18]
 	g := float64(rating)
 
-	newStability := stability * math.Exp(w17*(g-3.0+w18))
-	return math.Max(1.0, newStability)
+	return math.Max(stability*math.Exp(w17*(g-3.0+w18)), minStability)
 }
 
 // NextReviewFirst handles the first review of a card
@@ -185,37 +179,27 @@ func NextReviewFirst(rating int) (float64, float64) {
 	return stability, difficulty
 }
 
-// NextReviewSubsequent handles subsequent reviews
+// NextReviewSubsequent handles subsequent reviews. elapsedDays is the number of whole days since the last review.
+// Stability is updated from the difficulty before the review, and the difficulty afterwards, as in the reference implementations.
 func NextReviewSubsequent(rating int, currentDifficulty, currentStability float64, elapsedDays float64) (float64, float64, float64) {
-	// If this is a same-day review (elapsedDays < 1), use the same-day formula
-	if elapsedDays < 1.0 {
-		newStability := calculateStabilityAfterSameDayReview(currentStability, rating)
-		return calculateInterval(newStability, 0.9), currentDifficulty, newStability
-	}
-
-	// Calculate retrievability based on elapsed time and current stability
-	retrievability := calculateRetrievability(elapsedDays, currentStability)
-
-	// Update difficulty
 	newDifficulty := updateDifficulty(currentDifficulty, rating)
 
-	// Calculate new stability
 	var newStability float64
-	if rating == GradeAgain {
-		// For "Again" rating, use the forgetting formula
-		newStability = calculateStabilityAfterForgetting(currentStability, newDifficulty, retrievability)
-	} else {
-		// For other ratings, use the recall formula
-		newStability = calculateStabilityAfterRecall(currentStability, newDifficulty, retrievability, rating)
+	switch {
+	case elapsedDays < 1.0:
+		// Same-day reviews use the short-term formula
+		newStability = calculateStabilityAfterSameDayReview(currentStability, rating)
+	case rating == GradeAgain:
+		retrievability := calculateRetrievability(elapsedDays, currentStability)
+		newStability = calculateStabilityAfterForgetting(currentStability, currentDifficulty, retrievability)
+	default:
+		retrievability := calculateRetrievability(elapsedDays, currentStability)
+		newStability = calculateStabilityAfterRecall(currentStability, currentDifficulty, retrievability, rating)
 	}
 
-	// Calculate next interval
-	var nextInterval float64
-	if rating == GradeAgain {
-		// For "Again" rating, schedule for immediate review
-		nextInterval = 0.0
-	} else {
-		// For other ratings, calculate the interval based on the new stability
+	// A forgotten card is relearned rather than given a day-level interval
+	nextInterval := 0.0
+	if rating != GradeAgain {
 		nextInterval = calculateInterval(newStability, 0.9)
 	}
 
@@ -228,28 +212,7 @@ func DoInitialGrading(flashcard models.FlashcardModel, grade int) (float64, floa
 	return stability, difficulty
 }
 
-// DoSubsequentGrading processes subsequent gradings of a flashcard and returns next interval, difficulty, and stability
-func DoSubsequentGrading(flashcard *models.FlashcardModel, grade int) (float64, float64, float64) {
-	oldDifficulty := flashcard.FSRSDifficulty
-	oldStability := flashcard.FSRSStability
-
-	// Calculate elapsed days since last review
-	var elapsedDays float64
-	// LastReviewed is a *string, so we need to check if it's nil
-	if flashcard.LastReviewed != nil && *flashcard.LastReviewed != "" {
-		// Parse the time string to calculate actual elapsed days
-		lastReviewed, err := time.Parse(time.RFC3339, *flashcard.LastReviewed)
-		if err == nil {
-			elapsedDays = time.Since(lastReviewed).Hours() / 24.0
-		} else {
-			// If parsing fails, use a reasonable default
-			elapsedDays = 1.0
-		}
-	} else {
-		// If never reviewed, use the stability-based approximation
-		elapsedDays = oldStability * 0.9
-	}
-
-	// Call the core algorithm function with the elapsed days
-	return NextReviewSubsequent(grade, oldDifficulty, oldStability, elapsedDays)
+// DoSubsequentGrading processes subsequent gradings of a flashcard at now and returns next interval, difficulty, and stability
+func DoSubsequentGrading(flashcard *models.FlashcardModel, grade int, now time.Time) (float64, float64, float64) {
+	return NextReviewSubsequent(grade, flashcard.FSRSDifficulty, flashcard.FSRSStability, ElapsedDays(*flashcard, now))
 }
@@ -0,0 +1,186 @@
+package algorithms
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// Expected values in the formula tests below were computed from the published FSRS-5 equations with the
+// default parameters in a separate script, not with this implementation, and are given to 6 decimal places.
+// The review sequences further down are regression snapshots, except where a test says otherwise.
+const tolerance = 1e-6
+
+func assertClose(t *testing.T, name string, got float64, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > tolerance {
+		t.Errorf("%s: expected %.6f, got %.6f", name, want, got)
+	}
+}
+
+// withParams runs a test with a different parameter set, restoring the defaults afterwards
+func withParams(t *testing.T, params []float64) {
+	t.Helper()
+	original := defaultParams
+	defaultParams = params
+	t.Cleanup(func() {
+		defaultParams = original
+	})
+}
+
+func TestInitialState(t *testing.T) {
+	wantDifficulty := []float64{7.1949, 6.488305, 5.282434, 3.224502}
+	for grade := GradeAgain; grade <= GradeEasy; grade++ {
+		stability, difficulty := NextReviewFirst(grade)
+		assertClose(t, "initial stability", stability, defaultParams[grade-1])
+		assertClose(t, "initial difficulty", difficulty, wantDifficulty[grade-1])
+	}
+}
+
+func TestUpdateDifficulty(t *testing.T) {
+	// A step of w_6 per grade and mean reversion towards the unclamped D_0(4)
+	want := []float64{7.899197, 6.445515, 4.991833, 3.538151}
+	for grade := GradeAgain; grade <= GradeEasy; grade++ {
+		assertClose(t, "difficulty", updateDifficulty(5.0, grade), want[grade-1])
+	}
+
+	if d := updateDifficulty(10.0, GradeAgain); d > 10.0 {
+		t.Errorf("Expected difficulty to be clamped to 10, got %f", d)
+	}
+}
+
+func TestStabilityAfterRecall(t *testing.T) {
+	assertClose(t, "hard", calculateStabilityAfterRecall(10, 5, 0.9, GradeHard), 15.313912)
+	assertClose(t, "good", calculateStabilityAfterRecall(10, 5, 0.9, GradeGood), 32.954264)
+	assertClose(t, "easy", calculateStabilityAfterRecall(10, 5, 0.9, GradeEasy), 78.628658)
+}
+
+func TestStabilityAfterForgetting(t *testing.T) {
+	assertClose(t, "long-term", calculateStabilityAfterForgetting(10, 5, 0.9), 2.107696)
+	// A long-overdue lapse is capped by the short-term stability S / e^(w_17 * w_18)
+	assertClose(t, "capped", calculateStabilityAfterForgetting(100, 8, 0.5), 14.019701)
+}
+
+func TestStabilityAfterSameDayReview(t *testing.T) {
+	want := []float64{1.503086, 2.519524, 4.223314, 7.079265}
+	for grade := GradeAgain; grade <= GradeEasy; grade++ {
+		assertClose(t, "short-term stability", calculateStabilityAfterSameDayReview(3, grade), want[grade-1])
+	}
+}
+
+func TestRetrievabilityAndInterval(t *testing.T) {
+	// By definition of stability, recall probability is 90% after S days, so at 90% retention the interval is S
+	assertClose(t, "retrievability", calculateRetrievability(10, 10), 0.9)
+	if interval := calculateInterval(4.4669, 0.9); interval != 4 {
+		t.Errorf("Expected interval 4, got %f", interval)
+	}
+	if interval := calculateInterval(0.2, 0.9); interval != 1 {
+		t.Errorf("Expected interval to be at least 1 day, got %f", interval)
+	}
+}
+
+// simulateReviews grades a new card with each rating in turn, reviewing it exactly when it is due,
+// and returns the interval in whole days after each review along with the final card
+func simulateReviews(t *testing.T, ratings []int) ([]int, models.FlashcardModel) {
+	t.Helper()
+
+	steps, err := ParseLearningSteps(DefaultLearningSteps, DefaultRelearningSteps)
+	if err != nil {
+		t.Fatalf("Failed to parse default steps: %v", err)
+	}
+
+	now := time.Date(2022, 11, 29, 12, 30, 0, 0, time.UTC)
+	card := models.FlashcardModel{State: StateNew}
+	intervals := []int{}
+	for _, rating := range ratings {
+		schedule := ScheduleReview(card, rating, steps, now)
+		due := now.Add(time.Duration(schedule.IntervalDays * 24 * float64(time.Hour)))
+		intervals = append(intervals, int(due.Sub(now).Hours()/24))
+
+		lastReviewed := now.Format(time.RFC3339)
+		card.LastReviewed = &lastReviewed
+		card.State = schedule.State
+		card.Step = schedule.Step
+		card.FSRSStability = schedule.Stability
+		card.FSRSDifficulty = schedule.Difficulty
+		now = due
+	}
+	return intervals, card
+}
+
+func assertIntervals(t *testing.T, got []int, want []int) {
+	t.Helper()
+	if len(got) < len(want) {
+		t.Fatalf("Expected %d intervals, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected intervals %v, got %v", want, got[:len(want)])
+			return
+		}
+	}
+}
+
+func TestReferenceReviewSequence(t *testing.T) {
+	// Parameters of the review sequence in the py-fsrs and ts-fsrs test suites, and the intervals published there,
+	// including the lapse and relearning
+	withParams(t, []float64{0.4072, 1.1829, 3.1262, 15.4722, 7.2102, 0.5316, 1.0651, 0.0234, 1.616, 0.1544, 1.0824, 1.9813, 0.0953, 0.2975, 2.2042, 0.2407, 2.9466, 0.5034, 0.6567})
+
+	ratings := []int{GradeGood, GradeGood, GradeGood, GradeGood, GradeGood, GradeGood, GradeAgain, GradeAgain, GradeGood, GradeGood, GradeGood, GradeGood, GradeGood}
+	intervals, _ := simulateReviews(t, ratings)
+	want := []int{0, 4, 15, 48, 136, 351, 0, 0, 7, 13, 24, 43, 77}
+	if len(intervals) != len(want) {
+		t.Fatalf("Expected %d intervals, got %v", len(want), intervals)
+	}
+	assertIntervals(t, intervals, want)
+}
+
+// TestReviewSequences pins the intervals and final memory state this implementation gives longer sequences
+// with the default parameters. They are regression snapshots, not reference values: update them only
+// when a scheduling change is intended.
+func TestReviewSequences(t *testing.T) {
+	tests := []struct {
+		name       string
+		ratings    []int
+		intervals  []int
+		stability  float64
+		difficulty float64
+	}{
+		{
+			name:       "lapse and relearn",
+			ratings:    []int{3, 3, 3, 3, 3, 3, 1, 1, 3, 3, 3, 3, 3},
+			intervals:  []int{0, 4, 14, 44, 125, 328, 0, 0, 7, 9, 13, 18, 26},
+			stability:  25.5935,
+			difficulty: 9.8456,
+		},
+		{
+			name:       "easy first review",
+			ratings:    []int{4, 3, 2, 3, 1, 3, 4},
+			intervals:  []int{16, 61, 95, 270, 0, 12, 59},
+			stability:  58.5802,
+			difficulty: 6.0786,
+		},
+		{
+			name:       "struggling new card",
+			ratings:    []int{1, 2, 3, 3, 2, 3},
+			intervals:  []int{0, 0, 0, 1, 1, 1},
+			stability:  1.4557,
+			difficulty: 9.9688,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intervals, card := simulateReviews(t, tt.ratings)
+			assertIntervals(t, intervals, tt.intervals)
+			if math.Abs(card.FSRSStability-tt.stability) > 1e-4 {
+				t.Errorf("Expected stability %.4f, got %.4f", tt.stability, card.FSRSStability)
+			}
+			if math.Abs(card.FSRSDifficulty-tt.difficulty) > 1e-4 {
+				t.Errorf("Expected difficulty %.4f, got %.4f", tt.difficulty, card.FSRSDifficulty)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package algorithms
+
+import "math"
+
+// DefaultMaximumInterval caps intervals at about 100 years, as in Anki
+const DefaultMaximumInterval = 36500
+
+// fuzzRange adds factor days of fuzz for every day of the interval between start and end
+type fuzzRange struct {
+	start  float64
+	end    float64
+	factor float64
+}
+
+// Fuzz ranges used by the reference FSRS schedulers: longer intervals get proportionally less fuzz
+var fuzzRanges = []fuzzRange{
+	{start: 2.5, end: 7.0, factor: 0.15},
+	{start: 7.0, end: 20.0, factor: 0.1},
+	{start: 20.0, end: math.Inf(1), factor: 0.05},
+}
+
+// FuzzBounds returns the smallest and largest interval, in days, a review interval may be fuzzed to.
+// Intervals shorter than 2.5 days aren't fuzzed and get a range of one day.
+func FuzzBounds(interval float64, elapsedDays float64, maximumInterval int) (int, int) {
+	if interval < 2.5 {
+		rounded := min(max(int(math.Round(interval)), 1), maximumInterval)
+		return rounded, rounded
+	}
+
+	delta := 1.0
+	for _, r := range fuzzRanges {
+		delta += r.factor * math.Max(math.Min(interval, r.end)-r.start, 0.0)
+	}
+
+	interval = math.Min(interval, float64(maximumInterval))
+	minInterval := max(2, int(math.Round(interval-delta)))
+	maxInterval := min(int(math.Round(interval+delta)), maximumInterval)
+	// Don't let fuzz schedule a card sooner than the gap it just survived
+	if interval > elapsedDays {
+		minInterval = max(minInterval, int(elapsedDays)+1)
+	}
+	minInterval = min(minInterval, maxInterval)
+	return minInterval, maxInterval
+}
+
+// FuzzInterval picks an interval within the fuzz bounds using r, a random number in [0, 1)
+func FuzzInterval(interval float64, elapsedDays float64, maximumInterval int, r float64) int {
+	minInterval, maxInterval := FuzzBounds(interval, elapsedDays, maximumInterval)
+	return min(minInterval+int(r*float64(maxInterval-minInterval+1)), maxInterval)
+}
+
+// BalanceInterval picks the interval within [minInterval, maxInterval] whose day has the fewest cards due,
+// according to dueOn. Ties go to the day closest to the unfuzzed interval.
+func BalanceInterval(interval float64, minInterval int, maxInterval int, dueOn func(days int) int) int {
+	best := minInterval
+	bestLoad := math.MaxInt
+	for days := minInterval; days <= maxInterval; days++ {
+		load := dueOn(days)
+		if load < bestLoad || (load == bestLoad && math.Abs(float64(days)-interval) < math.Abs(float64(best)-interval)) {
+			best = days
+			bestLoad = load
+		}
+	}
+	return best
+}
+
+// IntervalSpread controls how review intervals are spread out so cards studied together don't stay due together
+type IntervalSpread struct {
+	Fuzz            bool
+	MaximumInterval int
+	Random          func() float64     // random number in [0, 1) used for fuzz
+	DueOn           func(days int) int // when set, the least loaded day in the fuzz range is chosen instead of a random one
+}
+
+// SpreadInterval applies fuzz or load balancing to a review interval in days
+func SpreadInterval(interval float64, elapsedDays float64, spread IntervalSpread) float64 {
+	maximumInterval := spread.MaximumInterval
+	if maximumInterval <= 0 {
+		maximumInterval = DefaultMaximumInterval
+	}
+
+	switch {
+	case spread.DueOn != nil:
+		minInterval, maxInterval := FuzzBounds(interval, elapsedDays, maximumInterval)
+		return float64(BalanceInterval(interval, minInterval, maxInterval, spread.DueOn))
+	case spread.Fuzz && spread.Random != nil:
+		return float64(FuzzInterval(interval, elapsedDays, maximumInterval, spread.Random()))
+	default:
+		return math.Min(interval, float64(maximumInterval))
+	}
+}
@@ -0,0 +1,122 @@
+package algorithms
+
+import "testing"
+
+func TestFuzzBounds(t *testing.T) {
+	cases := []struct {
+		interval float64
+		elapsed  float64
+		maximum  int
+		min, max int
+	}{
+		// Short intervals aren't fuzzed
+		{0.3, 0, 36500, 1, 1},
+		{1.4, 0, 36500, 1, 1},
+		{2.4, 0, 36500, 2, 2},
+		// 1 + 0.15 * (3 - 2.5) = 1.075 days either way
+		{3, 0, 36500, 2, 4},
+		// 1 + 0.15 * 4.5 + 0.1 * 3 = 1.975 days either way
+		{10, 0, 36500, 8, 12},
+		// 1 + 0.15 * 4.5 + 0.1 * 13 + 0.05 * 80 = 6.975 days either way
+		{100, 0, 36500, 93, 107},
+		// The maximum interval caps both ends
+		{100, 0, 50, 43, 50},
+		{10, 0, 5, 3, 5},
+		{1, 0, 0, 0, 0},
+		// A card isn't scheduled sooner than the gap it just survived
+		{10, 9, 36500, 10, 12},
+		{10, 20, 36500, 8, 12},
+		{10, 11.5, 36500, 8, 12},
+	}
+
+	for _, tc := range cases {
+		minInterval, maxInterval := FuzzBounds(tc.interval, tc.elapsed, tc.maximum)
+		if minInterval != tc.min || maxInterval != tc.max {
+			t.Errorf("FuzzBounds(%v, %v, %d): expected [%d, %d], got [%d, %d]",
+				tc.interval, tc.elapsed, tc.maximum, tc.min, tc.max, minInterval, maxInterval)
+		}
+	}
+}
+
+func TestFuzzIntervalCoversRangeEvenly(t *testing.T) {
+	const steps = 1000
+	counts := map[int]int{}
+	for i := 0; i < steps; i++ {
+		r := float64(i) / steps
+		counts[FuzzInterval(10, 0, DefaultMaximumInterval, r)]++
+	}
+
+	// [8, 12] has five days, each picked for a fifth of the random range
+	for days := 8; days <= 12; days++ {
+		if counts[days] != steps/5 {
+			t.Errorf("Expected %d days to be picked %d times, got %d", days, steps/5, counts[days])
+		}
+	}
+	if len(counts) != 5 {
+		t.Errorf("Expected only intervals within [8, 12], got %v", counts)
+	}
+
+	if got := FuzzInterval(10, 0, DefaultMaximumInterval, 0.9999999); got != 12 {
+		t.Errorf("Expected r close to 1 to give the longest interval, got %d", got)
+	}
+	if got := FuzzInterval(2, 0, DefaultMaximumInterval, 0.9); got != 2 {
+		t.Errorf("Expected a short interval to stay unfuzzed, got %d", got)
+	}
+}
+
+func TestBalanceInterval(t *testing.T) {
+	due := map[int]int{8: 5, 9: 3, 10: 4, 11: 3, 12: 9}
+	dueOn := func(days int) int { return due[days] }
+
+	// 9 and 11 tie on load; 11 is closer to the unfuzzed 10.6
+	if got := BalanceInterval(10.6, 8, 12, dueOn); got != 11 {
+		t.Errorf("Expected the least loaded day closest to the interval (11), got %d", got)
+	}
+	if got := BalanceInterval(9.4, 8, 12, dueOn); got != 9 {
+		t.Errorf("Expected the least loaded day closest to the interval (9), got %d", got)
+	}
+
+	// With nothing due, the day closest to the interval wins
+	if got := BalanceInterval(10.4, 8, 12, func(int) int { return 0 }); got != 10 {
+		t.Errorf("Expected the unfuzzed interval on an empty schedule, got %d", got)
+	}
+	if got := BalanceInterval(5, 5, 5, dueOn); got != 5 {
+		t.Errorf("Expected a single day range to give that day, got %d", got)
+	}
+}
+
+func TestSpreadInterval(t *testing.T) {
+	if got := SpreadInterval(10.4, 0, IntervalSpread{}); got != 10.4 {
+		t.Errorf("Expected no spread to keep the interval, got %v", got)
+	}
+	if got := SpreadInterval(50000, 0, IntervalSpread{}); got != DefaultMaximumInterval {
+		t.Errorf("Expected the default maximum interval to apply, got %v", got)
+	}
+	if got := SpreadInterval(50, 0, IntervalSpread{MaximumInterval: 30}); got != 30 {
+		t.Errorf("Expected the maximum interval to apply, got %v", got)
+	}
+
+	// Fuzz needs a random source
+	if got := SpreadInterval(10, 0, IntervalSpread{Fuzz: true}); got != 10 {
+		t.Errorf("Expected fuzz without a random source to keep the interval, got %v", got)
+	}
+	fuzzed := SpreadInterval(10, 0, IntervalSpread{Fuzz: true, Random: func() float64 { return 0 }})
+	if fuzzed != 8 {
+		t.Errorf("Expected fuzz with r = 0 to give the shortest interval, got %v", fuzzed)
+	}
+
+	// Load balancing takes over from random fuzz
+	balanced := SpreadInterval(10, 0, IntervalSpread{
+		Fuzz:   true,
+		Random: func() float64 { return 0 },
+		DueOn: func(days int) int {
+			if days == 12 {
+				return 0
+			}
+			return 10
+		},
+	})
+	if balanced != 12 {
+		t.Errorf("Expected load balancing to pick the empty day, got %v", balanced)
+	}
+}
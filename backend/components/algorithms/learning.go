@@ -0,0 +1,184 @@
+package algorithms
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// Card states, see models.CardStateNew
+const (
+	StateNew        = models.CardStateNew
+	StateLearning   = models.CardStateLearning
+	StateReview     = models.CardStateReview
+	StateRelearning = models.CardStateRelearning
+)
+
+// Default steps for decks that haven't configured their own
+const (
+	DefaultLearningSteps   = models.DefaultLearningSteps
+	DefaultRelearningSteps = models.DefaultRelearningSteps
+)
+
+// LearningSteps holds the delays between reviews while a card is learning or relearning
+type LearningSteps struct {
+	Learning   []time.Duration
+	Relearning []time.Duration
+}
+
+// ParseSteps parses space separated steps such as "1m 10m 1h 1d". An empty string means no steps.
+func ParseSteps(steps string) ([]time.Duration, error) {
+	parsed := []time.Duration{}
+	for _, field := range strings.Fields(steps) {
+		if len(field) < 2 {
+			return nil, fmt.Errorf("invalid step %q: use a number followed by s, m, h or d", field)
+		}
+
+		value, err := strconv.ParseFloat(field[:len(field)-1], 64)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid step %q: use a positive number followed by s, m, h or d", field)
+		}
+
+		var unit time.Duration
+		switch field[len(field)-1] {
+		case 's':
+			unit = time.Second
+		case 'm':
+			unit = time.Minute
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = 24 * time.Hour
+		default:
+			return nil, fmt.Errorf("invalid step %q: use a number followed by s, m, h or d", field)
+		}
+		parsed = append(parsed, time.Duration(value*float64(unit)))
+	}
+	return parsed, nil
+}
+
+// ParseLearningSteps parses a deck's learning and relearning steps
+func ParseLearningSteps(learning string, relearning string) (LearningSteps, error) {
+	learningSteps, err := ParseSteps(learning)
+	if err != nil {
+		return LearningSteps{}, fmt.Errorf("learning steps: %v", err)
+	}
+	relearningSteps, err := ParseSteps(relearning)
+	if err != nil {
+		return LearningSteps{}, fmt.Errorf("relearning steps: %v", err)
+	}
+	return LearningSteps{Learning: learningSteps, Relearning: relearningSteps}, nil
+}
+
+// hardDelay is the delay for Hard on a step: halfway to the next step on the first step, like Anki,
+// or 1.5 times the step when there is only one, and a repeat of the step otherwise
+func hardDelay(steps []time.Duration, step int) time.Duration {
+	if step == 0 {
+		if len(steps) == 1 {
+			return steps[0] * 3 / 2
+		}
+		return (steps[0] + steps[1]) / 2
+	}
+	return steps[step]
+}
+
+func days(d time.Duration) float64 {
+	return d.Hours() / 24.0
+}
+
+// ScheduleReview works out a card's state, memory and next due time after it is graded at now
+func ScheduleReview(card models.FlashcardModel, grade int, steps LearningSteps, now time.Time) models.CardSchedule {
+	state := card.State
+	if state == "" {
+		state = StateNew
+	}
+
+	schedule := models.CardSchedule{}
+	if state == StateNew {
+		schedule.Stability, schedule.Difficulty = NextReviewFirst(grade)
+	} else {
+		var interval float64
+		interval, schedule.Difficulty, schedule.Stability = NextReviewSubsequent(grade, card.FSRSDifficulty, card.FSRSStability, ElapsedDays(card, now))
+		schedule.IntervalDays = interval
+	}
+
+	graduate := func() models.CardSchedule {
+		schedule.State = StateReview
+		schedule.Step = 0
+		schedule.IntervalDays = calculateInterval(schedule.Stability, 0.9)
+		return schedule
+	}
+
+	switch state {
+	case StateNew, StateLearning, StateRelearning:
+		stepDelays := steps.Learning
+		schedule.State = StateLearning
+		if state == StateRelearning {
+			stepDelays = steps.Relearning
+			schedule.State = StateRelearning
+		}
+		if len(stepDelays) == 0 {
+			return graduate()
+		}
+
+		step := card.Step
+		if state == StateNew {
+			step = 0
+		}
+		// The deck's steps may have been shortened since the card's last review
+		if step >= len(stepDelays) {
+			if grade != GradeAgain {
+				return graduate()
+			}
+			step = 0
+		}
+
+		switch grade {
+		case GradeAgain:
+			schedule.Step = 0
+			schedule.IntervalDays = days(stepDelays[0])
+		case GradeHard:
+			schedule.Step = step
+			schedule.IntervalDays = days(hardDelay(stepDelays, step))
+		case GradeGood:
+			// A new card starts on the first step, so Good moves it on to the second
+			next := step + 1
+			if next >= len(stepDelays) {
+				return graduate()
+			}
+			schedule.Step = next
+			schedule.IntervalDays = days(stepDelays[next])
+		default:
+			return graduate()
+		}
+		return schedule
+
+	default:
+		if grade == GradeAgain && len(steps.Relearning) > 0 {
+			schedule.State = StateRelearning
+			schedule.Step = 0
+			schedule.IntervalDays = days(steps.Relearning[0])
+			return schedule
+		}
+		return graduate()
+	}
+}
+
+// ElapsedDays returns the whole days between the card's last review and now, as used by the FSRS formulas
+func ElapsedDays(card models.FlashcardModel, now time.Time) float64 {
+	if card.LastReviewed == nil || *card.LastReviewed == "" {
+		// If never reviewed, use the stability-based approximation
+		return card.FSRSStability * 0.9
+	}
+
+	lastReviewed, err := time.Parse(time.RFC3339, *card.LastReviewed)
+	if err != nil {
+		// If parsing fails, use a reasonable default
+		return 1.0
+	}
+	return math.Max(0, math.Floor(now.Sub(lastReviewed).Hours()/24.0))
+}
@@ -0,0 +1,77 @@
+package algorithms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/clock"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// reviewAt grades a card at the clock's time and returns it with its new schedule applied, and its due time
+func reviewAt(card models.FlashcardModel, grade int, steps LearningSteps, c clock.Clock) (models.FlashcardModel, time.Time) {
+	now := c.Now()
+	schedule := ScheduleReview(card, grade, steps, now)
+
+	lastReviewed := now.Format(time.RFC3339)
+	card.LastReviewed = &lastReviewed
+	card.State = schedule.State
+	card.Step = schedule.Step
+	card.FSRSStability = schedule.Stability
+	card.FSRSDifficulty = schedule.Difficulty
+	return card, now.Add(time.Duration(schedule.IntervalDays * 24 * float64(time.Hour)))
+}
+
+func TestLearningStepsOverTime(t *testing.T) {
+	steps, err := ParseLearningSteps("1m 10m", "10m")
+	if err != nil {
+		t.Fatalf("Failed to parse steps: %v", err)
+	}
+
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	c := clock.NewManual(start)
+	card := models.FlashcardModel{State: StateNew}
+
+	tests := []struct {
+		grade   int
+		advance time.Duration // time to wait after the review before the next one
+		state   string
+		due     time.Duration // expected due time, from the review
+	}{
+		{grade: GradeAgain, advance: time.Minute, state: StateLearning, due: time.Minute},
+		{grade: GradeGood, advance: 10 * time.Minute, state: StateLearning, due: 10 * time.Minute},
+		// Failing the first step left the stability low, so the card graduates to a one day interval
+		{grade: GradeGood, advance: 24 * time.Hour, state: StateReview, due: 24 * time.Hour},
+		{grade: GradeAgain, advance: 10 * time.Minute, state: StateRelearning, due: 10 * time.Minute},
+		{grade: GradeGood, state: StateReview, due: 24 * time.Hour},
+	}
+
+	for i, tt := range tests {
+		var due time.Time
+		reviewedAt := c.Now()
+		card, due = reviewAt(card, tt.grade, steps, c)
+		if card.State != tt.state {
+			t.Errorf("Review %d: expected state %s, got %s", i+1, tt.state, card.State)
+		}
+		if got := due.Sub(reviewedAt).Round(time.Minute); got != tt.due {
+			t.Errorf("Review %d: expected to be due in %v, got %v", i+1, tt.due, got)
+		}
+		c.Advance(tt.advance)
+	}
+}
+
+func TestElapsedDaysUsesClock(t *testing.T) {
+	c := clock.NewManual(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC))
+	lastReviewed := c.Now().Format(time.RFC3339)
+	card := models.FlashcardModel{State: StateReview, LastReviewed: &lastReviewed}
+
+	c.Advance(47 * time.Hour)
+	if elapsed := ElapsedDays(card, c.Now()); elapsed != 1 {
+		t.Errorf("Expected 1 elapsed day, got %f", elapsed)
+	}
+
+	c.Set(clock.Offset(c, 2*time.Hour).Now())
+	if elapsed := ElapsedDays(card, c.Now()); elapsed != 2 {
+		t.Errorf("Expected 2 elapsed days, got %f", elapsed)
+	}
+}
@@ -0,0 +1,32 @@
+package algorithms
+
+import "github.com/jorkle/brightcards/backend/components/models"
+
+// What happens to a card when it becomes a leech
+const (
+	LeechActionTag     = models.LeechActionTag
+	LeechActionSuspend = models.LeechActionSuspend
+	LeechActionRewrite = models.LeechActionRewrite
+)
+
+// DefaultLeechThreshold is the number of lapses that makes a card a leech
+const DefaultLeechThreshold = models.DefaultLeechThreshold
+
+// IsLapse reports whether grading a card counts as forgetting it: Again on a card that had graduated to review
+func IsLapse(state string, grade int) bool {
+	return state == StateReview && grade == GradeAgain
+}
+
+// IsLeech reports whether a card becomes a leech on reaching the given number of lapses. Like Anki, a card
+// that stays a leech is flagged again every half threshold after the first time.
+func IsLeech(lapses int, threshold int) bool {
+	if threshold <= 0 || lapses < threshold {
+		return false
+	}
+	return (lapses-threshold)%max(threshold/2, 1) == 0
+}
+
+// ValidLeechAction reports whether action is one of the leech actions
+func ValidLeechAction(action string) bool {
+	return action == LeechActionTag || action == LeechActionSuspend || action == LeechActionRewrite
+}
@@ -0,0 +1,29 @@
+package algorithms
+
+import "testing"
+
+func TestIsLeech(t *testing.T) {
+	// With a threshold of 8, a card is flagged at 8 lapses and again every 4 after
+	var flagged []int
+	for lapses := 0; lapses <= 20; lapses++ {
+		if IsLeech(lapses, 8) {
+			flagged = append(flagged, lapses)
+		}
+	}
+	want := []int{8, 12, 16, 20}
+	if len(flagged) != len(want) {
+		t.Fatalf("Expected leeches at %v, got %v", want, flagged)
+	}
+	for i := range want {
+		if flagged[i] != want[i] {
+			t.Fatalf("Expected leeches at %v, got %v", want, flagged)
+		}
+	}
+
+	if !IsLeech(2, 1) || !IsLeech(3, 1) {
+		t.Errorf("Expected every lapse from the first to flag a card with a threshold of 1")
+	}
+	if IsLeech(8, 0) {
+		t.Errorf("Expected a threshold of 0 to turn leech detection off")
+	}
+}
@@ -0,0 +1,64 @@
+package algorithms
+
+import (
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// leitnerIntervals is the review interval, in days, of each box
+var leitnerIntervals = []float64{1, 2, 4, 8, 16, 32}
+
+// LeitnerScheduler moves cards between boxes: a correct answer promotes the card to the next box
+// and a wrong one sends it back to the first
+type LeitnerScheduler struct{}
+
+func (s *LeitnerScheduler) Name() string {
+	return SchedulerLeitner
+}
+
+// Next moves the card down to box 1 on Again, keeps it in its box on Hard, promotes it one box on Good and two on Easy
+func (s *LeitnerScheduler) Next(card models.FlashcardModel, grade int, now time.Time) models.CardSchedule {
+	schedule := migratedSchedule(card)
+	schedule.State = StateReview
+	schedule.Step = 0
+
+	box := card.LeitnerBox
+	if card.State == StateNew || box < 1 {
+		box = 0
+	}
+
+	switch grade {
+	case GradeAgain:
+		box = 1
+	case GradeHard:
+		box = max(box, 1)
+	case GradeEasy:
+		box += 2
+	default:
+		box++
+	}
+	box = min(box, len(leitnerIntervals))
+
+	schedule.LeitnerBox = box
+	schedule.IntervalDays = leitnerIntervals[box-1]
+	return schedule
+}
+
+// Migrate puts the card in the highest box whose interval doesn't exceed the card's current interval
+func (s *LeitnerScheduler) Migrate(card models.FlashcardModel) models.CardSchedule {
+	schedule := migratedSchedule(card)
+	if card.State == StateNew {
+		return schedule
+	}
+
+	schedule.State = StateReview
+	schedule.Step = 0
+	schedule.LeitnerBox = 1
+	for i, interval := range leitnerIntervals {
+		if interval <= schedule.IntervalDays {
+			schedule.LeitnerBox = i + 1
+		}
+	}
+	return schedule
+}
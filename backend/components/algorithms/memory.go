@@ -0,0 +1,82 @@
+package algorithms
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// gradeLabels names the grades, indexed by grade - 1
+var gradeLabels = []string{"Again", "Hard", "Good", "Easy"}
+
+// Retrievability returns the chance of recalling a card at now under FSRS, or 0 for a card that was never reviewed
+func Retrievability(card models.FlashcardModel, now time.Time) float64 {
+	if card.State == StateNew || card.State == "" || card.FSRSStability <= 0 {
+		return 0
+	}
+	if card.LastReviewed == nil {
+		return calculateRetrievability(ElapsedDays(card, now), card.FSRSStability)
+	}
+
+	lastReviewed, err := time.Parse(time.RFC3339, *card.LastReviewed)
+	if err != nil {
+		return 0
+	}
+	// Unlike ElapsedDays, partial days count so the value keeps falling during the day
+	return calculateRetrievability(max(now.Sub(lastReviewed).Hours()/24.0, 0), card.FSRSStability)
+}
+
+// EstimateMemoryState returns the card with its stability, difficulty and chance of recalling it at now as
+// scheduled by scheduler. Only FSRS keeps the card's stability and difficulty up to date; under the other
+// schedulers they are left from when the deck last used FSRS, so both are estimated from their interval and ease
+// the way switching the deck to FSRS would.
+func EstimateMemoryState(scheduler Scheduler, card models.FlashcardModel, now time.Time) models.FlashcardModel {
+	if scheduler.Name() != SchedulerFSRS {
+		migrated := (&FSRSScheduler{}).Migrate(card)
+		card.FSRSStability = migrated.Stability
+		card.FSRSDifficulty = migrated.Difficulty
+	}
+	card.Retrievability = Retrievability(card, now)
+	return card
+}
+
+// NextIntervals returns the interval the scheduler would give a card for each grade if it were reviewed at now
+func NextIntervals(scheduler Scheduler, card models.FlashcardModel, now time.Time) []models.NextInterval {
+	intervals := make([]models.NextInterval, 0, len(gradeLabels))
+	for grade := GradeAgain; grade <= GradeEasy; grade++ {
+		days := scheduler.Next(card, grade, now).IntervalDays
+		intervals = append(intervals, models.NextInterval{
+			Grade: grade,
+			Label: gradeLabels[grade-1],
+			Days:  days,
+			Text:  FormatInterval(days),
+		})
+	}
+	return intervals
+}
+
+// FormatInterval formats an interval in days the way the grade buttons show it, e.g. "10m", "5d", "3.5mo" or "1.2y"
+func FormatInterval(days float64) string {
+	duration := time.Duration(days * 24 * float64(time.Hour))
+	switch {
+	case duration < time.Minute:
+		return fmt.Sprintf("%ds", int(duration.Round(time.Second).Seconds()))
+	case duration < time.Hour:
+		return fmt.Sprintf("%dm", int(duration.Round(time.Minute).Minutes()))
+	case days < 1:
+		return formatUnit(duration.Hours(), "h")
+	case days < 30:
+		return formatUnit(days, "d")
+	case days < 365:
+		return formatUnit(days/30, "mo")
+	default:
+		return formatUnit(days/365, "y")
+	}
+}
+
+// formatUnit shows a value with at most one decimal, dropping it when it is zero
+func formatUnit(value float64, unit string) string {
+	return strconv.FormatFloat(float64(int(value*10+0.5))/10, 'f', -1, 64) + unit
+}
@@ -0,0 +1,78 @@
+package algorithms
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+func TestFormatInterval(t *testing.T) {
+	cases := []struct {
+		days float64
+		want string
+	}{
+		{0, "0s"},
+		{30.0 / 86400, "30s"},
+		{1.0 / 1440, "1m"},
+		{10.0 / 1440, "10m"},
+		{59.0 / 1440, "59m"},
+		{1.0 / 24, "1h"},
+		{1.5 / 24, "1.5h"},
+		{23.0 / 24, "23h"},
+		{1, "1d"},
+		{2.25, "2.3d"},
+		{5, "5d"},
+		{29.99, "30d"},
+		{30, "1mo"},
+		{105, "3.5mo"},
+		{364, "12.1mo"},
+		{365, "1y"},
+		{438, "1.2y"},
+		{3650, "10y"},
+	}
+
+	for _, tc := range cases {
+		if got := FormatInterval(tc.days); got != tc.want {
+			t.Errorf("FormatInterval(%v): expected %q, got %q", tc.days, tc.want, got)
+		}
+	}
+}
+
+func TestEstimateMemoryState(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	lastReviewed := now.AddDate(0, 0, -30).Format(time.RFC3339)
+
+	// An SM-2 card on a 30 day interval, with the stability it had when the deck last used FSRS
+	card := models.FlashcardModel{
+		State:          StateReview,
+		FSRSStability:  2,
+		FSRSDifficulty: 5,
+		EaseFactor:     2.5,
+		IntervalDays:   30,
+		LastReviewed:   &lastReviewed,
+		DueDate:        now,
+	}
+
+	// FSRS uses the stored memory state as it is
+	fsrs := EstimateMemoryState(&FSRSScheduler{}, card, now)
+	if want := Retrievability(card, now); fsrs.Retrievability != want || fsrs.FSRSStability != 2 || fsrs.FSRSDifficulty != 5 {
+		t.Errorf("Expected FSRS to use the stored stability and difficulty (%v), got %+v", want, fsrs)
+	}
+
+	// The other schedulers take the interval as the stability, which FSRS recalls at 90% once it has passed,
+	// and the difficulty from the ease, reported alongside it
+	for _, scheduler := range []Scheduler{&SM2Scheduler{}, &LeitnerScheduler{}} {
+		got := EstimateMemoryState(scheduler, card, now)
+		if math.Abs(got.Retrievability-0.9) > 1e-6 || got.FSRSStability != 30 || got.FSRSDifficulty != difficultyFromEase(2.5) {
+			t.Errorf("%s: expected 0.9 at the end of the interval with stability 30 and difficulty %v, got %v, %v and %v",
+				scheduler.Name(), difficultyFromEase(2.5), got.Retrievability, got.FSRSStability, got.FSRSDifficulty)
+		}
+	}
+
+	card.State = StateNew
+	if got := EstimateMemoryState(&SM2Scheduler{}, card, now); got.Retrievability != 0 {
+		t.Errorf("Expected a new card to have no retrievability, got %v", got.Retrievability)
+	}
+}
@@ -0,0 +1,139 @@
+package algorithms
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// Scheduling algorithms a deck can use
+const (
+	SchedulerFSRS    = models.SchedulerFSRS
+	SchedulerSM2     = models.SchedulerSM2
+	SchedulerLeitner = models.SchedulerLeitner
+)
+
+// Scheduler decides when a card is next due after it is graded
+type Scheduler interface {
+	// Name returns the identifier stored on the deck
+	Name() string
+	// Next returns the card's schedule after it is graded at now
+	Next(card models.FlashcardModel, grade int, now time.Time) models.CardSchedule
+	// Migrate converts the memory state of a card scheduled by another algorithm, keeping its current interval
+	Migrate(card models.FlashcardModel) models.CardSchedule
+}
+
+// SchedulerConfig holds the deck and collection settings schedulers may use
+type SchedulerConfig struct {
+	Steps  LearningSteps
+	Spread IntervalSpread
+}
+
+// NewScheduler returns the scheduler with the given name
+func NewScheduler(name string, config SchedulerConfig) (Scheduler, error) {
+	switch name {
+	case SchedulerFSRS, "":
+		return &FSRSScheduler{Steps: config.Steps, Spread: config.Spread}, nil
+	case SchedulerSM2:
+		return &SM2Scheduler{}, nil
+	case SchedulerLeitner:
+		return &LeitnerScheduler{}, nil
+	default:
+		return nil, fmt.Errorf("unknown scheduler %q", name)
+	}
+}
+
+// SchedulerNames lists the available schedulers
+func SchedulerNames() []string {
+	return []string{SchedulerFSRS, SchedulerSM2, SchedulerLeitner}
+}
+
+// currentInterval returns the interval a card was last given, in days
+func currentInterval(card models.FlashcardModel) float64 {
+	if card.IntervalDays > 0 {
+		return card.IntervalDays
+	}
+
+	// Cards reviewed before intervals were stored: use the gap between the last review and the due date
+	if card.LastReviewed != nil {
+		if lastReviewed, err := time.Parse(time.RFC3339, *card.LastReviewed); err == nil {
+			return max(card.DueDate.Sub(lastReviewed).Hours()/24.0, 0)
+		}
+	}
+	return card.FSRSStability
+}
+
+// migratedSchedule starts a migration from the parts of the state every scheduler shares
+func migratedSchedule(card models.FlashcardModel) models.CardSchedule {
+	return models.CardSchedule{
+		State:        card.State,
+		Step:         card.Step,
+		Stability:    card.FSRSStability,
+		Difficulty:   card.FSRSDifficulty,
+		EaseFactor:   card.EaseFactor,
+		Repetitions:  card.Repetitions,
+		LeitnerBox:   card.LeitnerBox,
+		IntervalDays: currentInterval(card),
+	}
+}
+
+// Reschedule returns the schedule of a card given an interval by hand. It becomes a review card; a new card gets
+// the memory of a first review graded Good, so every scheduler can carry on from there.
+func Reschedule(card models.FlashcardModel, days float64) models.CardSchedule {
+	schedule := migratedSchedule(card)
+	schedule.State = StateReview
+	schedule.Step = 0
+	schedule.IntervalDays = days
+	if card.State == StateNew || card.State == "" {
+		schedule.Stability, schedule.Difficulty = NextReviewFirst(GradeGood)
+		schedule.EaseFactor = defaultEaseFactor
+		schedule.Repetitions = 1
+		schedule.LeitnerBox = 1
+	}
+	return schedule
+}
+
+// FSRSScheduler schedules cards with FSRS-5, using learning steps for new and lapsed cards
+type FSRSScheduler struct {
+	Steps  LearningSteps
+	Spread IntervalSpread
+}
+
+func (s *FSRSScheduler) Name() string {
+	return SchedulerFSRS
+}
+
+func (s *FSRSScheduler) Next(card models.FlashcardModel, grade int, now time.Time) models.CardSchedule {
+	schedule := ScheduleReview(card, grade, s.Steps, now)
+	// Keep the other schedulers' state, so switching back to them resumes where the card was
+	schedule.EaseFactor = card.EaseFactor
+	schedule.Repetitions = card.Repetitions
+	schedule.LeitnerBox = card.LeitnerBox
+
+	// Only day-level intervals are spread out; learning steps stay exact
+	if schedule.State == StateReview {
+		schedule.IntervalDays = SpreadInterval(schedule.IntervalDays, ElapsedDays(card, now), s.Spread)
+	}
+	return schedule
+}
+
+// Migrate estimates FSRS memory from the card's interval, which FSRS gives at 90% retention when it equals the
+// stability, and from its SM-2 ease
+func (s *FSRSScheduler) Migrate(card models.FlashcardModel) models.CardSchedule {
+	schedule := migratedSchedule(card)
+	if card.State == StateNew {
+		return schedule
+	}
+
+	schedule.Stability = max(schedule.IntervalDays, minStability)
+	if card.EaseFactor > 0 {
+		schedule.Difficulty = difficultyFromEase(card.EaseFactor)
+	} else if schedule.Difficulty == 0 {
+		schedule.Difficulty = initialDifficulty(GradeGood)
+	}
+	if schedule.State == StateLearning || schedule.State == StateRelearning {
+		schedule.Step = 0
+	}
+	return schedule
+}
@@ -0,0 +1,211 @@
+package algorithms
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// applySchedule returns the card as it is stored after being given a schedule
+func applySchedule(card models.FlashcardModel, schedule models.CardSchedule) models.FlashcardModel {
+	card.State = schedule.State
+	card.Step = schedule.Step
+	card.FSRSStability = schedule.Stability
+	card.FSRSDifficulty = schedule.Difficulty
+	card.EaseFactor = schedule.EaseFactor
+	card.Repetitions = schedule.Repetitions
+	card.LeitnerBox = schedule.LeitnerBox
+	card.IntervalDays = schedule.IntervalDays
+	return card
+}
+
+func TestSM2Intervals(t *testing.T) {
+	scheduler := &SM2Scheduler{}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	card := models.FlashcardModel{State: StateNew}
+
+	// Good keeps the ease factor, so the intervals are 1, 6, then 6 * 2.5 and on
+	wantIntervals := []float64{1, 6, 15, 38, 95}
+	for i, want := range wantIntervals {
+		card = applySchedule(card, scheduler.Next(card, GradeGood, now))
+		if card.IntervalDays != want || card.Repetitions != i+1 || card.EaseFactor != defaultEaseFactor {
+			t.Fatalf("Review %d: expected interval %v at repetition %d with ease %v, got %v at %d with ease %v",
+				i+1, want, i+1, defaultEaseFactor, card.IntervalDays, card.Repetitions, card.EaseFactor)
+		}
+		if card.State != StateReview {
+			t.Fatalf("Review %d: expected a review card, got %q", i+1, card.State)
+		}
+	}
+
+	// A lapse restarts the repetitions without touching the ease factor
+	lapsed := applySchedule(card, scheduler.Next(card, GradeAgain, now))
+	if lapsed.IntervalDays != 1 || lapsed.Repetitions != 0 || lapsed.EaseFactor != defaultEaseFactor {
+		t.Errorf("Expected Again to give 1 day at repetition 0 with the same ease, got %v at %d with ease %v",
+			lapsed.IntervalDays, lapsed.Repetitions, lapsed.EaseFactor)
+	}
+	relearned := applySchedule(lapsed, scheduler.Next(lapsed, GradeGood, now))
+	if relearned.IntervalDays != 1 || relearned.Repetitions != 1 {
+		t.Errorf("Expected the first review after a lapse to give 1 day, got %v at repetition %d", relearned.IntervalDays, relearned.Repetitions)
+	}
+}
+
+func TestSM2EaseFactor(t *testing.T) {
+	scheduler := &SM2Scheduler{}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	card := models.FlashcardModel{State: StateReview, EaseFactor: 2.5, Repetitions: 2, IntervalDays: 6}
+
+	cases := []struct {
+		grade    int
+		ease     float64
+		interval float64
+	}{
+		{GradeEasy, 2.6, 15},
+		{GradeGood, 2.5, 15},
+		{GradeHard, 2.36, 15},
+		{GradeAgain, 2.5, 1},
+	}
+	for _, tc := range cases {
+		schedule := scheduler.Next(card, tc.grade, now)
+		if math.Abs(schedule.EaseFactor-tc.ease) > 1e-9 || schedule.IntervalDays != tc.interval {
+			t.Errorf("Grade %d: expected ease %v and interval %v, got %v and %v", tc.grade, tc.ease, tc.interval, schedule.EaseFactor, schedule.IntervalDays)
+		}
+	}
+
+	// Hard never takes the ease below its floor
+	card.EaseFactor = minEaseFactor
+	if schedule := scheduler.Next(card, GradeHard, now); schedule.EaseFactor != minEaseFactor {
+		t.Errorf("Expected the ease to stay at %v, got %v", minEaseFactor, schedule.EaseFactor)
+	}
+}
+
+func TestLeitnerBoxes(t *testing.T) {
+	scheduler := &LeitnerScheduler{}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		state    string
+		box      int
+		grade    int
+		wantBox  int
+		interval float64
+	}{
+		{StateNew, 0, GradeGood, 1, 1},
+		{StateNew, 0, GradeEasy, 2, 2},
+		{StateNew, 0, GradeHard, 1, 1},
+		{StateNew, 0, GradeAgain, 1, 1},
+		{StateReview, 3, GradeGood, 4, 8},
+		{StateReview, 3, GradeEasy, 5, 16},
+		{StateReview, 3, GradeHard, 3, 4},
+		{StateReview, 5, GradeAgain, 1, 1},
+		// The last box is as far as a card goes
+		{StateReview, 6, GradeGood, 6, 32},
+		{StateReview, 5, GradeEasy, 6, 32},
+	}
+	for _, tc := range cases {
+		card := models.FlashcardModel{State: tc.state, LeitnerBox: tc.box}
+		schedule := scheduler.Next(card, tc.grade, now)
+		if schedule.LeitnerBox != tc.wantBox || schedule.IntervalDays != tc.interval {
+			t.Errorf("Box %d, grade %d: expected box %d with %v days, got box %d with %v days",
+				tc.box, tc.grade, tc.wantBox, tc.interval, schedule.LeitnerBox, schedule.IntervalDays)
+		}
+		if schedule.State != StateReview {
+			t.Errorf("Box %d, grade %d: expected a review card, got %q", tc.box, tc.grade, schedule.State)
+		}
+	}
+}
+
+func TestEaseDifficultyMapping(t *testing.T) {
+	cases := []struct {
+		difficulty float64
+		ease       float64
+	}{
+		{1, maxEaseFactor},
+		{10, minEaseFactor},
+		{5.5, 2.4},
+		// Out of range values are clamped
+		{0, maxEaseFactor},
+		{12, minEaseFactor},
+	}
+	for _, tc := range cases {
+		if got := easeFromDifficulty(tc.difficulty); math.Abs(got-tc.ease) > 1e-9 {
+			t.Errorf("easeFromDifficulty(%v): expected %v, got %v", tc.difficulty, tc.ease, got)
+		}
+	}
+
+	if got := difficultyFromEase(5); got != 1 {
+		t.Errorf("Expected an ease above the maximum to give difficulty 1, got %v", got)
+	}
+	if got := difficultyFromEase(1); got != 10 {
+		t.Errorf("Expected an ease below the minimum to give difficulty 10, got %v", got)
+	}
+
+	for d := 1.0; d <= 10; d += 0.5 {
+		if got := difficultyFromEase(easeFromDifficulty(d)); math.Abs(got-d) > 1e-9 {
+			t.Errorf("Expected difficulty %v to survive a round trip through ease, got %v", d, got)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	review := models.FlashcardModel{State: StateReview, FSRSStability: 12, FSRSDifficulty: 5.5, IntervalDays: 10}
+
+	sm2 := (&SM2Scheduler{}).Migrate(review)
+	if sm2.IntervalDays != 10 || sm2.Repetitions != 2 || math.Abs(sm2.EaseFactor-2.4) > 1e-9 {
+		t.Errorf("Expected SM-2 to keep 10 days at repetition 2 with ease 2.4, got %v at %d with ease %v",
+			sm2.IntervalDays, sm2.Repetitions, sm2.EaseFactor)
+	}
+
+	// The highest box whose interval fits: 8 days
+	leitner := (&LeitnerScheduler{}).Migrate(review)
+	if leitner.LeitnerBox != 4 || leitner.IntervalDays != 10 {
+		t.Errorf("Expected Leitner box 4 keeping 10 days, got box %d with %v days", leitner.LeitnerBox, leitner.IntervalDays)
+	}
+
+	sm2Card := models.FlashcardModel{State: StateReview, EaseFactor: 1.3, Repetitions: 7, IntervalDays: 40}
+	fsrs := (&FSRSScheduler{}).Migrate(sm2Card)
+	if fsrs.Stability != 40 || fsrs.Difficulty != 10 || fsrs.IntervalDays != 40 {
+		t.Errorf("Expected FSRS stability 40 and difficulty 10, got %v and %v", fsrs.Stability, fsrs.Difficulty)
+	}
+
+	// Intervals under a day start SM-2 over and put the card in the first box
+	learning := models.FlashcardModel{State: StateLearning, Step: 1, IntervalDays: 10.0 / 1440}
+	if schedule := (&SM2Scheduler{}).Migrate(learning); schedule.Repetitions != 0 || schedule.State != StateReview || schedule.Step != 0 {
+		t.Errorf("Expected a learning card to become an SM-2 review at repetition 0, got %+v", schedule)
+	}
+	if schedule := (&LeitnerScheduler{}).Migrate(learning); schedule.LeitnerBox != 1 {
+		t.Errorf("Expected a learning card to go in box 1, got %d", schedule.LeitnerBox)
+	}
+
+	// New cards have nothing to convert
+	for _, scheduler := range []Scheduler{&FSRSScheduler{}, &SM2Scheduler{}, &LeitnerScheduler{}} {
+		schedule := scheduler.Migrate(models.FlashcardModel{State: StateNew})
+		if schedule != (models.CardSchedule{State: StateNew}) {
+			t.Errorf("%s: expected a new card to stay untouched, got %+v", scheduler.Name(), schedule)
+		}
+	}
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	schedulers := []Scheduler{&FSRSScheduler{}, &SM2Scheduler{}, &LeitnerScheduler{}, &FSRSScheduler{}}
+
+	for _, interval := range []float64{0.5, 1, 3, 6, 10, 45, 400} {
+		card := models.FlashcardModel{State: StateReview, FSRSStability: interval, FSRSDifficulty: 4, IntervalDays: interval}
+		for _, scheduler := range schedulers {
+			card = applySchedule(card, scheduler.Migrate(card))
+			if card.IntervalDays != interval || card.State != StateReview {
+				t.Errorf("Interval %v: expected migrating to %s to keep the interval and review state, got %v in %q",
+					interval, scheduler.Name(), card.IntervalDays, card.State)
+			}
+		}
+
+		// Difficulty is carried through the ease factor and back
+		if math.Abs(card.FSRSDifficulty-4) > 1e-9 {
+			t.Errorf("Interval %v: expected difficulty 4 after a round trip, got %v", interval, card.FSRSDifficulty)
+		}
+		if card.FSRSStability != max(interval, minStability) {
+			t.Errorf("Interval %v: expected stability to match the interval, got %v", interval, card.FSRSStability)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package algorithms
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// ReviewCosts holds how long reviews take, in seconds, and how often each grade is given.
+// The defaults are the averages used by the FSRS simulator.
+type ReviewCosts struct {
+	LearnSeconds      [4]float64 // first review of a new card, by grade, including its learning steps
+	ReviewSeconds     [4]float64 // review of a learned card, by grade, including relearning after Again
+	FirstGradeChances [4]float64 // chance of each grade on the first review
+	RecallGradeChance [3]float64 // chance of Hard, Good and Easy when a card is recalled
+}
+
+// DefaultReviewCosts are used until enough of the user's own reviews are timed
+var DefaultReviewCosts = ReviewCosts{
+	LearnSeconds:      [4]float64{33.79, 24.3, 13.68, 6.5},
+	ReviewSeconds:     [4]float64{23.0, 11.68, 7.33, 5.6},
+	FirstGradeChances: [4]float64{0.24, 0.094, 0.495, 0.171},
+	RecallGradeChance: [3]float64{0.224, 0.631, 0.145},
+}
+
+// SimulationConfig controls a workload simulation
+type SimulationConfig struct {
+	Start            time.Time // start of the first simulated study day
+	Days             int
+	NewCardsPerDay   int
+	DesiredRetention float64
+	MaximumInterval  int
+	Runs             int    // Monte Carlo runs averaged together
+	Seed             uint64 // the same seed gives the same recall outcomes, so settings can be compared fairly
+	Costs            ReviewCosts
+}
+
+// simulatedCard is a card's memory during a simulation; day and lastDay are days from the start
+type simulatedCard struct {
+	stability  float64
+	difficulty float64
+	lastDay    float64
+	day        int
+}
+
+// SimulateWorkload runs the FSRS model forward over a deck's cards, drawing recall outcomes at random, and returns
+// the average daily workload. New cards are introduced in order at NewCardsPerDay, and reviews are never capped,
+// so the result shows all the work that keeping up at the desired retention takes.
+func SimulateWorkload(cards []models.FlashcardModel, config SimulationConfig) models.WorkloadSimulation {
+	if config.Runs <= 0 {
+		config.Runs = 1
+	}
+	if config.MaximumInterval <= 0 {
+		config.MaximumInterval = DefaultMaximumInterval
+	}
+
+	reviews := make([]float64, config.Days)
+	newCards := make([]float64, config.Days)
+	seconds := make([]float64, config.Days)
+	var retentionTotal, rememberedTotal float64
+
+	random := rand.New(rand.NewPCG(config.Seed, config.Seed^0x9e3779b97f4a7c15))
+	for run := 0; run < config.Runs; run++ {
+		studied := 0
+		remembered := 0.0
+		newIndex := 0
+		for _, card := range cards {
+			if card.Suspended {
+				continue
+			}
+
+			var sim simulatedCard
+			if card.State == StateNew || card.State == "" {
+				if config.NewCardsPerDay <= 0 {
+					continue
+				}
+				sim.day = newIndex / config.NewCardsPerDay
+				newIndex++
+				if sim.day >= config.Days {
+					continue
+				}
+
+				grade := pickGrade(random.Float64(), config.Costs.FirstGradeChances[:])
+				sim.stability, sim.difficulty = NextReviewFirst(grade)
+				newCards[sim.day]++
+				seconds[sim.day] += config.Costs.LearnSeconds[grade-1]
+				sim.lastDay = float64(sim.day)
+				sim.day += simulatedInterval(sim.stability, config)
+			} else {
+				sim = startingMemory(card, config.Start)
+			}
+
+			for sim.day < config.Days {
+				elapsed := float64(sim.day) - sim.lastDay
+				grade := GradeAgain
+				if random.Float64() < calculateRetrievability(elapsed, sim.stability) {
+					grade = GradeHard + pickGrade(random.Float64(), config.Costs.RecallGradeChance[:]) - 1
+				}
+
+				_, sim.difficulty, sim.stability = NextReviewSubsequent(grade, sim.difficulty, sim.stability, elapsed)
+				reviews[sim.day]++
+				seconds[sim.day] += config.Costs.ReviewSeconds[grade-1]
+				sim.lastDay = float64(sim.day)
+				sim.day += simulatedInterval(sim.stability, config)
+			}
+
+			studied++
+			remembered += calculateRetrievability(float64(config.Days)-sim.lastDay, sim.stability)
+		}
+
+		rememberedTotal += remembered
+		if studied > 0 {
+			retentionTotal += remembered / float64(studied)
+		}
+	}
+
+	runs := float64(config.Runs)
+	result := models.WorkloadSimulation{
+		DesiredRetention:   config.DesiredRetention,
+		NewCardsPerDay:     config.NewCardsPerDay,
+		Days:               make([]models.SimulatedDay, config.Days),
+		ExpectedRetention:  retentionTotal / runs,
+		ExpectedRemembered: rememberedTotal / runs,
+	}
+	for day := range result.Days {
+		result.Days[day] = models.SimulatedDay{
+			Day:      day,
+			Date:     config.Start.AddDate(0, 0, day).Format("2006-01-02"),
+			Reviews:  reviews[day] / runs,
+			NewCards: newCards[day] / runs,
+			Minutes:  seconds[day] / 60 / runs,
+		}
+		result.TotalReviews += result.Days[day].Reviews
+		result.TotalNewCards += result.Days[day].NewCards
+		result.TotalMinutes += result.Days[day].Minutes
+	}
+	return result
+}
+
+// startingMemory places a card that has been studied on the simulation's calendar. Overdue cards
+// and cards in a learning step are due on the first day.
+func startingMemory(card models.FlashcardModel, start time.Time) simulatedCard {
+	sim := simulatedCard{
+		stability:  max(card.FSRSStability, minStability),
+		difficulty: card.FSRSDifficulty,
+	}
+	if sim.difficulty == 0 {
+		sim.difficulty = initialDifficulty(GradeGood)
+	}
+
+	dayOf := func(t time.Time) float64 {
+		return math.Floor(t.Sub(start).Hours() / 24.0)
+	}
+	if card.State == StateReview {
+		sim.day = max(int(dayOf(card.DueDate)), 0)
+	}
+	sim.lastDay = float64(sim.day) - math.Round(currentInterval(card))
+	if card.LastReviewed != nil {
+		if lastReviewed, err := time.Parse(time.RFC3339, *card.LastReviewed); err == nil {
+			sim.lastDay = dayOf(lastReviewed)
+		}
+	}
+	sim.lastDay = math.Min(sim.lastDay, float64(sim.day))
+	return sim
+}
+
+// simulatedInterval is the whole number of days until the next review at the desired retention
+func simulatedInterval(stability float64, config SimulationConfig) int {
+	return int(math.Min(calculateInterval(stability, config.DesiredRetention), float64(config.MaximumInterval)))
+}
+
+// pickGrade returns 1 plus the index of the chance r falls into
+func pickGrade(r float64, chances []float64) int {
+	total := 0.0
+	for _, chance := range chances {
+		total += chance
+	}
+
+	cumulative := 0.0
+	for i, chance := range chances {
+		cumulative += chance / total
+		if r < cumulative {
+			return i + 1
+		}
+	}
+	return len(chances)
+}
@@ -0,0 +1,48 @@
+package algorithms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+func simulateNewDeck(retention float64) models.WorkloadSimulation {
+	cards := make([]models.FlashcardModel, 200)
+	for i := range cards {
+		cards[i].State = StateNew
+	}
+	return SimulateWorkload(cards, SimulationConfig{
+		Start:            time.Date(2024, 3, 1, 4, 0, 0, 0, time.UTC),
+		Days:             60,
+		NewCardsPerDay:   10,
+		DesiredRetention: retention,
+		Runs:             10,
+		Seed:             1,
+		Costs:            DefaultReviewCosts,
+	})
+}
+
+func TestSimulateWorkload(t *testing.T) {
+	result := simulateNewDeck(0.9)
+	if result.TotalNewCards != 200 {
+		t.Errorf("Expected all 200 new cards to be introduced, got %f", result.TotalNewCards)
+	}
+	if result.Days[19].NewCards != 10 || result.Days[20].NewCards != 0 {
+		t.Errorf("Expected 10 new cards a day for 20 days, got %f on day 19 and %f on day 20", result.Days[19].NewCards, result.Days[20].NewCards)
+	}
+	if result.Days[0].Reviews != 0 {
+		t.Errorf("Expected no reviews on the first day, got %f", result.Days[0].Reviews)
+	}
+
+	if again := simulateNewDeck(0.9); again.TotalReviews != result.TotalReviews {
+		t.Errorf("Expected the same seed to give the same result, got %f and %f reviews", result.TotalReviews, again.TotalReviews)
+	}
+
+	// Asking for higher retention means shorter intervals, so more reviews
+	higher := simulateNewDeck(0.95)
+	if higher.TotalReviews <= result.TotalReviews || higher.ExpectedRetention <= result.ExpectedRetention {
+		t.Errorf("Expected more reviews and higher retention at 95%%, got %f reviews at %f and %f reviews at %f",
+			higher.TotalReviews, higher.ExpectedRetention, result.TotalReviews, result.ExpectedRetention)
+	}
+}
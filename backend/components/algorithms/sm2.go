@@ -0,0 +1,105 @@
+package algorithms
+
+import (
+	"math"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// SM-2 ease factor limits
+const (
+	defaultEaseFactor = 2.5
+	minEaseFactor     = 1.3
+	maxEaseFactor     = 3.5 // only used to map ease to FSRS difficulty
+)
+
+// SM2Scheduler schedules cards with the classic SuperMemo SM-2 algorithm
+type SM2Scheduler struct{}
+
+func (s *SM2Scheduler) Name() string {
+	return SchedulerSM2
+}
+
+// sm2Quality maps a grade to SM-2's 0-5 response quality
+func sm2Quality(grade int) float64 {
+	switch grade {
+	case GradeAgain:
+		return 1
+	case GradeHard:
+		return 3
+	case GradeEasy:
+		return 5
+	default:
+		return 4
+	}
+}
+
+// Next applies SM-2: intervals of 1 and 6 days, then the previous interval times the ease factor.
+// A failed review restarts the repetitions without changing the ease factor.
+func (s *SM2Scheduler) Next(card models.FlashcardModel, grade int, now time.Time) models.CardSchedule {
+	schedule := migratedSchedule(card)
+	schedule.State = StateReview
+	schedule.Step = 0
+	if schedule.EaseFactor == 0 {
+		schedule.EaseFactor = defaultEaseFactor
+	}
+
+	q := sm2Quality(grade)
+	if q < 3 {
+		schedule.Repetitions = 0
+		schedule.IntervalDays = 1
+		return schedule
+	}
+
+	switch schedule.Repetitions {
+	case 0:
+		schedule.IntervalDays = 1
+	case 1:
+		schedule.IntervalDays = 6
+	default:
+		schedule.IntervalDays = math.Round(schedule.IntervalDays * schedule.EaseFactor)
+	}
+	schedule.Repetitions++
+	schedule.EaseFactor = math.Max(minEaseFactor, schedule.EaseFactor+(0.1-(5-q)*(0.08+(5-q)*0.02)))
+	return schedule
+}
+
+// Migrate keeps the card's interval and derives an ease factor from its FSRS difficulty
+func (s *SM2Scheduler) Migrate(card models.FlashcardModel) models.CardSchedule {
+	schedule := migratedSchedule(card)
+	if card.State == StateNew {
+		return schedule
+	}
+
+	schedule.State = StateReview
+	schedule.Step = 0
+	if schedule.EaseFactor == 0 {
+		schedule.EaseFactor = defaultEaseFactor
+		if card.FSRSDifficulty > 0 {
+			schedule.EaseFactor = easeFromDifficulty(card.FSRSDifficulty)
+		}
+	}
+
+	// Place the card on the repetition matching its interval, so it continues multiplying from there
+	switch {
+	case schedule.IntervalDays < 1:
+		schedule.Repetitions = 0
+	case schedule.IntervalDays < 6:
+		schedule.Repetitions = 1
+	default:
+		schedule.Repetitions = max(schedule.Repetitions, 2)
+	}
+	return schedule
+}
+
+// easeFromDifficulty maps FSRS difficulty 1-10 linearly onto ease factors 3.5-1.3
+func easeFromDifficulty(difficulty float64) float64 {
+	return maxEaseFactor - (clampDifficulty(difficulty)-1)/9*(maxEaseFactor-minEaseFactor)
+}
+
+// difficultyFromEase is the inverse of easeFromDifficulty
+func difficultyFromEase(ease float64) float64 {
+	ease = math.Max(minEaseFactor, math.Min(maxEaseFactor, ease))
+	return 1 + (maxEaseFactor-ease)/(maxEaseFactor-minEaseFactor)*9
+}
@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gen2brain/malgo"
+)
+
+// CaptureDevice describes an audio input device reported by the audio backend
+type CaptureDevice struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	IsDefault bool   `json:"isDefault"`
+}
+
+// CaptureDevices lists the capture devices currently available on the system
+func (r *Recorder) CaptureDevices() ([]CaptureDevice, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.ctx == nil {
+		return nil, fmt.Errorf("audio context is not initialized")
+	}
+
+	infos, err := r.ctx.Devices(malgo.Capture)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enumerate capture devices: %v", err)
+	}
+
+	devices := make([]CaptureDevice, len(infos))
+	for i := range infos {
+		devices[i] = CaptureDevice{
+			ID:        infos[i].ID.String(),
+			Name:      infos[i].Name(),
+			IsDefault: infos[i].IsDefault != 0,
+		}
+	}
+	return devices, nil
+}
+
+// SetCaptureDevice selects the capture device used by the next recording.
+// An empty id selects the system default device.
+func (r *Recorder) SetCaptureDevice(id string) error {
+	deviceID, err := parseDeviceID(id)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.deviceID = deviceID
+	return nil
+}
+
+// CaptureDevice returns the id of the selected capture device, or an empty string for the system default
+func (r *Recorder) CaptureDevice() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.deviceID == nil {
+		return ""
+	}
+	return r.deviceID.String()
+}
+
+// parseDeviceID converts the hexadecimal form produced by malgo.DeviceID.String back into a device id
+func parseDeviceID(id string) (*malgo.DeviceID, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	raw, err := hex.DecodeString(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device id %q: %v", id, err)
+	}
+
+	var deviceID malgo.DeviceID
+	if len(raw) > len(deviceID) {
+		return nil, fmt.Errorf("invalid device id %q: too long", id)
+	}
+	copy(deviceID[:], raw)
+	return &deviceID, nil
+}
@@ -0,0 +1,28 @@
+package audio
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gen2brain/malgo"
+)
+
+func TestParseDeviceID(t *testing.T) {
+	if id, err := parseDeviceID(""); err != nil || id != nil {
+		t.Errorf("Expected no id for the default device, got %v (%v)", id, err)
+	}
+
+	// An id round-trips through the string malgo reports it as
+	var want malgo.DeviceID
+	copy(want[:], "hw:1,0")
+	id, err := parseDeviceID(want.String())
+	if err != nil || id == nil || *id != want {
+		t.Errorf("Expected %s, got %v (%v)", want, id, err)
+	}
+
+	for _, invalid := range []string{"not hex", "abc", strings.Repeat("01", len(want)+1)} {
+		if _, err := parseDeviceID(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Minimal FLAC encoder for mono 16-bit audio.
+// Each block is coded with the cheapest of the fixed linear predictors (order 0-4)
+// and Rice-coded residuals, falling back to verbatim samples when prediction doesn't help.
+// Format reference: https://xiph.org/flac/format.html
+
+const (
+	flacBlockSize     = 4096
+	flacBitsPerSample = 16
+	flacMaxRiceParam  = 14
+)
+
+// writeFLAC encodes mono 16-bit samples to a FLAC file
+func writeFLAC(filepath string, samples []int16, sampleRate int) error {
+	data, err := encodeFLAC(samples, sampleRate)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write FLAC file: %v", err)
+	}
+	return nil
+}
+
+// encodeFLAC encodes mono 16-bit samples into a complete FLAC stream
+func encodeFLAC(samples []int16, sampleRate int) ([]byte, error) {
+	if sampleRate <= 0 || sampleRate >= 1<<20 {
+		return nil, fmt.Errorf("unsupported sample rate for FLAC: %d", sampleRate)
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString("fLaC")
+	writeFLACStreamInfo(out, samples, sampleRate)
+
+	for frameNumber, start := 0, 0; start < len(samples); frameNumber, start = frameNumber+1, start+flacBlockSize {
+		end := start + flacBlockSize
+		if end > len(samples) {
+			end = len(samples)
+		}
+		out.Write(encodeFLACFrame(samples[start:end], frameNumber))
+	}
+
+	return out.Bytes(), nil
+}
+
+// writeFLACStreamInfo writes the mandatory STREAMINFO metadata block, marked as the last metadata block
+func writeFLACStreamInfo(out *bytes.Buffer, samples []int16, sampleRate int) {
+	// Block header: last-metadata-block flag, type 0 (STREAMINFO), 34 byte length
+	out.Write([]byte{0x80, 0x00, 0x00, 34})
+
+	w := &bitWriter{}
+	w.write(flacBlockSize, 16) // minimum block size
+	w.write(flacBlockSize, 16) // maximum block size
+	w.write(0, 24)             // minimum frame size (unknown)
+	w.write(0, 24)             // maximum frame size (unknown)
+	w.write(uint64(sampleRate), 20)
+	w.write(0, 3) // channels - 1
+	w.write(flacBitsPerSample-1, 5)
+	w.write(uint64(len(samples)), 36)
+	out.Write(w.bytes())
+
+	// MD5 of the unencoded audio, as little-endian signed samples
+	raw := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(raw[i*2:], uint16(s))
+	}
+	sum := md5.Sum(raw)
+	out.Write(sum[:])
+}
+
+// encodeFLACFrame encodes one block of samples as a FLAC frame
+func encodeFLACFrame(block []int16, frameNumber int) []byte {
+	w := &bitWriter{}
+
+	// Frame header
+	w.write(0x3ffe, 14) // sync code
+	w.write(0, 1)       // reserved
+	w.write(0, 1)       // fixed block size stream
+	w.write(0x7, 4)     // block size stored as 16-bit (blocksize-1) at end of header
+	w.write(0x0, 4)     // sample rate taken from STREAMINFO
+	w.write(0x0, 4)     // mono
+	w.write(0x4, 3)     // 16 bits per sample
+	w.write(0, 1)       // reserved
+	w.writeCodedNumber(uint64(frameNumber))
+	w.write(uint64(len(block)-1), 16)
+	w.write(uint64(crc8(w.bytes())), 8)
+
+	encodeFLACSubframe(w, block)
+
+	w.align()
+	w.write(uint64(crc16(w.bytes())), 16)
+	return w.bytes()
+}
+
+// encodeFLACSubframe writes the cheapest of the fixed-predictor and verbatim encodings of a block
+func encodeFLACSubframe(w *bitWriter, block []int16) {
+	verbatimBits := len(block) * flacBitsPerSample
+
+	bestOrder, bestParam, bestBits := -1, 0, verbatimBits
+	for order := 0; order <= 4 && order < len(block); order++ {
+		residual := fixedResidual(block, order)
+		param, bits := bestRiceParam(residual)
+		// warm-up samples plus the residual header (2 bit method, 4 bit order, 4 bit parameter)
+		bits += order*flacBitsPerSample + 10
+		if bits < bestBits {
+			bestOrder, bestParam, bestBits = order, param, bits
+		}
+	}
+
+	if bestOrder < 0 {
+		w.write(0, 1)    // padding
+		w.write(0x01, 6) // SUBFRAME_VERBATIM
+		w.write(0, 1)    // no wasted bits
+		for _, s := range block {
+			w.write(uint64(uint16(s)), flacBitsPerSample)
+		}
+		return
+	}
+
+	w.write(0, 1)                      // padding
+	w.write(uint64(0x08|bestOrder), 6) // SUBFRAME_FIXED with predictor order
+	w.write(0, 1)                      // no wasted bits
+	for _, s := range block[:bestOrder] {
+		w.write(uint64(uint16(s)), flacBitsPerSample)
+	}
+
+	w.write(0, 2) // Rice coding with 4-bit parameters
+	w.write(0, 4) // partition order 0
+	w.write(uint64(bestParam), 4)
+	for _, r := range fixedResidual(block, bestOrder) {
+		w.writeRice(r, bestParam)
+	}
+}
+
+// fixedResidual returns the prediction error of the FLAC fixed predictor of the given order
+func fixedResidual(block []int16, order int) []int32 {
+	residual := make([]int32, 0, len(block)-order)
+	for i := order; i < len(block); i++ {
+		s := func(k int) int32 { return int32(block[i-k]) }
+		var prediction int32
+		switch order {
+		case 1:
+			prediction = s(1)
+		case 2:
+			prediction = 2*s(1) - s(2)
+		case 3:
+			prediction = 3*s(1) - 3*s(2) + s(3)
+		case 4:
+			prediction = 4*s(1) - 6*s(2) + 4*s(3) - s(4)
+		}
+		residual = append(residual, s(0)-prediction)
+	}
+	return residual
+}
+
+// bestRiceParam finds the Rice parameter that codes the residual in the fewest bits
+func bestRiceParam(residual []int32) (int, int) {
+	bestParam, bestBits := 0, math.MaxInt
+	for param := 0; param <= flacMaxRiceParam; param++ {
+		bits := 0
+		for _, r := range residual {
+			bits += int(zigzag(r)>>param) + 1 + param
+		}
+		if bits < bestBits {
+			bestParam, bestBits = param, bits
+		}
+	}
+	return bestParam, bestBits
+}
+
+func zigzag(v int32) uint32 {
+	return uint32(v<<1) ^ uint32(v>>31)
+}
+
+// bitWriter accumulates a big-endian bit stream
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(value uint64, bits uint) {
+	for bits > 0 {
+		n := bits
+		if n > 32 {
+			n = 32
+		}
+		bits -= n
+		w.acc = w.acc<<n | (value>>bits)&(1<<n-1)
+		w.nbits += n
+		for w.nbits >= 8 {
+			w.nbits -= 8
+			w.buf = append(w.buf, byte(w.acc>>w.nbits))
+		}
+	}
+}
+
+func (w *bitWriter) writeRice(value int32, param int) {
+	u := zigzag(value)
+	for q := u >> param; q > 0; {
+		n := q
+		if n > 32 {
+			n = 32
+		}
+		w.write(0, uint(n))
+		q -= n
+	}
+	w.write(1, 1)
+	w.write(uint64(u), uint(param))
+}
+
+// writeCodedNumber writes a frame number using FLAC's extended UTF-8 style coding
+func (w *bitWriter) writeCodedNumber(n uint64) {
+	if n < 0x80 {
+		w.write(n, 8)
+		return
+	}
+
+	// Count the continuation bytes needed; each carries 6 bits
+	extra := 1
+	for n >= 1<<(6*extra+6-extra) {
+		extra++
+	}
+	lead := uint64(0xff<<(7-extra)) & 0xff
+	w.write(lead|n>>(6*extra), 8)
+	for i := extra - 1; i >= 0; i-- {
+		w.write(0x80|(n>>(6*i))&0x3f, 8)
+	}
+}
+
+// align pads the stream with zero bits up to the next byte boundary
+func (w *bitWriter) align() {
+	if w.nbits > 0 {
+		w.write(0, 8-w.nbits)
+	}
+}
+
+// bytes returns the complete bytes written so far
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+// crc8 computes the frame header checksum (polynomial x^8 + x^2 + x^1 + x^0)
+func crc8(data []byte) uint8 {
+	var crc uint8
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16 computes the frame footer checksum (polynomial x^16 + x^15 + x^2 + x^0)
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
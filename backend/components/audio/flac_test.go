@@ -0,0 +1,140 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/mewkiz/flac"
+)
+
+// decodeFLAC decodes a stream produced by encodeFLAC with an independent decoder
+func decodeFLAC(t *testing.T, data []byte) ([]int16, int) {
+	t.Helper()
+
+	stream, err := flac.New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to open FLAC stream: %v", err)
+	}
+	defer stream.Close()
+
+	var samples []int16
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to decode FLAC frame: %v", err)
+		}
+		if len(frame.Subframes) != 1 {
+			t.Fatalf("Expected 1 channel, got %d", len(frame.Subframes))
+		}
+		for _, s := range frame.Subframes[0].Samples {
+			samples = append(samples, int16(s))
+		}
+	}
+
+	if stream.Info.NSamples != uint64(len(samples)) {
+		t.Errorf("Expected STREAMINFO to report %d samples, got %d", len(samples), stream.Info.NSamples)
+	}
+	raw := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(raw[i*2:], uint16(s))
+	}
+	if md5.Sum(raw) != stream.Info.MD5sum {
+		t.Errorf("Expected STREAMINFO MD5 to match the decoded audio")
+	}
+	return samples, int(stream.Info.SampleRate)
+}
+
+func TestFLACRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sine := func(n int) []int16 {
+		samples := make([]int16, n)
+		for i := range samples {
+			samples[i] = int16(12000 * math.Sin(float64(i)*2*math.Pi*440/16000))
+		}
+		return samples
+	}
+	noise := func(n int) []int16 {
+		samples := make([]int16, n)
+		for i := range samples {
+			samples[i] = int16(rng.Intn(1<<16) - 1<<15)
+		}
+		return samples
+	}
+	extremes := make([]int16, 5000)
+	for i := range extremes {
+		if i%2 == 0 {
+			extremes[i] = math.MaxInt16
+		} else {
+			extremes[i] = math.MinInt16
+		}
+	}
+
+	cases := []struct {
+		name    string
+		samples []int16
+	}{
+		{"empty", []int16{}},
+		{"single sample", []int16{-1234}},
+		{"shorter than predictor order", []int16{7, -7, 300}},
+		{"odd length", sine(4097)},
+		{"several blocks", sine(3*flacBlockSize + 123)},
+		{"silence", make([]int16, flacBlockSize)},
+		{"white noise", noise(2*flacBlockSize + 1)},
+		{"full scale extremes", extremes},
+		// Enough frames that frame numbers need the multi-byte coding
+		{"many frames", sine(200 * flacBlockSize)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := encodeFLAC(tc.samples, 16000)
+			if err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+
+			decoded, sampleRate := decodeFLAC(t, data)
+			if sampleRate != 16000 {
+				t.Errorf("Expected sample rate 16000, got %d", sampleRate)
+			}
+			if len(decoded) != len(tc.samples) {
+				t.Fatalf("Expected %d samples, got %d", len(tc.samples), len(decoded))
+			}
+			for i := range decoded {
+				if decoded[i] != tc.samples[i] {
+					t.Fatalf("Sample %d: expected %d, got %d", i, tc.samples[i], decoded[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFLACCompressesSpeechLikeAudio(t *testing.T) {
+	samples := make([]int16, 16000)
+	for i := range samples {
+		samples[i] = int16(8000 * math.Sin(float64(i)*2*math.Pi*220/16000))
+	}
+
+	data, err := encodeFLAC(samples, 16000)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if len(data) >= len(samples) {
+		t.Errorf("Expected a smooth signal to compress to under half its PCM size, got %d of %d bytes", len(data), len(samples)*2)
+	}
+}
+
+func TestFLACRejectsUnsupportedSampleRates(t *testing.T) {
+	for _, rate := range []int{0, -1, 1 << 20} {
+		if _, err := encodeFLAC([]int16{1, 2, 3}, rate); err == nil {
+			t.Errorf("Expected sample rate %d to be rejected", rate)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// InputLevel holds the RMS and peak amplitude of a block of captured audio, normalized to 0..1
+type InputLevel struct {
+	RMS  float64 `json:"rms"`
+	Peak float64 `json:"peak"`
+}
+
+// levelMeter accumulates 16-bit PCM samples and reports a level once per window
+type levelMeter struct {
+	windowFrames int
+	frames       int
+	sumSquares   float64
+	peak         float64
+}
+
+func newLevelMeter(sampleRate int, updatesPerSecond int) *levelMeter {
+	return &levelMeter{windowFrames: sampleRate / updatesPerSecond}
+}
+
+// add feeds mono S16 little-endian samples into the meter and returns a level when a window is complete
+func (m *levelMeter) add(samples []byte) (InputLevel, bool) {
+	for i := 0; i+1 < len(samples); i += 2 {
+		v := float64(int16(binary.LittleEndian.Uint16(samples[i:]))) / 32768.0
+		m.sumSquares += v * v
+		if a := math.Abs(v); a > m.peak {
+			m.peak = a
+		}
+		m.frames++
+	}
+
+	if m.frames < m.windowFrames {
+		return InputLevel{}, false
+	}
+
+	level := InputLevel{
+		RMS:  math.Sqrt(m.sumSquares / float64(m.frames)),
+		Peak: m.peak,
+	}
+	m.reset()
+	return level, true
+}
+
+func (m *levelMeter) reset() {
+	m.frames = 0
+	m.sumSquares = 0
+	m.peak = 0
+}
@@ -0,0 +1,53 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// pcmBytes encodes samples as S16 little-endian, as the capture device delivers them
+func pcmBytes(samples []int16) []byte {
+	data := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	return data
+}
+
+func TestLevelMeter(t *testing.T) {
+	meter := newLevelMeter(1000, 10)
+
+	// Nothing is reported until a whole window of 100 frames has arrived
+	if _, ok := meter.add(pcmBytes(make([]int16, 60))); ok {
+		t.Fatalf("Expected no level before the window is full")
+	}
+	square := make([]int16, 40)
+	for i := range square {
+		square[i] = 16384
+		if i%2 == 1 {
+			square[i] = -16384
+		}
+	}
+	level, ok := meter.add(pcmBytes(square))
+	if !ok {
+		t.Fatalf("Expected a level once the window is full")
+	}
+	// 60 silent frames and 40 at half scale
+	if want := math.Sqrt(40 * 0.25 / 100); math.Abs(level.RMS-want) > 1e-9 || level.Peak != 0.5 {
+		t.Errorf("Expected RMS %.4f and peak 0.5, got %.4f and %.4f", want, level.RMS, level.Peak)
+	}
+
+	// The next window starts from silence, and a full-scale negative sample peaks at 1
+	samples := make([]int16, 100)
+	samples[50] = math.MinInt16
+	level, ok = meter.add(pcmBytes(samples))
+	if !ok || level.Peak != 1 || math.Abs(level.RMS-0.1) > 1e-9 {
+		t.Errorf("Expected a peak of 1 and RMS 0.1, got %+v (%v)", level, ok)
+	}
+
+	// A trailing odd byte is ignored
+	if _, ok := meter.add([]byte{0xff}); ok || meter.frames != 0 {
+		t.Errorf("Expected a lone byte to be ignored, got %d frames", meter.frames)
+	}
+}
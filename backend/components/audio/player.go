@@ -0,0 +1,152 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/gen2brain/malgo"
+)
+
+// Player plays mono 16-bit audio through the default output device, one clip at a time
+type Player struct {
+	ctx      *malgo.AllocatedContext
+	device   *malgo.Device
+	samples  []int16
+	position int
+	drained  int
+	mutex    sync.Mutex
+}
+
+// drainBlocks is the number of silent blocks played after a clip ends before the device is released
+const drainBlocks = 3
+
+var (
+	player     *Player
+	playerOnce sync.Once
+)
+
+func GetPlayer() (*Player, error) {
+	var initErr error
+	playerOnce.Do(func() {
+		ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
+		if err != nil {
+			initErr = fmt.Errorf("failed to initialize context: %v", err)
+			return
+		}
+
+		player = &Player{
+			ctx: ctx,
+		}
+	})
+
+	if initErr != nil {
+		return nil, initErr
+	}
+	return player, nil
+}
+
+// Play starts playing the samples, replacing anything already playing. It returns once playback has started.
+func (p *Player) Play(samples []int16, sampleRate int) error {
+	p.Stop()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.ctx == nil {
+		return fmt.Errorf("audio context is not initialized")
+	}
+
+	deviceConfig := malgo.DefaultDeviceConfig(malgo.Playback)
+	deviceConfig.Playback.Format = malgo.FormatS16
+	deviceConfig.Playback.Channels = 1
+	deviceConfig.SampleRate = uint32(sampleRate)
+	deviceConfig.Alsa.NoMMap = 1
+
+	callbacks := malgo.DeviceCallbacks{
+		Data: p.onData,
+	}
+
+	device, err := malgo.InitDevice(p.ctx.Context, deviceConfig, callbacks)
+	if err != nil {
+		return fmt.Errorf("failed to initialize device: %v", err)
+	}
+
+	p.samples = samples
+	p.position = 0
+	p.drained = 0
+	p.device = device
+
+	if err := device.Start(); err != nil {
+		p.device = nil
+		device.Uninit()
+		return fmt.Errorf("failed to start device: %v", err)
+	}
+
+	return nil
+}
+
+// onData feeds the next block of samples to the device, padding with silence once the clip ends
+func (p *Player) onData(pOutput, pInput []byte, frameCount uint32) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	n := 0
+	for ; n < int(frameCount) && p.position < len(p.samples); n++ {
+		binary.LittleEndian.PutUint16(pOutput[n*2:], uint16(p.samples[p.position]))
+		p.position++
+	}
+	for i := n * 2; i < len(pOutput); i++ {
+		pOutput[i] = 0
+	}
+
+	// Let a few blocks of silence through so the device plays out its buffer, then release it
+	// from another goroutine, as the device can't be stopped from its own callback
+	if p.position >= len(p.samples) {
+		p.drained++
+	}
+	if p.drained > drainBlocks && p.device != nil {
+		device := p.device
+		p.device = nil
+		go releaseDevice(device)
+	}
+}
+
+// IsPlaying reports whether a clip is currently playing
+func (p *Player) IsPlaying() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.device != nil
+}
+
+// Stop ends playback immediately
+func (p *Player) Stop() {
+	p.mutex.Lock()
+	device := p.device
+	p.device = nil
+	p.samples = nil
+	p.mutex.Unlock()
+
+	// Stop the device without holding the lock, as stopping waits for the data callback to return
+	if device != nil {
+		releaseDevice(device)
+	}
+}
+
+func releaseDevice(device *malgo.Device) {
+	device.Stop()
+	device.Uninit()
+}
+
+func (p *Player) Cleanup() {
+	p.Stop()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.ctx != nil {
+		p.ctx.Uninit()
+		p.ctx = nil
+	}
+}
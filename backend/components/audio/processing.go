@@ -0,0 +1,248 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// WhisperSampleRate is the sample rate speech models are trained on; anything above it is wasted upload
+	WhisperSampleRate = 16000
+
+	// WhisperMaxUploadBytes is the OpenAI transcription upload limit
+	WhisperMaxUploadBytes = 25 * 1024 * 1024
+
+	FormatWAV  = "wav"
+	FormatFLAC = "flac"
+
+	silenceWindowSeconds  = 0.02
+	silencePaddingSeconds = 0.25
+	silenceThreshold      = 0.01 // RMS relative to full scale, about -40 dBFS
+	resampleZeroCrossings = 16
+)
+
+// ProcessingOptions controls how a raw recording is prepared for transcription and storage
+type ProcessingOptions struct {
+	SampleRate     int    // Target sample rate, 0 keeps the recorded rate
+	TrimSilence    bool   // Remove leading and trailing silence
+	Format         string // FormatWAV or FormatFLAC
+	MaxUploadBytes int    // Recordings that could exceed this size are split, 0 disables splitting
+}
+
+// DefaultProcessingOptions returns options suitable for Whisper transcription
+func DefaultProcessingOptions() ProcessingOptions {
+	return ProcessingOptions{
+		SampleRate:     WhisperSampleRate,
+		TrimSilence:    true,
+		Format:         FormatFLAC,
+		MaxUploadBytes: WhisperMaxUploadBytes,
+	}
+}
+
+// ProcessRecording resamples, trims and encodes a recorded WAV file.
+// The output is written next to the input, split into numbered parts when it
+// would exceed the upload limit. The paths of the written files are returned in order.
+func ProcessRecording(wavPath string, opts ProcessingOptions) ([]string, error) {
+	samples, sampleRate, err := ReadWAV(wavPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.SampleRate > 0 && opts.SampleRate != sampleRate {
+		samples = resample(samples, sampleRate, opts.SampleRate)
+		sampleRate = opts.SampleRate
+	}
+
+	if opts.TrimSilence {
+		samples = trimSilence(samples, sampleRate)
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("recording contains no audio")
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = FormatWAV
+	}
+	if format != FormatWAV && format != FormatFLAC {
+		return nil, fmt.Errorf("unsupported audio format: %s", format)
+	}
+
+	// Split on the uncompressed size, which bounds the FLAC size as well
+	maxSamples := len(samples)
+	if opts.MaxUploadBytes > 0 {
+		maxSamples = (opts.MaxUploadBytes - 1024) / 2
+	}
+	parts := splitSamples(samples, sampleRate, maxSamples)
+
+	base := strings.TrimSuffix(wavPath, filepath.Ext(wavPath))
+	removeProcessedParts(base)
+
+	paths := make([]string, len(parts))
+	for i, part := range parts {
+		outPath := fmt.Sprintf("%s_%02d.%s", base, i+1, format)
+		switch format {
+		case FormatFLAC:
+			err = writeFLAC(outPath, part, sampleRate)
+		default:
+			err = WriteWAV(outPath, part, sampleRate)
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = outPath
+	}
+
+	return paths, nil
+}
+
+// removeProcessedParts deletes parts left over from processing a previous recording
+func removeProcessedParts(base string) {
+	for _, format := range []string{FormatWAV, FormatFLAC} {
+		matches, err := filepath.Glob(base + "_[0-9][0-9]." + format)
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			os.Remove(match)
+		}
+	}
+}
+
+// resample converts samples between rates using windowed-sinc interpolation,
+// low-pass filtering at the lower Nyquist frequency to avoid aliasing
+func resample(samples []int16, fromRate int, toRate int) []int16 {
+	if fromRate == toRate || len(samples) == 0 {
+		return samples
+	}
+
+	ratio := float64(fromRate) / float64(toRate)
+	cutoff := math.Min(1.0, 1.0/ratio) * 0.95 // fraction of the input Nyquist frequency
+	halfWidth := float64(resampleZeroCrossings) / cutoff
+
+	out := make([]int16, int(float64(len(samples))/ratio))
+	for i := range out {
+		center := float64(i) * ratio
+		lo := int(math.Ceil(center - halfWidth))
+		hi := int(math.Floor(center + halfWidth))
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(samples)-1 {
+			hi = len(samples) - 1
+		}
+
+		var sum float64
+		for k := lo; k <= hi; k++ {
+			x := center - float64(k)
+			sum += float64(samples[k]) * cutoff * sinc(cutoff*x) * blackman(x/halfWidth)
+		}
+		out[i] = clampSample(sum)
+	}
+	return out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman evaluates a Blackman window spanning x in [-1, 1]
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+}
+
+func clampSample(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// windowRMS returns the RMS of each consecutive window of samples, normalized to 0..1
+func windowRMS(samples []int16, window int) []float64 {
+	levels := make([]float64, 0, len(samples)/window+1)
+	for start := 0; start < len(samples); start += window {
+		end := start + window
+		if end > len(samples) {
+			end = len(samples)
+		}
+		var sum float64
+		for _, s := range samples[start:end] {
+			v := float64(s) / 32768.0
+			sum += v * v
+		}
+		levels = append(levels, math.Sqrt(sum/float64(end-start)))
+	}
+	return levels
+}
+
+// trimSilence removes leading and trailing audio below the silence threshold, keeping a little padding
+func trimSilence(samples []int16, sampleRate int) []int16 {
+	window := int(float64(sampleRate) * silenceWindowSeconds)
+	if window <= 0 || len(samples) == 0 {
+		return samples
+	}
+
+	levels := windowRMS(samples, window)
+	first, last := -1, -1
+	for i, level := range levels {
+		if level >= silenceThreshold {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return samples[:0]
+	}
+
+	padding := int(float64(sampleRate) * silencePaddingSeconds)
+	start := first*window - padding
+	end := (last+1)*window + padding
+	if start < 0 {
+		start = 0
+	}
+	if end > len(samples) {
+		end = len(samples)
+	}
+	return samples[start:end]
+}
+
+// splitSamples cuts samples into parts of at most maxSamples,
+// placing each cut at the quietest point in the last tenth of the part so words aren't split
+func splitSamples(samples []int16, sampleRate int, maxSamples int) [][]int16 {
+	window := int(float64(sampleRate) * silenceWindowSeconds)
+	if maxSamples <= 0 || len(samples) <= maxSamples || window <= 0 {
+		return [][]int16{samples}
+	}
+
+	var parts [][]int16
+	for len(samples) > maxSamples {
+		searchStart := maxSamples - maxSamples/10
+		cut := maxSamples
+		quietest := math.MaxFloat64
+		for start := searchStart; start+window <= maxSamples; start += window {
+			if level := windowRMS(samples[start:start+window], window)[0]; level < quietest {
+				quietest = level
+				cut = start + window/2
+			}
+		}
+		parts = append(parts, samples[:cut])
+		samples = samples[cut:]
+	}
+	return append(parts, samples)
+}
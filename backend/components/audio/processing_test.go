@@ -0,0 +1,192 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func sineWave(n int, frequency float64, sampleRate int, amplitude float64) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(amplitude * math.Sin(float64(i)*2*math.Pi*frequency/float64(sampleRate)))
+	}
+	return samples
+}
+
+// rms returns the RMS of samples relative to full scale
+func rms(samples []int16) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	return windowRMS(samples, len(samples))[0]
+}
+
+func TestResampleLength(t *testing.T) {
+	cases := []struct {
+		n, from, to, want int
+	}{
+		{48000, 48000, 16000, 16000},
+		{44100, 44100, 16000, 16000},
+		{8000, 8000, 16000, 16000},
+		{1, 48000, 16000, 0},
+		{3, 48000, 16000, 1},
+	}
+	for _, tc := range cases {
+		got := resample(make([]int16, tc.n), tc.from, tc.to)
+		if len(got) != tc.want {
+			t.Errorf("Resampling %d samples from %d to %d Hz: expected %d samples, got %d", tc.n, tc.from, tc.to, tc.want, len(got))
+		}
+	}
+
+	if got := resample(nil, 48000, 16000); len(got) != 0 {
+		t.Errorf("Expected no samples from empty input, got %d", len(got))
+	}
+	same := []int16{1, 2, 3}
+	if got := resample(same, 16000, 16000); &got[0] != &same[0] {
+		t.Errorf("Expected samples at the target rate to be returned unchanged")
+	}
+}
+
+func TestResamplePreservesInBandTone(t *testing.T) {
+	in := sineWave(48000, 1000, 48000, 10000)
+	out := resample(in, 48000, 16000)
+
+	// Ignore the edges where the filter runs off the end of the input
+	middle := out[1000 : len(out)-1000]
+	if got, want := rms(middle), rms(in); math.Abs(got-want)/want > 0.02 {
+		t.Errorf("Expected a 1 kHz tone to keep its level (%.4f), got %.4f", want, got)
+	}
+}
+
+func TestResampleFiltersAliasing(t *testing.T) {
+	// 12 kHz is above the 8 kHz Nyquist limit of 16 kHz audio and would fold back to 4 kHz
+	in := sineWave(48000, 12000, 48000, 10000)
+	out := resample(in, 48000, 16000)
+
+	middle := out[1000 : len(out)-1000]
+	if got := rms(middle); got > rms(in)*0.01 {
+		t.Errorf("Expected a tone above the new Nyquist frequency to be filtered out, got RMS %.4f", got)
+	}
+}
+
+func TestResampleClampsFullScale(t *testing.T) {
+	in := make([]int16, 4800)
+	for i := range in {
+		in[i] = math.MaxInt16
+	}
+	// Filter ripple pushes full scale input past the int16 range; it must saturate instead of wrapping
+	out := resample(in, 48000, 16000)
+	for i := 100; i < len(out)-100; i++ {
+		if out[i] < math.MaxInt16-100 {
+			t.Fatalf("Expected sample %d to stay at full scale, got %d", i, out[i])
+		}
+	}
+}
+
+func TestTrimSilence(t *testing.T) {
+	const rate = 16000
+	window := int(rate * silenceWindowSeconds)
+	padding := int(rate * silencePaddingSeconds)
+
+	tone := sineWave(rate, 440, rate, 8000)
+	samples := make([]int16, 0, 3*rate)
+	samples = append(samples, make([]int16, rate)...)
+	samples = append(samples, tone...)
+	samples = append(samples, make([]int16, rate)...)
+
+	trimmed := trimSilence(samples, rate)
+	if want := len(tone) + 2*padding; len(trimmed) != want {
+		t.Errorf("Expected the tone plus %d samples of padding on each side (%d), got %d", padding, want, len(trimmed))
+	}
+	if len(trimmed)%window != 0 {
+		t.Errorf("Expected the cut to fall on a window boundary, got %d samples", len(trimmed))
+	}
+}
+
+func TestTrimSilenceEdges(t *testing.T) {
+	const rate = 16000
+
+	if got := trimSilence(make([]int16, rate), rate); len(got) != 0 {
+		t.Errorf("Expected pure silence to trim to nothing, got %d samples", len(got))
+	}
+	if got := trimSilence(nil, rate); len(got) != 0 {
+		t.Errorf("Expected empty input to stay empty, got %d samples", len(got))
+	}
+
+	// Sound right at the start and end leaves no room for padding
+	tone := sineWave(rate/2, 440, rate, 8000)
+	if got := trimSilence(tone, rate); len(got) != len(tone) {
+		t.Errorf("Expected audio without silence to be kept whole, got %d of %d samples", len(got), len(tone))
+	}
+
+	// A tone just under the threshold counts as silence
+	quiet := sineWave(rate, 440, rate, silenceThreshold*32768*0.9)
+	if got := trimSilence(quiet, rate); len(got) != 0 {
+		t.Errorf("Expected audio below the threshold to be trimmed, got %d samples", len(got))
+	}
+
+	// A sample rate too low for a single window leaves the audio untouched
+	if got := trimSilence([]int16{1, 2, 3}, 10); len(got) != 3 {
+		t.Errorf("Expected audio to be untouched when the window is empty, got %d samples", len(got))
+	}
+}
+
+func TestSplitSamples(t *testing.T) {
+	const rate = 16000
+	const maxSamples = 10 * rate
+	window := int(rate * silenceWindowSeconds)
+
+	// Speech-like bursts separated by a gap inside the last tenth of each part
+	samples := sineWave(25*rate, 300, rate, 8000)
+	gap := maxSamples - maxSamples/20
+	for i := gap; i < gap+2*window; i++ {
+		samples[i] = 0
+	}
+
+	parts := splitSamples(samples, rate, maxSamples)
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 parts, got %d", len(parts))
+	}
+
+	total := 0
+	for i, part := range parts {
+		if len(part) > maxSamples {
+			t.Errorf("Part %d has %d samples, over the limit of %d", i, len(part), maxSamples)
+		}
+		total += len(part)
+	}
+	if total != len(samples) {
+		t.Errorf("Expected parts to cover all %d samples, got %d", len(samples), total)
+	}
+
+	if cut := len(parts[0]); cut < gap || cut > gap+2*window {
+		t.Errorf("Expected the first cut inside the silent gap at %d, got %d", gap, cut)
+	}
+}
+
+func TestSplitSamplesEdges(t *testing.T) {
+	const rate = 16000
+
+	short := make([]int16, 100)
+	if parts := splitSamples(short, rate, 100); len(parts) != 1 || len(parts[0]) != 100 {
+		t.Errorf("Expected audio at the limit to stay in one part")
+	}
+	if parts := splitSamples(short, rate, 0); len(parts) != 1 {
+		t.Errorf("Expected a limit of 0 to disable splitting")
+	}
+	if parts := splitSamples(nil, rate, 100); len(parts) != 1 || len(parts[0]) != 0 {
+		t.Errorf("Expected empty input to give one empty part")
+	}
+
+	// A steady tone has no real pauses but must still split within the limit
+	loud := sineWave(35*rate/10, 300, rate, 8000)
+	parts := splitSamples(loud, rate, rate)
+	if len(parts) != 4 {
+		t.Fatalf("Expected 4 parts, got %d", len(parts))
+	}
+	for i, part := range parts {
+		if len(part) == 0 || len(part) > rate {
+			t.Errorf("Part %d has %d samples, expected between 1 and %d", i, len(part), rate)
+		}
+	}
+}
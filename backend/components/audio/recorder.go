@@ -1,46 +1,50 @@
 package audio
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"os"
 	"path"
 	"sync"
+	"time"
 
 	"github.com/gen2brain/malgo"
 )
 
 type Recorder struct {
-	ctx      *malgo.AllocatedContext
-	device   *malgo.Device
-	buffer   *bytes.Buffer
-	mutex    sync.Mutex
-	isActive bool
+	ctx          *malgo.AllocatedContext
+	device       *malgo.Device
+	deviceID     *malgo.DeviceID
+	meter        *levelMeter
+	onLevel      func(InputLevel)
+	onAutoStop   func(error)
+	writes       chan []byte
+	writerDone   chan error
+	frames       int64
+	maxFrames    int64
+	mutex        sync.Mutex
+	isActive     bool
+	isPaused     bool
+	limitReached bool
+	autoStopped  bool
+	saved        chan struct{} // closed once the last recording has been finalized on disk
+	saveErr      error
 }
 
+const (
+	recordingSampleRate = 44100
+	levelUpdatesPerSec  = 20
+
+	// Capture callbacks arrive roughly every 10ms, so this buffers several seconds of audio
+	// if the disk stalls before frames start being dropped
+	writeQueueLength = 1024
+)
+
 var (
 	recorder     *Recorder
 	recorderOnce sync.Once
 )
 
-// WAV header structure
-type wavHeader struct {
-	ChunkID       [4]byte // "RIFF"
-	ChunkSize     uint32  // 36 + SubChunk2Size
-	Format        [4]byte // "WAVE"
-	SubChunk1ID   [4]byte // "fmt "
-	SubChunk1Size uint32  // 16 for PCM
-	AudioFormat   uint16  // 1 for PCM
-	NumChannels   uint16  // 1 for mono
-	SampleRate    uint32  // 44100
-	ByteRate      uint32  // SampleRate * NumChannels * BitsPerSample/8
-	BlockAlign    uint16  // NumChannels * BitsPerSample/8
-	BitsPerSample uint16  // 16
-	SubChunk2ID   [4]byte // "data"
-	SubChunk2Size uint32  // size of audio data
-}
-
 func GetRecorder() (*Recorder, error) {
 	var initErr error
 	recorderOnce.Do(func() {
@@ -51,8 +55,7 @@ func GetRecorder() (*Recorder, error) {
 		}
 
 		recorder = &Recorder{
-			ctx:    ctx,
-			buffer: &bytes.Buffer{},
+			ctx: ctx,
 		}
 	})
 
@@ -62,6 +65,43 @@ func GetRecorder() (*Recorder, error) {
 	return recorder, nil
 }
 
+// recordingPaths returns the path of the finished recording and of the file written while recording
+func recordingPaths() (string, string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get cache directory: %v", err)
+	}
+	return path.Join(cacheDir, "bcards_recording.wav"), path.Join(cacheDir, "bcards_recording.partial.wav"), nil
+}
+
+// SetLevelCallback registers a function that receives input levels while recording
+func (r *Recorder) SetLevelCallback(onLevel func(InputLevel)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.onLevel = onLevel
+}
+
+// SetAutoStopCallback registers a function that is called when a recording reaches its maximum duration
+// and is stopped automatically. It receives the error from saving the recording, if any.
+func (r *Recorder) SetAutoStopCallback(onAutoStop func(error)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.onAutoStop = onAutoStop
+}
+
+// SetMaxDuration limits the length of future recordings. Zero or a negative duration removes the limit.
+func (r *Recorder) SetMaxDuration(d time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.maxFrames = 0
+	if d > 0 {
+		r.maxFrames = int64(d.Seconds() * recordingSampleRate)
+	}
+}
+
 func (r *Recorder) StartRecording() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -69,135 +109,315 @@ func (r *Recorder) StartRecording() error {
 	if r.isActive {
 		return fmt.Errorf("recording is already in progress")
 	}
+	if r.saving() {
+		return fmt.Errorf("previous recording is still being saved")
+	}
+	if r.ctx == nil {
+		return fmt.Errorf("audio context is not initialized")
+	}
 
 	// Check and delete existing recording
-	cacheDir, err := os.UserCacheDir()
+	recordingPath, partialPath, err := recordingPaths()
 	if err != nil {
-		return fmt.Errorf("failed to get cache directory: %v", err)
+		return err
 	}
-	recordingPath := path.Join(cacheDir, "bcards_recording.wav")
-	if _, err := os.Stat(recordingPath); err == nil {
-		if err := os.Remove(recordingPath); err != nil {
-			return fmt.Errorf("failed to delete existing recording: %v", err)
+	for _, p := range []string{recordingPath, partialPath} {
+		if _, err := os.Stat(p); err == nil {
+			if err := os.Remove(p); err != nil {
+				return fmt.Errorf("failed to delete existing recording: %v", err)
+			}
 		}
 	}
 
+	// Audio is streamed to disk as it arrives so an interrupted recording can be recovered
+	f, err := os.Create(partialPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	if err := binary.Write(f, binary.LittleEndian, newWAVHeader(recordingSampleRate, 0)); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write WAV header: %v", err)
+	}
+
 	deviceConfig := malgo.DefaultDeviceConfig(malgo.Capture)
 	deviceConfig.Capture.Format = malgo.FormatS16
 	deviceConfig.Capture.Channels = 1
-	deviceConfig.SampleRate = 44100
+	deviceConfig.SampleRate = recordingSampleRate
 	deviceConfig.Alsa.NoMMap = 1
-
-	onData := func(pOutput, pInput []byte, frameCount uint32) {
-		r.mutex.Lock()
-		defer r.mutex.Unlock()
-
-		if r.isActive {
-			r.buffer.Write(pInput)
-		}
+	if r.deviceID != nil {
+		deviceConfig.Capture.DeviceID = r.deviceID.Pointer()
 	}
 
 	callbacks := malgo.DeviceCallbacks{
-		Data: onData,
+		Data: r.onData,
 	}
 
 	device, err := malgo.InitDevice(r.ctx.Context, deviceConfig, callbacks)
+	if err != nil && r.deviceID != nil {
+		// The selected device may have been unplugged since it was chosen, so record from the default one instead.
+		// It stays selected for when it comes back.
+		println("Warning: failed to open input device, using the default device:", err.Error())
+		deviceConfig.Capture.DeviceID = nil
+		device, err = malgo.InitDevice(r.ctx.Context, deviceConfig, callbacks)
+	}
 	if err != nil {
+		f.Close()
 		return fmt.Errorf("failed to initialize device: %v", err)
 	}
 
+	r.meter = newLevelMeter(recordingSampleRate, levelUpdatesPerSec)
+	r.writes = make(chan []byte, writeQueueLength)
+	r.writerDone = make(chan error, 1)
+	r.frames = 0
+	r.isPaused = false
+	r.limitReached = false
+	r.autoStopped = false
+	go writeRecording(f, r.writes, r.writerDone)
+
 	err = device.Start()
 	if err != nil {
+		device.Uninit()
+		close(r.writes)
+		<-r.writerDone
 		return fmt.Errorf("failed to start device: %v", err)
 	}
 
 	r.device = device
 	r.isActive = true
-	r.buffer.Reset()
+	r.saved = make(chan struct{})
+	r.saveErr = nil
 
 	return nil
 }
 
-func (r *Recorder) StopRecording() error {
+// onData receives captured audio from the device
+func (r *Recorder) onData(pOutput, pInput []byte, frameCount uint32) {
+	r.mutex.Lock()
+	if !r.isActive || r.isPaused || r.limitReached {
+		r.mutex.Unlock()
+		return
+	}
+
+	if r.maxFrames > 0 && r.frames+int64(frameCount) >= r.maxFrames {
+		// Keep only the frames that fit and stop; the device can't be stopped from its own callback
+		keep := int(r.maxFrames-r.frames) * 2
+		if keep < len(pInput) {
+			pInput = pInput[:keep]
+		}
+		r.limitReached = true
+		go r.stop(true)
+	}
+
+	// The device reuses its buffer, so queue a copy for the writer
+	data := make([]byte, len(pInput))
+	copy(data, pInput)
+	select {
+	case r.writes <- data:
+		r.frames += int64(len(data) / 2)
+	default:
+		// Drop the block rather than block the audio thread
+	}
+
+	level, ready := r.meter.add(pInput)
+	onLevel := r.onLevel
+	r.mutex.Unlock()
+
+	// Report the level outside the lock so slow listeners can't stall the capture callback
+	if ready && onLevel != nil {
+		onLevel(level)
+	}
+}
+
+// writeRecording appends queued audio to the file until the queue is closed, then fixes up the WAV header
+func writeRecording(f *os.File, writes <-chan []byte, done chan<- error) {
+	var dataSize int
+	var writeErr error
+	for data := range writes {
+		if writeErr != nil {
+			continue
+		}
+		n, err := f.Write(data)
+		dataSize += n
+		if err != nil {
+			writeErr = fmt.Errorf("failed to write audio data: %v", err)
+		}
+	}
+
+	if err := finalizeWAV(f, dataSize); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if err := f.Close(); err != nil && writeErr == nil {
+		writeErr = fmt.Errorf("failed to close recording: %v", err)
+	}
+	done <- writeErr
+}
+
+// PauseRecording stops capturing audio until ResumeRecording is called
+func (r *Recorder) PauseRecording() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	if !r.isActive {
 		return fmt.Errorf("no recording in progress")
 	}
+	if r.isPaused {
+		return fmt.Errorf("recording is already paused")
+	}
+
+	r.isPaused = true
+	return nil
+}
+
+// ResumeRecording continues a paused recording
+func (r *Recorder) ResumeRecording() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.isActive {
+		return fmt.Errorf("no recording in progress")
+	}
+	if !r.isPaused {
+		return fmt.Errorf("recording is not paused")
+	}
+
+	r.isPaused = false
+	return nil
+}
+
+// Elapsed returns the length of audio captured so far in the current or last recording
+func (r *Recorder) Elapsed() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return time.Duration(float64(r.frames) / recordingSampleRate * float64(time.Second))
+}
+
+func (r *Recorder) StopRecording() error {
+	return r.stop(false)
+}
+
+// stop ends the recording and finalizes the file on disk
+func (r *Recorder) stop(auto bool) error {
+	r.mutex.Lock()
+	if !r.isActive {
+		// A recording that hit its maximum length is saved by the automatic stop,
+		// so wait for it to finish and report how it went
+		if !auto && r.autoStopped {
+			r.autoStopped = false
+			saved := r.saved
+			r.mutex.Unlock()
+
+			<-saved
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			return r.saveErr
+		}
+		r.mutex.Unlock()
+		return fmt.Errorf("no recording in progress")
+	}
 
 	r.isActive = false
-	if r.device != nil {
-		r.device.Stop()
-		r.device.Uninit()
-		r.device = nil
+	r.autoStopped = auto
+	saved := r.saved
+	device := r.device
+	r.device = nil
+	writes := r.writes
+	writerDone := r.writerDone
+	onAutoStop := r.onAutoStop
+	r.mutex.Unlock()
+
+	// Stop the device without holding the lock, as stopping waits for the data callback to return
+	if device != nil {
+		device.Stop()
+		device.Uninit()
 	}
 
-	// Save the audio data as WAV
-	cacheDir, err := os.UserCacheDir()
+	// Nothing is queued once isActive is cleared, so the writer can be closed safely
+	close(writes)
+	err := <-writerDone
+	if err == nil {
+		err = promotePartialRecording()
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get cache directory: %v", err)
+		err = fmt.Errorf("failed to save recording: %v", err)
 	}
 
-	recordingPath := path.Join(cacheDir, "bcards_recording.wav")
-	err = r.saveToWAV(recordingPath)
-	if err != nil {
-		return fmt.Errorf("failed to save recording: %v", err)
+	r.mutex.Lock()
+	r.saveErr = err
+	r.mutex.Unlock()
+	close(saved)
+
+	if auto && onAutoStop != nil {
+		onAutoStop(err)
 	}
+	return err
+}
 
-	return nil
+// saving reports whether a stopped recording is still being written out. The caller must hold the mutex.
+func (r *Recorder) saving() bool {
+	if r.saved == nil {
+		return false
+	}
+	select {
+	case <-r.saved:
+		return false
+	default:
+		return true
+	}
 }
 
-func (r *Recorder) saveToWAV(filepath string) error {
-	f, err := os.Create(filepath)
+// promotePartialRecording moves the file written while recording to the finished recording path
+func promotePartialRecording() error {
+	recordingPath, partialPath, err := recordingPaths()
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+		return err
 	}
-	defer f.Close()
-
-	// Prepare WAV header
-	audioData := r.buffer.Bytes()
-	header := wavHeader{
-		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
-		ChunkSize:     uint32(36 + len(audioData)),
-		Format:        [4]byte{'W', 'A', 'V', 'E'},
-		SubChunk1ID:   [4]byte{'f', 'm', 't', ' '},
-		SubChunk1Size: 16,
-		AudioFormat:   1, // PCM
-		NumChannels:   1, // Mono
-		SampleRate:    44100,
-		BitsPerSample: 16,
-		SubChunk2ID:   [4]byte{'d', 'a', 't', 'a'},
-		SubChunk2Size: uint32(len(audioData)),
-	}
-
-	// Calculate derived values
-	header.ByteRate = header.SampleRate * uint32(header.NumChannels) * uint32(header.BitsPerSample) / 8
-	header.BlockAlign = header.NumChannels * header.BitsPerSample / 8
-
-	// Write header
-	if err := binary.Write(f, binary.LittleEndian, header); err != nil {
-		return fmt.Errorf("failed to write WAV header: %v", err)
+	return os.Rename(partialPath, recordingPath)
+}
+
+// RecoverRecording repairs a recording left behind by a crash and makes it the last recording.
+// It reports whether there was anything to recover.
+func (r *Recorder) RecoverRecording() (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.isActive || r.saving() {
+		return false, fmt.Errorf("recording is in progress")
 	}
 
-	// Write audio data
-	if _, err := f.Write(audioData); err != nil {
-		return fmt.Errorf("failed to write audio data: %v", err)
+	_, partialPath, err := recordingPaths()
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(partialPath); os.IsNotExist(err) {
+		return false, nil
 	}
 
-	return nil
+	if err := repairWAV(partialPath); err != nil {
+		return false, err
+	}
+	if err := promotePartialRecording(); err != nil {
+		return false, fmt.Errorf("failed to recover recording: %v", err)
+	}
+	return true, nil
 }
 
 func (r *Recorder) Cleanup() {
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
-
-	if r.device != nil {
-		r.device.Stop()
-		r.device.Uninit()
-		r.device = nil
+	active := r.isActive
+	saved := r.saved
+	r.mutex.Unlock()
+
+	if active {
+		r.StopRecording()
+	} else if saved != nil {
+		// Let an automatic stop finish writing the file before the context goes away
+		<-saved
 	}
 
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	if r.ctx != nil {
 		r.ctx.Uninit()
 		r.ctx = nil
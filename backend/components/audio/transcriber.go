@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"sync"
 
+	"github.com/jorkle/brightcards/backend/components/ai/usage"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -31,6 +33,11 @@ func InitTranscriber(apiKey string) error {
 
 // TranscribeAudio takes a path to a WAV file and returns its transcription using OpenAI's Whisper API
 func TranscribeAudio(filepath string) (string, error) {
+	return TranscribeAudioContext(context.Background(), filepath)
+}
+
+// TranscribeAudioContext is TranscribeAudio with a context that can cancel the upload
+func TranscribeAudioContext(ctx context.Context, filepath string) (string, error) {
 	if !initialized {
 		return "", fmt.Errorf("transcriber not initialized, call InitTranscriber first")
 	}
@@ -42,19 +49,44 @@ func TranscribeAudio(filepath string) (string, error) {
 	}
 	defer file.Close()
 
+	if err := usage.Allow(); err != nil {
+		return "", err
+	}
+
+	// The verbose format also reports the length of the audio, which transcription is billed by
 	req := openai.AudioRequest{
 		Model:    openai.Whisper1,
 		FilePath: filepath,
+		Format:   openai.AudioResponseFormatVerboseJSON,
 	}
 
-	resp, err := openaiClient.CreateTranscription(context.Background(), req)
+	resp, err := openaiClient.CreateTranscription(ctx, req)
 	if err != nil {
-		return "", fmt.Errorf("failed to transcribe audio: %v", err)
+		return "", fmt.Errorf("failed to transcribe audio: %w", err)
 	}
+	usage.Add(usage.Record{Operation: usage.OperationTranscription, Model: req.Model, AudioSeconds: resp.Duration})
 
 	return resp.Text, nil
 }
 
+// TranscribeFiles transcribes the parts of a split recording in order and joins the text
+func TranscribeFiles(filepaths []string) (string, error) {
+	return TranscribeFilesContext(context.Background(), filepaths)
+}
+
+// TranscribeFilesContext is TranscribeFiles with a context that can cancel the remaining uploads
+func TranscribeFilesContext(ctx context.Context, filepaths []string) (string, error) {
+	texts := make([]string, 0, len(filepaths))
+	for _, filepath := range filepaths {
+		text, err := TranscribeAudioContext(ctx, filepath)
+		if err != nil {
+			return "", err
+		}
+		texts = append(texts, strings.TrimSpace(text))
+	}
+	return strings.Join(texts, " "), nil
+}
+
 // GetLastRecordingPath returns the path to the last recorded audio file
 func GetLastRecordingPath() (string, error) {
 	cacheDir, err := os.UserCacheDir()
@@ -0,0 +1,26 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscribeAudioCancelled(t *testing.T) {
+	if err := InitTranscriber("test-key"); err != nil {
+		t.Fatalf("Failed to initialize transcriber: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "recording.flac")
+	if err := os.WriteFile(path, []byte("fLaC"), 0o644); err != nil {
+		t.Fatalf("Failed to write recording: %v", err)
+	}
+
+	// A cancelled upload is reported as cancelled, so callers don't retry it or show it as an API failure
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := TranscribeFilesContext(ctx, []string{path, path}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the transcription to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WAV header structure
+type wavHeader struct {
+	ChunkID       [4]byte // "RIFF"
+	ChunkSize     uint32  // 36 + SubChunk2Size
+	Format        [4]byte // "WAVE"
+	SubChunk1ID   [4]byte // "fmt "
+	SubChunk1Size uint32  // 16 for PCM
+	AudioFormat   uint16  // 1 for PCM
+	NumChannels   uint16  // 1 for mono
+	SampleRate    uint32  // 44100
+	ByteRate      uint32  // SampleRate * NumChannels * BitsPerSample/8
+	BlockAlign    uint16  // NumChannels * BitsPerSample/8
+	BitsPerSample uint16  // 16
+	SubChunk2ID   [4]byte // "data"
+	SubChunk2Size uint32  // size of audio data
+}
+
+// newWAVHeader builds the header for a mono 16-bit PCM file holding dataSize bytes of audio
+func newWAVHeader(sampleRate int, dataSize int) wavHeader {
+	header := wavHeader{
+		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     uint32(36 + dataSize),
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		SubChunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		SubChunk1Size: 16,
+		AudioFormat:   1, // PCM
+		NumChannels:   1, // Mono
+		SampleRate:    uint32(sampleRate),
+		BitsPerSample: 16,
+		SubChunk2ID:   [4]byte{'d', 'a', 't', 'a'},
+		SubChunk2Size: uint32(dataSize),
+	}
+
+	// Calculate derived values
+	header.ByteRate = header.SampleRate * uint32(header.NumChannels) * uint32(header.BitsPerSample) / 8
+	header.BlockAlign = header.NumChannels * header.BitsPerSample / 8
+
+	return header
+}
+
+// WriteWAV writes mono 16-bit samples to a WAV file
+func WriteWAV(filepath string, samples []int16, sampleRate int) error {
+	f, err := os.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer f.Close()
+
+	header := newWAVHeader(sampleRate, len(samples)*2)
+	if err := binary.Write(f, binary.LittleEndian, header); err != nil {
+		return fmt.Errorf("failed to write WAV header: %v", err)
+	}
+
+	if err := binary.Write(f, binary.LittleEndian, samples); err != nil {
+		return fmt.Errorf("failed to write audio data: %v", err)
+	}
+
+	return nil
+}
+
+// finalizeWAV rewrites the header of a WAV file once the amount of audio data is known
+func finalizeWAV(f *os.File, dataSize int) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to update WAV header: %v", err)
+	}
+	if err := binary.Write(f, binary.LittleEndian, newWAVHeader(recordingSampleRate, dataSize)); err != nil {
+		return fmt.Errorf("failed to update WAV header: %v", err)
+	}
+	return nil
+}
+
+// repairWAV fixes the header of a recording that was interrupted before finalizeWAV ran,
+// sizing the data chunk from whatever audio made it to disk
+func repairWAV(filepath string) error {
+	f, err := os.OpenFile(filepath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open recording: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read recording: %v", err)
+	}
+
+	headerSize := int64(binary.Size(wavHeader{}))
+	if info.Size() < headerSize {
+		return fmt.Errorf("recording is too short to recover")
+	}
+
+	// Drop a trailing half sample from a write cut off mid-block
+	dataSize := (info.Size() - headerSize) &^ 1
+	return finalizeWAV(f, int(dataSize))
+}
+
+// ReadWAV reads a mono 16-bit PCM WAV file and returns its samples and sample rate
+func ReadWAV(filepath string) ([]int16, int, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read WAV file: %v", err)
+	}
+
+	return DecodeWAV(data)
+}
+
+// DecodeWAV parses mono 16-bit PCM WAV data and returns its samples and sample rate
+func DecodeWAV(data []byte) ([]int16, int, error) {
+	r := bytes.NewReader(data)
+	var riff struct {
+		ChunkID   [4]byte
+		ChunkSize uint32
+		Format    [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil {
+		return nil, 0, fmt.Errorf("failed to read WAV header: %v", err)
+	}
+	if string(riff.ChunkID[:]) != "RIFF" || string(riff.Format[:]) != "WAVE" {
+		return nil, 0, fmt.Errorf("not a WAV file")
+	}
+
+	sampleRate := 0
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return nil, 0, fmt.Errorf("WAV file has no data chunk")
+		}
+
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			var format struct {
+				AudioFormat   uint16
+				NumChannels   uint16
+				SampleRate    uint32
+				ByteRate      uint32
+				BlockAlign    uint16
+				BitsPerSample uint16
+			}
+			if err := binary.Read(r, binary.LittleEndian, &format); err != nil {
+				return nil, 0, fmt.Errorf("failed to read WAV format: %v", err)
+			}
+			if format.AudioFormat != 1 || format.NumChannels != 1 || format.BitsPerSample != 16 {
+				return nil, 0, fmt.Errorf("unsupported WAV format: only mono 16-bit PCM is supported")
+			}
+			sampleRate = int(format.SampleRate)
+			if _, err := r.Seek(int64(chunk.Size)-16, io.SeekCurrent); err != nil {
+				return nil, 0, fmt.Errorf("failed to read WAV format: %v", err)
+			}
+		case "data":
+			if sampleRate == 0 {
+				return nil, 0, fmt.Errorf("WAV data chunk precedes format chunk")
+			}
+			// Tolerate a size that runs past the end of the file, e.g. from an interrupted recording
+			size := int(chunk.Size)
+			if size > r.Len() {
+				size = r.Len()
+			}
+			samples := make([]int16, size/2)
+			if err := binary.Read(r, binary.LittleEndian, samples); err != nil {
+				return nil, 0, fmt.Errorf("failed to read audio data: %v", err)
+			}
+			return samples, sampleRate, nil
+		default:
+			if _, err := r.Seek(int64(chunk.Size+chunk.Size%2), io.SeekCurrent); err != nil {
+				return nil, 0, fmt.Errorf("failed to skip WAV chunk: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package clock abstracts the current time so scheduling can be tested and previewed at any moment
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock returns the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// System is the real wall clock
+var System Clock = systemClock{}
+
+// Manual is a clock that only moves when told to, for tests and simulations
+type Manual struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManual returns a clock stopped at now
+func NewManual(now time.Time) *Manual {
+	return &Manual{now: now}
+}
+
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// Set moves the clock to now
+func (m *Manual) Set(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// Advance moves the clock forward by d
+func (m *Manual) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+}
+
+type offsetClock struct {
+	base   Clock
+	offset time.Duration
+}
+
+func (o offsetClock) Now() time.Time {
+	return o.base.Now().Add(o.offset)
+}
+
+// Offset returns a clock running offset ahead of base, e.g. to preview what is due tomorrow
+func Offset(base Clock, offset time.Duration) Clock {
+	return offsetClock{base: base, offset: offset}
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// CachedAIResponse returns the cached content of an AI request that hasn't expired at now.
+// It returns sql.ErrNoRows when there is none.
+func CachedAIResponse(key string, now time.Time) (string, error) {
+	return CachedAIResponseContext(context.Background(), key, now)
+}
+
+// CachedAIResponseContext is CachedAIResponse with a context that can cancel the query
+func CachedAIResponseContext(ctx context.Context, key string, now time.Time) (string, error) {
+	if err := Init(); err != nil {
+		return "", err
+	}
+
+	var content string
+	err := DB.QueryRowContext(ctx, "SELECT content FROM ai_response_cache WHERE key = ? AND datetime(expires_at) > datetime(?)", key, now.UTC().Format(sqliteTimeLayout)).Scan(&content)
+	return content, err
+}
+
+// SaveAIResponse caches the content of an AI request until it expires, replacing any earlier response
+func SaveAIResponse(key string, operation string, content string, now time.Time, expires time.Time) error {
+	return SaveAIResponseContext(context.Background(), key, operation, content, now, expires)
+}
+
+// SaveAIResponseContext is SaveAIResponse with a context that can cancel the query
+func SaveAIResponseContext(ctx context.Context, key string, operation string, content string, now time.Time, expires time.Time) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.ExecContext(ctx, "INSERT OR REPLACE INTO ai_response_cache (key, operation, content, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		key, operation, content, now.UTC().Format(time.RFC3339), expires.UTC().Format(time.RFC3339))
+	return err
+}
+
+// DeleteAIResponses removes the cached responses of an operation, or of every operation when it is empty,
+// and returns how many were removed
+func DeleteAIResponses(operation string) (int, error) {
+	if err := Init(); err != nil {
+		return 0, err
+	}
+
+	result, err := DB.Exec("DELETE FROM ai_response_cache WHERE ? = '' OR operation = ?", operation, operation)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+// DeleteExpiredAIResponses removes the cached responses that have expired at now
+func DeleteExpiredAIResponses(now time.Time) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("DELETE FROM ai_response_cache WHERE datetime(expires_at) <= datetime(?)", now.UTC().Format(sqliteTimeLayout))
+	return err
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// Statuses of an AI job
+const (
+	AIJobQueued    = "queued"
+	AIJobRunning   = "running"
+	AIJobSucceeded = "succeeded"
+	AIJobFailed    = "failed"
+	AIJobCancelled = "cancelled"
+)
+
+// aiJobColumns lists the columns read by scanAIJob, in order
+const aiJobColumns = "id, kind, status, payload, result, error, attempts, run_after, created_at, updated_at"
+
+// scanAIJob reads a row selected with aiJobColumns into an AIJobModel
+func scanAIJob(row rowScanner) (models.AIJobModel, error) {
+	job := models.AIJobModel{}
+	var result sql.NullString
+	var errorMessage sql.NullString
+	err := row.Scan(&job.ID, &job.Kind, &job.Status, &job.Payload, &result, &errorMessage, &job.Attempts, &job.RunAfter, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return models.AIJobModel{}, err
+	}
+	job.Result = result.String
+	job.Error = errorMessage.String
+	return job, nil
+}
+
+// CreateAIJob queues an AI job to run as soon as a worker is free
+func CreateAIJob(kind string, payload string, now time.Time) (models.AIJobModel, error) {
+	if err := Init(); err != nil {
+		return models.AIJobModel{}, err
+	}
+
+	jobId, err := insertAIJob(context.Background(), DB, kind, payload, now)
+	if err != nil {
+		return models.AIJobModel{}, err
+	}
+
+	return AIJob(jobId)
+}
+
+// CreateUniqueAIJob queues an AI job unless one of the same kind and payload is already queued or running,
+// or failed after failedSince. It reports whether the job was queued.
+func CreateUniqueAIJob(kind string, payload string, failedSince time.Time, now time.Time) (models.AIJobModel, bool, error) {
+	if err := Init(); err != nil {
+		return models.AIJobModel{}, false, err
+	}
+
+	result, err := DB.Exec(`INSERT INTO ai_jobs (kind, payload, status, run_after, created_at, updated_at)
+		SELECT ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+		WHERE NOT EXISTS (SELECT 1 FROM ai_jobs WHERE kind = ? AND payload = ?
+			AND (status IN (?, ?) OR (status = ? AND datetime(updated_at) > datetime(?))))`,
+		kind, payload, AIJobQueued, now.UTC().Format(time.RFC3339), kind, payload, AIJobQueued, AIJobRunning,
+		AIJobFailed, failedSince.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return models.AIJobModel{}, false, err
+	}
+	created, err := result.RowsAffected()
+	if err != nil || created == 0 {
+		return models.AIJobModel{}, false, err
+	}
+
+	jobId, err := result.LastInsertId()
+	if err != nil {
+		return models.AIJobModel{}, false, err
+	}
+	job, err := AIJob(int(jobId))
+	return job, err == nil, err
+}
+
+// insertAIJob adds a queued job and returns its id
+func insertAIJob(ctx context.Context, db execer, kind string, payload string, now time.Time) (int, error) {
+	result, err := db.ExecContext(ctx, "INSERT INTO ai_jobs (kind, payload, status, run_after, created_at, updated_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+		kind, payload, AIJobQueued, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// AIJob returns an AI job
+func AIJob(jobId int) (models.AIJobModel, error) {
+	return AIJobContext(context.Background(), jobId)
+}
+
+// AIJobContext is AIJob with a context that can cancel the query
+func AIJobContext(ctx context.Context, jobId int) (models.AIJobModel, error) {
+	if err := Init(); err != nil {
+		return models.AIJobModel{}, err
+	}
+
+	return scanAIJob(DB.QueryRowContext(ctx, "SELECT "+aiJobColumns+" FROM ai_jobs WHERE id = ?", jobId))
+}
+
+// AIJobs returns the most recent AI jobs, newest first
+func AIJobs(limit int) ([]models.AIJobModel, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query("SELECT "+aiJobColumns+" FROM ai_jobs ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	jobs := []models.AIJobModel{}
+	for results.Next() {
+		job, err := scanAIJob(results)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, results.Err()
+}
+
+// ClaimAIJob marks the oldest queued job that may run at now as running and returns it.
+// It returns sql.ErrNoRows when no job is ready.
+func ClaimAIJob(now time.Time) (models.AIJobModel, error) {
+	return ClaimAIJobContext(context.Background(), now)
+}
+
+// ClaimAIJobContext is ClaimAIJob with a context that can cancel the query
+func ClaimAIJobContext(ctx context.Context, now time.Time) (models.AIJobModel, error) {
+	if err := Init(); err != nil {
+		return models.AIJobModel{}, err
+	}
+
+	for {
+		var jobId int
+		err := DB.QueryRowContext(ctx, "SELECT id FROM ai_jobs WHERE status = ? AND datetime(run_after) <= datetime(?) ORDER BY id LIMIT 1",
+			AIJobQueued, now.UTC().Format(sqliteTimeLayout)).Scan(&jobId)
+		if err != nil {
+			return models.AIJobModel{}, err
+		}
+
+		// Another worker may have claimed the job in between, in which case the next one is tried
+		result, err := DB.ExecContext(ctx, "UPDATE ai_jobs SET status = ?, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+			AIJobRunning, jobId, AIJobQueued)
+		if err != nil {
+			return models.AIJobModel{}, err
+		}
+		claimed, err := result.RowsAffected()
+		if err != nil {
+			return models.AIJobModel{}, err
+		}
+		if claimed == 1 {
+			return AIJobContext(ctx, jobId)
+		}
+	}
+}
+
+// FinishAIJob stores the outcome of a running job. A job cancelled while it ran stays cancelled.
+func FinishAIJob(jobId int, status string, result string, errorMessage string) error {
+	return FinishAIJobContext(context.Background(), jobId, status, result, errorMessage)
+}
+
+// FinishAIJobContext is FinishAIJob with a context that can cancel the query
+func FinishAIJobContext(ctx context.Context, jobId int, status string, result string, errorMessage string) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.ExecContext(ctx, "UPDATE ai_jobs SET status = ?, result = ?, error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		status, result, errorMessage, jobId, AIJobRunning)
+	return err
+}
+
+// RetryAIJob queues a running job again to run after the given time
+func RetryAIJob(jobId int, runAfter time.Time, errorMessage string) error {
+	return RetryAIJobContext(context.Background(), jobId, runAfter, errorMessage)
+}
+
+// RetryAIJobContext is RetryAIJob with a context that can cancel the query
+func RetryAIJobContext(ctx context.Context, jobId int, runAfter time.Time, errorMessage string) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.ExecContext(ctx, "UPDATE ai_jobs SET status = ?, run_after = ?, error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		AIJobQueued, runAfter.UTC().Format(time.RFC3339), errorMessage, jobId, AIJobRunning)
+	return err
+}
+
+// CancelAIJob cancels a job that hasn't finished. It reports whether the job was still queued or running.
+func CancelAIJob(jobId int) (bool, error) {
+	if err := Init(); err != nil {
+		return false, err
+	}
+
+	result, err := DB.Exec("UPDATE ai_jobs SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status IN (?, ?)",
+		AIJobCancelled, jobId, AIJobQueued, AIJobRunning)
+	if err != nil {
+		return false, err
+	}
+	cancelled, err := result.RowsAffected()
+	return cancelled == 1, err
+}
+
+// RequeueInterruptedAIJobs queues again the jobs that were running when the app last stopped
+func RequeueInterruptedAIJobs() error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("UPDATE ai_jobs SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE status = ?", AIJobQueued, AIJobRunning)
+	return err
+}
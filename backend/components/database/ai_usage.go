@@ -0,0 +1,55 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// RecordAIUsage stores what a request to the AI services used
+func RecordAIUsage(entry models.AIUsageModel, at time.Time) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("INSERT INTO ai_usage (operation, model, prompt_tokens, completion_tokens, audio_seconds, characters, cost, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.Operation, entry.Model, entry.PromptTokens, entry.CompletionTokens, entry.AudioSeconds, entry.Characters, entry.Cost, at.UTC().Format(time.RFC3339))
+	return err
+}
+
+// AIUsageTotals adds up the AI usage from one time until another, by operation and model, most expensive first
+func AIUsageTotals(from time.Time, to time.Time) ([]models.AIUsageTotal, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query(`SELECT operation, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(audio_seconds), SUM(characters), SUM(cost)
+		FROM ai_usage WHERE datetime(created_at) >= datetime(?) AND datetime(created_at) < datetime(?) GROUP BY operation, model ORDER BY SUM(cost) DESC, operation, model`,
+		from.UTC().Format(sqliteTimeLayout), to.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	totals := []models.AIUsageTotal{}
+	for results.Next() {
+		var total models.AIUsageTotal
+		err := results.Scan(&total.Operation, &total.Model, &total.Requests, &total.PromptTokens, &total.CompletionTokens, &total.AudioSeconds, &total.Characters, &total.Cost)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, results.Err()
+}
+
+// AIUsageCostSince returns the estimated cost of the AI requests made since the given time
+func AIUsageCostSince(since time.Time) (float64, error) {
+	if err := Init(); err != nil {
+		return 0, err
+	}
+
+	var cost float64
+	err := DB.QueryRow("SELECT COALESCE(SUM(cost), 0) FROM ai_usage WHERE datetime(created_at) >= datetime(?)", since.UTC().Format(sqliteTimeLayout)).Scan(&cost)
+	return cost, err
+}
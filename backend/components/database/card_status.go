@@ -0,0 +1,108 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// SetCardSuspended takes a card out of the study queue, or returns it. Suspending or unsuspending by hand
+// takes over from a suspension applied by the leech action, so clearing the leech leaves it as it is.
+func SetCardSuspended(cardId int, suspended bool) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("UPDATE flashcards SET suspended = ?, leech_suspended = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?", suspended, cardId)
+	return err
+}
+
+// BuryCard leaves a card out of the study queue until the given time
+func BuryCard(cardId int, until time.Time) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("UPDATE flashcards SET buried_until = ? WHERE id = ?", until.UTC().Format(time.RFC3339), cardId)
+	return err
+}
+
+// UnburyCard returns a buried card to the study queue
+func UnburyCard(cardId int) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("UPDATE flashcards SET buried_until = NULL WHERE id = ?", cardId)
+	return err
+}
+
+// siblingCardsQuery selects the cards made from the same note as a card and the other phrasings of the same card,
+// taking the card twice
+const siblingCardsQuery = `SELECT m.card_id FROM occlusion_masks m JOIN occlusion_masks c ON m.note_id = c.note_id WHERE c.card_id = ? AND m.card_id != c.card_id
+	UNION SELECT f.id FROM flashcards f JOIN flashcards c ON COALESCE(f.parent_card_id, f.id) = COALESCE(c.parent_card_id, c.id) WHERE c.id = ? AND f.id != c.id`
+
+// SiblingCardIds returns the cards made from the same note as a card, such as the other masks of an image occlusion,
+// and its rephrasings or the card it rephrases
+func SiblingCardIds(cardId int) ([]int, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query(siblingCardsQuery, cardId, cardId)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	ids := []int{}
+	for results.Next() {
+		var id int
+		if err := results.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, results.Err()
+}
+
+// BurySiblings buries the new and review siblings of a card until the given time, so related cards aren't
+// seen on the same day. Siblings in a learning step are left alone, as they have to be finished.
+func BurySiblings(cardId int, until time.Time) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("UPDATE flashcards SET buried_until = ? WHERE id IN ("+siblingCardsQuery+") AND ("+newCardCondition+" OR "+reviewCardCondition+")",
+		until.UTC().Format(time.RFC3339), cardId, cardId)
+	return err
+}
+
+// RescheduleCard stores a schedule set by hand, due at the given time. Unlike ReviewCard, nothing is logged.
+func RescheduleCard(cardId int, schedule models.CardSchedule, due time.Time) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("UPDATE flashcards SET card_state = ?, learning_step = ?, fsrs_stability = ?, fsrs_difficulty = ?, ease_factor = ?, repetitions = ?, leitner_box = ?, interval_days = ?, schedule_due = ?, buried_until = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		schedule.State, schedule.Step, schedule.Stability, schedule.Difficulty, schedule.EaseFactor, schedule.Repetitions, schedule.LeitnerBox, schedule.IntervalDays,
+		due.UTC().Format(time.RFC3339), cardId)
+	return err
+}
+
+// ResetCard turns a card back into a new card, forgetting its memory state. Its review log is kept.
+// The lapse count is only cleared when resetCounts is set, which also clears the leech flag like ClearLeech,
+// lifting a suspension the leech action made.
+func ResetCard(cardId int, resetCounts bool, now time.Time) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec(`UPDATE flashcards SET card_state = ?, learning_step = 0, fsrs_stability = 0, fsrs_difficulty = 0, ease_factor = 0,
+		repetitions = 0, leitner_box = 0, interval_days = 0, schedule_due = ?, buried_until = NULL,
+		lapses = CASE WHEN ? THEN 0 ELSE lapses END, leech = CASE WHEN ? THEN 0 ELSE leech END,
+		suspended = CASE WHEN ? THEN suspended AND NOT leech_suspended ELSE suspended END,
+		leech_suspended = CASE WHEN ? THEN 0 ELSE leech_suspended END, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		models.CardStateNew, now.UTC().Format(time.RFC3339), resetCounts, resetCounts, resetCounts, resetCounts, cardId)
+	return err
+}
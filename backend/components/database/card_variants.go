@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// How a deck reviews the rephrasings of a card
+const (
+	VariantModeSeparate = "separate" // every variant is a card with its own schedule
+	VariantModeRotate   = "rotate"   // the original is scheduled alone and shown through a different phrasing each review
+)
+
+// rotatedVariantCondition matches variants that are reviewed through their parent rather than on their own
+const rotatedVariantCondition = "(parent_card_id IS NOT NULL AND deck_id IN (SELECT id FROM decks WHERE variant_mode = '" + VariantModeRotate + "'))"
+
+// CardVariants returns the rephrasings of a card, oldest first
+func CardVariants(cardId int) ([]models.FlashcardModel, error) {
+	return CardVariantsContext(context.Background(), cardId)
+}
+
+// CardVariantsContext is CardVariants with a context that can cancel the query
+func CardVariantsContext(ctx context.Context, cardId int) ([]models.FlashcardModel, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.QueryContext(ctx, "SELECT "+cardColumns+" FROM flashcards WHERE parent_card_id = ? ORDER BY id", cardId)
+	if err != nil {
+		return nil, err
+	}
+	return scanCards(results)
+}
+
+// CountCardReviews returns how many times a card has been reviewed
+func CountCardReviews(cardId int) (int, error) {
+	if err := Init(); err != nil {
+		return 0, err
+	}
+
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM review_logs WHERE card_id = ?", cardId).Scan(&count)
+	return count, err
+}
+
+// UpdateDeckVariantMode sets whether a deck schedules rephrasings separately or rotates them
+func UpdateDeckVariantMode(deckId int, mode string) (DeckModel, error) {
+	if err := Init(); err != nil {
+		return DeckModel{}, err
+	}
+
+	_, err := DB.Exec("UPDATE decks SET variant_mode = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", mode, deckId)
+	if err != nil {
+		return DeckModel{}, err
+	}
+
+	return Deck(deckId)
+}
+
+// CardsToRephrase returns mature cards of decks with auto-rephrase on that have fewer variants than their deck allows.
+// Variants themselves and image occlusion cards are left out, as they have no wording of their own to vary.
+func CardsToRephrase(limit int) ([]models.FlashcardModel, error) {
+	return CardsToRephraseContext(context.Background(), limit)
+}
+
+// CardsToRephraseContext is CardsToRephrase with a context that can cancel the query
+func CardsToRephraseContext(ctx context.Context, limit int) ([]models.FlashcardModel, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.QueryContext(ctx, `SELECT `+cardColumns+` FROM flashcards WHERE parent_card_id IS NULL AND `+reviewCardCondition+` AND interval_days >= ? AND NOT suspended
+		AND id NOT IN (SELECT card_id FROM occlusion_masks)
+		AND (SELECT COUNT(*) FROM flashcards v WHERE v.parent_card_id = flashcards.id) <
+			(SELECT COALESCE(max_rephrased_cards, ?) FROM decks WHERE decks.id = flashcards.deck_id AND enable_auto_rephrase)
+		ORDER BY id LIMIT ?`, matureInterval, DefaultMaxRephrasedCards, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanCards(results)
+}
@@ -1,8 +1,10 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"os"
 	"path"
 	"time"
@@ -21,6 +23,16 @@ type DeckModel struct {
 	EnableAutoRephrase   bool
 	EnableInitialismSwap bool
 	MaxRephrasedCards    int
+	TTSAutoPlayFront     bool
+	TTSAutoPlayBack      bool
+	Scheduler            string
+	LeechThreshold       int
+	LeechAction          string
+	VariantMode          string
+	LearningSteps        string
+	RelearningSteps      string
+	NewCardsPerDay       int
+	MaxReviewsPerDay     int
 	CardCount            int
 	LastReviewed         *string
 	CreatedAt            string
@@ -59,10 +71,21 @@ func Init() error {
 	if errors.Is(err, os.ErrNotExist) {
 		CreateDatabaseFile()
 	}
-	DB, err = sql.Open("sqlite3", path.Join(storageDir, sqliteFile))
+	return Open(path.Join(storageDir, sqliteFile))
+}
+
+// Open switches to the database file at filePath, creating and migrating it if needed.
+// Init opens the one in the user's config folder; tests use Open to work on a temporary copy.
+func Open(filePath string) error {
+	// Transactions take the write lock up front so two of them can't both read and then fail to upgrade
+	db, err := sql.Open("sqlite3", filePath+"?_txlock=immediate")
 	if err != nil {
 		return err
 	}
+	if DB != nil {
+		DB.Close()
+	}
+	DB = db
 
 	InitDatabase()
 	return nil
@@ -84,6 +107,40 @@ func InitDatabase() error {
 		return err
 	}
 
+	// Create card_media table if it doesn't exist
+	_, err = DB.Exec("CREATE TABLE IF NOT EXISTS card_media (id INTEGER PRIMARY KEY AUTOINCREMENT, card_id INTEGER NOT NULL, side TEXT NOT NULL, media_type TEXT NOT NULL, file_name TEXT NOT NULL, original_name TEXT, mime_type TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("CREATE INDEX IF NOT EXISTS idx_card_media_card_id ON card_media (card_id)")
+	if err != nil {
+		return err
+	}
+
+	// Create review_logs table if it doesn't exist. Every review is recorded for daily limits and statistics.
+	_, err = DB.Exec("CREATE TABLE IF NOT EXISTS review_logs (id INTEGER PRIMARY KEY AUTOINCREMENT, card_id INTEGER NOT NULL, deck_id INTEGER NOT NULL, grade INTEGER NOT NULL, was_new BOOLEAN DEFAULT 0, stability REAL, difficulty REAL, interval_days REAL, reviewed_at DATETIME NOT NULL)")
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("CREATE INDEX IF NOT EXISTS idx_review_logs_deck_reviewed ON review_logs (deck_id, reviewed_at)")
+	if err != nil {
+		return err
+	}
+
+	// Create image occlusion tables if they don't exist. Each mask is scheduled as its own card.
+	_, err = DB.Exec("CREATE TABLE IF NOT EXISTS occlusion_notes (id INTEGER PRIMARY KEY AUTOINCREMENT, deck_id INTEGER NOT NULL, file_name TEXT NOT NULL, width INTEGER NOT NULL, height INTEGER NOT NULL, header TEXT, hide_all BOOLEAN DEFAULT 0, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("CREATE TABLE IF NOT EXISTS occlusion_masks (id INTEGER PRIMARY KEY AUTOINCREMENT, note_id INTEGER NOT NULL, card_id INTEGER NOT NULL, ordinal INTEGER NOT NULL, shape TEXT NOT NULL, points TEXT NOT NULL, label TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("CREATE INDEX IF NOT EXISTS idx_occlusion_masks_card_id ON occlusion_masks (card_id)")
+	if err != nil {
+		return err
+	}
+
 	// Add columns to existing databases
 	err = addCardTypeColumn()
 	if err != nil {
@@ -107,10 +164,166 @@ func InitDatabase() error {
 		return err
 	}
 
+	// Add text-to-speech auto-play columns to decks
+	err = addColumnIfMissing("decks", "tts_autoplay_front", "BOOLEAN DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("decks", "tts_autoplay_back", "BOOLEAN DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	// Add learning step columns to decks
+	err = addColumnIfMissing("decks", "learning_steps", fmt.Sprintf("TEXT NOT NULL DEFAULT '%s'", models.DefaultLearningSteps))
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("decks", "relearning_steps", fmt.Sprintf("TEXT NOT NULL DEFAULT '%s'", models.DefaultRelearningSteps))
+	if err != nil {
+		return err
+	}
+
+	// Add card state columns to flashcards. Cards reviewed before states existed are in review.
+	err = addColumnIfMissing("flashcards", "card_state", fmt.Sprintf("TEXT NOT NULL DEFAULT '%s'", models.CardStateNew))
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("flashcards", "learning_step", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("UPDATE flashcards SET card_state = ? WHERE card_state = ? AND NOT (fsrs_stability = 0 AND fsrs_difficulty = 0)",
+		models.CardStateReview, models.CardStateNew)
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("review_logs", "state", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("review_logs", "answer_ms", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("review_logs", "answer_side_ms", "INTEGER")
+	if err != nil {
+		return err
+	}
+
+	// Add daily limit columns to decks
+	err = addColumnIfMissing("decks", "new_cards_per_day", fmt.Sprintf("INTEGER DEFAULT %d", DefaultNewCardsPerDay))
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("decks", "max_reviews_per_day", fmt.Sprintf("INTEGER DEFAULT %d", DefaultMaxReviewsPerDay))
+	if err != nil {
+		return err
+	}
+
+	// Add the scheduler to decks, and the SM-2 and Leitner state to flashcards
+	err = addColumnIfMissing("decks", "scheduler", fmt.Sprintf("TEXT NOT NULL DEFAULT '%s'", models.SchedulerFSRS))
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("flashcards", "ease_factor", "REAL NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("flashcards", "repetitions", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("flashcards", "leitner_box", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("flashcards", "interval_days", "REAL NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	// Add leech detection to decks and flashcards, and the table of AI rewrites suggested for leeches
+	err = addColumnIfMissing("decks", "leech_threshold", fmt.Sprintf("INTEGER NOT NULL DEFAULT %d", models.DefaultLeechThreshold))
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("decks", "leech_action", fmt.Sprintf("TEXT NOT NULL DEFAULT '%s'", models.LeechActionTag))
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("flashcards", "lapses", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("flashcards", "leech", "BOOLEAN NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("flashcards", "suspended", "BOOLEAN NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("flashcards", "buried_until", "DATETIME")
+	if err != nil {
+		return err
+	}
+	// Link rephrased cards to the card they vary, and let decks review a card through its variants in turn
+	err = addColumnIfMissing("flashcards", "parent_card_id", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing("decks", "variant_mode", fmt.Sprintf("TEXT NOT NULL DEFAULT '%s'", VariantModeSeparate))
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.Exec("CREATE TABLE IF NOT EXISTS card_rewrites (card_id INTEGER PRIMARY KEY, front TEXT, back TEXT, pending BOOLEAN NOT NULL DEFAULT 1, created_at DATETIME DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		return err
+	}
+	// Rewrites are generated by an AI job; ones requested before that were lost when the app closed
+	err = addColumnIfMissing("card_rewrites", "job_id", "INTEGER")
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("DELETE FROM card_rewrites WHERE pending AND job_id IS NULL")
+	if err != nil {
+		return err
+	}
+	// Whether a card was suspended by its deck's leech action rather than by hand
+	err = addColumnIfMissing("flashcards", "leech_suspended", "BOOLEAN NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	// What each request to the AI services used and its estimated cost
+	_, err = DB.Exec("CREATE TABLE IF NOT EXISTS ai_usage (id INTEGER PRIMARY KEY AUTOINCREMENT, operation TEXT NOT NULL, model TEXT NOT NULL, prompt_tokens INTEGER NOT NULL DEFAULT 0, completion_tokens INTEGER NOT NULL DEFAULT 0, audio_seconds REAL NOT NULL DEFAULT 0, characters INTEGER NOT NULL DEFAULT 0, cost REAL NOT NULL DEFAULT 0, created_at DATETIME NOT NULL)")
+	if err != nil {
+		return err
+	}
+
+	// Responses of deterministic AI requests, by a hash of the request
+	_, err = DB.Exec("CREATE TABLE IF NOT EXISTS ai_response_cache (key TEXT PRIMARY KEY, operation TEXT NOT NULL, content TEXT NOT NULL, created_at DATETIME NOT NULL, expires_at DATETIME NOT NULL)")
+	if err != nil {
+		return err
+	}
+
+	// Queue of AI requests run in the background, kept across restarts
+	_, err = DB.Exec("CREATE TABLE IF NOT EXISTS ai_jobs (id INTEGER PRIMARY KEY AUTOINCREMENT, kind TEXT NOT NULL, payload TEXT NOT NULL, status TEXT NOT NULL, attempts INTEGER NOT NULL DEFAULT 0, result TEXT, error TEXT, run_after DATETIME NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func Card(deckId int, cardId int) (models.FlashcardModel, error) {
+	return CardContext(context.Background(), deckId, cardId)
+}
+
+// CardContext is Card with a context that can cancel the query
+func CardContext(ctx context.Context, deckId int, cardId int) (models.FlashcardModel, error) {
 	if err := Init(); err != nil {
 		return models.FlashcardModel{}, err
 	}
@@ -133,14 +346,23 @@ func Card(deckId int, cardId int) (models.FlashcardModel, error) {
 		return models.FlashcardModel{}, err
 	}
 
-	// Include last_reviewed in the query
-	results := DB.QueryRow("SELECT id, front, back, deck_id, created_at, updated_at, fsrs_stability, fsrs_difficulty, schedule_due, card_type, last_reviewed, source FROM flashcards WHERE deck_id = ? AND id = ?", deckId, cardId)
+	return scanCard(DB.QueryRowContext(ctx, "SELECT "+cardColumns+" FROM flashcards WHERE deck_id = ? AND id = ?", deckId, cardId))
+}
+
+// cardColumns lists the columns read by scanCard, in order
+const cardColumns = `id, front, back, deck_id, created_at, updated_at, fsrs_stability, fsrs_difficulty,
+	schedule_due, card_type, last_reviewed, source, card_state, learning_step, ease_factor, repetitions, leitner_box, interval_days, lapses, leech, suspended, buried_until, parent_card_id`
 
+// scanCard reads a row selected with cardColumns into a FlashcardModel, applying defaults for null values
+func scanCard(row rowScanner) (models.FlashcardModel, error) {
 	card := models.FlashcardModel{}
 	var cardType sql.NullString
 	var lastReviewed sql.NullString
 	var source sql.NullString
-	err = results.Scan(&card.ID, &card.Front, &card.Back, &card.DeckId, &card.CreatedAt, &card.UpdatedAt, &card.FSRSStability, &card.FSRSDifficulty, &card.DueDate, &cardType, &lastReviewed, &source)
+	var buriedUntil sql.NullString
+	var parentCardId sql.NullInt64
+	err := row.Scan(&card.ID, &card.Front, &card.Back, &card.DeckId, &card.CreatedAt, &card.UpdatedAt, &card.FSRSStability, &card.FSRSDifficulty, &card.DueDate, &cardType, &lastReviewed, &source, &card.State, &card.Step,
+		&card.EaseFactor, &card.Repetitions, &card.LeitnerBox, &card.IntervalDays, &card.Lapses, &card.Leech, &card.Suspended, &buriedUntil, &parentCardId)
 	if err != nil {
 		return models.FlashcardModel{}, err
 	}
@@ -157,6 +379,15 @@ func Card(deckId int, cardId int) (models.FlashcardModel, error) {
 		card.LastReviewed = &lastReviewed.String
 	}
 
+	if buriedUntil.Valid {
+		card.BuriedUntil = &buriedUntil.String
+	}
+
+	if parentCardId.Valid {
+		parent := int(parentCardId.Int64)
+		card.ParentCardId = &parent
+	}
+
 	// Set Source if not null
 	if source.Valid {
 		card.Source = source.String
@@ -167,6 +398,21 @@ func Card(deckId int, cardId int) (models.FlashcardModel, error) {
 	return card, nil
 }
 
+// scanCards reads every row selected with cardColumns
+func scanCards(results *sql.Rows) ([]models.FlashcardModel, error) {
+	defer results.Close()
+
+	cards := []models.FlashcardModel{}
+	for results.Next() {
+		card, err := scanCard(results)
+		if err != nil {
+			return []models.FlashcardModel{}, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, results.Err()
+}
+
 func UpdateCard(card models.FlashcardModel) (models.FlashcardModel, error) {
 	if err := Init(); err != nil {
 		return models.FlashcardModel{}, err
@@ -200,6 +446,11 @@ func UpdateCard(card models.FlashcardModel) (models.FlashcardModel, error) {
 }
 
 func Cards(deckId int) ([]models.FlashcardModel, error) {
+	return CardsContext(context.Background(), deckId)
+}
+
+// CardsContext is Cards with a context that can cancel the query
+func CardsContext(ctx context.Context, deckId int) ([]models.FlashcardModel, error) {
 	if err := Init(); err != nil {
 		return []models.FlashcardModel{}, err
 	}
@@ -222,48 +473,19 @@ func Cards(deckId int) ([]models.FlashcardModel, error) {
 		return []models.FlashcardModel{}, err
 	}
 
-	results, err := DB.Query("SELECT id, front, back, deck_id, created_at, updated_at, fsrs_stability, fsrs_difficulty, schedule_due, card_type, last_reviewed, source FROM flashcards WHERE deck_id = ?", deckId)
+	results, err := DB.QueryContext(ctx, "SELECT "+cardColumns+" FROM flashcards WHERE deck_id = ?", deckId)
 	if err != nil {
 		return []models.FlashcardModel{}, err
 	}
-	defer results.Close()
-	cards := []models.FlashcardModel{}
-	for results.Next() {
-		card := models.FlashcardModel{}
-		var cardType sql.NullString
-		var lastReviewed sql.NullString
-		var source sql.NullString
-
-		err = results.Scan(&card.ID, &card.Front, &card.Back, &card.DeckId, &card.CreatedAt, &card.UpdatedAt, &card.FSRSStability, &card.FSRSDifficulty, &card.DueDate, &cardType, &lastReviewed, &source)
-		if err != nil {
-			return []models.FlashcardModel{}, err
-		}
-
-		// Set default card type if null
-		if cardType.Valid {
-			card.CardType = cardType.String
-		} else {
-			card.CardType = "standard"
-		}
-
-		// Set LastReviewed if not null
-		if lastReviewed.Valid {
-			card.LastReviewed = &lastReviewed.String
-		}
-
-		// Set Source if not null
-		if source.Valid {
-			card.Source = source.String
-		} else {
-			card.Source = "unspecified"
-		}
-
-		cards = append(cards, card)
-	}
-	return cards, nil
+	return scanCards(results)
 }
 
 func CreateCard(card models.FlashcardModel) (models.FlashcardModel, error) {
+	return CreateCardContext(context.Background(), card)
+}
+
+// CreateCardContext is CreateCard with a context that can cancel the insert
+func CreateCardContext(ctx context.Context, card models.FlashcardModel) (models.FlashcardModel, error) {
 	if err := Init(); err != nil {
 		return models.FlashcardModel{}, err
 	}
@@ -280,6 +502,16 @@ func CreateCard(card models.FlashcardModel) (models.FlashcardModel, error) {
 		return models.FlashcardModel{}, err
 	}
 
+	cardId, err := insertCard(ctx, DB, card)
+	if err != nil {
+		return models.FlashcardModel{}, err
+	}
+
+	return CardContext(ctx, card.DeckId, cardId)
+}
+
+// insertCard adds a card and returns its id
+func insertCard(ctx context.Context, db execer, card models.FlashcardModel) (int, error) {
 	// If card type is not specified, default to "standard"
 	if card.CardType == "" {
 		card.CardType = "standard"
@@ -290,46 +522,78 @@ func CreateCard(card models.FlashcardModel) (models.FlashcardModel, error) {
 		card.Source = "manual"
 	}
 
-	result, err := DB.Exec("INSERT INTO flashcards (front, back, deck_id, card_type, source, created_at, updated_at) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
-		card.Front, card.Back, card.DeckId, card.CardType, card.Source)
+	result, err := db.ExecContext(ctx, "INSERT INTO flashcards (front, back, deck_id, card_type, source, parent_card_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+		card.Front, card.Back, card.DeckId, card.CardType, card.Source, card.ParentCardId)
 	if err != nil {
-		return models.FlashcardModel{}, err
+		return 0, err
 	}
 
 	cardId, err := result.LastInsertId()
 	if err != nil {
-		return models.FlashcardModel{}, err
+		return 0, err
 	}
+	return int(cardId), nil
+}
 
-	return Card(card.DeckId, int(cardId))
+// deckColumns lists the columns read by scanDeck, in order
+const deckColumns = `id, name, description, purpose, enable_auto_rephrase,
+	enable_initialism_swap, max_rephrased_cards, tts_autoplay_front, tts_autoplay_back,
+	scheduler, leech_threshold, leech_action, variant_mode, learning_steps, relearning_steps, new_cards_per_day, max_reviews_per_day, created_at, updated_at`
+
+// Daily limits for decks created before the limits were configurable
+const (
+	DefaultNewCardsPerDay   = 20
+	DefaultMaxReviewsPerDay = 200
+)
+
+// DefaultMaxRephrasedCards is how many variants auto-rephrase gives a card in decks that haven't set a number
+const DefaultMaxRephrasedCards = 3
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func Deck(deckId int) (DeckModel, error) {
-	if err := Init(); err != nil {
-		return DeckModel{}, err
-	}
+// execer is implemented by both *sql.DB and *sql.Tx, so statements can run inside or outside a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
 
-	// Check if rephrasing settings columns exist and add them if they don't
-	err := addDeckRephraseSettingsColumns()
+// inTransaction runs fn in a transaction, committing if it succeeds and rolling back if it fails
+func inTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := DB.Begin()
 	if err != nil {
-		return DeckModel{}, err
+		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
 
-	// Update the SQL query to include the new columns
-	result := DB.QueryRow(`
-		SELECT id, name, description, purpose, enable_auto_rephrase, 
-		enable_initialism_swap, max_rephrased_cards, created_at, updated_at 
-		FROM decks WHERE id = ?
-	`, deckId)
-
+// scanDeck reads a row selected with deckColumns into a DeckModel, applying defaults for null values
+func scanDeck(row rowScanner) (DeckModel, error) {
 	deck := DeckModel{}
 	var enableAutoRephrase sql.NullBool
 	var enableInitialismSwap sql.NullBool
 	var maxRephrasedCards sql.NullInt64
+	var ttsAutoPlayFront sql.NullBool
+	var ttsAutoPlayBack sql.NullBool
+	var newCardsPerDay sql.NullInt64
+	var maxReviewsPerDay sql.NullInt64
 
-	err = result.Scan(
+	err := row.Scan(
 		&deck.ID, &deck.Name, &deck.Description, &deck.Purpose,
 		&enableAutoRephrase, &enableInitialismSwap, &maxRephrasedCards,
+		&ttsAutoPlayFront, &ttsAutoPlayBack,
+		&deck.Scheduler, &deck.LeechThreshold, &deck.LeechAction, &deck.VariantMode, &deck.LearningSteps, &deck.RelearningSteps,
+		&newCardsPerDay, &maxReviewsPerDay,
 		&deck.CreatedAt, &deck.UpdatedAt,
 	)
 	if err != nil {
@@ -337,27 +601,34 @@ func Deck(deckId int) (DeckModel, error) {
 	}
 
 	// Set defaults for null values
-	if enableAutoRephrase.Valid {
-		deck.EnableAutoRephrase = enableAutoRephrase.Bool
-	} else {
-		deck.EnableAutoRephrase = false
-	}
-
-	if enableInitialismSwap.Valid {
-		deck.EnableInitialismSwap = enableInitialismSwap.Bool
-	} else {
-		deck.EnableInitialismSwap = false
-	}
+	deck.EnableAutoRephrase = enableAutoRephrase.Valid && enableAutoRephrase.Bool
+	deck.EnableInitialismSwap = enableInitialismSwap.Valid && enableInitialismSwap.Bool
+	deck.TTSAutoPlayFront = ttsAutoPlayFront.Valid && ttsAutoPlayFront.Bool
+	deck.TTSAutoPlayBack = ttsAutoPlayBack.Valid && ttsAutoPlayBack.Bool
 
 	if maxRephrasedCards.Valid {
 		deck.MaxRephrasedCards = int(maxRephrasedCards.Int64)
 	} else {
-		deck.MaxRephrasedCards = 3 // Default value
+		deck.MaxRephrasedCards = DefaultMaxRephrasedCards
 	}
 
+	deck.NewCardsPerDay = DefaultNewCardsPerDay
+	if newCardsPerDay.Valid {
+		deck.NewCardsPerDay = int(newCardsPerDay.Int64)
+	}
+	deck.MaxReviewsPerDay = DefaultMaxReviewsPerDay
+	if maxReviewsPerDay.Valid {
+		deck.MaxReviewsPerDay = int(maxReviewsPerDay.Int64)
+	}
+
+	return deck, nil
+}
+
+// loadDeckStats fills in the card count and last review time of a deck
+func loadDeckStats(deck *DeckModel) {
 	// Count cards for this deck
 	var cardCount int
-	countErr := DB.QueryRow("SELECT COUNT(*) FROM flashcards WHERE deck_id = ?", deckId).Scan(&cardCount)
+	countErr := DB.QueryRow("SELECT COUNT(*) FROM flashcards WHERE deck_id = ?", deck.ID).Scan(&cardCount)
 	if countErr == nil {
 		deck.CardCount = cardCount
 	}
@@ -368,12 +639,35 @@ func Deck(deckId int) (DeckModel, error) {
 		SELECT last_reviewed FROM flashcards 
 		WHERE deck_id = ? AND last_reviewed IS NOT NULL 
 		ORDER BY last_reviewed DESC LIMIT 1
-	`, deckId).Scan(&lastReviewed)
+	`, deck.ID).Scan(&lastReviewed)
 
 	if lastReviewedErr == nil && lastReviewed.Valid {
 		deck.LastReviewed = &lastReviewed.String
 	}
+}
+
+func Deck(deckId int) (DeckModel, error) {
+	return DeckContext(context.Background(), deckId)
+}
+
+// DeckContext is Deck with a context that can cancel the query
+func DeckContext(ctx context.Context, deckId int) (DeckModel, error) {
+	if err := Init(); err != nil {
+		return DeckModel{}, err
+	}
+
+	// Check if rephrasing settings columns exist and add them if they don't
+	err := addDeckRephraseSettingsColumns()
+	if err != nil {
+		return DeckModel{}, err
+	}
 
+	deck, err := scanDeck(DB.QueryRowContext(ctx, "SELECT "+deckColumns+" FROM decks WHERE id = ?", deckId))
+	if err != nil {
+		return DeckModel{}, err
+	}
+
+	loadDeckStats(&deck)
 	return deck, nil
 }
 
@@ -388,12 +682,7 @@ func Decks() ([]DeckModel, error) {
 		return []DeckModel{}, err
 	}
 
-	// Update the SQL query to include the new columns
-	results, err := DB.Query(`
-		SELECT id, name, description, purpose, enable_auto_rephrase, 
-		enable_initialism_swap, max_rephrased_cards, created_at, updated_at 
-		FROM decks
-	`)
+	results, err := DB.Query("SELECT " + deckColumns + " FROM decks")
 	if err != nil {
 		return []DeckModel{}, err
 	}
@@ -401,60 +690,18 @@ func Decks() ([]DeckModel, error) {
 
 	decks := []DeckModel{}
 	for results.Next() {
-		deck := DeckModel{}
-		var enableAutoRephrase sql.NullBool
-		var enableInitialismSwap sql.NullBool
-		var maxRephrasedCards sql.NullInt64
-
-		err = results.Scan(
-			&deck.ID, &deck.Name, &deck.Description, &deck.Purpose,
-			&enableAutoRephrase, &enableInitialismSwap, &maxRephrasedCards,
-			&deck.CreatedAt, &deck.UpdatedAt,
-		)
+		deck, err := scanDeck(results)
 		if err != nil {
 			return []DeckModel{}, err
 		}
-
-		// Set defaults for null values
-		if enableAutoRephrase.Valid {
-			deck.EnableAutoRephrase = enableAutoRephrase.Bool
-		} else {
-			deck.EnableAutoRephrase = false
-		}
-
-		if enableInitialismSwap.Valid {
-			deck.EnableInitialismSwap = enableInitialismSwap.Bool
-		} else {
-			deck.EnableInitialismSwap = false
-		}
-
-		if maxRephrasedCards.Valid {
-			deck.MaxRephrasedCards = int(maxRephrasedCards.Int64)
-		} else {
-			deck.MaxRephrasedCards = 3 // Default value
-		}
-
-		// Count cards for this deck
-		var cardCount int
-		countErr := DB.QueryRow("SELECT COUNT(*) FROM flashcards WHERE deck_id = ?", deck.ID).Scan(&cardCount)
-		if countErr == nil {
-			deck.CardCount = cardCount
-		}
-
-		// Get the last reviewed date for this deck (most recent card review)
-		var lastReviewed sql.NullString
-		lastReviewedErr := DB.QueryRow(`
-			SELECT last_reviewed FROM flashcards 
-			WHERE deck_id = ? AND last_reviewed IS NOT NULL 
-			ORDER BY last_reviewed DESC LIMIT 1
-		`, deck.ID).Scan(&lastReviewed)
-
-		if lastReviewedErr == nil && lastReviewed.Valid {
-			deck.LastReviewed = &lastReviewed.String
-		}
-
 		decks = append(decks, deck)
 	}
+
+	// Stats are loaded after the rows are closed so the queries don't need a second connection
+	results.Close()
+	for i := range decks {
+		loadDeckStats(&decks[i])
+	}
 	return decks, nil
 }
 
@@ -558,13 +805,97 @@ func UpdateDeckWithRephraseSettings(deckId int, name string, description string,
 	return Deck(deckId)
 }
 
+// UpdateDeckTTSSettings sets whether card fronts and backs are read aloud during review
+func UpdateDeckTTSSettings(deckId int, autoPlayFront bool, autoPlayBack bool) (DeckModel, error) {
+	if err := Init(); err != nil {
+		return DeckModel{}, err
+	}
+
+	_, err := DB.Exec("UPDATE decks SET tts_autoplay_front = ?, tts_autoplay_back = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		autoPlayFront, autoPlayBack, deckId)
+	if err != nil {
+		return DeckModel{}, err
+	}
+
+	return Deck(deckId)
+}
+
+// UpdateDeckLimits sets how many new cards are introduced and how many reviews are shown per day
+func UpdateDeckLimits(deckId int, newCardsPerDay int, maxReviewsPerDay int) (DeckModel, error) {
+	if err := Init(); err != nil {
+		return DeckModel{}, err
+	}
+
+	_, err := DB.Exec("UPDATE decks SET new_cards_per_day = ?, max_reviews_per_day = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		newCardsPerDay, maxReviewsPerDay, deckId)
+	if err != nil {
+		return DeckModel{}, err
+	}
+
+	return Deck(deckId)
+}
+
+// UpdateDeckLearningSteps sets the learning and relearning steps of a deck, e.g. "1m 10m"
+func UpdateDeckLearningSteps(deckId int, learningSteps string, relearningSteps string) (DeckModel, error) {
+	if err := Init(); err != nil {
+		return DeckModel{}, err
+	}
+
+	_, err := DB.Exec("UPDATE decks SET learning_steps = ?, relearning_steps = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		learningSteps, relearningSteps, deckId)
+	if err != nil {
+		return DeckModel{}, err
+	}
+
+	return Deck(deckId)
+}
+
+// UpdateDeckLeechSettings sets how many lapses make a card a leech and what is done with it
+func UpdateDeckLeechSettings(deckId int, threshold int, action string) (DeckModel, error) {
+	if err := Init(); err != nil {
+		return DeckModel{}, err
+	}
+
+	_, err := DB.Exec("UPDATE decks SET leech_threshold = ?, leech_action = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", threshold, action, deckId)
+	if err != nil {
+		return DeckModel{}, err
+	}
+
+	return Deck(deckId)
+}
+
 func DeleteDeck(deckId int) error {
 	if err := Init(); err != nil {
 		return err
 	}
 
+	// Detach media from the deck's cards; the files are removed by media garbage collection
+	_, err := DB.Exec("DELETE FROM card_media WHERE card_id IN (SELECT id FROM flashcards WHERE deck_id = ?)", deckId)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.Exec("DELETE FROM occlusion_masks WHERE note_id IN (SELECT id FROM occlusion_notes WHERE deck_id = ?)", deckId)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("DELETE FROM occlusion_notes WHERE deck_id = ?", deckId)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.Exec("DELETE FROM review_logs WHERE deck_id = ?", deckId)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.Exec("DELETE FROM card_rewrites WHERE card_id IN (SELECT id FROM flashcards WHERE deck_id = ?)", deckId)
+	if err != nil {
+		return err
+	}
+
 	// First delete all flashcards associated with the deck
-	_, err := DB.Exec("DELETE FROM flashcards WHERE deck_id = ?", deckId)
+	_, err = DB.Exec("DELETE FROM flashcards WHERE deck_id = ?", deckId)
 	if err != nil {
 		return err
 	}
@@ -578,7 +909,9 @@ func DeleteDeck(deckId int) error {
 	return nil
 }
 
-func GetDueCards(deckId int) ([]models.FlashcardModel, error) {
+// GetDueCards returns every card in a deck due at now, whatever its state and ignoring daily limits,
+// except suspended and buried cards
+func GetDueCards(deckId int, now time.Time) ([]models.FlashcardModel, error) {
 	if err := Init(); err != nil {
 		return []models.FlashcardModel{}, err
 	}
@@ -601,88 +934,150 @@ func GetDueCards(deckId int) ([]models.FlashcardModel, error) {
 		return []models.FlashcardModel{}, err
 	}
 
-	results, err := DB.Query("SELECT id, front, back, deck_id, created_at, updated_at, fsrs_stability, fsrs_difficulty, schedule_due, card_type, last_reviewed, source FROM flashcards WHERE deck_id = ? AND schedule_due <= datetime('now')", deckId)
+	results, err := DB.Query("SELECT "+cardColumns+" FROM flashcards WHERE deck_id = ? AND "+studyableCardCondition+" AND datetime(schedule_due) <= datetime(?)",
+		deckId, now.UTC().Format(sqliteTimeLayout), now.UTC().Format(sqliteTimeLayout))
 	if err != nil {
 		return []models.FlashcardModel{}, err
 	}
-	defer results.Close()
-	cards := []models.FlashcardModel{}
-	for results.Next() {
-		card := models.FlashcardModel{}
-		var cardType sql.NullString
-		var lastReviewed sql.NullString
-		var source sql.NullString
+	return scanCards(results)
+}
 
-		err = results.Scan(&card.ID, &card.Front, &card.Back, &card.DeckId, &card.CreatedAt, &card.UpdatedAt, &card.FSRSStability, &card.FSRSDifficulty, &card.DueDate, &cardType, &lastReviewed, &source)
-		if err != nil {
-			return []models.FlashcardModel{}, err
-		}
+// ReviewCard stores the new schedule of a card reviewed at now and records the review, with how long it took, in the review log
+func ReviewCard(deckId int, cardId int, grade int, schedule models.CardSchedule, now time.Time, timing models.ReviewTiming) error {
+	if err := Init(); err != nil {
+		return err
+	}
+	// Verify the card exists
+	card, err := Card(deckId, cardId)
+	if err != nil {
+		return err
+	}
 
-		// Set default card type if null
-		if cardType.Valid {
-			card.CardType = cardType.String
-		} else {
-			card.CardType = "standard"
-		}
+	now = now.UTC()
+	nowStr := now.Format(time.RFC3339)
+	scheduledDue := now
+	if schedule.IntervalDays > 0 {
+		// Learning steps are minutes long, so keep the fractional part of the interval down to the second
+		scheduledDue = now.Add(time.Duration(schedule.IntervalDays * 24 * float64(time.Hour))).Truncate(time.Second)
+	}
+
+	// Update the card with its new state, memory, due date, and last reviewed timestamp
+	_, err = DB.Exec("UPDATE flashcards SET card_state = ?, learning_step = ?, fsrs_stability = ?, fsrs_difficulty = ?, ease_factor = ?, repetitions = ?, leitner_box = ?, interval_days = ?, lapses = ?, schedule_due = ?, last_reviewed = ?, updated_at = ? WHERE id = ? AND deck_id = ?",
+		schedule.State, schedule.Step, schedule.Stability, schedule.Difficulty, schedule.EaseFactor, schedule.Repetitions, schedule.LeitnerBox, schedule.IntervalDays, schedule.Lapses,
+		scheduledDue.Format(time.RFC3339), nowStr, nowStr, cardId, deckId)
+	if err != nil {
+		return err
+	}
+
+	return logReview(models.ReviewLogModel{
+		CardId:       cardId,
+		DeckId:       deckId,
+		Grade:        grade,
+		WasNew:       card.State == models.CardStateNew,
+		State:        card.State,
+		Stability:    schedule.Stability,
+		Difficulty:   schedule.Difficulty,
+		IntervalDays: schedule.IntervalDays,
+		AnswerMs:     timing.AnswerMs,
+		AnswerSideMs: timing.AnswerSideMs,
+		ReviewedAt:   nowStr,
+	})
+}
 
-		// Set LastReviewed if not null
-		if lastReviewed.Valid {
-			card.LastReviewed = &lastReviewed.String
+// MigrateDeckScheduler switches a deck to another scheduler, storing each card's state as converted by migrate.
+// Due dates are kept and nothing is logged, as a migration isn't a review. The cards and the deck are updated in one
+// transaction, so a failure leaves the deck on its old scheduler with its cards untouched.
+func MigrateDeckScheduler(deckId int, scheduler string, migrate func(models.FlashcardModel) models.CardSchedule) (DeckModel, error) {
+	if err := Init(); err != nil {
+		return DeckModel{}, err
+	}
+
+	err := inTransaction(func(tx *sql.Tx) error {
+		ctx := context.Background()
+		results, err := tx.QueryContext(ctx, "SELECT "+cardColumns+" FROM flashcards WHERE deck_id = ?", deckId)
+		if err != nil {
+			return err
+		}
+		cards, err := scanCards(results)
+		if err != nil {
+			return err
 		}
 
-		// Set Source if not null
-		if source.Valid {
-			card.Source = source.String
-		} else {
-			card.Source = "unspecified"
+		for _, card := range cards {
+			schedule := migrate(card)
+			_, err := tx.ExecContext(ctx, "UPDATE flashcards SET card_state = ?, learning_step = ?, fsrs_stability = ?, fsrs_difficulty = ?, ease_factor = ?, repetitions = ?, leitner_box = ?, interval_days = ? WHERE id = ?",
+				schedule.State, schedule.Step, schedule.Stability, schedule.Difficulty, schedule.EaseFactor, schedule.Repetitions, schedule.LeitnerBox, schedule.IntervalDays, card.ID)
+			if err != nil {
+				return fmt.Errorf("failed to migrate flashcard %d: %v", card.ID, err)
+			}
 		}
 
-		cards = append(cards, card)
+		_, err = tx.ExecContext(ctx, "UPDATE decks SET scheduler = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", scheduler, deckId)
+		return err
+	})
+	if err != nil {
+		return DeckModel{}, err
 	}
-	return cards, nil
+
+	return Deck(deckId)
 }
 
-func ReviewCard(deckId int, cardId int, stability float64, difficulty float64, daysTillDue float64) error {
+func DeleteCard(cardId int) error {
 	if err := Init(); err != nil {
 		return err
 	}
-	// Verify the card exists
-	_, err := Card(deckId, cardId)
+
+	return inTransaction(func(tx *sql.Tx) error {
+		return deleteCard(context.Background(), tx, cardId)
+	})
+}
+
+// deleteCard removes a card with its variants and everything attached to it
+func deleteCard(ctx context.Context, db execer, cardId int) error {
+	// Rephrasings only exist to vary the card, so they go with it
+	results, err := db.QueryContext(ctx, "SELECT id FROM flashcards WHERE parent_card_id = ?", cardId)
 	if err != nil {
 		return err
 	}
+	var variantIds []int
+	for results.Next() {
+		var id int
+		if err := results.Scan(&id); err != nil {
+			results.Close()
+			return err
+		}
+		variantIds = append(variantIds, id)
+	}
+	results.Close()
+	for _, variantId := range variantIds {
+		if err := deleteCard(ctx, db, variantId); err != nil {
+			return err
+		}
+	}
 
-	now := time.Now().UTC()
-	nowStr := now.Format(time.RFC3339)
-	var scheduledDue time.Time
-
-	if daysTillDue <= 0 {
-		// For "Again" grade, schedule for immediate review
-		scheduledDue = now
-	} else {
-		// Convert days to duration including fractional parts
-		hours := daysTillDue * 24
-		minutes := (hours - float64(int(hours))) * 60
-		duration := time.Duration(int(hours))*time.Hour + time.Duration(int(minutes))*time.Minute
-		scheduledDue = now.Add(duration)
+	_, err = db.ExecContext(ctx, "DELETE FROM flashcards WHERE id = ?", cardId)
+	if err != nil {
+		return err
 	}
 
-	// Update the card with new stability, difficulty, due date, and last reviewed timestamp
-	_, err = DB.Exec("UPDATE flashcards SET fsrs_stability = ?, fsrs_difficulty = ?, schedule_due = ?, last_reviewed = ?, updated_at = ? WHERE id = ? AND deck_id = ?",
-		stability, difficulty, scheduledDue.Format(time.RFC3339), nowStr, nowStr, cardId, deckId)
+	// Detach the card's media; the files are removed by media garbage collection
+	_, err = db.ExecContext(ctx, "DELETE FROM card_media WHERE card_id = ?", cardId)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	_, err = db.ExecContext(ctx, "DELETE FROM review_logs WHERE card_id = ?", cardId)
+	if err != nil {
+		return err
+	}
 
-func DeleteCard(cardId int) error {
-	if err := Init(); err != nil {
+	_, err = db.ExecContext(ctx, "DELETE FROM card_rewrites WHERE card_id = ?", cardId)
+	if err != nil {
 		return err
 	}
 
-	_, err := DB.Exec("DELETE FROM flashcards WHERE id = ?", cardId)
+	// Drop the card's occlusion mask; a note left without masks is removed by media garbage collection
+	_, err = db.ExecContext(ctx, "DELETE FROM occlusion_masks WHERE card_id = ?", cardId)
 	if err != nil {
 		return err
 	}
@@ -811,43 +1206,79 @@ func addDeckRephraseSettingsColumns() error {
 	return nil
 }
 
-// SaveOpenAIKey saves the OpenAI API key to the database
-func SaveOpenAIKey(apiKey string) error {
+// addColumnIfMissing adds a column to a table if it doesn't exist yet
+func addColumnIfMissing(table string, column string, definition string) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		_, err = DB.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveSetting stores a value in the settings table, replacing any existing value for the key
+func SaveSetting(key string, value string) error {
 	if err := Init(); err != nil {
 		return err
 	}
 
 	// Check if the key already exists
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM settings WHERE key = 'openai_api_key'").Scan(&count)
+	err := DB.QueryRow("SELECT COUNT(*) FROM settings WHERE key = ?", key).Scan(&count)
 	if err != nil {
 		return err
 	}
 
 	// If the key exists, update it, otherwise insert it
 	if count > 0 {
-		_, err = DB.Exec("UPDATE settings SET value = ?, updated_at = CURRENT_TIMESTAMP WHERE key = 'openai_api_key'", apiKey)
+		_, err = DB.Exec("UPDATE settings SET value = ?, updated_at = CURRENT_TIMESTAMP WHERE key = ?", value, key)
 	} else {
-		_, err = DB.Exec("INSERT INTO settings (key, value, created_at, updated_at) VALUES ('openai_api_key', ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)", apiKey)
+		_, err = DB.Exec("INSERT INTO settings (key, value, created_at, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)", key, value)
 	}
 
 	return err
 }
 
-// GetOpenAIKey retrieves the OpenAI API key from the database
-func GetOpenAIKey() (string, error) {
+// GetSetting retrieves a value from the settings table, returning an empty string if the key is not set
+func GetSetting(key string) (string, error) {
+	return GetSettingContext(context.Background(), key)
+}
+
+// GetSettingContext is GetSetting with a context that can cancel the query
+func GetSettingContext(ctx context.Context, key string) (string, error) {
 	if err := Init(); err != nil {
 		return "", err
 	}
 
-	var apiKey string
-	err := DB.QueryRow("SELECT value FROM settings WHERE key = 'openai_api_key'").Scan(&apiKey)
+	var value sql.NullString
+	err := DB.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = ?", key).Scan(&value)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", nil // No key found, return empty string
+			return "", nil // No value found, return empty string
 		}
 		return "", err
 	}
 
-	return apiKey, nil
+	return value.String, nil
+}
+
+// SaveOpenAIKey saves the OpenAI API key to the database
+func SaveOpenAIKey(apiKey string) error {
+	return SaveSetting("openai_api_key", apiKey)
+}
+
+// GetOpenAIKey retrieves the OpenAI API key from the database
+func GetOpenAIKey() (string, error) {
+	return GetSetting("openai_api_key")
 }
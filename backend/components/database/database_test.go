@@ -0,0 +1,131 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// useTestDatabase points the database at an empty file for the rest of the test
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+
+	if err := Open(filepath.Join(t.TempDir(), "bcards.db")); err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { DB.Close() })
+}
+
+// createReviewCards creates a deck with a review card due at each of the given times
+func createReviewCards(t *testing.T, due ...time.Time) (DeckModel, []models.FlashcardModel) {
+	t.Helper()
+
+	deck, err := CreateDeck("Test Deck", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create deck: %v", err)
+	}
+
+	cards := make([]models.FlashcardModel, len(due))
+	for i := range due {
+		cards[i], err = CreateCard(models.FlashcardModel{DeckId: deck.ID, Front: "Front", Back: "Back"})
+		if err != nil {
+			t.Fatalf("Failed to create card: %v", err)
+		}
+		schedule := models.CardSchedule{State: models.CardStateReview, Stability: 10, Difficulty: 5, IntervalDays: 10}
+		if err := RescheduleCard(cards[i].ID, schedule, due[i]); err != nil {
+			t.Fatalf("Failed to reschedule card: %v", err)
+		}
+	}
+	return deck, cards
+}
+
+// cardIds returns the ids of cards
+func cardIds(cards []models.FlashcardModel) []int {
+	ids := make([]int, len(cards))
+	for i, card := range cards {
+		ids[i] = card.ID
+	}
+	return ids
+}
+
+func sameIds(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetDueCardsAcrossMidnight(t *testing.T) {
+	useTestDatabase(t)
+
+	midnight := time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC)
+	deck, cards := createReviewCards(t, midnight.Add(-time.Second), midnight, midnight.Add(time.Second))
+
+	cases := []struct {
+		now  time.Time
+		want []int
+	}{
+		{midnight.Add(-time.Minute), nil},
+		{midnight.Add(-time.Second), cardIds(cards[:1])},
+		{midnight, cardIds(cards[:2])},
+		{midnight.Add(time.Second), cardIds(cards)},
+		// The same instants given in another zone
+		{midnight.In(time.FixedZone("UTC+2", 2*60*60)), cardIds(cards[:2])},
+		{midnight.Add(-time.Second).In(time.FixedZone("UTC-7", -7*60*60)), cardIds(cards[:1])},
+	}
+	for _, tc := range cases {
+		due, err := GetDueCards(deck.ID, tc.now)
+		if err != nil {
+			t.Fatalf("Failed to get due cards: %v", err)
+		}
+		if ids := cardIds(due); !sameIds(ids, tc.want) {
+			t.Errorf("At %v: expected %v to be due, got %v", tc.now, tc.want, ids)
+		}
+	}
+}
+
+func TestBuriedCardsReturnAtStudyDayStart(t *testing.T) {
+	useTestDatabase(t)
+
+	// Buried late in the evening until the next study day, which starts at 04:00
+	evening := time.Date(2024, 5, 10, 23, 30, 0, 0, time.UTC)
+	dayStart := time.Date(2024, 5, 11, 4, 0, 0, 0, time.UTC)
+	deck, cards := createReviewCards(t, evening.Add(-time.Hour), evening.Add(-time.Hour))
+	if err := BuryCard(cards[0].ID, dayStart); err != nil {
+		t.Fatalf("Failed to bury card: %v", err)
+	}
+
+	cases := []struct {
+		now  time.Time
+		want []int
+	}{
+		{evening, cardIds(cards[1:])},
+		{time.Date(2024, 5, 11, 0, 30, 0, 0, time.UTC), cardIds(cards[1:])},
+		{dayStart.Add(-time.Second), cardIds(cards[1:])},
+		{dayStart, cardIds(cards)},
+	}
+	for _, tc := range cases {
+		due, err := GetDueCards(deck.ID, tc.now)
+		if err != nil {
+			t.Fatalf("Failed to get due cards: %v", err)
+		}
+		if ids := cardIds(due); !sameIds(ids, tc.want) {
+			t.Errorf("At %v: expected %v to be due, got %v", tc.now, tc.want, ids)
+		}
+
+		reviews, err := DueReviewCards(deck.ID, tc.now, 10)
+		if err != nil {
+			t.Fatalf("Failed to get due reviews: %v", err)
+		}
+		if ids := cardIds(reviews); !sameIds(ids, tc.want) {
+			t.Errorf("At %v: expected %v to be due for review, got %v", tc.now, tc.want, ids)
+		}
+	}
+}
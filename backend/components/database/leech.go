@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// MarkLeech flags a card as a leech, also suspending it when suspend is set. A card the user had already
+// suspended isn't recorded as suspended by the leech action, so clearing the leech keeps it suspended.
+func MarkLeech(cardId int, suspend bool) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("UPDATE flashcards SET leech = 1, leech_suspended = leech_suspended OR (? AND NOT suspended), suspended = suspended OR ? WHERE id = ?",
+		suspend, suspend, cardId)
+	return err
+}
+
+// ClearLeech removes a card's leech flag and undoes the suspension the leech action applied, if any.
+// Its lapses are kept.
+func ClearLeech(cardId int) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("UPDATE flashcards SET leech = 0, suspended = suspended AND NOT leech_suspended, leech_suspended = 0 WHERE id = ?", cardId)
+	return err
+}
+
+// Leeches returns the leeches of a deck, most lapses first, with any rewrite suggested for them
+func Leeches(deckId int) ([]models.LeechModel, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query("SELECT "+cardColumns+" FROM flashcards WHERE deck_id = ? AND leech ORDER BY lapses DESC, id", deckId)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := scanCards(results)
+	if err != nil {
+		return nil, err
+	}
+
+	leeches := []models.LeechModel{}
+	for _, card := range cards {
+		leech := models.LeechModel{Card: card}
+		leech.RewriteFront, leech.RewriteBack, leech.RewritePending, err = CardRewrite(card.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		leeches = append(leeches, leech)
+	}
+	return leeches, nil
+}
+
+// QueueCardRewrite queues an AI job that rewrites a card and records that its rewrite is pending, replacing
+// any earlier suggestion. Both are saved in one transaction, so the job always finds its rewrite pending.
+func QueueCardRewrite(cardId int, kind string, payload string, now time.Time) (models.AIJobModel, error) {
+	if err := Init(); err != nil {
+		return models.AIJobModel{}, err
+	}
+
+	var jobId int
+	err := inTransaction(func(tx *sql.Tx) error {
+		ctx := context.Background()
+		var err error
+		jobId, err = insertAIJob(ctx, tx, kind, payload, now)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT OR REPLACE INTO card_rewrites (card_id, job_id, pending, created_at) VALUES (?, ?, 1, CURRENT_TIMESTAMP)", cardId, jobId)
+		return err
+	})
+	if err != nil {
+		return models.AIJobModel{}, err
+	}
+
+	return AIJob(jobId)
+}
+
+// PendingCardRewriteJob returns the AI job generating a card's rewrite, or 0 when no rewrite is pending
+func PendingCardRewriteJob(cardId int) (int, error) {
+	return PendingCardRewriteJobContext(context.Background(), cardId)
+}
+
+// PendingCardRewriteJobContext is PendingCardRewriteJob with a context that can cancel the query
+func PendingCardRewriteJobContext(ctx context.Context, cardId int) (int, error) {
+	if err := Init(); err != nil {
+		return 0, err
+	}
+
+	var jobId sql.NullInt64
+	err := DB.QueryRowContext(ctx, "SELECT job_id FROM card_rewrites WHERE card_id = ? AND pending", cardId).Scan(&jobId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return int(jobId.Int64), err
+}
+
+// SaveCardRewrite stores the rewrite generated by an AI job. It reports false, saving nothing, when the rewrite
+// is no longer pending for that job because the leech was cleared, the card deleted or another rewrite requested.
+func SaveCardRewrite(cardId int, jobId int, front string, back string) (bool, error) {
+	return SaveCardRewriteContext(context.Background(), cardId, jobId, front, back)
+}
+
+// SaveCardRewriteContext is SaveCardRewrite with a context that can cancel the query
+func SaveCardRewriteContext(ctx context.Context, cardId int, jobId int, front string, back string) (bool, error) {
+	if err := Init(); err != nil {
+		return false, err
+	}
+
+	result, err := DB.ExecContext(ctx, "UPDATE card_rewrites SET front = ?, back = ?, pending = 0 WHERE card_id = ? AND job_id = ? AND pending", front, back, cardId, jobId)
+	if err != nil {
+		return false, err
+	}
+	saved, err := result.RowsAffected()
+	return saved == 1, err
+}
+
+// DeletePendingCardRewrite discards a rewrite that the given AI job failed to generate
+func DeletePendingCardRewrite(cardId int, jobId int) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("DELETE FROM card_rewrites WHERE card_id = ? AND job_id = ? AND pending", cardId, jobId)
+	return err
+}
+
+// CardRewrite returns the rewrite suggested for a card and whether it is still being generated.
+// It returns sql.ErrNoRows when no rewrite was requested.
+func CardRewrite(cardId int) (string, string, bool, error) {
+	if err := Init(); err != nil {
+		return "", "", false, err
+	}
+
+	var front, back sql.NullString
+	var pending bool
+	err := DB.QueryRow("SELECT front, back, pending FROM card_rewrites WHERE card_id = ?", cardId).Scan(&front, &back, &pending)
+	if err != nil {
+		return "", "", false, err
+	}
+	return front.String, back.String, pending, nil
+}
+
+// DeleteCardRewrite discards the rewrite suggested for a card
+func DeleteCardRewrite(cardId int) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("DELETE FROM card_rewrites WHERE card_id = ?", cardId)
+	return err
+}
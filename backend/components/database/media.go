@@ -0,0 +1,124 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+const cardMediaColumns = "id, card_id, side, media_type, file_name, original_name, mime_type, created_at"
+
+func scanCardMedia(row rowScanner) (models.MediaModel, error) {
+	m := models.MediaModel{}
+	var originalName sql.NullString
+	var mimeType sql.NullString
+	err := row.Scan(&m.ID, &m.CardId, &m.Side, &m.MediaType, &m.FileName, &originalName, &mimeType, &m.CreatedAt)
+	if err != nil {
+		return models.MediaModel{}, err
+	}
+	m.Original = originalName.String
+	m.MimeType = mimeType.String
+	return m, nil
+}
+
+// CreateCardMedia records a media file attached to one side of a card
+func CreateCardMedia(m models.MediaModel) (models.MediaModel, error) {
+	if err := Init(); err != nil {
+		return models.MediaModel{}, err
+	}
+
+	result, err := DB.Exec("INSERT INTO card_media (card_id, side, media_type, file_name, original_name, mime_type, created_at) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)",
+		m.CardId, m.Side, m.MediaType, m.FileName, m.Original, m.MimeType)
+	if err != nil {
+		return models.MediaModel{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.MediaModel{}, err
+	}
+
+	return CardMediaItem(int(id))
+}
+
+// CardMediaItem returns a single media attachment
+func CardMediaItem(mediaId int) (models.MediaModel, error) {
+	if err := Init(); err != nil {
+		return models.MediaModel{}, err
+	}
+
+	return scanCardMedia(DB.QueryRow("SELECT "+cardMediaColumns+" FROM card_media WHERE id = ?", mediaId))
+}
+
+// CardMedia returns the media attached to a card, in the order it was attached
+func CardMedia(cardId int) ([]models.MediaModel, error) {
+	if err := Init(); err != nil {
+		return []models.MediaModel{}, err
+	}
+
+	results, err := DB.Query("SELECT "+cardMediaColumns+" FROM card_media WHERE card_id = ? ORDER BY id", cardId)
+	if err != nil {
+		return []models.MediaModel{}, err
+	}
+	defer results.Close()
+
+	items := []models.MediaModel{}
+	for results.Next() {
+		m, err := scanCardMedia(results)
+		if err != nil {
+			return []models.MediaModel{}, err
+		}
+		items = append(items, m)
+	}
+	return items, nil
+}
+
+// DeleteCardMedia removes a media attachment. The file itself is left for garbage collection,
+// as other cards may share it.
+func DeleteCardMedia(mediaId int) error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec("DELETE FROM card_media WHERE id = ?", mediaId)
+	return err
+}
+
+// DeleteOrphanedMediaRecords removes attachments whose card no longer exists
+// and image occlusion notes whose masks have all been deleted
+func DeleteOrphanedMediaRecords() error {
+	if err := Init(); err != nil {
+		return err
+	}
+
+	if _, err := DB.Exec("DELETE FROM card_media WHERE card_id NOT IN (SELECT id FROM flashcards)"); err != nil {
+		return err
+	}
+	_, err := DB.Exec("DELETE FROM occlusion_notes WHERE id NOT IN (SELECT note_id FROM occlusion_masks)")
+	return err
+}
+
+// ReferencedMediaFiles returns the names of all media files still attached to a card or image occlusion note.
+// Attachments of deleted cards and notes without masks don't count.
+func ReferencedMediaFiles() (map[string]bool, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query(`SELECT file_name FROM card_media WHERE card_id IN (SELECT id FROM flashcards)
+		UNION SELECT file_name FROM occlusion_notes WHERE id IN (SELECT note_id FROM occlusion_masks)`)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	referenced := map[string]bool{}
+	for results.Next() {
+		var name string
+		if err := results.Scan(&name); err != nil {
+			return nil, err
+		}
+		referenced[name] = true
+	}
+	return referenced, nil
+}
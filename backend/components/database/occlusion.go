@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+const occlusionNoteColumns = "id, deck_id, file_name, width, height, header, hide_all, created_at, updated_at"
+
+func scanOcclusionNote(row rowScanner) (models.OcclusionNoteModel, error) {
+	n := models.OcclusionNoteModel{}
+	var header sql.NullString
+	err := row.Scan(&n.ID, &n.DeckId, &n.FileName, &n.Width, &n.Height, &header, &n.HideAll, &n.CreatedAt, &n.UpdatedAt)
+	if err != nil {
+		return models.OcclusionNoteModel{}, err
+	}
+	n.Header = header.String
+	return n, nil
+}
+
+// CreateOcclusion records an image occlusion note with its masks, creating cards[i] to schedule note.Masks[i].
+// Everything is saved in one transaction so a failure can't leave a partial note behind.
+func CreateOcclusion(note models.OcclusionNoteModel, cards []models.FlashcardModel) (int, error) {
+	if err := Init(); err != nil {
+		return 0, err
+	}
+	if len(cards) != len(note.Masks) {
+		return 0, fmt.Errorf("expected a card for each of the %d masks, got %d", len(note.Masks), len(cards))
+	}
+
+	var noteId int
+	err := inTransaction(func(tx *sql.Tx) error {
+		ctx := context.Background()
+		result, err := tx.ExecContext(ctx, "INSERT INTO occlusion_notes (deck_id, file_name, width, height, header, hide_all, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+			note.DeckId, note.FileName, note.Width, note.Height, note.Header, note.HideAll)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		noteId = int(id)
+
+		for i, mask := range note.Masks {
+			if err := insertOcclusionMask(ctx, tx, noteId, i, mask, cards[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return noteId, err
+}
+
+// UpdateOcclusion saves a note's header, hide mode and masks in one transaction. Masks with an ID are
+// updated and their card's text replaced with cards[i], masks without one get cards[i] as a new card,
+// and the cards in removedCardIds are deleted along with their masks.
+func UpdateOcclusion(note models.OcclusionNoteModel, cards []models.FlashcardModel, removedCardIds []int) error {
+	if err := Init(); err != nil {
+		return err
+	}
+	if len(cards) != len(note.Masks) {
+		return fmt.Errorf("expected a card for each of the %d masks, got %d", len(note.Masks), len(cards))
+	}
+
+	return inTransaction(func(tx *sql.Tx) error {
+		ctx := context.Background()
+		_, err := tx.ExecContext(ctx, "UPDATE occlusion_notes SET header = ?, hide_all = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			note.Header, note.HideAll, note.ID)
+		if err != nil {
+			return err
+		}
+
+		for i, mask := range note.Masks {
+			if mask.ID == 0 {
+				if err := insertOcclusionMask(ctx, tx, note.ID, i, mask, cards[i]); err != nil {
+					return err
+				}
+				continue
+			}
+
+			points, err := json.Marshal(mask.Points)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE occlusion_masks SET ordinal = ?, shape = ?, points = ?, label = ? WHERE id = ?",
+				i, mask.Shape, string(points), mask.Label, mask.ID)
+			if err != nil {
+				return err
+			}
+
+			// Only the text changes, so the card keeps its schedule
+			_, err = tx.ExecContext(ctx, "UPDATE flashcards SET front = ?, back = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+				cards[i].Front, cards[i].Back, cards[i].ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, cardId := range removedCardIds {
+			if err := deleteCard(ctx, tx, cardId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// insertOcclusionMask creates the card that schedules a mask and links the mask to it
+func insertOcclusionMask(ctx context.Context, db execer, noteId int, ordinal int, mask models.OcclusionMaskModel, card models.FlashcardModel) error {
+	cardId, err := insertCard(ctx, db, card)
+	if err != nil {
+		return fmt.Errorf("failed to create flashcard: %v", err)
+	}
+
+	points, err := json.Marshal(mask.Points)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO occlusion_masks (note_id, card_id, ordinal, shape, points, label) VALUES (?, ?, ?, ?, ?, ?)",
+		noteId, cardId, ordinal, mask.Shape, string(points), mask.Label)
+	if err != nil {
+		return fmt.Errorf("failed to save mask: %v", err)
+	}
+	return nil
+}
+
+// OcclusionNote returns a note with its masks in order
+func OcclusionNote(noteId int) (models.OcclusionNoteModel, error) {
+	if err := Init(); err != nil {
+		return models.OcclusionNoteModel{}, err
+	}
+
+	note, err := scanOcclusionNote(DB.QueryRow("SELECT "+occlusionNoteColumns+" FROM occlusion_notes WHERE id = ?", noteId))
+	if err != nil {
+		return models.OcclusionNoteModel{}, err
+	}
+
+	results, err := DB.Query("SELECT id, card_id, shape, points, label FROM occlusion_masks WHERE note_id = ? ORDER BY ordinal, id", noteId)
+	if err != nil {
+		return models.OcclusionNoteModel{}, err
+	}
+	defer results.Close()
+
+	note.Masks = []models.OcclusionMaskModel{}
+	for results.Next() {
+		mask := models.OcclusionMaskModel{}
+		var points string
+		var label sql.NullString
+		if err := results.Scan(&mask.ID, &mask.CardId, &mask.Shape, &points, &label); err != nil {
+			return models.OcclusionNoteModel{}, err
+		}
+		if err := json.Unmarshal([]byte(points), &mask.Points); err != nil {
+			return models.OcclusionNoteModel{}, fmt.Errorf("failed to decode mask %d: %v", mask.ID, err)
+		}
+		mask.Label = label.String
+		note.Masks = append(note.Masks, mask)
+	}
+	return note, nil
+}
+
+// OcclusionNoteForCard returns the id of the note a card's mask belongs to
+func OcclusionNoteForCard(cardId int) (int, error) {
+	if err := Init(); err != nil {
+		return 0, err
+	}
+
+	var noteId int
+	err := DB.QueryRow("SELECT note_id FROM occlusion_masks WHERE card_id = ?", cardId).Scan(&noteId)
+	return noteId, err
+}
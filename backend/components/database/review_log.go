@@ -0,0 +1,138 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// sqliteTimeLayout matches datetime('now'), so times can be compared with datetime() in queries
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// Conditions selecting cards that have never been reviewed and cards in a learning or relearning step
+const (
+	newCardCondition      = "card_state = '" + models.CardStateNew + "'"
+	learningCardCondition = "card_state IN ('" + models.CardStateLearning + "', '" + models.CardStateRelearning + "')"
+	reviewCardCondition   = "card_state = '" + models.CardStateReview + "'"
+)
+
+// activeCardCondition leaves out cards taken out of the study queue, including variants reviewed through
+// their parent in decks that rotate phrasings. studyableCardCondition also leaves out cards buried at the
+// given time, which it takes as a parameter.
+const (
+	activeCardCondition    = "NOT suspended AND NOT " + rotatedVariantCondition
+	studyableCardCondition = activeCardCondition + " AND (buried_until IS NULL OR datetime(buried_until) <= datetime(?))"
+)
+
+func logReview(entry models.ReviewLogModel) error {
+	// Untimed reviews store NULL, so they are told apart from instant answers
+	var answerMs, answerSideMs sql.NullInt64
+	if entry.AnswerMs > 0 {
+		answerMs = sql.NullInt64{Int64: int64(entry.AnswerMs), Valid: true}
+		answerSideMs = sql.NullInt64{Int64: int64(entry.AnswerSideMs), Valid: true}
+	}
+
+	_, err := DB.Exec("INSERT INTO review_logs (card_id, deck_id, grade, was_new, state, stability, difficulty, interval_days, answer_ms, answer_side_ms, reviewed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.CardId, entry.DeckId, entry.Grade, entry.WasNew, entry.State, entry.Stability, entry.Difficulty, entry.IntervalDays, answerMs, answerSideMs, entry.ReviewedAt)
+	return err
+}
+
+// CountReviewsSince returns how many new cards were introduced and how many reviews were done in a deck since
+// the given time. Reviews of cards in learning or relearning don't count towards the review limit.
+func CountReviewsSince(deckId int, since time.Time) (int, int, error) {
+	if err := Init(); err != nil {
+		return 0, 0, err
+	}
+
+	var newCount, reviewCount int
+	err := DB.QueryRow("SELECT COALESCE(SUM(was_new), 0), COALESCE(SUM(COALESCE(state, 'review') = 'review'), 0) FROM review_logs WHERE deck_id = ? AND datetime(reviewed_at) >= datetime(?)",
+		deckId, since.UTC().Format(sqliteTimeLayout)).Scan(&newCount, &reviewCount)
+	if err != nil {
+		return 0, 0, err
+	}
+	return newCount, reviewCount, nil
+}
+
+// DueReviewCards returns up to limit cards in review due at the given time, most overdue first
+func DueReviewCards(deckId int, now time.Time, limit int) ([]models.FlashcardModel, error) {
+	if err := Init(); err != nil {
+		return []models.FlashcardModel{}, err
+	}
+
+	results, err := DB.Query("SELECT "+cardColumns+" FROM flashcards WHERE deck_id = ? AND "+reviewCardCondition+" AND "+studyableCardCondition+" AND datetime(schedule_due) <= datetime(?) ORDER BY datetime(schedule_due), id LIMIT ?",
+		deckId, now.UTC().Format(sqliteTimeLayout), now.UTC().Format(sqliteTimeLayout), limit)
+	if err != nil {
+		return []models.FlashcardModel{}, err
+	}
+	return scanCards(results)
+}
+
+// DueLearningCards returns the cards in a learning or relearning step that are due by the given time, soonest first.
+// They aren't limited, as a card that has started learning has to be finished.
+func DueLearningCards(deckId int, until time.Time) ([]models.FlashcardModel, error) {
+	if err := Init(); err != nil {
+		return []models.FlashcardModel{}, err
+	}
+
+	results, err := DB.Query("SELECT "+cardColumns+" FROM flashcards WHERE deck_id = ? AND "+learningCardCondition+" AND "+studyableCardCondition+" AND datetime(schedule_due) <= datetime(?) ORDER BY datetime(schedule_due), id",
+		deckId, until.UTC().Format(sqliteTimeLayout), until.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return []models.FlashcardModel{}, err
+	}
+	return scanCards(results)
+}
+
+// NewCards returns up to limit cards that have never been reviewed and aren't buried at now, in the order they were added
+func NewCards(deckId int, now time.Time, limit int) ([]models.FlashcardModel, error) {
+	if err := Init(); err != nil {
+		return []models.FlashcardModel{}, err
+	}
+
+	results, err := DB.Query("SELECT "+cardColumns+" FROM flashcards WHERE deck_id = ? AND "+newCardCondition+" AND "+studyableCardCondition+" ORDER BY id LIMIT ?",
+		deckId, now.UTC().Format(sqliteTimeLayout), limit)
+	if err != nil {
+		return []models.FlashcardModel{}, err
+	}
+	return scanCards(results)
+}
+
+// CountAvailableCards returns the number of new cards and of reviews due at the given time in a deck, ignoring daily limits
+func CountAvailableCards(deckId int, now time.Time) (int, int, error) {
+	if err := Init(); err != nil {
+		return 0, 0, err
+	}
+
+	var newCount, dueCount int
+	err := DB.QueryRow("SELECT COALESCE(SUM("+newCardCondition+"), 0), COALESCE(SUM("+reviewCardCondition+" AND datetime(schedule_due) <= datetime(?)), 0) FROM flashcards WHERE deck_id = ? AND "+studyableCardCondition,
+		now.UTC().Format(sqliteTimeLayout), deckId, now.UTC().Format(sqliteTimeLayout)).Scan(&newCount, &dueCount)
+	if err != nil {
+		return 0, 0, err
+	}
+	return newCount, dueCount, nil
+}
+
+// DueCountsByDay returns how many cards in review are due on each day from dayStart, across all decks,
+// keyed by the number of days after dayStart. Only days up to maxDays are counted.
+func DueCountsByDay(dayStart time.Time, maxDays int) (map[int]int, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query("SELECT CAST(julianday(schedule_due) - julianday(?) AS INTEGER) AS day, COUNT(*) FROM flashcards WHERE "+reviewCardCondition+" AND "+activeCardCondition+" AND julianday(schedule_due) >= julianday(?) GROUP BY day HAVING day <= ?",
+		dayStart.UTC().Format(sqliteTimeLayout), dayStart.UTC().Format(sqliteTimeLayout), maxDays)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	counts := map[int]int{}
+	for results.Next() {
+		var day, count int
+		if err := results.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	return counts, results.Err()
+}
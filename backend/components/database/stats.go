@@ -0,0 +1,334 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// deckFilter restricts a query to one deck, or to none when the deck id is 0. It takes the deck id twice.
+const deckFilter = "(? = 0 OR deck_id = ?)"
+
+// matureInterval is the interval, in days, from which a card counts as mature, as in Anki
+const matureInterval = 21
+
+// maxAnswerMs caps the time counted for one review, as in Anki, so a card left on screen doesn't skew the stats
+const maxAnswerMs = 60000
+
+// timedReviews adds to every review the gap since the previous review in any deck
+const timedReviews = `timed AS (
+	SELECT id, card_id, deck_id, grade, was_new, COALESCE(state, 'review') AS state, interval_days, answer_ms, reviewed_at,
+		(julianday(reviewed_at) - julianday(LAG(reviewed_at) OVER (ORDER BY reviewed_at, id))) * 86400 AS gap
+	FROM review_logs
+)`
+
+// reviewSeconds is the time spent on a review of timedReviews. Reviews from before answer times were recorded are
+// estimated from the gap since the previous review, capped the same way, or count as nothing when the gap is long
+// enough to start a new session.
+var reviewSeconds = fmt.Sprintf("CASE WHEN answer_ms IS NOT NULL THEN MIN(answer_ms, %d) / 1000.0 WHEN gap IS NULL OR gap > 300 THEN 0 ELSE MIN(gap, %d) END",
+	maxAnswerMs, maxAnswerMs/1000)
+
+// RetentionSince counts the reviews of cards in review since the given time, and how many were passed,
+// for young and mature cards. A card is mature when the interval it was given at its previous review was long enough.
+func RetentionSince(deckId int, since time.Time) (models.RetentionWindow, error) {
+	if err := Init(); err != nil {
+		return models.RetentionWindow{}, err
+	}
+
+	window := models.RetentionWindow{}
+	err := DB.QueryRow(`WITH reviews AS (
+			SELECT deck_id, grade, COALESCE(state, 'review') AS state, reviewed_at,
+				LAG(interval_days) OVER (PARTITION BY card_id ORDER BY reviewed_at, id) AS previous_interval
+			FROM review_logs
+		)
+		SELECT
+			COALESCE(SUM(COALESCE(previous_interval, 0) < ?), 0),
+			COALESCE(SUM(COALESCE(previous_interval, 0) < ? AND grade > ?), 0),
+			COALESCE(SUM(COALESCE(previous_interval, 0) >= ?), 0),
+			COALESCE(SUM(COALESCE(previous_interval, 0) >= ? AND grade > ?), 0)
+		FROM reviews WHERE state = ? AND `+deckFilter+` AND datetime(reviewed_at) >= datetime(?)`,
+		matureInterval, matureInterval, models.GradeAgain, matureInterval, matureInterval, models.GradeAgain,
+		models.CardStateReview, deckId, deckId, since.UTC().Format(sqliteTimeLayout),
+	).Scan(&window.YoungReviews, &window.YoungPassed, &window.MatureReviews, &window.MaturePassed)
+	if err != nil {
+		return models.RetentionWindow{}, err
+	}
+	return window, nil
+}
+
+// DailyReviewsSince summarizes the reviews of each study day since the given time. dayModifier is an SQLite
+// date modifier such as "-14400 seconds" that shifts review times so each study day falls on one calendar date.
+func DailyReviewsSince(deckId int, since time.Time, dayModifier string) ([]models.DailyReviews, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query(`WITH `+timedReviews+`
+		SELECT date(reviewed_at, ?) AS day, COUNT(*), COALESCE(SUM(was_new), 0),
+			COALESCE(SUM(state IN (?, ?)), 0), COALESCE(SUM(grade = ?), 0), COALESCE(SUM(`+reviewSeconds+`), 0)
+		FROM timed WHERE `+deckFilter+` AND datetime(reviewed_at) >= datetime(?)
+		GROUP BY day ORDER BY day`,
+		dayModifier, models.CardStateLearning, models.CardStateRelearning, models.GradeAgain,
+		deckId, deckId, since.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	days := []models.DailyReviews{}
+	for results.Next() {
+		var day models.DailyReviews
+		var seconds float64
+		if err := results.Scan(&day.Date, &day.Reviews, &day.NewCards, &day.Learning, &day.Again, &seconds); err != nil {
+			return nil, err
+		}
+		day.Minutes = seconds / 60
+		days = append(days, day)
+	}
+	return days, results.Err()
+}
+
+// ReviewCountsByDay returns the number of reviews on each study day between from and to, keyed by date
+func ReviewCountsByDay(deckId int, from time.Time, to time.Time, dayModifier string) (map[string]int, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query("SELECT date(reviewed_at, ?) AS day, COUNT(*) FROM review_logs WHERE "+deckFilter+" AND datetime(reviewed_at) >= datetime(?) AND datetime(reviewed_at) < datetime(?) GROUP BY day",
+		dayModifier, deckId, deckId, from.UTC().Format(sqliteTimeLayout), to.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	counts := map[string]int{}
+	for results.Next() {
+		var day string
+		var count int
+		if err := results.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	return counts, results.Err()
+}
+
+// DueForecast returns how many studied cards fall due on each of the days after dayStart, keyed by the number of days
+// after dayStart. Overdue cards count towards day 0.
+func DueForecast(deckId int, dayStart time.Time, days int) (map[int]int, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	start := dayStart.UTC().Format(sqliteTimeLayout)
+	results, err := DB.Query("SELECT MAX(CAST(julianday(schedule_due) - julianday(?) AS INTEGER), 0) AS day, COUNT(*) FROM flashcards WHERE NOT "+newCardCondition+" AND "+activeCardCondition+" AND "+deckFilter+" AND julianday(schedule_due) < julianday(?) + ? GROUP BY day",
+		start, deckId, deckId, start, days)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	counts := map[int]int{}
+	for results.Next() {
+		var day, count int
+		if err := results.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	return counts, results.Err()
+}
+
+// Bucket edges of the card distributions
+var (
+	dayBuckets        = []float64{1, 3, 7, 14, 21, 30, 60, 90, 180, 365}
+	difficultyBuckets = []float64{2, 3, 4, 5, 6, 7, 8, 9, 10}
+)
+
+// bucketExpression returns an SQL expression numbering the bucket value falls in: 0 below the first edge,
+// up to len(edges) from the last edge on
+func bucketExpression(value string, edges []float64) string {
+	var expression strings.Builder
+	expression.WriteString("CASE")
+	for i, edge := range edges {
+		fmt.Fprintf(&expression, " WHEN %s < %g THEN %d", value, edge, i)
+	}
+	fmt.Fprintf(&expression, " ELSE %d END", len(edges))
+	return expression.String()
+}
+
+// cardIntervalExpression is the interval of a card, falling back to the gap between its last review and due date
+// for cards reviewed before intervals were stored
+const cardIntervalExpression = "CASE WHEN interval_days > 0 THEN interval_days ELSE MAX(julianday(schedule_due) - julianday(last_reviewed), 0) END"
+
+// CardDistributions counts the studied cards in each bucket of stability, difficulty and, for cards in review, interval
+func CardDistributions(deckId int) (models.CardDistributions, error) {
+	if err := Init(); err != nil {
+		return models.CardDistributions{}, err
+	}
+
+	stability, err := distribution(bucketExpression("fsrs_stability", dayBuckets), "NOT "+newCardCondition, deckId, dayBuckets, 0)
+	if err != nil {
+		return models.CardDistributions{}, err
+	}
+	difficulty, err := distribution(bucketExpression("fsrs_difficulty", difficultyBuckets), "NOT "+newCardCondition, deckId, difficultyBuckets, 1)
+	if err != nil {
+		return models.CardDistributions{}, err
+	}
+	interval, err := distribution(bucketExpression(cardIntervalExpression, dayBuckets), reviewCardCondition, deckId, dayBuckets, 0)
+	if err != nil {
+		return models.CardDistributions{}, err
+	}
+	return models.CardDistributions{Stability: stability, Difficulty: difficulty, Interval: interval}, nil
+}
+
+// distribution counts the cards matching condition in each bucket, the first of which starts at lowest
+func distribution(bucket string, condition string, deckId int, edges []float64, lowest float64) ([]models.DistributionBucket, error) {
+	buckets := make([]models.DistributionBucket, len(edges)+1)
+	from := lowest
+	for i := range buckets {
+		buckets[i].From = from
+		if i < len(edges) {
+			buckets[i].To = edges[i]
+			buckets[i].Label = fmt.Sprintf("%g-%g", from, edges[i])
+			from = edges[i]
+		} else {
+			buckets[i].Label = fmt.Sprintf("%g+", from)
+		}
+	}
+
+	results, err := DB.Query("SELECT "+bucket+" AS bucket, COUNT(*) FROM flashcards WHERE "+condition+" AND "+deckFilter+" GROUP BY bucket", deckId, deckId)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		var index, count int
+		if err := results.Scan(&index, &count); err != nil {
+			return nil, err
+		}
+		buckets[index].Cards = count
+	}
+	return buckets, results.Err()
+}
+
+// StudyDayRun is a stretch of consecutive study days with at least one review
+type StudyDayRun struct {
+	First string // YYYY-MM-DD
+	Last  string
+	Days  int
+}
+
+// StudyDayRuns returns the stretches of consecutive study days with reviews, most recent first
+func StudyDayRuns(deckId int, dayModifier string) ([]StudyDayRun, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query(`WITH days AS (
+			SELECT DISTINCT date(reviewed_at, ?) AS day FROM review_logs WHERE `+deckFilter+`
+		),
+		runs AS (
+			SELECT day, julianday(day) - ROW_NUMBER() OVER (ORDER BY day) AS run FROM days
+		)
+		SELECT MIN(day), MAX(day), COUNT(*) FROM runs GROUP BY run ORDER BY MAX(day) DESC`,
+		dayModifier, deckId, deckId)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	runs := []StudyDayRun{}
+	for results.Next() {
+		var run StudyDayRun
+		if err := results.Scan(&run.First, &run.Last, &run.Days); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, results.Err()
+}
+
+// ReviewTimeKey groups timed reviews by the state of the card when it was reviewed and the grade given
+type ReviewTimeKey struct {
+	WasNew bool
+	State  string
+	Grade  int
+}
+
+// ReviewTimeAverage is the average capped answer time of a group of timed reviews
+type ReviewTimeAverage struct {
+	Seconds float64
+	Reviews int
+}
+
+// AverageReviewTimes returns the average answer time of timed reviews across all decks, by card state and grade
+func AverageReviewTimes() (map[ReviewTimeKey]ReviewTimeAverage, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query("SELECT was_new, COALESCE(state, 'review'), grade, AVG(MIN(answer_ms, ?)) / 1000.0, COUNT(*) FROM review_logs WHERE answer_ms IS NOT NULL GROUP BY 1, 2, 3",
+		maxAnswerMs)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	averages := map[ReviewTimeKey]ReviewTimeAverage{}
+	for results.Next() {
+		var key ReviewTimeKey
+		var average ReviewTimeAverage
+		if err := results.Scan(&key.WasNew, &key.State, &key.Grade, &average.Seconds, &average.Reviews); err != nil {
+			return nil, err
+		}
+		averages[key] = average
+	}
+	return averages, results.Err()
+}
+
+// SlowCards returns up to limit cards of a deck with the longest average answer time over their passed reviews,
+// ignoring cards with fewer than minReviews passed timed reviews
+func SlowCards(deckId int, minReviews int, limit int) ([]models.SlowCard, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+
+	results, err := DB.Query(`SELECT card_id,
+			SUM(grade > ? AND answer_ms IS NOT NULL) AS timed,
+			AVG(CASE WHEN grade > ? THEN answer_ms END) / 1000.0 AS answer_seconds,
+			COALESCE(AVG(CASE WHEN grade > ? THEN answer_side_ms END), 0) / 1000.0,
+			AVG(grade >= ?)
+		FROM review_logs WHERE deck_id = ? GROUP BY card_id HAVING timed >= ? ORDER BY answer_seconds DESC LIMIT ?`,
+		models.GradeAgain, models.GradeAgain, models.GradeAgain, models.GradeGood, deckId, minReviews, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	slow := []models.SlowCard{}
+	for results.Next() {
+		var card models.SlowCard
+		if err := results.Scan(&card.Card.ID, &card.TimedReviews, &card.AverageAnswerSeconds, &card.AverageAnswerSideSeconds, &card.EasyOrGoodRate); err != nil {
+			results.Close()
+			return nil, err
+		}
+		slow = append(slow, card)
+	}
+	results.Close()
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+
+	// Load the cards once the query is closed, as Card may still migrate the flashcards table
+	for i := range slow {
+		card, err := Card(deckId, slow[i].Card.ID)
+		if err != nil {
+			return nil, err
+		}
+		slow[i].Card = card
+	}
+	return slow, nil
+}
@@ -0,0 +1,41 @@
+package media
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Handler serves files from the media folder to the frontend under URLPrefix
+type Handler struct{}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, URLPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, URLPrefix)
+	if !validName(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	mediaDir, err := Dir()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Content-addressed files never change, so they can be cached indefinitely
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeFile(w, r, path.Join(mediaDir, name))
+}
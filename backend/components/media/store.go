@@ -0,0 +1,204 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	TypeImage = "image"
+	TypeAudio = "audio"
+
+	// URLPrefix is the asset server path media files are served under
+	URLPrefix = "/media/"
+
+	// MaxFileSize limits attachments to keep the database and media folder manageable
+	MaxFileSize = 50 * 1024 * 1024
+)
+
+// StoredFile describes a file saved in the media folder
+type StoredFile struct {
+	Hash      string // sha256 of the contents, which is also the file name without extension
+	Name      string // file name in the media folder
+	MediaType string // TypeImage or TypeAudio
+	MimeType  string
+}
+
+// Dir returns the media folder, creating it if needed
+func Dir() (string, error) {
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	mediaDir := path.Join(userConfigDir, "brightcards", "media")
+	if err := os.MkdirAll(mediaDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create media folder: %v", err)
+	}
+	return mediaDir, nil
+}
+
+// URL returns the asset server URL of a stored file
+func URL(name string) string {
+	return URLPrefix + name
+}
+
+// Store saves data to the media folder under its content hash.
+// Identical files are stored once no matter how many cards use them.
+func Store(originalName string, data []byte) (StoredFile, error) {
+	if len(data) == 0 {
+		return StoredFile{}, fmt.Errorf("media file is empty")
+	}
+	if len(data) > MaxFileSize {
+		return StoredFile{}, fmt.Errorf("media file is larger than %d MB", MaxFileSize/1024/1024)
+	}
+
+	mimeType, mediaType, err := detectType(originalName, data)
+	if err != nil {
+		return StoredFile{}, err
+	}
+
+	hash := sha256.Sum256(data)
+	stored := StoredFile{
+		Hash:      hex.EncodeToString(hash[:]),
+		MediaType: mediaType,
+		MimeType:  mimeType,
+	}
+	stored.Name = stored.Hash + extension(originalName, mimeType)
+
+	mediaDir, err := Dir()
+	if err != nil {
+		return StoredFile{}, err
+	}
+
+	target := path.Join(mediaDir, stored.Name)
+	if _, err := os.Stat(target); err == nil {
+		return stored, nil
+	}
+
+	// Write to a temporary file first so a partial write never appears under the content hash
+	tmp, err := os.CreateTemp(mediaDir, ".upload-*")
+	if err != nil {
+		return StoredFile{}, fmt.Errorf("failed to create media file: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return StoredFile{}, fmt.Errorf("failed to write media file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return StoredFile{}, fmt.Errorf("failed to write media file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		os.Remove(tmp.Name())
+		return StoredFile{}, fmt.Errorf("failed to save media file: %v", err)
+	}
+
+	return stored, nil
+}
+
+// Remove deletes a file from the media folder
+func Remove(name string) error {
+	if !validName(name) {
+		return fmt.Errorf("invalid media file name: %s", name)
+	}
+	mediaDir, err := Dir()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path.Join(mediaDir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CollectGarbage deletes files in the media folder that aren't in the referenced set,
+// returning the number of files removed
+func CollectGarbage(referenced map[string]bool) (int, error) {
+	mediaDir, err := Dir()
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(mediaDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read media folder: %v", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || referenced[entry.Name()] {
+			continue
+		}
+
+		// Leave temporary files alone unless they were abandoned by an interrupted upload
+		if strings.HasPrefix(entry.Name(), ".") {
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < time.Hour {
+				continue
+			}
+		}
+
+		if err := os.Remove(path.Join(mediaDir, entry.Name())); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %v", entry.Name(), err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// detectType determines the MIME type of the data and whether it is an image or audio file
+func detectType(originalName string, data []byte) (string, string, error) {
+	mimeType := http.DetectContentType(data)
+
+	// Content sniffing doesn't recognize every format, so fall back to the file extension
+	if mimeType == "application/octet-stream" || strings.HasPrefix(mimeType, "text/") {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(originalName))); byExt != "" {
+			mimeType = byExt
+		}
+	}
+	mimeType = strings.TrimSpace(strings.Split(mimeType, ";")[0])
+
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return mimeType, TypeImage, nil
+	case strings.HasPrefix(mimeType, "audio/"), mimeType == "application/ogg":
+		return mimeType, TypeAudio, nil
+	default:
+		return "", "", fmt.Errorf("unsupported media type %s: only images and audio can be attached", mimeType)
+	}
+}
+
+// extension picks the file extension for stored media, preferring the original one
+func extension(originalName string, mimeType string) string {
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if ext != "" && validName("x"+ext) {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// validName reports whether name is a plain file name that can't escape the media folder
+func validName(name string) bool {
+	if name == "" || strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package models
+
+// The values below are stored in the database, so the database and the scheduling algorithms share them from here
+
+// Card states, as in Anki. New cards go through the learning steps before their first day-level interval,
+// and lapsed review cards go through the relearning steps before returning to review.
+const (
+	CardStateNew        = "new"
+	CardStateLearning   = "learning"
+	CardStateReview     = "review"
+	CardStateRelearning = "relearning"
+)
+
+// Grades given to a card when it is reviewed
+const (
+	GradeAgain = 1 // 'Again'
+	GradeHard  = 2 // 'Hard'
+	GradeGood  = 3 // 'Good'
+	GradeEasy  = 4 // 'Easy'
+)
+
+// Scheduling algorithms a deck can use
+const (
+	SchedulerFSRS    = "fsrs"
+	SchedulerSM2     = "sm2"
+	SchedulerLeitner = "leitner"
+)
+
+// What happens to a card when it becomes a leech
+const (
+	LeechActionTag     = "tag"     // only mark the card as a leech
+	LeechActionSuspend = "suspend" // mark it and take it out of the study queue
+	LeechActionRewrite = "rewrite" // mark it and ask the AI for a clearer version
+)
+
+// Settings for decks that haven't configured their own
+const (
+	DefaultLearningSteps   = "1m 10m"
+	DefaultRelearningSteps = "10m"
+	DefaultLeechThreshold  = 8 // lapses that make a card a leech, as in Anki
+)
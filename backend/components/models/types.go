@@ -3,19 +3,43 @@ package models
 import "time"
 
 type FlashcardModel struct {
-	ID             int       `json:"ID"`
-	Front          string    `json:"Front"`
-	Back           string    `json:"Back"`
-	DeckId         int       `json:"DeckId"`
-	CardType       string    `json:"CardType"`
-	Source         string    `json:"Source"`
-	FSRSDifficulty float64   `json:"FSRSDifficulty"`
-	FSRSStability  float64   `json:"FSRSStability"`
-	DueDate        time.Time `json:"DueDate"`
-	LastReviewed   *string   `json:"LastReviewed,omitempty"`
-	Difficulty     *string   `json:"Difficulty,omitempty"`
-	CreatedAt      string    `json:"CreatedAt"`
-	UpdatedAt      string    `json:"UpdatedAt"`
+	ID             int            `json:"ID"`
+	Front          string         `json:"Front"`
+	Back           string         `json:"Back"`
+	DeckId         int            `json:"DeckId"`
+	CardType       string         `json:"CardType"`
+	Source         string         `json:"Source"`
+	FSRSDifficulty float64        `json:"FSRSDifficulty"`
+	FSRSStability  float64        `json:"FSRSStability"`
+	State          string         `json:"State"`                  // "new", "learning", "review" or "relearning"
+	Step           int            `json:"Step"`                   // current learning or relearning step
+	EaseFactor     float64        `json:"EaseFactor"`             // SM-2 ease factor
+	Repetitions    int            `json:"Repetitions"`            // SM-2 successful reviews in a row
+	LeitnerBox     int            `json:"LeitnerBox"`             // Leitner box, starting at 1
+	IntervalDays   float64        `json:"IntervalDays"`           // interval given at the last review
+	Lapses         int            `json:"Lapses"`                 // times the card was forgotten after graduating
+	Leech          bool           `json:"Leech"`                  // forgotten often enough to reach the deck's leech threshold
+	Suspended      bool           `json:"Suspended"`              // left out of the study queue
+	BuriedUntil    *string        `json:"BuriedUntil,omitempty"`  // left out of the study queue until then, usually the next study day
+	ParentCardId   *int           `json:"ParentCardId,omitempty"` // the card this one rephrases
+	VariantId      int            `json:"VariantId,omitempty"`    // in decks that rotate phrasings, the card whose wording is shown
+	DisplayFront   string         `json:"DisplayFront,omitempty"` // the wording of that card shown for review; Front and Back stay the card's own
+	DisplayBack    string         `json:"DisplayBack,omitempty"`
+	DueDate        time.Time      `json:"DueDate"`
+	LastReviewed   *string        `json:"LastReviewed,omitempty"`
+	Difficulty     *string        `json:"Difficulty,omitempty"`
+	Retrievability float64        `json:"Retrievability"`          // chance of recalling the card now, 0 for new cards
+	NextIntervals  []NextInterval `json:"NextIntervals,omitempty"` // interval each grade would give if the card were reviewed now
+	CreatedAt      string         `json:"CreatedAt"`
+	UpdatedAt      string         `json:"UpdatedAt"`
+}
+
+// NextInterval is the interval a grade would give a card
+type NextInterval struct {
+	Grade int     `json:"Grade"` // 1 (Again) to 4 (Easy)
+	Label string  `json:"Label"` // "Again", "Hard", "Good" or "Easy"
+	Days  float64 `json:"Days"`
+	Text  string  `json:"Text"` // short form such as "10m", "5d" or "1.2y"
 }
 
 type DeckModel struct {
@@ -26,8 +50,279 @@ type DeckModel struct {
 	EnableAutoRephrase   bool    `json:"EnableAutoRephrase"`
 	EnableInitialismSwap bool    `json:"EnableInitialismSwap"`
 	MaxRephrasedCards    int     `json:"MaxRephrasedCards"`
+	TTSAutoPlayFront     bool    `json:"TTSAutoPlayFront"`
+	TTSAutoPlayBack      bool    `json:"TTSAutoPlayBack"`
+	Scheduler            string  `json:"Scheduler"`       // "fsrs", "sm2" or "leitner"
+	LeechThreshold       int     `json:"LeechThreshold"`  // lapses that make a card a leech, 0 to turn detection off
+	LeechAction          string  `json:"LeechAction"`     // "tag", "suspend" or "rewrite"
+	VariantMode          string  `json:"VariantMode"`     // "separate" or "rotate"
+	LearningSteps        string  `json:"LearningSteps"`   // e.g. "1m 10m"
+	RelearningSteps      string  `json:"RelearningSteps"` // e.g. "10m"
+	NewCardsPerDay       int     `json:"NewCardsPerDay"`
+	MaxReviewsPerDay     int     `json:"MaxReviewsPerDay"`
 	CardCount            int     `json:"CardCount"`
 	LastReviewed         *string `json:"LastReviewed,omitempty"`
 	CreatedAt            string  `json:"CreatedAt"`
 	UpdatedAt            string  `json:"UpdatedAt"`
 }
+
+type MediaModel struct {
+	ID        int    `json:"ID"`
+	CardId    int    `json:"CardId"`
+	Side      string `json:"Side"`      // "front" or "back"
+	MediaType string `json:"MediaType"` // "image" or "audio"
+	FileName  string `json:"FileName"`  // name in the media folder
+	Original  string `json:"Original"`  // name of the file that was attached
+	MimeType  string `json:"MimeType"`
+	URL       string `json:"URL"`
+	CreatedAt string `json:"CreatedAt"`
+}
+
+// Point is a position on an image, with coordinates relative to its size (0..1)
+type Point struct {
+	X float64 `json:"X"`
+	Y float64 `json:"Y"`
+}
+
+type OcclusionMaskModel struct {
+	ID     int     `json:"ID"`
+	CardId int     `json:"CardId"`
+	Shape  string  `json:"Shape"`  // "rect" (top-left and bottom-right corners) or "polygon"
+	Points []Point `json:"Points"` // relative to the image size
+	Label  string  `json:"Label"`  // what the mask hides, shown on the answer side
+}
+
+type OcclusionNoteModel struct {
+	ID        int                  `json:"ID"`
+	DeckId    int                  `json:"DeckId"`
+	FileName  string               `json:"FileName"`
+	ImageURL  string               `json:"ImageURL"`
+	Width     int                  `json:"Width"`
+	Height    int                  `json:"Height"`
+	Header    string               `json:"Header"`
+	HideAll   bool                 `json:"HideAll"` // hide every mask on the question side, not just the one asked
+	Masks     []OcclusionMaskModel `json:"Masks"`
+	CreatedAt string               `json:"CreatedAt"`
+	UpdatedAt string               `json:"UpdatedAt"`
+}
+
+// OcclusionView is the question and answer rendering of one mask of an image occlusion note
+type OcclusionView struct {
+	CardId         int    `json:"CardId"`
+	NoteId         int    `json:"NoteId"`
+	ImageURL       string `json:"ImageURL"`
+	Header         string `json:"Header"`
+	Label          string `json:"Label"`
+	QuestionSVG    string `json:"QuestionSVG"`
+	AnswerSVG      string `json:"AnswerSVG"`
+	SiblingCardIds []int  `json:"SiblingCardIds"`
+}
+
+// RenderedFlashcard holds the sanitized HTML rendering of a card's Markdown
+type RenderedFlashcard struct {
+	ID        int    `json:"ID"`
+	DeckId    int    `json:"DeckId"`
+	FrontHTML string `json:"FrontHTML"`
+	BackHTML  string `json:"BackHTML"`
+}
+
+// CardSchedule is a card's scheduling state after a review
+type CardSchedule struct {
+	State        string  `json:"State"`
+	Step         int     `json:"Step"`
+	Stability    float64 `json:"Stability"`
+	Difficulty   float64 `json:"Difficulty"`
+	EaseFactor   float64 `json:"EaseFactor"`
+	Repetitions  int     `json:"Repetitions"`
+	LeitnerBox   int     `json:"LeitnerBox"`
+	IntervalDays float64 `json:"IntervalDays"` // time until the card is due, in days
+	Lapses       int     `json:"Lapses"`
+}
+
+// ReviewLogModel is one review of a card
+type ReviewLogModel struct {
+	ID           int     `json:"ID"`
+	CardId       int     `json:"CardId"`
+	DeckId       int     `json:"DeckId"`
+	Grade        int     `json:"Grade"`
+	WasNew       bool    `json:"WasNew"` // first review of the card
+	State        string  `json:"State"`  // state of the card when it was reviewed
+	Stability    float64 `json:"Stability"`
+	Difficulty   float64 `json:"Difficulty"`
+	IntervalDays float64 `json:"IntervalDays"`
+	AnswerMs     int     `json:"AnswerMs"`     // time from showing the question to grading, 0 when not timed
+	AnswerSideMs int     `json:"AnswerSideMs"` // part of AnswerMs spent with the answer shown
+	ReviewedAt   string  `json:"ReviewedAt"`
+}
+
+// ReviewTiming is how long a review took, in milliseconds. Zero values mean the review wasn't timed.
+type ReviewTiming struct {
+	AnswerMs     int `json:"AnswerMs"`     // time from showing the question to grading
+	AnswerSideMs int `json:"AnswerSideMs"` // time spent with the answer shown
+}
+
+// SlowCard is a card that takes long to answer even when it is recalled, which often means it should be rewritten
+type SlowCard struct {
+	Card                     FlashcardModel `json:"Card"`
+	TimedReviews             int            `json:"TimedReviews"`         // passed reviews with a recorded time
+	AverageAnswerSeconds     float64        `json:"AverageAnswerSeconds"` // over passed reviews
+	AverageAnswerSideSeconds float64        `json:"AverageAnswerSideSeconds"`
+	EasyOrGoodRate           float64        `json:"EasyOrGoodRate"` // share of all reviews graded Good or Easy
+}
+
+// StudyQueueCounts summarizes what is left to study in a deck today
+type StudyQueueCounts struct {
+	NewCards         int `json:"NewCards"`         // new cards still available under today's limit
+	Learning         int `json:"Learning"`         // cards in a learning or relearning step that are due
+	Reviews          int `json:"Reviews"`          // due reviews still available under today's limit
+	NewStudiedToday  int `json:"NewStudiedToday"`  // new cards introduced since the study day started
+	ReviewsDoneToday int `json:"ReviewsDoneToday"` // reviews done since the study day started
+}
+
+// SimulatedDay is the projected workload of one day of a workload simulation, averaged over the simulation runs
+type SimulatedDay struct {
+	Day      int     `json:"Day"`      // days from the start of the simulation, 0 being today
+	Date     string  `json:"Date"`     // YYYY-MM-DD
+	Reviews  float64 `json:"Reviews"`  // reviews of cards already learned
+	NewCards float64 `json:"NewCards"` // new cards introduced
+	Minutes  float64 `json:"Minutes"`  // time spent on reviews and new cards
+}
+
+// WorkloadSimulation is the projected workload and retention of a deck studied at a desired retention
+type WorkloadSimulation struct {
+	DeckId             int            `json:"DeckId"`
+	DesiredRetention   float64        `json:"DesiredRetention"`
+	NewCardsPerDay     int            `json:"NewCardsPerDay"`
+	Days               []SimulatedDay `json:"Days"`
+	TotalReviews       float64        `json:"TotalReviews"`
+	TotalNewCards      float64        `json:"TotalNewCards"`
+	TotalMinutes       float64        `json:"TotalMinutes"`
+	ExpectedRetention  float64        `json:"ExpectedRetention"`  // average recall probability of studied cards on the day after the simulation
+	ExpectedRemembered float64        `json:"ExpectedRemembered"` // expected number of cards remembered on the day after the simulation
+}
+
+// RetentionWindow is the share of reviews that were passed over a period. Only reviews of cards in review count,
+// split between young cards, whose previous interval was under 21 days, and mature cards.
+type RetentionWindow struct {
+	Label           string  `json:"Label"` // "Today", "Week", "Month" or "Year"
+	Days            int     `json:"Days"`
+	YoungReviews    int     `json:"YoungReviews"`
+	YoungPassed     int     `json:"YoungPassed"`
+	MatureReviews   int     `json:"MatureReviews"`
+	MaturePassed    int     `json:"MaturePassed"`
+	Retention       float64 `json:"Retention"`       // passed / reviews, 0 when there were no reviews
+	YoungRetention  float64 `json:"YoungRetention"`  // likewise for young cards
+	MatureRetention float64 `json:"MatureRetention"` // likewise for mature cards
+}
+
+// DailyReviews summarizes the reviews of one study day
+type DailyReviews struct {
+	Date     string  `json:"Date"` // YYYY-MM-DD of the study day
+	Reviews  int     `json:"Reviews"`
+	NewCards int     `json:"NewCards"`
+	Learning int     `json:"Learning"` // reviews of cards in a learning or relearning step
+	Again    int     `json:"Again"`    // reviews graded Again
+	Minutes  float64 `json:"Minutes"`  // time spent reviewing
+}
+
+// ForecastDay is how many cards fall due on a day
+type ForecastDay struct {
+	Date string `json:"Date"`
+	Due  int    `json:"Due"` // the first day includes overdue cards
+}
+
+// DistributionBucket counts the cards whose value lies in [From, To)
+type DistributionBucket struct {
+	Label string  `json:"Label"`
+	From  float64 `json:"From"`
+	To    float64 `json:"To"` // 0 for the last, open-ended bucket
+	Cards int     `json:"Cards"`
+}
+
+// CardDistributions describes the memory of the studied cards
+type CardDistributions struct {
+	Stability  []DistributionBucket `json:"Stability"`  // in days
+	Difficulty []DistributionBucket `json:"Difficulty"` // 1-10
+	Interval   []DistributionBucket `json:"Interval"`   // in days
+}
+
+// StreakStats counts consecutive study days
+type StreakStats struct {
+	Current     int `json:"Current"` // days in a row up to today, or yesterday if nothing was studied yet today
+	Longest     int `json:"Longest"`
+	DaysStudied int `json:"DaysStudied"`
+}
+
+// HeatmapDay is the number of reviews on a day of the activity heatmap
+type HeatmapDay struct {
+	Date    string `json:"Date"`
+	Reviews int    `json:"Reviews"`
+}
+
+// OverviewStats gathers the statistics shown on the overview page
+type OverviewStats struct {
+	DeckId        int               `json:"DeckId"` // 0 for all decks
+	Retention     []RetentionWindow `json:"Retention"`
+	DailyReviews  []DailyReviews    `json:"DailyReviews"`
+	Forecast      []ForecastDay     `json:"Forecast"`
+	Distributions CardDistributions `json:"Distributions"`
+	Streak        StreakStats       `json:"Streak"`
+	Heatmap       []HeatmapDay      `json:"Heatmap"`
+}
+
+// LeechModel is a leech with the AI rewrite suggested for it, if any
+type LeechModel struct {
+	Card           FlashcardModel `json:"Card"`
+	RewriteFront   string         `json:"RewriteFront,omitempty"`
+	RewriteBack    string         `json:"RewriteBack,omitempty"`
+	RewritePending bool           `json:"RewritePending"` // a rewrite was requested and hasn't arrived yet
+}
+
+// AIJobModel is an AI request run in the background. Payload and Result hold the JSON of its input and output.
+type AIJobModel struct {
+	ID        int    `json:"ID"`
+	Kind      string `json:"Kind"`   // "generate_flashcards", "rephrase_flashcard", "process_text", "rewrite_leech" or "auto_rephrase"
+	Status    string `json:"Status"` // "queued", "running", "succeeded", "failed" or "cancelled"
+	Payload   string `json:"Payload"`
+	Result    string `json:"Result,omitempty"`
+	Error     string `json:"Error,omitempty"`
+	Attempts  int    `json:"Attempts"`
+	RunAfter  string `json:"RunAfter"` // when a queued job may next run, later than now while it waits to be retried
+	CreatedAt string `json:"CreatedAt"`
+	UpdatedAt string `json:"UpdatedAt"`
+}
+
+// AIUsageModel is what a single request to the AI services used
+type AIUsageModel struct {
+	Operation        string  `json:"Operation"` // e.g. "generate_flashcards", "transcription" or "speech"
+	Model            string  `json:"Model"`
+	PromptTokens     int     `json:"PromptTokens"`
+	CompletionTokens int     `json:"CompletionTokens"`
+	AudioSeconds     float64 `json:"AudioSeconds"` // audio transcribed
+	Characters       int     `json:"Characters"`   // text synthesized into speech
+	Cost             float64 `json:"Cost"`         // estimated, in US dollars
+	CreatedAt        string  `json:"CreatedAt"`
+}
+
+// AIUsageTotal adds up the requests of one operation and model
+type AIUsageTotal struct {
+	Operation        string  `json:"Operation"`
+	Model            string  `json:"Model"`
+	Requests         int     `json:"Requests"`
+	PromptTokens     int     `json:"PromptTokens"`
+	CompletionTokens int     `json:"CompletionTokens"`
+	AudioSeconds     float64 `json:"AudioSeconds"`
+	Characters       int     `json:"Characters"`
+	Cost             float64 `json:"Cost"`
+}
+
+// AIUsageSummary is the AI usage over a range of days
+type AIUsageSummary struct {
+	From           string         `json:"From"` // first day, YYYY-MM-DD
+	To             string         `json:"To"`   // last day, included
+	Requests       int            `json:"Requests"`
+	Cost           float64        `json:"Cost"`
+	Totals         []AIUsageTotal `json:"Totals"`        // by operation and model, most expensive first
+	MonthlyBudget  float64        `json:"MonthlyBudget"` // 0 when there is no cap
+	SpentThisMonth float64        `json:"SpentThisMonth"`
+}
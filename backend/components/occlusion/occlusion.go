@@ -0,0 +1,132 @@
+package occlusion
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+const (
+	CardType = "image_occlusion"
+
+	ShapeRect    = "rect"
+	ShapePolygon = "polygon"
+
+	// Fill colors for the mask being asked, other hidden masks, and the revealed answer
+	questionFill = "#ff8e8e"
+	hiddenFill   = "#ffeba2"
+	answerStroke = "#ff3b30"
+	maskStroke   = "#2d2d2d"
+)
+
+// ValidateMasks checks that every mask has a known shape and coordinates inside the image
+func ValidateMasks(masks []models.OcclusionMaskModel) error {
+	if len(masks) == 0 {
+		return fmt.Errorf("image occlusion needs at least one mask")
+	}
+
+	for i, mask := range masks {
+		switch mask.Shape {
+		case ShapeRect:
+			if len(mask.Points) != 2 {
+				return fmt.Errorf("mask %d: a rectangle needs exactly two corner points", i+1)
+			}
+			if mask.Points[0].X == mask.Points[1].X || mask.Points[0].Y == mask.Points[1].Y {
+				return fmt.Errorf("mask %d: rectangle has no area", i+1)
+			}
+		case ShapePolygon:
+			if len(mask.Points) < 3 {
+				return fmt.Errorf("mask %d: a polygon needs at least three points", i+1)
+			}
+		default:
+			return fmt.Errorf("mask %d: unknown shape %q", i+1, mask.Shape)
+		}
+
+		for _, p := range mask.Points {
+			if p.X < 0 || p.X > 1 || p.Y < 0 || p.Y > 1 {
+				return fmt.Errorf("mask %d: points must be relative to the image size (0 to 1)", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// Render builds the question and answer SVGs for the mask at index target.
+// The question covers the target (and every other mask when hideAll is set);
+// the answer reveals the target with an outline and its label.
+func Render(note models.OcclusionNoteModel, target int) (string, string, error) {
+	if target < 0 || target >= len(note.Masks) {
+		return "", "", fmt.Errorf("mask %d does not exist", target)
+	}
+
+	var question, answer strings.Builder
+	openSVG(&question, note)
+	openSVG(&answer, note)
+
+	for i, mask := range note.Masks {
+		switch {
+		case i == target:
+			writeShape(&question, note, mask, questionFill, answerStroke)
+			writeShape(&answer, note, mask, "none", answerStroke)
+			writeLabel(&answer, note, mask)
+		case note.HideAll:
+			writeShape(&question, note, mask, hiddenFill, maskStroke)
+			writeShape(&answer, note, mask, hiddenFill, maskStroke)
+		}
+	}
+
+	question.WriteString("</svg>")
+	answer.WriteString("</svg>")
+	return question.String(), answer.String(), nil
+}
+
+func openSVG(b *strings.Builder, note models.OcclusionNoteModel) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%">`, note.Width, note.Height)
+	fmt.Fprintf(b, `<image href="%s" x="0" y="0" width="%d" height="%d"/>`, html.EscapeString(note.ImageURL), note.Width, note.Height)
+}
+
+func writeShape(b *strings.Builder, note models.OcclusionNoteModel, mask models.OcclusionMaskModel, fill string, stroke string) {
+	w, h := float64(note.Width), float64(note.Height)
+	strokeWidth := math.Max(1, math.Min(w, h)/200)
+	switch mask.Shape {
+	case ShapeRect:
+		x0, x1 := mask.Points[0].X*w, mask.Points[1].X*w
+		y0, y1 := mask.Points[0].Y*h, mask.Points[1].Y*h
+		if x1 < x0 {
+			x0, x1 = x1, x0
+		}
+		if y1 < y0 {
+			y0, y1 = y1, y0
+		}
+		fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" stroke="%s" stroke-width="%.1f"/>`,
+			x0, y0, x1-x0, y1-y0, fill, stroke, strokeWidth)
+	case ShapePolygon:
+		points := make([]string, len(mask.Points))
+		for i, p := range mask.Points {
+			points[i] = fmt.Sprintf("%.1f,%.1f", p.X*w, p.Y*h)
+		}
+		fmt.Fprintf(b, `<polygon points="%s" fill="%s" stroke="%s" stroke-width="%.1f"/>`,
+			strings.Join(points, " "), fill, stroke, strokeWidth)
+	}
+}
+
+// writeLabel places the mask label at the centre of the mask
+func writeLabel(b *strings.Builder, note models.OcclusionNoteModel, mask models.OcclusionMaskModel) {
+	if mask.Label == "" {
+		return
+	}
+
+	var cx, cy float64
+	for _, p := range mask.Points {
+		cx += p.X
+		cy += p.Y
+	}
+	cx = cx / float64(len(mask.Points)) * float64(note.Width)
+	cy = cy / float64(len(mask.Points)) * float64(note.Height)
+
+	fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="middle" dominant-baseline="middle" fill="%s" font-weight="bold">%s</text>`,
+		cx, cy, answerStroke, html.EscapeString(mask.Label))
+}
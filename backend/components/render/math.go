@@ -0,0 +1,191 @@
+package render
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// mathSpan is a piece of TeX cut out of the Markdown so the Markdown parser can't mangle it
+type mathSpan struct {
+	tex     string
+	display bool
+}
+
+// placeholder is made of letters and digits only, so Markdown leaves it alone. The nonce is random for
+// every render so text in the card can't forge a placeholder.
+func placeholder(nonce string, i int) string {
+	return fmt.Sprintf("MATH%sX%dX", nonce, i)
+}
+
+func newNonce() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate math placeholder: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// extractMath replaces $...$ and $$...$$ outside of code with placeholders and returns the math it removed.
+// Like Pandoc, inline math must not start or end with a space and the closing $ must not be followed by a
+// digit, so prices such as $5 and $10 are left alone. \$ is a literal dollar sign.
+func extractMath(source string, nonce string) (string, []mathSpan) {
+	var out strings.Builder
+	var spans []mathSpan
+
+	lines := strings.SplitAfter(source, "\n")
+	var text strings.Builder
+	fence := ""
+	flush := func() {
+		out.WriteString(extractInlineMath(text.String(), nonce, &spans))
+		text.Reset()
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		switch {
+		case fence != "":
+			out.WriteString(line)
+			if strings.HasPrefix(strings.TrimSpace(line), fence) && strings.Trim(strings.TrimSpace(line), fence[:1]) == "" {
+				fence = ""
+			}
+		case indent <= 3 && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			flush()
+			fence = trimmed[:3]
+			for len(fence) < len(trimmed) && trimmed[len(fence)] == fence[0] {
+				fence += fence[:1]
+			}
+			out.WriteString(line)
+		default:
+			text.WriteString(line)
+		}
+	}
+	flush()
+
+	return out.String(), spans
+}
+
+// extractInlineMath handles the text between fenced code blocks, skipping code spans
+func extractInlineMath(text string, nonce string, spans *[]mathSpan) string {
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && text[i+1] == '$':
+			out.WriteString(text[i : i+2])
+			i += 2
+		case c == '`':
+			n := runLength(text, i, '`')
+			end := findBacktickRun(text, i+n, n)
+			if end < 0 {
+				out.WriteString(text[i : i+n])
+				i += n
+				continue
+			}
+			out.WriteString(text[i : end+n])
+			i = end + n
+		case c == '$' && strings.HasPrefix(text[i:], "$$"):
+			end := strings.Index(text[i+2:], "$$")
+			if end < 0 || strings.TrimSpace(text[i+2:i+2+end]) == "" {
+				out.WriteString("$$")
+				i += 2
+				continue
+			}
+			*spans = append(*spans, mathSpan{tex: strings.TrimSpace(text[i+2 : i+2+end]), display: true})
+			out.WriteString(placeholder(nonce, len(*spans)-1))
+			i += end + 4
+		case c == '$':
+			end := findInlineMathEnd(text, i+1)
+			if end < 0 {
+				out.WriteByte(c)
+				i++
+				continue
+			}
+			*spans = append(*spans, mathSpan{tex: text[i+1 : end]})
+			out.WriteString(placeholder(nonce, len(*spans)-1))
+			i = end + 1
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.String()
+}
+
+func runLength(text string, start int, c byte) int {
+	n := 0
+	for start+n < len(text) && text[start+n] == c {
+		n++
+	}
+	return n
+}
+
+// findBacktickRun finds the next run of exactly n backticks, which closes a code span
+func findBacktickRun(text string, start int, n int) int {
+	for i := start; i < len(text); {
+		if text[i] != '`' {
+			i++
+			continue
+		}
+		run := runLength(text, i, '`')
+		if run == n {
+			return i
+		}
+		i += run
+	}
+	return -1
+}
+
+// findInlineMathEnd returns the index of the $ closing inline math opened just before start, or -1
+func findInlineMathEnd(text string, start int) int {
+	if start >= len(text) || text[start] == ' ' || text[start] == '\n' || text[start] == '$' {
+		return -1
+	}
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '\n':
+			// Inline math can't span a blank line
+			if strings.TrimSpace(lineAfter(text, i)) == "" {
+				return -1
+			}
+		case '$':
+			if text[i-1] == ' ' || text[i-1] == '\n' {
+				return -1
+			}
+			if i+1 < len(text) && text[i+1] >= '0' && text[i+1] <= '9' {
+				return -1
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+func lineAfter(text string, newline int) string {
+	rest := text[newline+1:]
+	if end := strings.IndexByte(rest, '\n'); end >= 0 {
+		return rest[:end]
+	}
+	return rest
+}
+
+// restoreMath puts the extracted math back as escaped TeX in elements KaTeX can find by class.
+// The result must still be sanitized, as a placeholder may have ended up inside an attribute.
+func restoreMath(rendered string, nonce string, spans []mathSpan) string {
+	for i, span := range spans {
+		tex := html.EscapeString(span.tex)
+		if span.display {
+			block := `<div class="math math-display">` + tex + `</div>`
+			rendered = strings.Replace(rendered, "<p>"+placeholder(nonce, i)+"</p>", block, 1)
+			rendered = strings.Replace(rendered, placeholder(nonce, i), block, 1)
+			continue
+		}
+		rendered = strings.Replace(rendered, placeholder(nonce, i), `<span class="math math-inline">`+tex+`</span>`, 1)
+	}
+	return rendered
+}
@@ -0,0 +1,162 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const testNonce = "0123456789abcdef"
+
+func TestExtractMath(t *testing.T) {
+	cases := []struct {
+		source string
+		text   string
+		spans  []mathSpan
+	}{
+		{"$x^2$", placeholder(testNonce, 0), []mathSpan{{tex: "x^2"}}},
+		{"a $$\\sum_i i$$ b", "a " + placeholder(testNonce, 0) + " b", []mathSpan{{tex: "\\sum_i i", display: true}}},
+		{"$$\n x \n$$", placeholder(testNonce, 0), []mathSpan{{tex: "x", display: true}}},
+		{"$a$ and $b$", placeholder(testNonce, 0) + " and " + placeholder(testNonce, 1), []mathSpan{{tex: "a"}, {tex: "b"}}},
+		// Prices and escaped dollars aren't math
+		{"costs $5 or $10", "costs $5 or $10", nil},
+		{"\\$x\\$", "\\$x\\$", nil},
+		{"$ x $", "$ x $", nil},
+		{"$x $", "$x $", nil},
+		{"$x$5", "$x$5", nil},
+		// Math can't span a blank line
+		{"$a\n\nb$", "$a\n\nb$", nil},
+		// Code is left alone
+		{"`$x$`", "`$x$`", nil},
+		{"```\n$x$\n```\n$y$", "```\n$x$\n```\n" + placeholder(testNonce, 0), []mathSpan{{tex: "y"}}},
+		{"``a ` $x$``", "``a ` $x$``", nil},
+		// Unclosed delimiters
+		{"$x", "$x", nil},
+		{"$$x", "$$x", nil},
+		{"$$ $$", "$$ $$", nil},
+	}
+
+	for _, tc := range cases {
+		text, spans := extractMath(tc.source, testNonce)
+		if text != tc.text {
+			t.Errorf("extractMath(%q): expected text %q, got %q", tc.source, tc.text, text)
+		}
+		if len(spans) != len(tc.spans) {
+			t.Errorf("extractMath(%q): expected spans %v, got %v", tc.source, tc.spans, spans)
+			continue
+		}
+		for i := range spans {
+			if spans[i] != tc.spans[i] {
+				t.Errorf("extractMath(%q): expected spans %v, got %v", tc.source, tc.spans, spans)
+			}
+		}
+	}
+}
+
+func TestRestoreMathEscapesTeX(t *testing.T) {
+	spans := []mathSpan{{tex: `</span><script>alert(1)</script>`}, {tex: `"><img src=x>`, display: true}}
+	rendered := "<p>" + placeholder(testNonce, 0) + "</p>\n<p>" + placeholder(testNonce, 1) + "</p>"
+
+	got := restoreMath(rendered, testNonce, spans)
+	want := `<p><span class="math math-inline">&lt;/span&gt;&lt;script&gt;alert(1)&lt;/script&gt;</span></p>` + "\n" +
+		`<div class="math math-display">&#34;&gt;&lt;img src=x&gt;</div>`
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+// checkSafe parses rendered HTML and fails if it contains anything a card must not be able to inject
+func checkSafe(t *testing.T, source string, rendered string) {
+	t.Helper()
+
+	doc, err := html.Parse(strings.NewReader(rendered))
+	if err != nil {
+		t.Fatalf("Failed to parse output of %q: %v", source, err)
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "script", "style", "iframe", "object", "embed", "svg", "math":
+				t.Errorf("Rendering %q produced a <%s> element: %s", source, n.Data, rendered)
+			}
+			for _, attr := range n.Attr {
+				if strings.HasPrefix(strings.ToLower(attr.Key), "on") || attr.Key == "style" {
+					t.Errorf("Rendering %q produced a %s attribute: %s", source, attr.Key, rendered)
+				}
+				if attr.Key == "class" && strings.ContainsAny(attr.Val, `"<>=`) {
+					t.Errorf("Rendering %q produced an unexpected class %q: %s", source, attr.Val, rendered)
+				}
+				if (attr.Key == "href" || attr.Key == "src") && strings.HasPrefix(strings.ToLower(strings.TrimSpace(attr.Val)), "javascript:") {
+					t.Errorf("Rendering %q produced a javascript: URL: %s", source, rendered)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+}
+
+func TestMarkdownMathCannotInjectMarkup(t *testing.T) {
+	sources := []string{
+		`$<script>alert(1)</script>$`,
+		`$$</div><img src=x onerror=alert(1)>$$`,
+		`$x" onmouseover="alert(1)$`,
+		// Placeholders can't be forged, whatever nonce an attacker guesses
+		`[link](MATH0123456789abcdefX0X) $ onmouseover=alert(1) x$`,
+		`<a title="MATH0123456789abcdefX0X">t</a> $" onmouseover="alert(1)$`,
+		// Math whose placeholder lands inside an attribute
+		`[$x$](https://example.com "$" onmouseover="alert(1)$")`,
+		"![$\" onerror=\"alert(1)$](x.png)",
+		`<img alt="$" src=x onerror=alert(1) x="$">`,
+		`<span class="$x$">a</span>`,
+		"```\n</code><script>alert(1)</script>\n```",
+		`[x](javascript:alert(1)) $y$`,
+	}
+
+	for _, source := range sources {
+		rendered, err := Markdown(source)
+		if err != nil {
+			t.Fatalf("Failed to render %q: %v", source, err)
+		}
+		checkSafe(t, source, rendered)
+	}
+}
+
+func TestMarkdownRendersMath(t *testing.T) {
+	rendered, err := Markdown("Euler: $e^{i\\pi} + 1 = 0$\n\n$$\na < b\n$$")
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+
+	want := []string{
+		`<span class="math math-inline">e^{i\pi} + 1 = 0</span>`,
+		`<div class="math math-display">a &lt; b</div>`,
+	}
+	for _, w := range want {
+		if !strings.Contains(rendered, w) {
+			t.Errorf("Expected %q in %q", w, rendered)
+		}
+	}
+	if strings.Contains(rendered, "MATH") {
+		t.Errorf("Expected every placeholder to be replaced, got %q", rendered)
+	}
+}
+
+func TestMarkdownLeavesLiteralPlaceholdersAlone(t *testing.T) {
+	source := "MATH0123456789abcdefX0X $x$"
+	rendered, err := Markdown(source)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if !strings.Contains(rendered, "MATH0123456789abcdefX0X") {
+		t.Errorf("Expected text that looks like a placeholder to be kept, got %q", rendered)
+	}
+	if strings.Count(rendered, "math-inline") != 1 {
+		t.Errorf("Expected exactly one math span, got %q", rendered)
+	}
+}
@@ -0,0 +1,70 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// codeStyle is the chroma style used for the stylesheet returned by HighlightCSS
+const codeStyle = "github"
+
+var (
+	// Raw HTML is passed through by goldmark and removed by the sanitizer instead,
+	// so harmless tags like <br> and <sub> keep working in cards
+	markdown = goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			highlighting.NewHighlighting(
+				highlighting.WithStyle(codeStyle),
+				highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+			),
+		),
+		goldmark.WithRendererOptions(html.WithHardWraps(), html.WithUnsafe()),
+	)
+
+	policy = newPolicy()
+)
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// Syntax highlighting is done with chroma's CSS classes
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9_\- ]+$`)).OnElements("pre", "code", "span", "div")
+	// Task list checkboxes from GFM
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// Markdown renders card Markdown to sanitized HTML. Fenced code blocks are highlighted with CSS classes
+// (see HighlightCSS) and $...$ / $$...$$ math is left as TeX in .math elements for KaTeX to render.
+func Markdown(source string) (string, error) {
+	nonce := newNonce()
+	text, math := extractMath(source, nonce)
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(text), &buf); err != nil {
+		return "", fmt.Errorf("failed to render markdown: %v", err)
+	}
+
+	// Math goes back in before sanitizing so nothing in it can get past the sanitizer
+	return policy.Sanitize(restoreMath(buf.String(), nonce, math)), nil
+}
+
+// HighlightCSS returns the stylesheet for the classes used in highlighted code blocks
+func HighlightCSS() (string, error) {
+	var buf bytes.Buffer
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+	if err := formatter.WriteCSS(&buf, styles.Get(codeStyle)); err != nil {
+		return "", fmt.Errorf("failed to write highlight stylesheet: %v", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,32 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// textPolicy removes every tag, leaving only the text of the rendered card
+var textPolicy = bluemonday.StrictPolicy()
+
+// PlainText returns the words of card Markdown as they read on the rendered card, for reading aloud.
+// Formatting is removed, and so are math, images and other media, which don't make sense spoken.
+func PlainText(source string) (string, error) {
+	nonce := newNonce()
+	text, math := extractMath(source, nonce)
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(text), &buf); err != nil {
+		return "", fmt.Errorf("failed to render markdown: %v", err)
+	}
+
+	rendered := buf.String()
+	for i := range math {
+		rendered = strings.ReplaceAll(rendered, placeholder(nonce, i), "")
+	}
+	plain := html.UnescapeString(textPolicy.Sanitize(rendered))
+	return strings.Join(strings.Fields(plain), " "), nil
+}
@@ -0,0 +1,31 @@
+package render
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	cases := []struct {
+		source string
+		want   string
+	}{
+		{"What is **mitochondria**?", "What is mitochondria?"},
+		{"# Heading\n\n- first\n- second", "Heading first second"},
+		{"A [link](https://example.com) and `code`", "A link and code"},
+		{"Area is $\\pi r^2$ for a circle", "Area is for a circle"},
+		{"$$\n\\sum_i i\n$$\nSum", "Sum"},
+		{"costs $5 or $10", "costs $5 or $10"},
+		{"![diagram](/media/abc.png) Label", "Label"},
+		{"<audio src=\"/media/abc.mp3\"></audio>Listen", "Listen"},
+		{"Tom &amp; Jerry <script>alert(1)</script>", "Tom & Jerry"},
+		{"", ""},
+	}
+
+	for _, tc := range cases {
+		got, err := PlainText(tc.source)
+		if err != nil {
+			t.Fatalf("%q: failed to get plain text: %v", tc.source, err)
+		}
+		if got != tc.want {
+			t.Errorf("%q: expected %q, got %q", tc.source, tc.want, got)
+		}
+	}
+}
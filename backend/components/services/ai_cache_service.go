@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/ai/chat"
+	"github.com/jorkle/brightcards/backend/components/database"
+)
+
+const (
+	// aiCacheTTLSetting is how many hours a cached AI response is reused; 0 turns the cache off
+	aiCacheTTLSetting = "ai_cache_ttl_hours"
+
+	defaultAICacheTTL = 7 * 24 // hours
+)
+
+// aiResponseCache keeps the responses of repeated AI requests in the database. It holds the cache lifetime,
+// read when the app starts and updated by SaveAICacheTTL, so requests don't read the setting each time.
+type aiResponseCache struct {
+	mutex sync.RWMutex
+	ttl   time.Duration
+}
+
+// responseCache is the cache registered by CacheAIResponses
+var responseCache = &aiResponseCache{}
+
+// setTTL sets how many hours responses are reused; 0 turns the cache off
+func (c *aiResponseCache) setTTL(hours int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ttl = time.Duration(hours) * time.Hour
+}
+
+func (c *aiResponseCache) getTTL() time.Duration {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.ttl
+}
+
+func (c *aiResponseCache) Get(ctx context.Context, key string) (string, bool) {
+	if c.getTTL() == 0 {
+		return "", false
+	}
+
+	content, err := database.CachedAIResponseContext(ctx, key, time.Now())
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			println("Warning: failed to read AI response cache:", err.Error())
+		}
+		return "", false
+	}
+	return content, true
+}
+
+func (c *aiResponseCache) Put(ctx context.Context, key string, operation string, content string) {
+	ttl := c.getTTL()
+	if ttl == 0 {
+		return
+	}
+
+	now := time.Now()
+	if err := database.SaveAIResponseContext(ctx, key, operation, content, now, now.Add(ttl)); err != nil {
+		println("Warning: failed to cache AI response:", err.Error())
+	}
+}
+
+// CacheAIResponses reuses the responses of repeated AI requests, such as generating flashcards from the same notes,
+// and drops the cached responses that have expired. The cache stays off if its lifetime can't be read.
+func CacheAIResponses() error {
+	ttl, err := GetAICacheTTL()
+	responseCache.setTTL(ttl)
+	chat.SetResponseCache(responseCache)
+	if err != nil {
+		return err
+	}
+
+	if err := database.DeleteExpiredAIResponses(time.Now()); err != nil {
+		return fmt.Errorf("failed to clear expired AI responses: %v", err)
+	}
+	return nil
+}
+
+// GetAICacheTTL returns how many hours a cached AI response is reused, 0 when the cache is off
+func GetAICacheTTL() (int, error) {
+	value, err := database.GetSetting(aiCacheTTLSetting)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get AI cache settings: %v", err)
+	}
+	if value == "" {
+		return defaultAICacheTTL, nil
+	}
+
+	hours, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AI cache lifetime %q: %v", value, err)
+	}
+	return hours, nil
+}
+
+// SaveAICacheTTL sets how many hours a cached AI response is reused; 0 turns the cache off
+func SaveAICacheTTL(hours int) error {
+	if hours < 0 {
+		return fmt.Errorf("AI cache lifetime can't be negative")
+	}
+	if err := database.SaveSetting(aiCacheTTLSetting, strconv.Itoa(hours)); err != nil {
+		return fmt.Errorf("failed to save AI cache settings: %v", err)
+	}
+	responseCache.setTTL(hours)
+	return nil
+}
+
+// ClearAICache removes the cached responses of an operation such as "generate_flashcards",
+// or every cached response when it is empty, and returns how many were removed
+func ClearAICache(operation string) (int, error) {
+	removed, err := database.DeleteAIResponses(operation)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear AI cache: %v", err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+)
+
+// useResponseCache registers the AI response cache for the rest of the test
+func useResponseCache(t *testing.T) {
+	t.Helper()
+
+	if err := CacheAIResponses(); err != nil {
+		t.Fatalf("Failed to set up AI response cache: %v", err)
+	}
+	t.Cleanup(func() { responseCache.setTTL(0) })
+}
+
+func TestAIResponseCacheTTL(t *testing.T) {
+	useTestDatabase(t)
+	useResponseCache(t)
+	ctx := context.Background()
+
+	// The default lifetime
+	responseCache.Put(ctx, "key", "test", "Answer")
+	if content, ok := responseCache.Get(ctx, "key"); !ok || content != "Answer" {
+		t.Fatalf("Expected the cached answer, got %q (%v)", content, ok)
+	}
+	expiry := time.Now().Add(defaultAICacheTTL * time.Hour)
+	if _, err := database.CachedAIResponse("key", expiry.Add(-time.Minute)); err != nil {
+		t.Errorf("Expected the answer to be kept until just before %v, got %v", expiry, err)
+	}
+	if _, err := database.CachedAIResponse("key", expiry.Add(time.Minute)); err == nil {
+		t.Errorf("Expected the answer to expire at %v", expiry)
+	}
+
+	// A saved lifetime applies to the responses cached after it
+	if err := SaveAICacheTTL(1); err != nil {
+		t.Fatalf("Failed to save AI cache lifetime: %v", err)
+	}
+	responseCache.Put(ctx, "short", "test", "Answer")
+	if _, err := database.CachedAIResponse("short", time.Now().Add(2*time.Hour)); err == nil {
+		t.Errorf("Expected the answer to expire after an hour")
+	}
+
+	// Turning the cache off stops it reusing and saving responses
+	if err := SaveAICacheTTL(0); err != nil {
+		t.Fatalf("Failed to save AI cache lifetime: %v", err)
+	}
+	if _, ok := responseCache.Get(ctx, "key"); ok {
+		t.Errorf("Expected no answer with the cache off")
+	}
+	responseCache.Put(ctx, "off", "test", "Answer")
+	if _, err := database.CachedAIResponse("off", time.Now()); err == nil {
+		t.Errorf("Expected no answer to be saved with the cache off")
+	}
+
+	// The lifetime saved is used when the app starts again
+	if err := CacheAIResponses(); err != nil {
+		t.Fatalf("Failed to set up AI response cache: %v", err)
+	}
+	if ttl := responseCache.getTTL(); ttl != 0 {
+		t.Errorf("Expected the cache to stay off, got a lifetime of %v", ttl)
+	}
+}
+
+func TestCacheAIResponsesDropsExpired(t *testing.T) {
+	useTestDatabase(t)
+
+	now := time.Now()
+	if err := database.SaveAIResponse("expired", "test", "Old", now.Add(-2*time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Failed to cache response: %v", err)
+	}
+	if err := database.SaveAIResponse("fresh", "test", "New", now, now.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to cache response: %v", err)
+	}
+	useResponseCache(t)
+
+	// Only the fresh response is left to clear
+	if removed, err := ClearAICache(""); err != nil || removed != 1 {
+		t.Errorf("Expected 1 response to be left, got %d (%v)", removed, err)
+	}
+}
+
+func TestClearAICache(t *testing.T) {
+	useTestDatabase(t)
+
+	now := time.Now()
+	for key, operation := range map[string]string{"a": "generate_flashcards", "b": "generate_flashcards", "c": "process_text"} {
+		if err := database.SaveAIResponse(key, operation, "Answer", now, now.Add(time.Hour)); err != nil {
+			t.Fatalf("Failed to cache response: %v", err)
+		}
+	}
+
+	if removed, err := ClearAICache("generate_flashcards"); err != nil || removed != 2 {
+		t.Errorf("Expected 2 responses to be removed, got %d (%v)", removed, err)
+	}
+	if _, err := database.CachedAIResponse("c", now); err != nil {
+		t.Errorf("Expected other operations to be kept, got %v", err)
+	}
+	if removed, err := ClearAICache("process_text"); err != nil || removed != 1 {
+		t.Errorf("Expected 1 response to be removed, got %d (%v)", removed, err)
+	}
+	if removed, err := ClearAICache(""); err != nil || removed != 0 {
+		t.Errorf("Expected nothing left to remove, got %d (%v)", removed, err)
+	}
+}
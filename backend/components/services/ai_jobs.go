@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/ai/chat"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// AIJobEvent is emitted with the models.AIJobModel of a job whenever its status changes
+const AIJobEvent = "ai:job"
+
+// Kinds of AI job
+const (
+	AIJobGenerateFlashcards = "generate_flashcards"
+	AIJobRephraseFlashcard  = "rephrase_flashcard"
+	AIJobProcessText        = "process_text"
+	AIJobRewriteLeech       = "rewrite_leech"
+	AIJobAutoRephrase       = "auto_rephrase"
+)
+
+const (
+	// aiJobWorkers is how many AI jobs run at the same time
+	aiJobWorkers = 2
+
+	// aiJobMaxAttempts is how many times a job is tried before it fails for good on errors worth retrying
+	aiJobMaxAttempts = 5
+
+	// A retried job waits aiJobBaseBackoff, doubled for every earlier attempt, up to aiJobMaxBackoff
+	aiJobBaseBackoff = 2 * time.Second
+	aiJobMaxBackoff  = 5 * time.Minute
+
+	// aiJobPollInterval is how often idle workers look for jobs whose retry delay has passed
+	aiJobPollInterval = 5 * time.Second
+
+	// aiJobListSize is how many recent jobs GetAIJobs returns
+	aiJobListSize = 100
+)
+
+// GenerateFlashcardsPayload is the input of a generate_flashcards job, whose result is a list of chat.Flashcard
+type GenerateFlashcardsPayload struct {
+	InputText string `json:"inputText"`
+	Purpose   string `json:"purpose"`
+	MaxCards  int    `json:"maxCards"`
+}
+
+// RephraseFlashcardPayload is the input of a rephrase_flashcard job, whose result is the list of variants created
+type RephraseFlashcardPayload struct {
+	DeckId        int `json:"deckId"`
+	CardId        int `json:"cardId"`
+	MaxVariations int `json:"maxVariations"`
+}
+
+// ProcessTextPayload is the input of a process_text job, whose result is a chat.AnalysisResponse
+type ProcessTextPayload struct {
+	InputText string `json:"inputText"`
+}
+
+// aiJobHandler runs a job from its JSON payload. It should give up when ctx is cancelled.
+type aiJobHandler func(ctx context.Context, jobId int, payload string) (interface{}, error)
+
+var aiJobHandlers = map[string]aiJobHandler{
+	AIJobGenerateFlashcards: func(ctx context.Context, _ int, payload string) (interface{}, error) {
+		var input GenerateFlashcardsPayload
+		if err := json.Unmarshal([]byte(payload), &input); err != nil {
+			return nil, fmt.Errorf("invalid payload: %v", err)
+		}
+		return GenerateFlashcardsContext(ctx, input.InputText, input.Purpose, input.MaxCards)
+	},
+	AIJobRephraseFlashcard: func(ctx context.Context, _ int, payload string) (interface{}, error) {
+		var input RephraseFlashcardPayload
+		if err := json.Unmarshal([]byte(payload), &input); err != nil {
+			return nil, fmt.Errorf("invalid payload: %v", err)
+		}
+		return RephraseFlashcardContext(ctx, input.DeckId, input.CardId, input.MaxVariations)
+	},
+	AIJobProcessText: func(ctx context.Context, _ int, payload string) (interface{}, error) {
+		var input ProcessTextPayload
+		if err := json.Unmarshal([]byte(payload), &input); err != nil {
+			return nil, fmt.Errorf("invalid payload: %v", err)
+		}
+		return ProcessTextContext(ctx, input.InputText)
+	},
+	AIJobRewriteLeech: rewriteLeech,
+	AIJobAutoRephrase: autoRephrase,
+}
+
+// aiJobFailureHandlers undo what queueing a job of their kind set up once the job has failed for good
+var aiJobFailureHandlers = map[string]func(jobId int, payload string, err error){
+	AIJobRewriteLeech: leechRewriteFailed,
+}
+
+// aiJobCancelHandlers undo what queueing a job of their kind set up once the job has been cancelled
+var aiJobCancelHandlers = map[string]func(jobId int, payload string){
+	AIJobRewriteLeech: leechRewriteCancelled,
+}
+
+var (
+	aiJobsOnce   sync.Once
+	aiJobWake    = make(chan struct{}, 1)
+	aiJobMutex   sync.Mutex
+	aiJobCancels = map[int]context.CancelFunc{}
+)
+
+// StartAIJobs queues again the jobs interrupted when the app last stopped and starts the workers that run them.
+// The workers stop when ctx, usually the app's context, is done; a job they were running is queued again
+// at the next start.
+func StartAIJobs(ctx context.Context) error {
+	var err error
+	aiJobsOnce.Do(func() {
+		if err = database.RequeueInterruptedAIJobs(); err != nil {
+			err = fmt.Errorf("failed to requeue AI jobs: %v", err)
+			return
+		}
+		for i := 0; i < aiJobWorkers; i++ {
+			go aiJobWorker(ctx)
+		}
+	})
+	return err
+}
+
+// wakeAIJobWorkers tells an idle worker there is a new job, without waiting if one has been told already
+func wakeAIJobWorkers() {
+	select {
+	case aiJobWake <- struct{}{}:
+	default:
+	}
+}
+
+// EnqueueAIJob stores a job of the given kind with its payload and returns it queued
+func EnqueueAIJob(kind string, payload interface{}) (models.AIJobModel, error) {
+	if _, ok := aiJobHandlers[kind]; !ok {
+		return models.AIJobModel{}, fmt.Errorf("unknown AI job kind: %s", kind)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return models.AIJobModel{}, fmt.Errorf("failed to encode job payload: %v", err)
+	}
+
+	job, err := database.CreateAIJob(kind, string(data), time.Now())
+	if err != nil {
+		return models.AIJobModel{}, fmt.Errorf("failed to queue AI job: %v", err)
+	}
+	announceAIJob(job)
+	return job, nil
+}
+
+// announceAIJob tells the frontend about a newly queued job and wakes a worker to run it
+func announceAIJob(job models.AIJobModel) {
+	emit(AIJobEvent, job)
+	wakeAIJobWorkers()
+}
+
+// EnqueueGenerateFlashcards queues the generation of flashcards from text
+func EnqueueGenerateFlashcards(inputText string, purpose string, maxCards int) (models.AIJobModel, error) {
+	return EnqueueAIJob(AIJobGenerateFlashcards, GenerateFlashcardsPayload{InputText: inputText, Purpose: purpose, MaxCards: maxCards})
+}
+
+// EnqueueRephraseFlashcard queues the rephrasing of a card into new variants
+func EnqueueRephraseFlashcard(deckId int, cardId int, maxVariations int) (models.AIJobModel, error) {
+	if _, err := database.Card(deckId, cardId); err != nil {
+		return models.AIJobModel{}, fmt.Errorf("failed to get flashcard: %v", err)
+	}
+	return EnqueueAIJob(AIJobRephraseFlashcard, RephraseFlashcardPayload{DeckId: deckId, CardId: cardId, MaxVariations: maxVariations})
+}
+
+// EnqueueProcessText queues the analysis of a Feynman explanation
+func EnqueueProcessText(inputText string) (models.AIJobModel, error) {
+	return EnqueueAIJob(AIJobProcessText, ProcessTextPayload{InputText: inputText})
+}
+
+// GetAIJob returns an AI job with its result once it has finished
+func GetAIJob(jobId int) (models.AIJobModel, error) {
+	job, err := database.AIJob(jobId)
+	if err != nil {
+		return models.AIJobModel{}, fmt.Errorf("failed to get AI job: %v", err)
+	}
+	return job, nil
+}
+
+// GetAIJobs returns the most recent AI jobs, newest first
+func GetAIJobs() ([]models.AIJobModel, error) {
+	jobs, err := database.AIJobs(aiJobListSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI jobs: %v", err)
+	}
+	return jobs, nil
+}
+
+// CancelAIJob cancels a queued job, or stops a running one; its result is discarded if it still arrives
+func CancelAIJob(jobId int) (models.AIJobModel, error) {
+	cancelled, err := cancelAIJob(jobId)
+	if err != nil {
+		return models.AIJobModel{}, err
+	}
+	if !cancelled {
+		return models.AIJobModel{}, fmt.Errorf("AI job %d has already finished", jobId)
+	}
+	return GetAIJob(jobId)
+}
+
+// cancelAIJob cancels a job that hasn't finished, reporting whether there was anything to cancel
+func cancelAIJob(jobId int) (bool, error) {
+	cancelled, err := database.CancelAIJob(jobId)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel AI job: %v", err)
+	}
+	if !cancelled {
+		return false, nil
+	}
+
+	aiJobMutex.Lock()
+	if cancel, ok := aiJobCancels[jobId]; ok {
+		cancel()
+	}
+	aiJobMutex.Unlock()
+
+	job, err := database.AIJob(jobId)
+	if err != nil {
+		println("Warning: failed to get cancelled AI job:", err.Error())
+		return true, nil
+	}
+	if onCancel, ok := aiJobCancelHandlers[job.Kind]; ok {
+		onCancel(job.ID, job.Payload)
+	}
+	emit(AIJobEvent, job)
+	return true, nil
+}
+
+// aiJobWorker runs queued jobs one at a time, waiting for new ones when the queue is empty, until ctx is done
+func aiJobWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := database.ClaimAIJobContext(ctx, time.Now())
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+				println("Warning: failed to get next AI job:", err.Error())
+			}
+			select {
+			case <-aiJobWake:
+			case <-time.After(aiJobPollInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		runAIJob(ctx, job)
+	}
+}
+
+// runAIJob runs a claimed job and stores its outcome, queueing it again with a backoff when the API
+// was rate limited, had a server error, couldn't be reached or timed out
+func runAIJob(ctx context.Context, job models.AIJobModel) {
+	emit(AIJobEvent, job)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	aiJobMutex.Lock()
+	aiJobCancels[job.ID] = cancel
+	aiJobMutex.Unlock()
+
+	result, err := aiJobHandlers[job.Kind](jobCtx, job.ID, job.Payload)
+
+	aiJobMutex.Lock()
+	delete(aiJobCancels, job.ID)
+	aiJobMutex.Unlock()
+	cancelled := jobCtx.Err() != nil
+	cancel()
+
+	// A cancelled job has been marked and announced by CancelAIJob already. A job stopped because ctx is done
+	// is left running, so it is queued again at the next start.
+	if cancelled {
+		return
+	}
+
+	switch {
+	case err != nil && chat.IsRetryable(err) && job.Attempts < aiJobMaxAttempts:
+		err = database.RetryAIJobContext(ctx, job.ID, time.Now().Add(aiJobBackoff(job.Attempts)), err.Error())
+	case err != nil:
+		if onFailure, ok := aiJobFailureHandlers[job.Kind]; ok {
+			onFailure(job.ID, job.Payload, err)
+		}
+		err = database.FinishAIJobContext(ctx, job.ID, database.AIJobFailed, "", err.Error())
+	default:
+		var data []byte
+		data, err = json.Marshal(result)
+		if err == nil {
+			err = database.FinishAIJobContext(ctx, job.ID, database.AIJobSucceeded, string(data), "")
+		}
+	}
+	if err != nil {
+		println("Warning: failed to store AI job outcome:", err.Error())
+		return
+	}
+
+	if job, err = database.AIJobContext(ctx, job.ID); err == nil {
+		emit(AIJobEvent, job)
+	}
+}
+
+// aiJobBackoff returns how long to wait before trying a job again after the given number of attempts
+func aiJobBackoff(attempts int) time.Duration {
+	backoff := aiJobBaseBackoff
+	for i := 1; i < attempts && backoff < aiJobMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, aiJobMaxBackoff)
+}
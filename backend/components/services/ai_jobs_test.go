@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+func TestRunAIJobRetries(t *testing.T) {
+	useTestDatabase(t)
+
+	offline := &url.Error{Op: "Post", URL: "https://api.openai.com/v1/chat/completions", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	cases := []struct {
+		name   string
+		err    error
+		status string
+	}{
+		{"network error", offline, database.AIJobQueued},
+		{"timeout", context.DeadlineExceeded, database.AIJobQueued},
+		{"invalid request", errors.New("no flashcards found in response"), database.AIJobFailed},
+	}
+	for _, tc := range cases {
+		kind := "test_" + tc.name
+		aiJobHandlers[kind] = func(context.Context, int, string) (interface{}, error) {
+			return nil, tc.err
+		}
+		t.Cleanup(func() { delete(aiJobHandlers, kind) })
+
+		if _, err := database.CreateAIJob(kind, "{}", time.Now()); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		job, err := database.ClaimAIJob(time.Now())
+		if err != nil {
+			t.Fatalf("Failed to claim job: %v", err)
+		}
+		started := time.Now()
+		runAIJob(context.Background(), job)
+
+		job, err = database.AIJob(job.ID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Status != tc.status || job.Error != tc.err.Error() {
+			t.Errorf("%s: expected the job to be %s with its error, got %s with %q", tc.name, tc.status, job.Status, job.Error)
+		}
+		if tc.status != database.AIJobQueued {
+			continue
+		}
+		runAfter, err := time.Parse(time.RFC3339, job.RunAfter)
+		if err != nil {
+			t.Fatalf("Failed to parse run_after: %v", err)
+		}
+		if runAfter.Before(started.Add(aiJobBaseBackoff - time.Second)) {
+			t.Errorf("%s: expected the retry to wait %v, got %v", tc.name, aiJobBaseBackoff, runAfter.Sub(started))
+		}
+	}
+
+	// A job out of attempts fails for good
+	aiJobHandlers["test_offline"] = func(context.Context, int, string) (interface{}, error) {
+		return nil, offline
+	}
+	t.Cleanup(func() { delete(aiJobHandlers, "test_offline") })
+	created, err := database.CreateAIJob("test_offline", "{}", time.Now())
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	if _, err := database.DB.Exec("UPDATE ai_jobs SET attempts = ? WHERE id = ?", aiJobMaxAttempts-1, created.ID); err != nil {
+		t.Fatalf("Failed to set attempts: %v", err)
+	}
+	job, err := database.ClaimAIJob(time.Now())
+	if err != nil || job.ID != created.ID {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+	runAIJob(context.Background(), job)
+	if job, err := database.AIJob(job.ID); err != nil || job.Status != database.AIJobFailed {
+		t.Errorf("Expected the job to fail after %d attempts, got %+v (%v)", aiJobMaxAttempts, job, err)
+	}
+}
+
+func TestCancelRunningAIJob(t *testing.T) {
+	useTestDatabase(t)
+
+	started := make(chan struct{})
+	aiJobHandlers["test_blocking"] = func(ctx context.Context, _ int, _ string) (interface{}, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	t.Cleanup(func() { delete(aiJobHandlers, "test_blocking") })
+
+	// run claims a blocking job and runs it with ctx until stop is called, returning the job as it was left
+	run := func(ctx context.Context, stop func()) models.AIJobModel {
+		t.Helper()
+		if _, err := database.CreateAIJob("test_blocking", "{}", time.Now()); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		job, err := database.ClaimAIJob(time.Now())
+		if err != nil {
+			t.Fatalf("Failed to claim job: %v", err)
+		}
+
+		finished := make(chan struct{})
+		go func() {
+			runAIJob(ctx, job)
+			close(finished)
+		}()
+		<-started
+		stop()
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the job to stop once cancelled")
+		}
+
+		job, err = database.AIJob(job.ID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		return job
+	}
+
+	// Cancelling the job stops its handler and marks it cancelled
+	var jobId int
+	job := run(context.Background(), func() {
+		jobs, err := database.AIJobs(1)
+		if err != nil {
+			t.Fatalf("Failed to get AI jobs: %v", err)
+		}
+		jobId = jobs[0].ID
+		if _, err := CancelAIJob(jobId); err != nil {
+			t.Fatalf("Failed to cancel job: %v", err)
+		}
+	})
+	if job.ID != jobId || job.Status != database.AIJobCancelled {
+		t.Errorf("Expected the job to be cancelled, got %+v", job)
+	}
+
+	// Shutting the app down stops the job too, but leaves it to run again at the next start
+	ctx, shutdown := context.WithCancel(context.Background())
+	job = run(ctx, shutdown)
+	if job.Status != database.AIJobRunning {
+		t.Errorf("Expected the interrupted job to be left running, got %s", job.Status)
+	}
+	if err := database.RequeueInterruptedAIJobs(); err != nil {
+		t.Fatalf("Failed to requeue jobs: %v", err)
+	}
+	if job, err := database.AIJob(job.ID); err != nil || job.Status != database.AIJobQueued {
+		t.Errorf("Expected the interrupted job to be queued again, got %+v (%v)", job, err)
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jorkle/brightcards/backend/components/ai/chat"
+)
+
+// GenerateFlashcardsContext turns text into flashcards, giving up when ctx is done or after the AI request timeout
+func GenerateFlashcardsContext(ctx context.Context, inputText string, purpose string, maxCards int) ([]chat.Flashcard, error) {
+	ctx, cancel, err := withAITimeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	return chat.GenerateFlashcardsContext(ctx, inputText, purpose, maxCards)
+}
+
+// ProcessTextContext analyzes the transcript of a Feynman explanation, giving up after the AI request timeout
+func ProcessTextContext(ctx context.Context, inputText string) (*chat.AnalysisResponse, error) {
+	ctx, cancel, err := withAITimeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	analysis, err := chat.ProcessTextContext(ctx, inputText)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze transcription: %w", err)
+	}
+	return analysis, nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/ai/usage"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// aiMonthlyBudgetSetting is the most, in US dollars, the AI services may cost in a calendar month
+const aiMonthlyBudgetSetting = "ai_monthly_budget"
+
+// usageDateLayout is the format of the days given to GetAIUsage
+const usageDateLayout = "2006-01-02"
+
+// TrackAIUsage records the usage of every AI request and refuses new requests once the monthly budget is spent.
+// See checkAIBudget for how closely the budget is kept to.
+func TrackAIUsage() {
+	usage.SetRecorder(func(record usage.Record) {
+		entry := models.AIUsageModel{
+			Operation:        record.Operation,
+			Model:            record.Model,
+			PromptTokens:     record.PromptTokens,
+			CompletionTokens: record.CompletionTokens,
+			AudioSeconds:     record.AudioSeconds,
+			Characters:       record.Characters,
+			Cost:             usage.EstimateCost(record),
+		}
+		if err := database.RecordAIUsage(entry, time.Now()); err != nil {
+			println("Warning: failed to record AI usage:", err.Error())
+		}
+	})
+	usage.SetGuard(checkAIBudget)
+}
+
+// GetAIMonthlyBudget returns the monthly AI budget in US dollars, 0 when there is no cap.
+// A budget that can't be read as a number is ignored, so it doesn't block every AI request.
+func GetAIMonthlyBudget() (float64, error) {
+	value, err := database.GetSetting(aiMonthlyBudgetSetting)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get AI budget: %v", err)
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	budget, err := strconv.ParseFloat(value, 64)
+	if err != nil || budget < 0 {
+		println("Warning: ignoring invalid AI budget", strconv.Quote(value))
+		return 0, nil
+	}
+	return budget, nil
+}
+
+// SaveAIMonthlyBudget sets the monthly AI budget in US dollars; 0 removes the cap
+func SaveAIMonthlyBudget(budget float64) error {
+	if budget < 0 {
+		return fmt.Errorf("AI budget can't be negative")
+	}
+	if err := database.SaveSetting(aiMonthlyBudgetSetting, strconv.FormatFloat(budget, 'f', -1, 64)); err != nil {
+		return fmt.Errorf("failed to save AI budget: %v", err)
+	}
+	return nil
+}
+
+// monthStart returns the start of the calendar month containing now, in the study timezone
+func monthStart(now time.Time) (time.Time, error) {
+	settings, err := GetStudyDaySettings()
+	if err != nil {
+		return time.Time{}, err
+	}
+	location, err := studyLocation(settings)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := now.In(location)
+	return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, location), nil
+}
+
+// spentThisMonth returns the estimated cost of the AI requests made this calendar month
+func spentThisMonth() (float64, error) {
+	start, err := monthStart(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	spent, err := database.AIUsageCostSince(start)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get AI usage: %v", err)
+	}
+	return spent, nil
+}
+
+// checkAIBudget refuses new AI requests once this month's spending has reached the budget. The budget is a soft cap:
+// the cost of a request is only known once it is done, so requests already running, or let through at the same
+// time by several AI job workers, can take this month's spending past it.
+func checkAIBudget() error {
+	budget, err := GetAIMonthlyBudget()
+	if err != nil || budget == 0 {
+		return err
+	}
+
+	spent, err := spentThisMonth()
+	if err != nil {
+		return err
+	}
+	if spent >= budget {
+		return fmt.Errorf("monthly AI budget of $%.2f has been reached ($%.2f spent)", budget, spent)
+	}
+	return nil
+}
+
+// GetAIUsage adds up the AI usage of the days from one date to another, both included and written as YYYY-MM-DD
+// in the study timezone, along with this month's spending against the budget
+func GetAIUsage(from string, to string) (models.AIUsageSummary, error) {
+	settings, err := GetStudyDaySettings()
+	if err != nil {
+		return models.AIUsageSummary{}, err
+	}
+	location, err := studyLocation(settings)
+	if err != nil {
+		return models.AIUsageSummary{}, err
+	}
+
+	start, err := time.ParseInLocation(usageDateLayout, from, location)
+	if err != nil {
+		return models.AIUsageSummary{}, fmt.Errorf("invalid date %q: %v", from, err)
+	}
+	end, err := time.ParseInLocation(usageDateLayout, to, location)
+	if err != nil {
+		return models.AIUsageSummary{}, fmt.Errorf("invalid date %q: %v", to, err)
+	}
+	if end.Before(start) {
+		return models.AIUsageSummary{}, fmt.Errorf("%s is before %s", to, from)
+	}
+
+	totals, err := database.AIUsageTotals(start, end.AddDate(0, 0, 1))
+	if err != nil {
+		return models.AIUsageSummary{}, fmt.Errorf("failed to get AI usage: %v", err)
+	}
+
+	summary := models.AIUsageSummary{From: from, To: to, Totals: totals}
+	for _, total := range totals {
+		summary.Requests += total.Requests
+		summary.Cost += total.Cost
+	}
+
+	if summary.MonthlyBudget, err = GetAIMonthlyBudget(); err != nil {
+		return models.AIUsageSummary{}, err
+	}
+	if summary.SpentThisMonth, err = spentThisMonth(); err != nil {
+		return models.AIUsageSummary{}, err
+	}
+	return summary, nil
+}
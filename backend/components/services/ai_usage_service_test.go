@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+func TestCheckAIBudget(t *testing.T) {
+	useTestDatabase(t)
+
+	if err := database.RecordAIUsage(models.AIUsageModel{Operation: "test", Model: "gpt-4o", Cost: 2}, time.Now()); err != nil {
+		t.Fatalf("Failed to record usage: %v", err)
+	}
+
+	cases := []struct {
+		budget  string
+		allowed bool
+	}{
+		{"", true},
+		{"0", true},
+		{"5", true},
+		{"2", false},
+		{"1.5", false},
+		// A budget that can't be read is ignored rather than blocking every request
+		{"five dollars", true},
+		{"-1", true},
+	}
+	for _, tc := range cases {
+		if err := database.SaveSetting(aiMonthlyBudgetSetting, tc.budget); err != nil {
+			t.Fatalf("Failed to save budget: %v", err)
+		}
+		if err := checkAIBudget(); (err == nil) != tc.allowed {
+			t.Errorf("Budget %q: expected allowed %v, got %v", tc.budget, tc.allowed, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/audio"
+	"github.com/jorkle/brightcards/backend/components/database"
+)
+
+const (
+	// InputDeviceSettingKey is the settings key holding the selected capture device id
+	InputDeviceSettingKey = "audio_input_device"
+
+	// AudioFormatSettingKey is the settings key holding the format processed recordings are stored in
+	AudioFormatSettingKey = "audio_storage_format"
+
+	// MaxRecordingSecondsSettingKey is the settings key holding the recording length limit in seconds
+	MaxRecordingSecondsSettingKey = "recording_max_seconds"
+
+	// DefaultMaxRecordingSeconds stops forgotten recordings after ten minutes
+	DefaultMaxRecordingSeconds = 600
+
+	// InputLevelEvent is emitted with an audio.InputLevel payload while recording
+	InputLevelEvent = "audio:level"
+
+	// RecordingAutoStoppedEvent is emitted when a recording reaches its maximum length,
+	// with an error message payload that is empty if the recording was saved
+	RecordingAutoStoppedEvent = "audio:recording-auto-stopped"
+)
+
+// ListInputDevices returns the capture devices available for recording
+func ListInputDevices() ([]audio.CaptureDevice, error) {
+	recorder, err := audio.GetRecorder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recorder: %v", err)
+	}
+
+	return recorder.CaptureDevices()
+}
+
+// SetInputDevice selects and persists the capture device used for recording.
+// An empty id selects the system default device.
+func SetInputDevice(deviceId string) error {
+	recorder, err := audio.GetRecorder()
+	if err != nil {
+		return fmt.Errorf("failed to get recorder: %v", err)
+	}
+
+	if err := recorder.SetCaptureDevice(deviceId); err != nil {
+		return err
+	}
+
+	if err := database.SaveSetting(InputDeviceSettingKey, deviceId); err != nil {
+		return fmt.Errorf("failed to save input device: %v", err)
+	}
+
+	return nil
+}
+
+// GetInputDevice returns the persisted capture device id, or an empty string for the system default
+func GetInputDevice() (string, error) {
+	return database.GetSetting(InputDeviceSettingKey)
+}
+
+// SetAudioFormat sets the format processed recordings are encoded in ("flac" or "wav")
+func SetAudioFormat(format string) error {
+	if format != audio.FormatFLAC && format != audio.FormatWAV {
+		return fmt.Errorf("unsupported audio format: %s", format)
+	}
+	return database.SaveSetting(AudioFormatSettingKey, format)
+}
+
+// GetAudioFormat returns the format processed recordings are encoded in
+func GetAudioFormat() (string, error) {
+	format, err := database.GetSetting(AudioFormatSettingKey)
+	if err != nil {
+		return "", err
+	}
+	if format == "" {
+		format = audio.DefaultProcessingOptions().Format
+	}
+	return format, nil
+}
+
+// SetMaxRecordingSeconds sets the length after which recordings stop automatically. Zero disables the limit.
+func SetMaxRecordingSeconds(seconds int) error {
+	if seconds < 0 {
+		return fmt.Errorf("maximum recording length cannot be negative")
+	}
+	return database.SaveSetting(MaxRecordingSecondsSettingKey, strconv.Itoa(seconds))
+}
+
+// GetMaxRecordingSeconds returns the length after which recordings stop automatically
+func GetMaxRecordingSeconds() (int, error) {
+	value, err := database.GetSetting(MaxRecordingSecondsSettingKey)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return DefaultMaxRecordingSeconds, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid maximum recording length %q: %v", value, err)
+	}
+	return seconds, nil
+}
+
+// recordingProcessingOptions returns the processing options for recordings, honoring the saved format
+func recordingProcessingOptions() audio.ProcessingOptions {
+	opts := audio.DefaultProcessingOptions()
+	if format, err := GetAudioFormat(); err == nil {
+		opts.Format = format
+	}
+	return opts
+}
+
+// prepareRecorder applies the persisted input device and level reporting to the recorder
+func prepareRecorder(recorder *audio.Recorder) error {
+	deviceId, err := GetInputDevice()
+	if err != nil {
+		return fmt.Errorf("failed to load input device: %v", err)
+	}
+
+	if err := recorder.SetCaptureDevice(deviceId); err != nil {
+		// Fall back to the default device rather than refusing to record. A valid id for a device that has been
+		// unplugged is kept, and the recorder falls back when it can't open it.
+		println("Warning: ignoring saved input device:", err.Error())
+		recorder.SetCaptureDevice("")
+	}
+
+	maxSeconds, err := GetMaxRecordingSeconds()
+	if err != nil {
+		return fmt.Errorf("failed to load maximum recording length: %v", err)
+	}
+	recorder.SetMaxDuration(time.Duration(maxSeconds) * time.Second)
+
+	recorder.SetLevelCallback(func(level audio.InputLevel) {
+		emit(InputLevelEvent, level)
+	})
+	recorder.SetAutoStopCallback(func(err error) {
+		message := ""
+		if err != nil {
+			message = err.Error()
+		}
+		emit(RecordingAutoStoppedEvent, message)
+	})
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+	"github.com/jorkle/brightcards/backend/components/occlusion"
+)
+
+// AutoRephraseEvent is emitted with the card id and the number of variants added when a card was rephrased automatically
+const AutoRephraseEvent = "rephrase:auto"
+
+// autoRephraseSweepSize is how many mature cards are queued when the app starts
+const autoRephraseSweepSize = 50
+
+// autoRephraseRetryDelay is how long a card whose automatic rephrasing failed, for example because the AI kept
+// repeating existing phrasings, waits before it is tried again, so it doesn't cost a request on every review
+const autoRephraseRetryDelay = 7 * 24 * time.Hour
+
+// AutoRephrasePayload is the input of an auto_rephrase job, whose result is the list of variants created
+type AutoRephrasePayload struct {
+	DeckId int `json:"deckId"`
+	CardId int `json:"cardId"`
+}
+
+// queueAutoRephrase queues an AI job that rephrases a card if its deck has auto-rephrase on.
+// A card already waiting to be rephrased isn't queued twice, and one that failed recently isn't queued again.
+func queueAutoRephrase(deck database.DeckModel, card models.FlashcardModel) error {
+	if !deck.EnableAutoRephrase || deck.MaxRephrasedCards <= 0 || card.ParentCardId != nil || card.CardType == occlusion.CardType {
+		return nil
+	}
+
+	data, err := json.Marshal(AutoRephrasePayload{DeckId: deck.ID, CardId: card.ID})
+	if err != nil {
+		return fmt.Errorf("failed to encode job payload: %v", err)
+	}
+	now := time.Now()
+	job, queued, err := database.CreateUniqueAIJob(AIJobAutoRephrase, string(data), now.Add(-autoRephraseRetryDelay), now)
+	if err != nil {
+		return fmt.Errorf("failed to queue card for rephrasing: %v", err)
+	}
+	if queued {
+		announceAIJob(job)
+	}
+	return nil
+}
+
+// autoRephrase runs an auto_rephrase job, adding the variants a card is still missing. The deck is read again
+// in case its settings changed while the job was queued.
+func autoRephrase(ctx context.Context, _ int, payload string) (interface{}, error) {
+	var input AutoRephrasePayload
+	if err := json.Unmarshal([]byte(payload), &input); err != nil {
+		return nil, fmt.Errorf("invalid payload: %v", err)
+	}
+
+	deck, err := database.DeckContext(ctx, input.DeckId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deck: %v", err)
+	}
+	if !deck.EnableAutoRephrase {
+		return []models.FlashcardModel{}, nil
+	}
+
+	variants, err := database.CardVariantsContext(ctx, input.CardId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variants: %v", err)
+	}
+	missing := deck.MaxRephrasedCards - len(variants)
+	if missing <= 0 {
+		return []models.FlashcardModel{}, nil
+	}
+
+	created, err := RephraseFlashcardContext(ctx, input.DeckId, input.CardId, missing)
+	if err != nil {
+		return nil, err
+	}
+	emit(AutoRephraseEvent, input.CardId, len(created))
+	return created, nil
+}
+
+// autoRephraseAfterReview queues a card for rephrasing after it was recalled in a review
+func autoRephraseAfterReview(deck database.DeckModel, card models.FlashcardModel, grade int) error {
+	if grade == algorithms.GradeAgain || card.State != algorithms.StateReview {
+		return nil
+	}
+	return queueAutoRephrase(deck, card)
+}
+
+// QueueMatureCardsForRephrase queues mature cards of auto-rephrase decks that have fewer variants than allowed.
+// It is meant to run once in the background when the app starts, and stops early when ctx is done.
+func QueueMatureCardsForRephrase(ctx context.Context) error {
+	cards, err := database.CardsToRephraseContext(ctx, autoRephraseSweepSize)
+	if err != nil {
+		return err
+	}
+
+	decks := map[int]database.DeckModel{}
+	for _, card := range cards {
+		deck, ok := decks[card.DeckId]
+		if !ok {
+			deck, err = database.DeckContext(ctx, card.DeckId)
+			if err != nil {
+				return err
+			}
+			decks[card.DeckId] = deck
+		}
+		if err := queueAutoRephrase(deck, card); err != nil {
+			return err
+		}
+	}
+	return nil
+}
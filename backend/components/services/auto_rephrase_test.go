@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// createAutoRephraseCards creates a deck with auto-rephrase on and no number of variants set, and n mature cards
+func createAutoRephraseCards(t *testing.T, n int) (database.DeckModel, []models.FlashcardModel) {
+	t.Helper()
+
+	deck, cards := createTestCards(t, n)
+	if _, err := database.DB.Exec("UPDATE decks SET enable_auto_rephrase = 1, max_rephrased_cards = NULL WHERE id = ?", deck.ID); err != nil {
+		t.Fatalf("Failed to turn on auto-rephrase: %v", err)
+	}
+	for i := range cards {
+		schedule := models.CardSchedule{State: models.CardStateReview, Stability: 30, Difficulty: 5, IntervalDays: 30}
+		if err := database.RescheduleCard(cards[i].ID, schedule, time.Now().AddDate(0, 0, 30)); err != nil {
+			t.Fatalf("Failed to reschedule card: %v", err)
+		}
+	}
+
+	deck, err := database.Deck(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get deck: %v", err)
+	}
+	return deck, cards
+}
+
+// addVariants gives a card n rephrasings
+func addVariants(t *testing.T, card models.FlashcardModel, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		_, err := database.CreateCard(models.FlashcardModel{DeckId: card.DeckId, Front: fmt.Sprintf("Variant %d", i), Back: "Back", ParentCardId: &card.ID})
+		if err != nil {
+			t.Fatalf("Failed to create variant: %v", err)
+		}
+	}
+}
+
+// autoRephraseJobs returns the card ids of the auto_rephrase jobs queued, oldest first
+func autoRephraseJobs(t *testing.T) []int {
+	t.Helper()
+
+	jobs, err := database.AIJobs(aiJobListSize)
+	if err != nil {
+		t.Fatalf("Failed to get AI jobs: %v", err)
+	}
+	cardIds := []int{}
+	for i := len(jobs) - 1; i >= 0; i-- {
+		if jobs[i].Kind != AIJobAutoRephrase || jobs[i].Status != database.AIJobQueued {
+			continue
+		}
+		var payload AutoRephrasePayload
+		if err := json.Unmarshal([]byte(jobs[i].Payload), &payload); err != nil {
+			t.Fatalf("Failed to decode payload: %v", err)
+		}
+		cardIds = append(cardIds, payload.CardId)
+	}
+	return cardIds
+}
+
+func TestQueueMatureCardsForRephrase(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createAutoRephraseCards(t, 3)
+	if deck.MaxRephrasedCards != database.DefaultMaxRephrasedCards {
+		t.Errorf("Expected the default of %d variants, got %d", database.DefaultMaxRephrasedCards, deck.MaxRephrasedCards)
+	}
+	// Short of the default by one, and at the default
+	addVariants(t, cards[1], database.DefaultMaxRephrasedCards-1)
+	addVariants(t, cards[2], database.DefaultMaxRephrasedCards)
+
+	if err := QueueMatureCardsForRephrase(context.Background()); err != nil {
+		t.Fatalf("Failed to queue cards: %v", err)
+	}
+	// Queuing again doesn't add jobs for cards that are already waiting
+	if err := QueueMatureCardsForRephrase(context.Background()); err != nil {
+		t.Fatalf("Failed to queue cards: %v", err)
+	}
+	if ids, want := autoRephraseJobs(t), []int{cards[0].ID, cards[1].ID}; !equalIds(ids, want) {
+		t.Errorf("Expected jobs for cards %v, got %v", want, ids)
+	}
+}
+
+func TestQueueAutoRephrase(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createAutoRephraseCards(t, 2)
+	variant, err := database.CreateCard(models.FlashcardModel{DeckId: deck.ID, Front: "Variant", Back: "Back", ParentCardId: &cards[0].ID})
+	if err != nil {
+		t.Fatalf("Failed to create variant: %v", err)
+	}
+
+	for _, card := range []models.FlashcardModel{cards[0], cards[0], variant} {
+		if err := queueAutoRephrase(deck, card); err != nil {
+			t.Fatalf("Failed to queue card: %v", err)
+		}
+	}
+	off := deck
+	off.EnableAutoRephrase = false
+	if err := queueAutoRephrase(off, cards[1]); err != nil {
+		t.Fatalf("Failed to queue card: %v", err)
+	}
+	if ids, want := autoRephraseJobs(t), []int{cards[0].ID}; !equalIds(ids, want) {
+		t.Errorf("Expected a single job for card %v, got %v", want, ids)
+	}
+
+	// Once the job has stopped waiting the card can be queued again
+	jobs, err := database.AIJobs(1)
+	if err != nil {
+		t.Fatalf("Failed to get AI jobs: %v", err)
+	}
+	if _, err := cancelAIJob(jobs[0].ID); err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+	if err := queueAutoRephrase(deck, cards[0]); err != nil {
+		t.Fatalf("Failed to queue card: %v", err)
+	}
+	if ids, want := autoRephraseJobs(t), []int{cards[0].ID}; !equalIds(ids, want) {
+		t.Errorf("Expected the card to be queued again, got %v", ids)
+	}
+}
+
+func TestAutoRephraseSkipsCardsWithEnoughVariants(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createAutoRephraseCards(t, 1)
+	addVariants(t, cards[0], database.DefaultMaxRephrasedCards)
+
+	// Nothing is missing, so no AI request is made
+	payload, _ := json.Marshal(AutoRephrasePayload{DeckId: deck.ID, CardId: cards[0].ID})
+	created, err := autoRephrase(context.Background(), 1, string(payload))
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+	if variants, ok := created.([]models.FlashcardModel); !ok || len(variants) != 0 {
+		t.Errorf("Expected no variants to be created, got %v", created)
+	}
+}
+
+func TestFailedAutoRephraseWaitsBeforeRetrying(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createAutoRephraseCards(t, 2)
+	for _, card := range cards {
+		if err := queueAutoRephrase(deck, card); err != nil {
+			t.Fatalf("Failed to queue card: %v", err)
+		}
+	}
+
+	// The first card's job fails, as when every phrasing the AI comes up with is a duplicate, and the second succeeds
+	for _, status := range []string{database.AIJobFailed, database.AIJobSucceeded} {
+		job, err := database.ClaimAIJob(time.Now())
+		if err != nil {
+			t.Fatalf("Failed to claim job: %v", err)
+		}
+		if err := database.FinishAIJob(job.ID, status, "", ""); err != nil {
+			t.Fatalf("Failed to finish job: %v", err)
+		}
+	}
+
+	for _, card := range cards {
+		if err := queueAutoRephrase(deck, card); err != nil {
+			t.Fatalf("Failed to queue card: %v", err)
+		}
+	}
+	if ids, want := autoRephraseJobs(t), []int{cards[1].ID}; !equalIds(ids, want) {
+		t.Errorf("Expected only the card that didn't fail to be queued, got %v", ids)
+	}
+
+	// Once the failure is old enough the card is tried again
+	_, err := database.DB.Exec("UPDATE ai_jobs SET updated_at = datetime('now', ?) WHERE status = ?",
+		fmt.Sprintf("-%d hours", int(autoRephraseRetryDelay.Hours())+1), database.AIJobFailed)
+	if err != nil {
+		t.Fatalf("Failed to age job: %v", err)
+	}
+	if err := queueAutoRephrase(deck, cards[0]); err != nil {
+		t.Fatalf("Failed to queue card: %v", err)
+	}
+	if ids, want := autoRephraseJobs(t), []int{cards[1].ID, cards[0].ID}; !equalIds(ids, want) {
+		t.Errorf("Expected the failed card to be queued again, got %v", ids)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+)
+
+// rescheduleDateLayout is the format of dates given to RescheduleFlashcard
+const rescheduleDateLayout = "2006-01-02"
+
+// nextStudyDay returns the moment the study day after the one containing now begins
+func nextStudyDay(now time.Time) (time.Time, error) {
+	dayStart, err := StudyDayStart(now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return dayStart.AddDate(0, 0, 1), nil
+}
+
+// burySiblings buries the siblings of a reviewed card until the next study day
+func burySiblings(cardId int, now time.Time) error {
+	until, err := nextStudyDay(now)
+	if err != nil {
+		return err
+	}
+	if err := database.BurySiblings(cardId, until); err != nil {
+		return fmt.Errorf("failed to bury sibling flashcards: %v", err)
+	}
+	return nil
+}
+
+// SuspendFlashcard takes a card out of the study queue until it is unsuspended
+func SuspendFlashcard(deckId int, cardId int, suspended bool) error {
+	if _, err := database.Card(deckId, cardId); err != nil {
+		return fmt.Errorf("failed to get flashcard: %v", err)
+	}
+	if err := database.SetCardSuspended(cardId, suspended); err != nil {
+		return fmt.Errorf("failed to suspend flashcard: %v", err)
+	}
+	return nil
+}
+
+// BuryFlashcard leaves a card out of the study queue until the next study day
+func BuryFlashcard(deckId int, cardId int) error {
+	if _, err := database.Card(deckId, cardId); err != nil {
+		return fmt.Errorf("failed to get flashcard: %v", err)
+	}
+
+	until, err := nextStudyDay(studyClock.Now())
+	if err != nil {
+		return err
+	}
+	if err := database.BuryCard(cardId, until); err != nil {
+		return fmt.Errorf("failed to bury flashcard: %v", err)
+	}
+	return nil
+}
+
+// UnburyFlashcard returns a buried card to the study queue
+func UnburyFlashcard(deckId int, cardId int) error {
+	if _, err := database.Card(deckId, cardId); err != nil {
+		return fmt.Errorf("failed to get flashcard: %v", err)
+	}
+	if err := database.UnburyCard(cardId); err != nil {
+		return fmt.Errorf("failed to unbury flashcard: %v", err)
+	}
+	return nil
+}
+
+// RescheduleFlashcard makes a card due at the start of the given study day after today, written as YYYY-MM-DD.
+// The card becomes a review card with an interval up to that day; its review log is left as it is.
+func RescheduleFlashcard(deckId int, cardId int, date string) error {
+	card, err := database.Card(deckId, cardId)
+	if err != nil {
+		return fmt.Errorf("failed to get flashcard: %v", err)
+	}
+
+	settings, err := GetStudyDaySettings()
+	if err != nil {
+		return err
+	}
+	location, err := studyLocation(settings)
+	if err != nil {
+		return err
+	}
+	day, err := time.ParseInLocation(rescheduleDateLayout, date, location)
+	if err != nil {
+		return fmt.Errorf("invalid date %q: %v", date, err)
+	}
+	due := time.Date(day.Year(), day.Month(), day.Day(), settings.StartHour, 0, 0, 0, location)
+
+	now := studyClock.Now()
+	today, err := StudyDayStart(now)
+	if err != nil {
+		return err
+	}
+	// A card due today would need an interval of 0 days, so the earliest day is tomorrow
+	if !due.After(today) {
+		return fmt.Errorf("cannot reschedule a flashcard to %s, which is not after today", date)
+	}
+
+	days := due.Sub(today).Round(24*time.Hour).Hours() / 24
+	if err := database.RescheduleCard(cardId, algorithms.Reschedule(card, days), due); err != nil {
+		return fmt.Errorf("failed to reschedule flashcard: %v", err)
+	}
+	return nil
+}
+
+// ResetFlashcard turns a card back into a new card and forgets what was learned, keeping its review log.
+// resetCounts also clears its lapse count and leech flag, along with any rewrite, as ClearLeech does.
+func ResetFlashcard(deckId int, cardId int, resetCounts bool) error {
+	if _, err := database.Card(deckId, cardId); err != nil {
+		return fmt.Errorf("failed to get flashcard: %v", err)
+	}
+	if resetCounts {
+		if err := cancelRewrite(cardId); err != nil {
+			return err
+		}
+		if err := database.DeleteCardRewrite(cardId); err != nil {
+			return fmt.Errorf("failed to delete rewrite: %v", err)
+		}
+	}
+	if err := database.ResetCard(cardId, resetCounts, studyClock.Now()); err != nil {
+		return fmt.Errorf("failed to reset flashcard: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+func TestRescheduleFlashcard(t *testing.T) {
+	useTestDatabase(t)
+	berlin := useStudyDay(t, "Europe/Berlin", 4)
+	// Before 04:00 it is still 9 May's study day
+	useManualClock(t, time.Date(2024, 5, 10, 2, 0, 0, 0, berlin))
+
+	deck, cards := createTestCards(t, 1)
+
+	for _, date := range []string{"2024-05-08", "2024-05-09", "10 May", ""} {
+		if err := RescheduleFlashcard(deck.ID, cards[0].ID, date); err == nil {
+			t.Errorf("Expected %q to be rejected", date)
+		}
+	}
+
+	cases := []struct {
+		date string
+		days float64
+	}{
+		{"2024-05-10", 1},
+		{"2024-05-16", 7},
+		// Across the end of summer time, which adds an hour
+		{"2024-10-28", 172},
+	}
+	for _, tc := range cases {
+		if err := RescheduleFlashcard(deck.ID, cards[0].ID, tc.date); err != nil {
+			t.Fatalf("Failed to reschedule card to %s: %v", tc.date, err)
+		}
+		card, err := database.Card(deck.ID, cards[0].ID)
+		if err != nil {
+			t.Fatalf("Failed to get card: %v", err)
+		}
+		day, _ := time.ParseInLocation(rescheduleDateLayout, tc.date, berlin)
+		due := day.Add(4 * time.Hour)
+		if card.State != algorithms.StateReview || card.IntervalDays != tc.days || !card.DueDate.Equal(due) {
+			t.Errorf("%s: expected a review card due at %v after %v days, got %s due at %v after %v days",
+				tc.date, due, tc.days, card.State, card.DueDate, card.IntervalDays)
+		}
+	}
+}
+
+func TestSiblingBuryFailureDoesNotFailReview(t *testing.T) {
+	useTestDatabase(t)
+	useStudyDay(t, "UTC", 4)
+	useManualClock(t, time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC))
+
+	deck, cards := createTestCards(t, 1)
+	variant, err := database.CreateCard(models.FlashcardModel{DeckId: deck.ID, Front: "Variant", Back: "Back", ParentCardId: &cards[0].ID})
+	if err != nil {
+		t.Fatalf("Failed to create variant: %v", err)
+	}
+
+	// Burying the variant fails, after the review is saved
+	_, err = database.DB.Exec(fmt.Sprintf("CREATE TRIGGER fail_bury BEFORE UPDATE OF buried_until ON flashcards WHEN NEW.id = %d AND NEW.buried_until IS NOT NULL BEGIN SELECT RAISE(ABORT, 'bury failed'); END", variant.ID))
+	if err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	if err := ReviewFlashcard(deck.ID, cards[0].ID, algorithms.GradeGood, models.ReviewTiming{}); err != nil {
+		t.Fatalf("Expected the review to succeed, got %v", err)
+	}
+	card, err := database.Card(deck.ID, cards[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+	if card.State == algorithms.StateNew {
+		t.Errorf("Expected the review to be saved, got a new card")
+	}
+	if variant, err := database.Card(deck.ID, variant.ID); err != nil || variant.BuriedUntil != nil {
+		t.Errorf("Expected the variant not to be buried, got %v (%v)", variant.BuriedUntil, err)
+	}
+}
+
+func TestResetFlashcardClearsLeech(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createTestCards(t, 3)
+	// Suspended by the leech action, suspended by hand before it became a leech, and a leech with a rewrite
+	if err := database.MarkLeech(cards[0].ID, true); err != nil {
+		t.Fatalf("Failed to mark leech: %v", err)
+	}
+	if err := database.SetCardSuspended(cards[1].ID, true); err != nil {
+		t.Fatalf("Failed to suspend card: %v", err)
+	}
+	if err := database.MarkLeech(cards[1].ID, true); err != nil {
+		t.Fatalf("Failed to mark leech: %v", err)
+	}
+	if err := database.MarkLeech(cards[2].ID, false); err != nil {
+		t.Fatalf("Failed to mark leech: %v", err)
+	}
+	if err := RequestLeechRewrite(deck.ID, cards[2].ID); err != nil {
+		t.Fatalf("Failed to request rewrite: %v", err)
+	}
+	jobId, err := database.PendingCardRewriteJob(cards[2].ID)
+	if err != nil || jobId == 0 {
+		t.Fatalf("Expected a pending rewrite job, got %d (%v)", jobId, err)
+	}
+
+	// Keeping the counts leaves the leech as it was
+	if err := ResetFlashcard(deck.ID, cards[0].ID, false); err != nil {
+		t.Fatalf("Failed to reset card: %v", err)
+	}
+	if card, err := database.Card(deck.ID, cards[0].ID); err != nil || !card.Leech || !card.Suspended {
+		t.Errorf("Expected a suspended leech, got %+v (%v)", card, err)
+	}
+
+	want := []bool{false, true, false}
+	for i, card := range cards {
+		if err := ResetFlashcard(deck.ID, card.ID, true); err != nil {
+			t.Fatalf("Failed to reset card: %v", err)
+		}
+		reset, err := database.Card(deck.ID, card.ID)
+		if err != nil {
+			t.Fatalf("Failed to get card: %v", err)
+		}
+		if reset.Leech || reset.Lapses != 0 || reset.Suspended != want[i] {
+			t.Errorf("Card %d: expected no leech or lapses and suspended %v, got leech %v, %d lapses and suspended %v",
+				i, want[i], reset.Leech, reset.Lapses, reset.Suspended)
+		}
+	}
+
+	// The reset dropped the rewrite and cancelled its job
+	if _, _, _, err := database.CardRewrite(cards[2].ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected no rewrite after resetting the card, got %v", err)
+	}
+	if job, err := database.AIJob(jobId); err != nil || job.Status != database.AIJobCancelled {
+		t.Errorf("Expected the rewrite job to be cancelled, got %+v (%v)", job, err)
+	}
+}
@@ -0,0 +1,11 @@
+package services
+
+import "github.com/jorkle/brightcards/backend/components/clock"
+
+// studyClock is the time reviews are graded at and study queues are built for
+var studyClock clock.Clock = clock.System
+
+// SetClock replaces the clock used for scheduling, e.g. with a manual clock in tests
+func SetClock(c clock.Clock) {
+	studyClock = c
+}
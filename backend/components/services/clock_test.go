@@ -0,0 +1,116 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+func TestStudyQueueFollowsClockAcrossMidnight(t *testing.T) {
+	useTestDatabase(t)
+	location := useStudyDay(t, "Europe/Berlin", 4)
+	now := useManualClock(t, time.Date(2024, 5, 10, 23, 59, 0, 0, location))
+
+	deck, cards := createTestCards(t, 3)
+	if _, err := UpdateDeckLimits(deck.ID, 1, 100); err != nil {
+		t.Fatalf("Failed to update limits: %v", err)
+	}
+
+	checkQueue := func(when string, want ...int) {
+		t.Helper()
+		queue, err := BuildStudyQueue(deck.ID)
+		if err != nil {
+			t.Fatalf("Failed to build study queue: %v", err)
+		}
+		if ids := queueIds(queue); !equalIds(ids, want) {
+			t.Errorf("%s: expected queue %v, got %v", when, want, ids)
+		}
+	}
+	checkCounts := func(when string, want models.StudyQueueCounts) {
+		t.Helper()
+		counts, err := GetStudyQueueCounts(deck.ID)
+		if err != nil {
+			t.Fatalf("Failed to get counts: %v", err)
+		}
+		if counts.Learning != want.Learning || counts.NewCards != want.NewCards || counts.Reviews != want.Reviews {
+			t.Errorf("%s: expected %d learning, %d new and %d reviews, got %d, %d and %d",
+				when, want.Learning, want.NewCards, want.Reviews, counts.Learning, counts.NewCards, counts.Reviews)
+		}
+	}
+
+	checkQueue("Before studying", cards[0].ID)
+
+	// Forgetting the card a minute before midnight puts it on the first learning step, due at midnight
+	if err := ReviewFlashcard(deck.ID, cards[0].ID, algorithms.GradeAgain, models.ReviewTiming{}); err != nil {
+		t.Fatalf("Failed to review card: %v", err)
+	}
+	reviewed, err := database.Card(deck.ID, cards[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+	midnight := time.Date(2024, 5, 11, 0, 0, 0, 0, location)
+	if !reviewed.DueDate.Equal(midnight) {
+		t.Errorf("Expected the card to be due at the clock's time plus a minute, %v, got %v", midnight, reviewed.DueDate)
+	}
+
+	now.Advance(30 * time.Second)
+	checkCounts("Before the step is due", models.StudyQueueCounts{})
+	// With nothing else to study, the learning card is shown early
+	checkQueue("Before the step is due", cards[0].ID)
+
+	// Midnight doesn't start a new study day, so the new card limit is still spent
+	now.Set(midnight)
+	checkCounts("At midnight", models.StudyQueueCounts{Learning: 1})
+	checkQueue("At midnight", cards[0].ID)
+
+	now.Set(time.Date(2024, 5, 11, 3, 59, 59, 0, location))
+	checkCounts("Just before the study day starts", models.StudyQueueCounts{Learning: 1})
+
+	// Building the queue for a later time doesn't depend on the clock
+	dayStart := time.Date(2024, 5, 11, 4, 0, 0, 0, location)
+	queue, err := BuildStudyQueueAt(deck.ID, dayStart)
+	if err != nil {
+		t.Fatalf("Failed to build study queue: %v", err)
+	}
+	if ids := queueIds(queue); !equalIds(ids, []int{cards[0].ID, cards[1].ID}) {
+		t.Errorf("Expected the queue at the next study day to be %v, got %v", []int{cards[0].ID, cards[1].ID}, ids)
+	}
+
+	now.Set(dayStart)
+	checkCounts("At the study day start", models.StudyQueueCounts{Learning: 1, NewCards: 1})
+	checkQueue("At the study day start", cards[0].ID, cards[1].ID)
+}
+
+func TestBuriedCardReturnsAtStudyDayStart(t *testing.T) {
+	useTestDatabase(t)
+	location := useStudyDay(t, "America/New_York", 4)
+	now := useManualClock(t, time.Date(2024, 5, 10, 22, 0, 0, 0, location))
+
+	deck, cards := createTestCards(t, 2)
+	if err := BuryFlashcard(deck.ID, cards[0].ID); err != nil {
+		t.Fatalf("Failed to bury card: %v", err)
+	}
+
+	cases := []struct {
+		now  time.Time
+		want []int
+	}{
+		{time.Date(2024, 5, 10, 23, 59, 0, 0, location), []int{cards[1].ID}},
+		{time.Date(2024, 5, 11, 0, 1, 0, 0, location), []int{cards[1].ID}},
+		{time.Date(2024, 5, 11, 3, 59, 0, 0, location), []int{cards[1].ID}},
+		{time.Date(2024, 5, 11, 4, 0, 0, 0, location), []int{cards[0].ID, cards[1].ID}},
+	}
+	for _, tc := range cases {
+		now.Set(tc.now)
+		queue, err := BuildStudyQueue(deck.ID)
+		if err != nil {
+			t.Fatalf("Failed to build study queue: %v", err)
+		}
+		if ids := queueIds(queue); !equalIds(ids, tc.want) {
+			t.Errorf("At %v: expected queue %v, got %v", tc.now, tc.want, ids)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+)
+
+const (
+	aiRequestTimeoutSetting     = "ai_request_timeout"
+	transcriptionTimeoutSetting = "transcription_timeout"
+
+	defaultAIRequestTimeout     = 120 // seconds
+	defaultTranscriptionTimeout = 600 // seconds
+)
+
+// TimeoutSettings limits how long calls to the AI services may take before they are given up
+type TimeoutSettings struct {
+	AIRequestSeconds     int `json:"aiRequestSeconds"`     // a chat completion, such as generating or rephrasing flashcards, or synthesizing speech
+	TranscriptionSeconds int `json:"transcriptionSeconds"` // transcribing a whole recording
+}
+
+// GetTimeoutSettings returns the saved timeouts
+func GetTimeoutSettings() (TimeoutSettings, error) {
+	return GetTimeoutSettingsContext(context.Background())
+}
+
+// GetTimeoutSettingsContext is GetTimeoutSettings with a context that can cancel reading the settings
+func GetTimeoutSettingsContext(ctx context.Context) (TimeoutSettings, error) {
+	settings := TimeoutSettings{
+		AIRequestSeconds:     defaultAIRequestTimeout,
+		TranscriptionSeconds: defaultTranscriptionTimeout,
+	}
+
+	for key, target := range map[string]*int{
+		aiRequestTimeoutSetting:     &settings.AIRequestSeconds,
+		transcriptionTimeoutSetting: &settings.TranscriptionSeconds,
+	} {
+		value, err := database.GetSettingContext(ctx, key)
+		if err != nil {
+			return TimeoutSettings{}, fmt.Errorf("failed to get timeout settings: %v", err)
+		}
+		if value == "" {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return TimeoutSettings{}, fmt.Errorf("invalid timeout %q: %v", value, err)
+		}
+		*target = seconds
+	}
+
+	return settings, nil
+}
+
+// SaveTimeoutSettings validates and saves the timeouts
+func SaveTimeoutSettings(settings TimeoutSettings) error {
+	if settings.AIRequestSeconds < 1 || settings.TranscriptionSeconds < 1 {
+		return fmt.Errorf("timeouts must be at least one second")
+	}
+
+	values := map[string]string{
+		aiRequestTimeoutSetting:     strconv.Itoa(settings.AIRequestSeconds),
+		transcriptionTimeoutSetting: strconv.Itoa(settings.TranscriptionSeconds),
+	}
+	for key, value := range values {
+		if err := database.SaveSetting(key, value); err != nil {
+			return fmt.Errorf("failed to save timeout settings: %v", err)
+		}
+	}
+	return nil
+}
+
+var (
+	requestMutex   sync.Mutex
+	requestCancels = map[int]context.CancelFunc{}
+	nextRequestId  int
+)
+
+// RequestContext returns the context of an AI request the UI is waiting on, such as generating flashcards or
+// analyzing a recording. It is cancelled with parent, usually the app's context, or by CancelAIRequests.
+// Call cancel once the request is done.
+func RequestContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	requestMutex.Lock()
+	id := nextRequestId
+	nextRequestId++
+	requestCancels[id] = cancel
+	requestMutex.Unlock()
+
+	return ctx, func() {
+		requestMutex.Lock()
+		delete(requestCancels, id)
+		requestMutex.Unlock()
+		cancel()
+	}
+}
+
+// CancelAIRequests cancels the AI requests the UI is waiting on. Background jobs are cancelled one at a time
+// with CancelAIJob.
+func CancelAIRequests() {
+	requestMutex.Lock()
+	defer requestMutex.Unlock()
+
+	for id, cancel := range requestCancels {
+		cancel()
+		delete(requestCancels, id)
+	}
+}
+
+// withAITimeout limits ctx to the AI request timeout
+func withAITimeout(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	settings, err := GetTimeoutSettingsContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(settings.AIRequestSeconds)*time.Second)
+	return ctx, cancel, nil
+}
+
+// withTranscriptionTimeout limits ctx to the transcription timeout
+func withTranscriptionTimeout(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	settings, err := GetTimeoutSettingsContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(settings.TranscriptionSeconds)*time.Second)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestContext(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	defer cancelParent()
+
+	first, done := RequestContext(parent)
+	defer done()
+	second, done := RequestContext(parent)
+	defer done()
+
+	// CancelAIRequests cancels the requests in flight, but not the ones made afterwards
+	CancelAIRequests()
+	if first.Err() != context.Canceled || second.Err() != context.Canceled {
+		t.Errorf("Expected the requests to be cancelled, got %v and %v", first.Err(), second.Err())
+	}
+	third, done := RequestContext(parent)
+	defer done()
+	if third.Err() != nil {
+		t.Errorf("Expected a later request not to be cancelled, got %v", third.Err())
+	}
+
+	// Cancelling the app's context cancels its requests too
+	cancelParent()
+	if third.Err() != context.Canceled {
+		t.Errorf("Expected the request to be cancelled with its parent, got %v", third.Err())
+	}
+
+	// A finished request is released, and leaves the parent alone
+	fourth, done := RequestContext(context.Background())
+	done()
+	if fourth.Err() != context.Canceled {
+		t.Errorf("Expected a finished request's context to be cancelled, got %v", fourth.Err())
+	}
+}
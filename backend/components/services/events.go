@@ -0,0 +1,30 @@
+package services
+
+import "sync"
+
+// EventEmitter forwards a named event and its payload to the frontend
+type EventEmitter func(eventName string, data ...interface{})
+
+var (
+	emitter      EventEmitter
+	emitterMutex sync.RWMutex
+)
+
+// SetEventEmitter registers the function used to push events to the frontend
+func SetEventEmitter(e EventEmitter) {
+	emitterMutex.Lock()
+	defer emitterMutex.Unlock()
+
+	emitter = e
+}
+
+// emit sends an event to the frontend if an emitter has been registered
+func emit(eventName string, data ...interface{}) {
+	emitterMutex.RLock()
+	e := emitter
+	emitterMutex.RUnlock()
+
+	if e != nil {
+		e(eventName, data...)
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -37,11 +38,15 @@ func StartRecording() error {
 		return fmt.Errorf("failed to get recorder: %v", err)
 	}
 
+	if err := prepareRecorder(recorder); err != nil {
+		return err
+	}
+
 	return recorder.StartRecording()
 }
 
-// StopRecordingAndAnalyze stops recording and analyzes the recorded audio
-func StopRecordingAndAnalyze() (*FeynmanAnalysis, error) {
+// StopRecordingAndAnalyzeContext stops recording and analyzes the recorded audio, giving up when ctx is done
+func StopRecordingAndAnalyzeContext(ctx context.Context) (*FeynmanAnalysis, error) {
 	// Stop recording
 	recorder, err := audio.GetRecorder()
 	if err != nil {
@@ -52,6 +57,43 @@ func StopRecordingAndAnalyze() (*FeynmanAnalysis, error) {
 		return nil, fmt.Errorf("failed to stop recording: %v", err)
 	}
 
+	return AnalyzeLastRecordingContext(ctx)
+}
+
+// PauseRecording pauses the current recording
+func PauseRecording() error {
+	recorder, err := audio.GetRecorder()
+	if err != nil {
+		return fmt.Errorf("failed to get recorder: %v", err)
+	}
+
+	return recorder.PauseRecording()
+}
+
+// ResumeRecording resumes a paused recording
+func ResumeRecording() error {
+	recorder, err := audio.GetRecorder()
+	if err != nil {
+		return fmt.Errorf("failed to get recorder: %v", err)
+	}
+
+	return recorder.ResumeRecording()
+}
+
+// RecoverRecording restores a recording interrupted by a crash so it can be analyzed.
+// It reports whether a recording was recovered.
+func RecoverRecording() (bool, error) {
+	recorder, err := audio.GetRecorder()
+	if err != nil {
+		return false, fmt.Errorf("failed to get recorder: %v", err)
+	}
+
+	return recorder.RecoverRecording()
+}
+
+// AnalyzeLastRecordingContext transcribes and analyzes the most recent recording. It gives up when ctx is done,
+// and the transcription and analysis each also after their timeout in the settings.
+func AnalyzeLastRecordingContext(ctx context.Context) (*FeynmanAnalysis, error) {
 	// Get the path to the recording
 	recordingPath, err := audio.GetLastRecordingPath()
 	if err != nil {
@@ -63,16 +105,27 @@ func StopRecordingAndAnalyze() (*FeynmanAnalysis, error) {
 		return nil, fmt.Errorf("recording file not found: %v", err)
 	}
 
+	// Downsample, trim and compress the recording, splitting it if it's too long to upload
+	parts, err := audio.ProcessRecording(recordingPath, recordingProcessingOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to process recording: %v", err)
+	}
+
 	// Transcribe the audio
-	transcription, err := audio.TranscribeAudio(recordingPath)
+	transcribeCtx, cancel, err := withTranscriptionTimeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	transcription, err := audio.TranscribeFilesContext(transcribeCtx, parts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to transcribe audio: %v", err)
+		return nil, fmt.Errorf("failed to transcribe audio: %w", err)
 	}
 
 	// Analyze the transcription
-	analysis, err := chat.ProcessText(transcription)
+	analysis, err := ProcessTextContext(ctx, transcription)
 	if err != nil {
-		return nil, fmt.Errorf("failed to analyze transcription: %v", err)
+		return nil, err
 	}
 
 	// Convert to our service-specific type
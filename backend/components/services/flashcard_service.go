@@ -0,0 +1,46 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// DeleteFlashcard deletes a card with its variants, stopping any leech rewrite still being generated for them
+func DeleteFlashcard(deckId int, cardId int) (models.FlashcardModel, error) {
+	card, err := database.Card(deckId, cardId)
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to get flashcard: %v", err)
+	}
+
+	variants, err := database.CardVariants(cardId)
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to get variants: %v", err)
+	}
+	for _, c := range append(variants, card) {
+		if err := cancelRewrite(c.ID); err != nil {
+			return models.FlashcardModel{}, err
+		}
+	}
+
+	if err := database.DeleteCard(cardId); err != nil {
+		return models.FlashcardModel{}, err
+	}
+	return card, nil
+}
+
+// DeleteDeck deletes a deck with its cards, stopping any leech rewrite still being generated for them
+func DeleteDeck(deckId int) error {
+	cards, err := database.Cards(deckId)
+	if err != nil {
+		return fmt.Errorf("failed to get flashcards: %v", err)
+	}
+	for _, card := range cards {
+		if err := cancelRewrite(card.ID); err != nil {
+			return err
+		}
+	}
+
+	return database.DeleteDeck(deckId)
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/ai/chat"
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+const (
+	// LeechEvent is emitted with the card id when a card becomes a leech
+	LeechEvent = "leech:detected"
+
+	// LeechRewriteEvent is emitted with the card id when the AI rewrite of a leech is ready, or has failed,
+	// in which case an error message follows
+	LeechRewriteEvent = "leech:rewrite"
+)
+
+// handleLeech applies the deck's leech action to a card that just reached the leech threshold
+func handleLeech(deck database.DeckModel, card models.FlashcardModel) error {
+	if err := database.MarkLeech(card.ID, deck.LeechAction == algorithms.LeechActionSuspend); err != nil {
+		return fmt.Errorf("failed to mark leech: %v", err)
+	}
+	emit(LeechEvent, card.ID)
+
+	if deck.LeechAction == algorithms.LeechActionRewrite {
+		return requestRewrite(deck, card)
+	}
+	return nil
+}
+
+// RewriteLeechPayload is the input of a rewrite_leech job, whose result is the chat.Flashcard suggested
+type RewriteLeechPayload struct {
+	DeckId int `json:"deckId"`
+	CardId int `json:"cardId"`
+}
+
+// requestRewrite queues an AI job that suggests a clearer version of a card, so the review isn't held up.
+// A rewrite still being generated for the card is cancelled and replaced.
+func requestRewrite(deck database.DeckModel, card models.FlashcardModel) error {
+	if err := cancelRewrite(card.ID); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(RewriteLeechPayload{DeckId: deck.ID, CardId: card.ID})
+	if err != nil {
+		return fmt.Errorf("failed to encode job payload: %v", err)
+	}
+	job, err := database.QueueCardRewrite(card.ID, AIJobRewriteLeech, string(data), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to request rewrite: %v", err)
+	}
+	announceAIJob(job)
+	return nil
+}
+
+// rewriteLeech runs a rewrite_leech job. The rewrite is only saved if it is still pending for this job,
+// so one cleared, replaced or deleted while the AI was working isn't brought back.
+func rewriteLeech(ctx context.Context, jobId int, payload string) (interface{}, error) {
+	var input RewriteLeechPayload
+	if err := json.Unmarshal([]byte(payload), &input); err != nil {
+		return nil, fmt.Errorf("invalid payload: %v", err)
+	}
+
+	pendingJob, err := database.PendingCardRewriteJobContext(ctx, input.CardId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rewrite: %v", err)
+	}
+	if pendingJob != jobId {
+		return nil, nil
+	}
+
+	deck, err := database.DeckContext(ctx, input.DeckId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deck: %v", err)
+	}
+	card, err := database.CardContext(ctx, input.DeckId, input.CardId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flashcard: %v", err)
+	}
+
+	requestCtx, cancel, err := withAITimeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	rewrites, err := chat.RephraseFlashcardContext(requestCtx, &card, deck.EnableInitialismSwap, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(rewrites) == 0 {
+		return nil, errors.New("no rewrite was generated")
+	}
+
+	saved, err := database.SaveCardRewriteContext(ctx, card.ID, jobId, rewrites[0].Front, rewrites[0].Back)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save rewrite: %v", err)
+	}
+	if saved {
+		emit(LeechRewriteEvent, card.ID)
+	}
+	return rewrites[0], nil
+}
+
+// leechRewriteFailed discards the pending rewrite of a rewrite_leech job that failed for good
+func leechRewriteFailed(jobId int, payload string, jobErr error) {
+	var input RewriteLeechPayload
+	if err := json.Unmarshal([]byte(payload), &input); err != nil {
+		return
+	}
+
+	println("Warning: failed to rewrite leech:", jobErr.Error())
+	if err := database.DeletePendingCardRewrite(input.CardId, jobId); err != nil {
+		println("Warning: failed to clear leech rewrite:", err.Error())
+	}
+	emit(LeechRewriteEvent, input.CardId, jobErr.Error())
+}
+
+// leechRewriteCancelled discards the pending rewrite of a rewrite_leech job that was cancelled, so the card
+// doesn't wait for a rewrite that won't come
+func leechRewriteCancelled(jobId int, payload string) {
+	var input RewriteLeechPayload
+	if err := json.Unmarshal([]byte(payload), &input); err != nil {
+		return
+	}
+
+	if err := database.DeletePendingCardRewrite(input.CardId, jobId); err != nil {
+		println("Warning: failed to clear leech rewrite:", err.Error())
+	}
+}
+
+// cancelRewrite stops the AI job generating a card's rewrite, if there is one
+func cancelRewrite(cardId int) error {
+	jobId, err := database.PendingCardRewriteJob(cardId)
+	if err != nil {
+		return fmt.Errorf("failed to get rewrite: %v", err)
+	}
+	if jobId == 0 {
+		return nil
+	}
+	_, err = cancelAIJob(jobId)
+	return err
+}
+
+// GetLeeches returns the leeches of a deck with the rewrites suggested for them
+func GetLeeches(deckId int) ([]models.LeechModel, error) {
+	leeches, err := database.Leeches(deckId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leeches: %v", err)
+	}
+	return leeches, nil
+}
+
+// RequestLeechRewrite asks the AI to rewrite a card, whatever the deck's leech action
+func RequestLeechRewrite(deckId int, cardId int) error {
+	deck, err := database.Deck(deckId)
+	if err != nil {
+		return fmt.Errorf("failed to get deck: %v", err)
+	}
+	card, err := database.Card(deckId, cardId)
+	if err != nil {
+		return fmt.Errorf("failed to get flashcard: %v", err)
+	}
+	return requestRewrite(deck, card)
+}
+
+// AcceptLeechRewrite replaces the text of a leech with its suggested rewrite and returns it to the study queue.
+// The card keeps its schedule and review history.
+func AcceptLeechRewrite(deckId int, cardId int) (models.FlashcardModel, error) {
+	card, err := database.Card(deckId, cardId)
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to get flashcard: %v", err)
+	}
+
+	front, back, pending, err := database.CardRewrite(cardId)
+	if errors.Is(err, sql.ErrNoRows) || pending {
+		return models.FlashcardModel{}, fmt.Errorf("no rewrite is ready for this flashcard")
+	}
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to get rewrite: %v", err)
+	}
+
+	card.Front = front
+	card.Back = back
+	if _, err := database.UpdateCard(card); err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to update flashcard: %v", err)
+	}
+	if err := database.DeleteCardRewrite(cardId); err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to delete rewrite: %v", err)
+	}
+	if err := database.ClearLeech(cardId); err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to clear leech: %v", err)
+	}
+	return database.Card(deckId, cardId)
+}
+
+// ClearLeech unmarks a leech and returns it to the study queue unless it was suspended by hand,
+// discarding any suggested rewrite
+func ClearLeech(deckId int, cardId int) error {
+	if _, err := database.Card(deckId, cardId); err != nil {
+		return fmt.Errorf("failed to get flashcard: %v", err)
+	}
+	if err := cancelRewrite(cardId); err != nil {
+		return err
+	}
+	if err := database.DeleteCardRewrite(cardId); err != nil {
+		return fmt.Errorf("failed to delete rewrite: %v", err)
+	}
+	return database.ClearLeech(cardId)
+}
+
+// UpdateDeckLeechSettings validates and saves the leech threshold and action of a deck
+func UpdateDeckLeechSettings(deckId int, threshold int, action string) (database.DeckModel, error) {
+	if threshold < 0 {
+		return database.DeckModel{}, fmt.Errorf("leech threshold can't be negative")
+	}
+	if !algorithms.ValidLeechAction(action) {
+		return database.DeckModel{}, fmt.Errorf("unknown leech action %q", action)
+	}
+
+	return database.UpdateDeckLeechSettings(deckId, threshold, action)
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+func TestClearLeechKeepsManualSuspension(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createTestCards(t, 3)
+	if err := database.SetCardSuspended(cards[0].ID, true); err != nil {
+		t.Fatalf("Failed to suspend card: %v", err)
+	}
+	for _, card := range cards[:2] {
+		if err := database.MarkLeech(card.ID, true); err != nil {
+			t.Fatalf("Failed to mark leech: %v", err)
+		}
+	}
+	// Suspended by hand after the leech action left it in the queue
+	if err := database.MarkLeech(cards[2].ID, false); err != nil {
+		t.Fatalf("Failed to mark leech: %v", err)
+	}
+	if err := database.SetCardSuspended(cards[2].ID, true); err != nil {
+		t.Fatalf("Failed to suspend card: %v", err)
+	}
+
+	want := []bool{true, false, true}
+	for i, card := range cards {
+		if err := ClearLeech(deck.ID, card.ID); err != nil {
+			t.Fatalf("Failed to clear leech: %v", err)
+		}
+		cleared, err := database.Card(deck.ID, card.ID)
+		if err != nil {
+			t.Fatalf("Failed to get card: %v", err)
+		}
+		if cleared.Leech || cleared.Suspended != want[i] {
+			t.Errorf("Card %d: expected no leech and suspended %v, got leech %v and suspended %v", i, want[i], cleared.Leech, cleared.Suspended)
+		}
+	}
+}
+
+func TestClearedRewriteIsNotSaved(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createTestCards(t, 2)
+	if err := RequestLeechRewrite(deck.ID, cards[0].ID); err != nil {
+		t.Fatalf("Failed to request rewrite: %v", err)
+	}
+	first, err := database.PendingCardRewriteJob(cards[0].ID)
+	if err != nil || first == 0 {
+		t.Fatalf("Expected a pending rewrite job, got %d (%v)", first, err)
+	}
+
+	// Requesting another rewrite cancels the first job, whose result is then dropped
+	if err := RequestLeechRewrite(deck.ID, cards[0].ID); err != nil {
+		t.Fatalf("Failed to request rewrite: %v", err)
+	}
+	second, err := database.PendingCardRewriteJob(cards[0].ID)
+	if err != nil || second == 0 || second == first {
+		t.Fatalf("Expected a new pending rewrite job, got %d (%v)", second, err)
+	}
+	if job, err := database.AIJob(first); err != nil || job.Status != "cancelled" {
+		t.Errorf("Expected the first job to be cancelled, got %+v (%v)", job, err)
+	}
+	if saved, err := database.SaveCardRewrite(cards[0].ID, first, "Old", "Old"); err != nil || saved {
+		t.Errorf("Expected the replaced rewrite not to be saved, got %v (%v)", saved, err)
+	}
+
+	// Clearing the leech cancels the second, and its rewrite doesn't come back
+	if err := ClearLeech(deck.ID, cards[0].ID); err != nil {
+		t.Fatalf("Failed to clear leech: %v", err)
+	}
+	if job, err := database.AIJob(second); err != nil || job.Status != "cancelled" {
+		t.Errorf("Expected the second job to be cancelled, got %+v (%v)", job, err)
+	}
+	if saved, err := database.SaveCardRewrite(cards[0].ID, second, "New", "New"); err != nil || saved {
+		t.Errorf("Expected the cleared rewrite not to be saved, got %v (%v)", saved, err)
+	}
+	if _, _, _, err := database.CardRewrite(cards[0].ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected no rewrite after clearing the leech, got %v", err)
+	}
+
+	// Deleting a card cancels its rewrite too
+	if err := RequestLeechRewrite(deck.ID, cards[1].ID); err != nil {
+		t.Fatalf("Failed to request rewrite: %v", err)
+	}
+	jobId, err := database.PendingCardRewriteJob(cards[1].ID)
+	if err != nil {
+		t.Fatalf("Failed to get rewrite job: %v", err)
+	}
+	if _, err := DeleteFlashcard(deck.ID, cards[1].ID); err != nil {
+		t.Fatalf("Failed to delete card: %v", err)
+	}
+	if job, err := database.AIJob(jobId); err != nil || job.Status != "cancelled" {
+		t.Errorf("Expected the deleted card's job to be cancelled, got %+v (%v)", job, err)
+	}
+	if saved, err := database.SaveCardRewrite(cards[1].ID, jobId, "New", "New"); err != nil || saved {
+		t.Errorf("Expected the deleted card's rewrite not to be saved, got %v (%v)", saved, err)
+	}
+}
+
+func TestLeechFailureDoesNotFailReview(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createTestCards(t, 1)
+	if _, err := UpdateDeckLeechSettings(deck.ID, 1, algorithms.LeechActionRewrite); err != nil {
+		t.Fatalf("Failed to update leech settings: %v", err)
+	}
+	schedule := models.CardSchedule{State: algorithms.StateReview, Stability: 10, Difficulty: 5, IntervalDays: 10}
+	if err := database.RescheduleCard(cards[0].ID, schedule, studyClock.Now()); err != nil {
+		t.Fatalf("Failed to reschedule card: %v", err)
+	}
+
+	// Queuing the rewrite fails once the card has lapsed and is marked a leech
+	if _, err := database.DB.Exec("DROP TABLE card_rewrites"); err != nil {
+		t.Fatalf("Failed to drop table: %v", err)
+	}
+
+	if err := ReviewFlashcard(deck.ID, cards[0].ID, algorithms.GradeAgain, models.ReviewTiming{}); err != nil {
+		t.Fatalf("Expected the review to succeed, got %v", err)
+	}
+	card, err := database.Card(deck.ID, cards[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+	if card.Lapses != 1 || !card.Leech || card.State == algorithms.StateReview {
+		t.Errorf("Expected the lapse to be saved and the card marked a leech, got %+v", card)
+	}
+}
+
+func TestCancelledRewriteIsCleared(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createTestCards(t, 1)
+	if err := RequestLeechRewrite(deck.ID, cards[0].ID); err != nil {
+		t.Fatalf("Failed to request rewrite: %v", err)
+	}
+	jobId, err := database.PendingCardRewriteJob(cards[0].ID)
+	if err != nil || jobId == 0 {
+		t.Fatalf("Expected a pending rewrite job, got %d (%v)", jobId, err)
+	}
+
+	// Cancelling the queued job from the job list drops the rewrite it would have made
+	if _, err := CancelAIJob(jobId); err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+	if _, _, _, err := database.CardRewrite(cards[0].ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected no rewrite after cancelling its job, got %v", err)
+	}
+
+	// So another one can be requested and accepted
+	if err := RequestLeechRewrite(deck.ID, cards[0].ID); err != nil {
+		t.Fatalf("Failed to request rewrite: %v", err)
+	}
+	jobId, err = database.PendingCardRewriteJob(cards[0].ID)
+	if err != nil || jobId == 0 {
+		t.Fatalf("Expected a new pending rewrite job, got %d (%v)", jobId, err)
+	}
+	if saved, err := database.SaveCardRewrite(cards[0].ID, jobId, "New front", "New back"); err != nil || !saved {
+		t.Fatalf("Expected the rewrite to be saved, got %v (%v)", saved, err)
+	}
+	card, err := AcceptLeechRewrite(deck.ID, cards[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to accept rewrite: %v", err)
+	}
+	if card.Front != "New front" || card.Back != "New back" {
+		t.Errorf("Expected the rewrite to be accepted, got %q and %q", card.Front, card.Back)
+	}
+}
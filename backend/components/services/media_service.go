@@ -0,0 +1,129 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/media"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// mediaMutex is held from storing a media file until it is recorded in the database,
+// so garbage collection never sees a file that is about to be attached
+var mediaMutex sync.Mutex
+
+// AttachMediaFile attaches an image or audio file from disk to one side of a card
+func AttachMediaFile(deckId int, cardId int, side string, filePath string) (models.MediaModel, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return models.MediaModel{}, fmt.Errorf("failed to read media file: %v", err)
+	}
+
+	return attachMedia(deckId, cardId, side, filepath.Base(filePath), data)
+}
+
+// AttachMediaData attaches base64 encoded image or audio data, e.g. pasted from the clipboard, to one side of a card
+func AttachMediaData(deckId int, cardId int, side string, fileName string, base64Data string) (models.MediaModel, error) {
+	data, err := base64.StdEncoding.DecodeString(base64Data)
+	if err != nil {
+		return models.MediaModel{}, fmt.Errorf("failed to decode media data: %v", err)
+	}
+
+	return attachMedia(deckId, cardId, side, fileName, data)
+}
+
+func attachMedia(deckId int, cardId int, side string, fileName string, data []byte) (models.MediaModel, error) {
+	if side != "front" && side != "back" {
+		return models.MediaModel{}, fmt.Errorf("invalid card side: %s", side)
+	}
+
+	// Make sure the card exists and belongs to the deck
+	if _, err := database.Card(deckId, cardId); err != nil {
+		return models.MediaModel{}, fmt.Errorf("failed to get flashcard: %v", err)
+	}
+
+	mediaMutex.Lock()
+	defer mediaMutex.Unlock()
+
+	stored, err := media.Store(fileName, data)
+	if err != nil {
+		return models.MediaModel{}, err
+	}
+
+	item, err := database.CreateCardMedia(models.MediaModel{
+		CardId:    cardId,
+		Side:      side,
+		MediaType: stored.MediaType,
+		FileName:  stored.Name,
+		Original:  fileName,
+		MimeType:  stored.MimeType,
+	})
+	if err != nil {
+		return models.MediaModel{}, fmt.Errorf("failed to save media attachment: %v", err)
+	}
+
+	item.URL = media.URL(item.FileName)
+	return item, nil
+}
+
+// ListCardMedia returns the media attached to a card
+func ListCardMedia(deckId int, cardId int) ([]models.MediaModel, error) {
+	if _, err := database.Card(deckId, cardId); err != nil {
+		return nil, fmt.Errorf("failed to get flashcard: %v", err)
+	}
+
+	items, err := database.CardMedia(cardId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].URL = media.URL(items[i].FileName)
+	}
+	return items, nil
+}
+
+// DeleteMedia detaches a media file from its card and removes the file if no other card uses it
+func DeleteMedia(mediaId int) error {
+	item, err := database.CardMediaItem(mediaId)
+	if err != nil {
+		return fmt.Errorf("failed to get media attachment: %v", err)
+	}
+
+	mediaMutex.Lock()
+	defer mediaMutex.Unlock()
+
+	if err := database.DeleteCardMedia(mediaId); err != nil {
+		return err
+	}
+
+	referenced, err := database.ReferencedMediaFiles()
+	if err != nil {
+		return err
+	}
+	if !referenced[item.FileName] {
+		return media.Remove(item.FileName)
+	}
+	return nil
+}
+
+// CollectOrphanedMedia removes media files that are no longer attached to any card,
+// returning the number of files removed
+func CollectOrphanedMedia() (int, error) {
+	mediaMutex.Lock()
+	defer mediaMutex.Unlock()
+
+	if err := database.DeleteOrphanedMediaRecords(); err != nil {
+		return 0, fmt.Errorf("failed to remove orphaned attachments: %v", err)
+	}
+
+	referenced, err := database.ReferencedMediaFiles()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list attached media: %v", err)
+	}
+
+	return media.CollectGarbage(referenced)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// WithMemoryState fills in the current stability, difficulty and retrievability and the interval each grade
+// would give for cards of one deck, building the deck's scheduler once for the whole list
+func WithMemoryState(deckId int, cards []models.FlashcardModel) ([]models.FlashcardModel, error) {
+	return WithMemoryStateAt(deckId, cards, studyClock.Now())
+}
+
+// WithMemoryStateAt is WithMemoryState as it would be at the given time
+func WithMemoryStateAt(deckId int, cards []models.FlashcardModel, now time.Time) ([]models.FlashcardModel, error) {
+	if len(cards) == 0 {
+		return cards, nil
+	}
+
+	deck, err := database.Deck(deckId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deck: %v", err)
+	}
+	steps, err := algorithms.ParseLearningSteps(deck.LearningSteps, deck.RelearningSteps)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := GetSchedulingSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	// Previews show the unfuzzed intervals, so they don't change every time the cards are listed
+	scheduler, err := algorithms.NewScheduler(deck.Scheduler, algorithms.SchedulerConfig{
+		Steps:  steps,
+		Spread: algorithms.IntervalSpread{MaximumInterval: settings.MaximumInterval},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range cards {
+		cards[i].NextIntervals = algorithms.NextIntervals(scheduler, cards[i], now)
+		cards[i] = algorithms.EstimateMemoryState(scheduler, cards[i], now)
+	}
+	return cards, nil
+}
+
+// CardWithMemoryState fills in the memory state of a single card
+func CardWithMemoryState(card models.FlashcardModel) (models.FlashcardModel, error) {
+	cards, err := WithMemoryState(card.DeckId, []models.FlashcardModel{card})
+	if err != nil {
+		return models.FlashcardModel{}, err
+	}
+	return cards[0], nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+func TestPreviewShowsMemoryStateAtPreviewTime(t *testing.T) {
+	useTestDatabase(t)
+	useStudyDay(t, "UTC", 4)
+	now := useManualClock(t, time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC))
+
+	deck, cards := createTestCards(t, 1)
+	if err := ReviewFlashcard(deck.ID, cards[0].ID, algorithms.GradeEasy, models.ReviewTiming{}); err != nil {
+		t.Fatalf("Failed to review card: %v", err)
+	}
+	reviewed, err := database.Card(deck.ID, cards[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+
+	daysAhead := int(math.Ceil(reviewed.IntervalDays)) + 1
+	preview, err := PreviewStudyQueue(deck.ID, daysAhead)
+	if err != nil {
+		t.Fatalf("Failed to preview study queue: %v", err)
+	}
+	if len(preview) != 1 {
+		t.Fatalf("Expected the card to be due in %d days, got %d cards", daysAhead, len(preview))
+	}
+
+	previewTime := now.Now().AddDate(0, 0, daysAhead)
+	if want := algorithms.Retrievability(reviewed, previewTime); math.Abs(preview[0].Retrievability-want) > 1e-9 {
+		t.Errorf("Expected the retrievability at the preview time, %v, got %v", want, preview[0].Retrievability)
+	}
+	if current := algorithms.Retrievability(reviewed, now.Now()); preview[0].Retrievability >= current {
+		t.Errorf("Expected the previewed retrievability to be lower than the current %v, got %v", current, preview[0].Retrievability)
+	}
+}
+
+func TestMemoryStateOfNonFSRSDecks(t *testing.T) {
+	useTestDatabase(t)
+	useStudyDay(t, "UTC", 4)
+	now := useManualClock(t, time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC))
+
+	deck, cards := createTestCards(t, 1)
+	if _, err := SetDeckScheduler(deck.ID, algorithms.SchedulerSM2); err != nil {
+		t.Fatalf("Failed to set scheduler: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := ReviewFlashcard(deck.ID, cards[0].ID, algorithms.GradeGood, models.ReviewTiming{}); err != nil {
+			t.Fatalf("Failed to review card: %v", err)
+		}
+		card, err := database.Card(deck.ID, cards[0].ID)
+		if err != nil {
+			t.Fatalf("Failed to get card: %v", err)
+		}
+		now.Set(card.DueDate)
+	}
+
+	// At the end of its 15 day interval the card is estimated at FSRS's 90%, whatever stability it still stores
+	card, err := database.Card(deck.ID, cards[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+	card, err = CardWithMemoryState(card)
+	if err != nil {
+		t.Fatalf("Failed to get memory state: %v", err)
+	}
+	if card.IntervalDays != 15 || math.Abs(card.Retrievability-0.9) > 1e-6 {
+		t.Errorf("Expected 90%% retrievability at the end of a 15 day interval, got %v after %v days", card.Retrievability, card.IntervalDays)
+	}
+	// The stability and difficulty shown are the ones the retrievability comes from
+	if card.FSRSStability != 15 || card.FSRSDifficulty <= 0 {
+		t.Errorf("Expected a stability of 15 and a difficulty, got %v and %v", card.FSRSStability, card.FSRSDifficulty)
+	}
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/media"
+	"github.com/jorkle/brightcards/backend/components/models"
+	"github.com/jorkle/brightcards/backend/components/occlusion"
+)
+
+// defaultOcclusionPrompt is shown on the front of an occlusion card when the note has no header
+const defaultOcclusionPrompt = "What is hidden?"
+
+// CreateImageOcclusion stores an image and creates one card per mask. Width and height are only needed
+// for images whose size can't be read, such as WebP or SVG.
+func CreateImageOcclusion(deckId int, fileName string, base64Image string, width int, height int, header string, hideAll bool, masks []models.OcclusionMaskModel) (models.OcclusionNoteModel, error) {
+	if err := occlusion.ValidateMasks(masks); err != nil {
+		return models.OcclusionNoteModel{}, err
+	}
+	if _, err := database.Deck(deckId); err != nil {
+		return models.OcclusionNoteModel{}, fmt.Errorf("failed to get deck: %v", err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(base64Image)
+	if err != nil {
+		return models.OcclusionNoteModel{}, fmt.Errorf("failed to decode image data: %v", err)
+	}
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		width, height = config.Width, config.Height
+	}
+	if width <= 0 || height <= 0 {
+		return models.OcclusionNoteModel{}, fmt.Errorf("image size could not be determined")
+	}
+
+	mediaMutex.Lock()
+	defer mediaMutex.Unlock()
+
+	stored, err := media.Store(fileName, data)
+	if err != nil {
+		return models.OcclusionNoteModel{}, err
+	}
+	if stored.MediaType != media.TypeImage {
+		return models.OcclusionNoteModel{}, fmt.Errorf("image occlusion needs an image, got %s", stored.MimeType)
+	}
+
+	noteId, err := database.CreateOcclusion(models.OcclusionNoteModel{
+		DeckId:   deckId,
+		FileName: stored.Name,
+		Width:    width,
+		Height:   height,
+		Header:   header,
+		HideAll:  hideAll,
+		Masks:    masks,
+	}, occlusionCards(deckId, header, masks))
+	if err != nil {
+		return models.OcclusionNoteModel{}, fmt.Errorf("failed to save image occlusion: %v", err)
+	}
+
+	return GetImageOcclusion(noteId)
+}
+
+// occlusionCards returns the card that schedules each mask
+func occlusionCards(deckId int, header string, masks []models.OcclusionMaskModel) []models.FlashcardModel {
+	cards := make([]models.FlashcardModel, len(masks))
+	for i, mask := range masks {
+		cards[i] = models.FlashcardModel{
+			ID:       mask.CardId,
+			Front:    occlusionPrompt(header),
+			Back:     mask.Label,
+			DeckId:   deckId,
+			CardType: occlusion.CardType,
+		}
+	}
+	return cards
+}
+
+func occlusionPrompt(header string) string {
+	if header == "" {
+		return defaultOcclusionPrompt
+	}
+	return header
+}
+
+// GetImageOcclusion returns an image occlusion note with its masks
+func GetImageOcclusion(noteId int) (models.OcclusionNoteModel, error) {
+	note, err := database.OcclusionNote(noteId)
+	if err != nil {
+		return models.OcclusionNoteModel{}, fmt.Errorf("failed to get image occlusion: %v", err)
+	}
+
+	note.ImageURL = media.URL(note.FileName)
+	return note, nil
+}
+
+// UpdateImageOcclusion replaces the masks of a note. Masks with an ID keep their card and its schedule,
+// masks without one get a new card, and cards of masks that were left out are deleted.
+func UpdateImageOcclusion(noteId int, header string, hideAll bool, masks []models.OcclusionMaskModel) (models.OcclusionNoteModel, error) {
+	if err := occlusion.ValidateMasks(masks); err != nil {
+		return models.OcclusionNoteModel{}, err
+	}
+
+	note, err := GetImageOcclusion(noteId)
+	if err != nil {
+		return models.OcclusionNoteModel{}, err
+	}
+
+	existing := map[int]models.OcclusionMaskModel{}
+	for _, mask := range note.Masks {
+		existing[mask.ID] = mask
+	}
+
+	// Masks are matched by ID, so the card of an existing mask comes from the saved note
+	for i, mask := range masks {
+		if mask.ID == 0 {
+			continue
+		}
+		previous, ok := existing[mask.ID]
+		if !ok {
+			return models.OcclusionNoteModel{}, fmt.Errorf("mask %d does not belong to this image occlusion", mask.ID)
+		}
+		delete(existing, mask.ID)
+		masks[i].CardId = previous.CardId
+	}
+
+	var removedCardIds []int
+	for _, removed := range existing {
+		removedCardIds = append(removedCardIds, removed.CardId)
+	}
+
+	note.Header = header
+	note.HideAll = hideAll
+	note.Masks = masks
+	if err := database.UpdateOcclusion(note, occlusionCards(note.DeckId, header, masks), removedCardIds); err != nil {
+		return models.OcclusionNoteModel{}, fmt.Errorf("failed to update image occlusion: %v", err)
+	}
+
+	return GetImageOcclusion(noteId)
+}
+
+// DeleteImageOcclusion deletes every card of a note. The note and its image are then removed by media garbage collection.
+func DeleteImageOcclusion(noteId int) error {
+	note, err := GetImageOcclusion(noteId)
+	if err != nil {
+		return err
+	}
+
+	for _, mask := range note.Masks {
+		if err := database.DeleteCard(mask.CardId); err != nil {
+			return fmt.Errorf("failed to delete flashcard: %v", err)
+		}
+	}
+
+	_, err = CollectOrphanedMedia()
+	return err
+}
+
+// GetOcclusionView renders the question and answer of an image occlusion card
+func GetOcclusionView(deckId int, cardId int) (models.OcclusionView, error) {
+	card, err := database.Card(deckId, cardId)
+	if err != nil {
+		return models.OcclusionView{}, fmt.Errorf("failed to get flashcard: %v", err)
+	}
+	if card.CardType != occlusion.CardType {
+		return models.OcclusionView{}, fmt.Errorf("flashcard %d is not an image occlusion card", cardId)
+	}
+
+	noteId, err := database.OcclusionNoteForCard(cardId)
+	if err != nil {
+		return models.OcclusionView{}, fmt.Errorf("failed to find image occlusion for flashcard %d: %v", cardId, err)
+	}
+	note, err := GetImageOcclusion(noteId)
+	if err != nil {
+		return models.OcclusionView{}, err
+	}
+
+	view := models.OcclusionView{
+		CardId:         cardId,
+		NoteId:         noteId,
+		ImageURL:       note.ImageURL,
+		Header:         note.Header,
+		SiblingCardIds: []int{},
+	}
+
+	target := -1
+	for i, mask := range note.Masks {
+		if mask.CardId == cardId {
+			target = i
+			view.Label = mask.Label
+			continue
+		}
+		view.SiblingCardIds = append(view.SiblingCardIds, mask.CardId)
+	}
+
+	view.QuestionSVG, view.AnswerSVG, err = occlusion.Render(note, target)
+	if err != nil {
+		return models.OcclusionView{}, err
+	}
+	return view, nil
+}
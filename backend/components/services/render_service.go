@@ -0,0 +1,83 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+	"github.com/jorkle/brightcards/backend/components/render"
+)
+
+// RenderCard renders both sides of a card, in the phrasing it is shown with when it has one. Review and listing
+// both go through here so a card looks the same everywhere.
+func RenderCard(card models.FlashcardModel) (models.RenderedFlashcard, error) {
+	frontText, backText := displayText(card)
+
+	front, err := render.Markdown(frontText)
+	if err != nil {
+		return models.RenderedFlashcard{}, err
+	}
+	back, err := render.Markdown(backText)
+	if err != nil {
+		return models.RenderedFlashcard{}, err
+	}
+
+	return models.RenderedFlashcard{
+		ID:        card.ID,
+		DeckId:    card.DeckId,
+		FrontHTML: front,
+		BackHTML:  back,
+	}, nil
+}
+
+// displayText returns the front and back a card is shown with, which are a variant's when its phrasing rotated in
+func displayText(card models.FlashcardModel) (string, string) {
+	if card.VariantId != 0 {
+		return card.DisplayFront, card.DisplayBack
+	}
+	return card.Front, card.Back
+}
+
+// displayedCard returns a card in the phrasing the study queue shows it with
+func displayedCard(deckId int, cardId int) (models.FlashcardModel, error) {
+	card, err := database.Card(deckId, cardId)
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to get flashcard: %v", err)
+	}
+
+	deck, err := database.Deck(deckId)
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to get deck: %v", err)
+	}
+	if deck.VariantMode == database.VariantModeRotate && card.ParentCardId == nil {
+		return rotatePhrasing(card)
+	}
+	return card, nil
+}
+
+// RenderFlashcard renders a single card for review, in the phrasing the study queue shows it with
+func RenderFlashcard(deckId int, cardId int) (models.RenderedFlashcard, error) {
+	card, err := displayedCard(deckId, cardId)
+	if err != nil {
+		return models.RenderedFlashcard{}, err
+	}
+	return RenderCard(card)
+}
+
+// RenderFlashcards renders every card in a deck for listing
+func RenderFlashcards(deckId int) ([]models.RenderedFlashcard, error) {
+	cards, err := database.Cards(deckId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flashcards: %v", err)
+	}
+
+	rendered := make([]models.RenderedFlashcard, 0, len(cards))
+	for _, card := range cards {
+		r, err := RenderCard(card)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, r)
+	}
+	return rendered, nil
+}
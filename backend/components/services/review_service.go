@@ -0,0 +1,213 @@
+package services
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+const (
+	fuzzEnabledSetting     = "scheduler_fuzz"
+	loadBalanceSetting     = "scheduler_load_balance"
+	maximumIntervalSetting = "scheduler_maximum_interval"
+)
+
+// SchedulingSettings controls how review intervals are spread out across days
+type SchedulingSettings struct {
+	Fuzz            bool `json:"fuzz"`            // randomize intervals slightly so cards added together drift apart
+	LoadBalance     bool `json:"loadBalance"`     // pick the least busy day within the fuzz range instead of a random one
+	MaximumInterval int  `json:"maximumInterval"` // longest interval in days
+}
+
+// GetSchedulingSettings returns the saved scheduling settings
+func GetSchedulingSettings() (SchedulingSettings, error) {
+	settings := SchedulingSettings{
+		Fuzz:            true,
+		MaximumInterval: algorithms.DefaultMaximumInterval,
+	}
+
+	values := map[string]string{}
+	for _, key := range []string{fuzzEnabledSetting, loadBalanceSetting, maximumIntervalSetting} {
+		value, err := database.GetSetting(key)
+		if err != nil {
+			return SchedulingSettings{}, fmt.Errorf("failed to get scheduling settings: %v", err)
+		}
+		values[key] = value
+	}
+
+	if values[fuzzEnabledSetting] != "" {
+		settings.Fuzz = values[fuzzEnabledSetting] == "true"
+	}
+	settings.LoadBalance = values[loadBalanceSetting] == "true"
+	if values[maximumIntervalSetting] != "" {
+		maximumInterval, err := strconv.Atoi(values[maximumIntervalSetting])
+		if err != nil {
+			return SchedulingSettings{}, fmt.Errorf("invalid maximum interval %q: %v", values[maximumIntervalSetting], err)
+		}
+		settings.MaximumInterval = maximumInterval
+	}
+
+	return settings, nil
+}
+
+// SaveSchedulingSettings validates and saves the scheduling settings
+func SaveSchedulingSettings(settings SchedulingSettings) error {
+	if settings.MaximumInterval < 1 {
+		return fmt.Errorf("maximum interval must be at least one day")
+	}
+
+	values := map[string]string{
+		fuzzEnabledSetting:     strconv.FormatBool(settings.Fuzz),
+		loadBalanceSetting:     strconv.FormatBool(settings.LoadBalance),
+		maximumIntervalSetting: strconv.Itoa(settings.MaximumInterval),
+	}
+	for key, value := range values {
+		if err := database.SaveSetting(key, value); err != nil {
+			return fmt.Errorf("failed to save scheduling settings: %v", err)
+		}
+	}
+	return nil
+}
+
+// intervalSpread builds the fuzz and load balancing options for a review graded at now
+func intervalSpread(now time.Time) (algorithms.IntervalSpread, error) {
+	settings, err := GetSchedulingSettings()
+	if err != nil {
+		return algorithms.IntervalSpread{}, err
+	}
+
+	spread := algorithms.IntervalSpread{
+		Fuzz:            settings.Fuzz,
+		MaximumInterval: settings.MaximumInterval,
+		Random:          rand.Float64,
+	}
+	if !settings.LoadBalance {
+		return spread, nil
+	}
+
+	dayStart, err := StudyDayStart(now)
+	if err != nil {
+		return algorithms.IntervalSpread{}, err
+	}
+	dueCounts, err := database.DueCountsByDay(dayStart, settings.MaximumInterval)
+	if err != nil {
+		return algorithms.IntervalSpread{}, fmt.Errorf("failed to get due counts: %v", err)
+	}
+	spread.DueOn = func(days int) int {
+		return dueCounts[days]
+	}
+	return spread, nil
+}
+
+// ReviewFlashcard grades a card, moves it through the deck's learning steps and stores its next review.
+// Its siblings are buried until the next study day, and a card forgotten often enough becomes a leech
+// and gets the deck's leech action. Recalled cards of auto-rephrase decks are queued for new variants.
+// timing is how long the answer took; leave it zero when the review wasn't timed.
+func ReviewFlashcard(deckId int, cardId int, grade int, timing models.ReviewTiming) error {
+	if grade < algorithms.GradeAgain || grade > algorithms.GradeEasy {
+		return fmt.Errorf("invalid grade: %d", grade)
+	}
+	if timing.AnswerMs < 0 || timing.AnswerSideMs < 0 || timing.AnswerSideMs > timing.AnswerMs {
+		return fmt.Errorf("invalid answer time: %d ms with %d ms on the answer side", timing.AnswerMs, timing.AnswerSideMs)
+	}
+
+	card, err := database.Card(deckId, cardId)
+	if err != nil {
+		return fmt.Errorf("failed to get flashcard: %v", err)
+	}
+
+	deck, err := database.Deck(deckId)
+	if err != nil {
+		return fmt.Errorf("failed to get deck: %v", err)
+	}
+
+	// Decks that rotate phrasings keep a single schedule on the original card
+	if card.ParentCardId != nil && deck.VariantMode == database.VariantModeRotate {
+		cardId = *card.ParentCardId
+		card, err = database.Card(deckId, cardId)
+		if err != nil {
+			return fmt.Errorf("failed to get original flashcard: %v", err)
+		}
+	}
+
+	now := studyClock.Now()
+	scheduler, err := deckScheduler(deck, now)
+	if err != nil {
+		return err
+	}
+
+	schedule := scheduler.Next(card, grade, now)
+	lapse := algorithms.IsLapse(card.State, grade)
+	schedule.Lapses = card.Lapses
+	if lapse {
+		schedule.Lapses++
+	}
+
+	if err := database.ReviewCard(deckId, cardId, grade, schedule, now, timing); err != nil {
+		return err
+	}
+
+	// The review is saved by now, so failing to bury siblings or act on a leech doesn't fail it
+	if err := burySiblings(cardId, now); err != nil {
+		println("Warning:", err.Error())
+	}
+	if err := autoRephraseAfterReview(deck, card, grade); err != nil {
+		println("Warning:", err.Error())
+	}
+
+	if lapse && algorithms.IsLeech(schedule.Lapses, deck.LeechThreshold) {
+		if err := handleLeech(deck, card); err != nil {
+			println("Warning: failed to handle leech:", err.Error())
+		}
+	}
+	return nil
+}
+
+// deckScheduler returns the scheduler a deck uses, configured with its steps and the collection's interval settings
+func deckScheduler(deck database.DeckModel, now time.Time) (algorithms.Scheduler, error) {
+	steps, err := algorithms.ParseLearningSteps(deck.LearningSteps, deck.RelearningSteps)
+	if err != nil {
+		return nil, err
+	}
+
+	spread, err := intervalSpread(now)
+	if err != nil {
+		return nil, err
+	}
+
+	return algorithms.NewScheduler(deck.Scheduler, algorithms.SchedulerConfig{Steps: steps, Spread: spread})
+}
+
+// SetDeckScheduler switches a deck to another scheduling algorithm, converting the memory state of its cards
+// so they keep their current intervals and due dates
+func SetDeckScheduler(deckId int, name string) (database.DeckModel, error) {
+	deck, err := database.Deck(deckId)
+	if err != nil {
+		return database.DeckModel{}, fmt.Errorf("failed to get deck: %v", err)
+	}
+	if deck.Scheduler == name {
+		return deck, nil
+	}
+
+	deck.Scheduler = name
+	scheduler, err := deckScheduler(deck, studyClock.Now())
+	if err != nil {
+		return database.DeckModel{}, err
+	}
+
+	return database.MigrateDeckScheduler(deckId, name, scheduler.Migrate)
+}
+
+// UpdateDeckLearningSteps validates and saves the learning and relearning steps of a deck
+func UpdateDeckLearningSteps(deckId int, learningSteps string, relearningSteps string) (database.DeckModel, error) {
+	if _, err := algorithms.ParseLearningSteps(learningSteps, relearningSteps); err != nil {
+		return database.DeckModel{}, err
+	}
+
+	return database.UpdateDeckLearningSteps(deckId, learningSteps, relearningSteps)
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+)
+
+func TestSetDeckSchedulerMigratesCards(t *testing.T) {
+	useTestDatabase(t)
+	useStudyDay(t, "UTC", 4)
+	now := useManualClock(t, time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC))
+
+	deck, cards := createTestCards(t, 2)
+	due := now.Now().AddDate(0, 0, 3)
+	if err := database.RescheduleCard(cards[0].ID, algorithms.Reschedule(cards[0], 10), due); err != nil {
+		t.Fatalf("Failed to reschedule card: %v", err)
+	}
+
+	deck, err := SetDeckScheduler(deck.ID, algorithms.SchedulerLeitner)
+	if err != nil {
+		t.Fatalf("Failed to set scheduler: %v", err)
+	}
+	if deck.Scheduler != algorithms.SchedulerLeitner {
+		t.Errorf("Expected the deck to use %q, got %q", algorithms.SchedulerLeitner, deck.Scheduler)
+	}
+
+	review, err := database.Card(deck.ID, cards[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+	if review.LeitnerBox != 4 || review.IntervalDays != 10 || !review.DueDate.Equal(due) {
+		t.Errorf("Expected box 4 with 10 days due %v, got box %d with %v days due %v", due, review.LeitnerBox, review.IntervalDays, review.DueDate)
+	}
+
+	fresh, err := database.Card(deck.ID, cards[1].ID)
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+	if fresh.State != algorithms.StateNew || fresh.LeitnerBox != 0 {
+		t.Errorf("Expected the new card to stay new, got %q in box %d", fresh.State, fresh.LeitnerBox)
+	}
+}
+
+func TestSetDeckSchedulerIsAtomic(t *testing.T) {
+	useTestDatabase(t)
+	useStudyDay(t, "UTC", 4)
+	now := useManualClock(t, time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC))
+
+	deck, cards := createTestCards(t, 3)
+	for _, card := range cards {
+		if err := database.RescheduleCard(card.ID, algorithms.Reschedule(card, 10), now.Now().AddDate(0, 0, 3)); err != nil {
+			t.Fatalf("Failed to reschedule card: %v", err)
+		}
+	}
+
+	// Fail the migration of the last card, after the others have been written
+	_, err := database.DB.Exec(fmt.Sprintf(`CREATE TRIGGER fail_migration BEFORE UPDATE OF leitner_box ON flashcards
+		WHEN NEW.id = %d BEGIN SELECT RAISE(ABORT, 'migration failed'); END`, cards[2].ID))
+	if err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	if _, err := SetDeckScheduler(deck.ID, algorithms.SchedulerLeitner); err == nil {
+		t.Fatalf("Expected the migration to fail")
+	}
+
+	deck, err = database.Deck(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get deck: %v", err)
+	}
+	if deck.Scheduler != algorithms.SchedulerFSRS {
+		t.Errorf("Expected the deck to stay on %q, got %q", algorithms.SchedulerFSRS, deck.Scheduler)
+	}
+	for _, card := range cards {
+		stored, err := database.Card(deck.ID, card.ID)
+		if err != nil {
+			t.Fatalf("Failed to get card: %v", err)
+		}
+		if stored.LeitnerBox != 1 {
+			t.Errorf("Expected card %d to be left as it was in box 1, got box %d", card.ID, stored.LeitnerBox)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/clock"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// useTestDatabase points the database at an empty file for the rest of the test
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+
+	if err := database.Open(filepath.Join(t.TempDir(), "bcards.db")); err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+}
+
+// useManualClock schedules with a clock stopped at now for the rest of the test
+func useManualClock(t *testing.T, now time.Time) *clock.Manual {
+	t.Helper()
+
+	c := clock.NewManual(now)
+	SetClock(c)
+	t.Cleanup(func() { SetClock(clock.System) })
+	return c
+}
+
+// useStudyDay sets the timezone and hour the study day starts at
+func useStudyDay(t *testing.T, timezone string, startHour int) *time.Location {
+	t.Helper()
+
+	if err := SaveStudyDaySettings(StudyDaySettings{Timezone: timezone, StartHour: startHour}); err != nil {
+		t.Fatalf("Failed to save study day settings: %v", err)
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		t.Fatalf("Failed to load timezone: %v", err)
+	}
+	return location
+}
+
+// createTestCards creates a deck with n new cards
+func createTestCards(t *testing.T, n int) (database.DeckModel, []models.FlashcardModel) {
+	t.Helper()
+
+	deck, err := database.CreateDeck("Test Deck", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create deck: %v", err)
+	}
+
+	cards := make([]models.FlashcardModel, n)
+	for i := range cards {
+		cards[i], err = database.CreateCard(models.FlashcardModel{DeckId: deck.ID, Front: "Front", Back: "Back"})
+		if err != nil {
+			t.Fatalf("Failed to create card: %v", err)
+		}
+	}
+	return deck, cards
+}
+
+// queueIds returns the ids of the cards in a study queue
+func queueIds(queue []models.FlashcardModel) []int {
+	ids := make([]int, len(queue))
+	for i, card := range queue {
+		ids[i] = card.ID
+	}
+	return ids
+}
+
+// equalIds reports whether two lists of ids are the same, in the same order
+func equalIds(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+const (
+	// maxSimulationDays keeps simulations responsive; beyond ten years the projection means little anyway
+	maxSimulationDays = 3650
+	simulationRuns    = 20
+	simulationSeed    = 42
+)
+
+// SimulateWorkload projects the daily reviews, study time and final retention of a deck over the coming days,
+// studying newPerDay new cards a day at the desired retention
+func SimulateWorkload(deckId int, days int, newPerDay int, retention float64) (models.WorkloadSimulation, error) {
+	if days < 1 || days > maxSimulationDays {
+		return models.WorkloadSimulation{}, fmt.Errorf("days must be between 1 and %d", maxSimulationDays)
+	}
+	if newPerDay < 0 {
+		return models.WorkloadSimulation{}, fmt.Errorf("new cards per day can't be negative")
+	}
+	if retention < 0.5 || retention > 0.99 {
+		return models.WorkloadSimulation{}, fmt.Errorf("desired retention must be between 0.5 and 0.99")
+	}
+
+	deck, err := database.Deck(deckId)
+	if err != nil {
+		return models.WorkloadSimulation{}, fmt.Errorf("failed to get deck: %v", err)
+	}
+	cards, err := database.Cards(deckId)
+	if err != nil {
+		return models.WorkloadSimulation{}, fmt.Errorf("failed to get flashcards: %v", err)
+	}
+
+	// Rotated variants are reviewed through their original, so they add no work of their own
+	if deck.VariantMode == database.VariantModeRotate {
+		scheduled := cards[:0]
+		for _, card := range cards {
+			if card.ParentCardId == nil {
+				scheduled = append(scheduled, card)
+			}
+		}
+		cards = scheduled
+	}
+
+	// The simulation uses FSRS memory states, so estimate them for decks on another scheduler
+	if deck.Scheduler != "" && deck.Scheduler != algorithms.SchedulerFSRS {
+		fsrs := &algorithms.FSRSScheduler{}
+		for i, card := range cards {
+			schedule := fsrs.Migrate(card)
+			cards[i].FSRSStability = schedule.Stability
+			cards[i].FSRSDifficulty = schedule.Difficulty
+		}
+	}
+
+	start, err := StudyDayStart(studyClock.Now())
+	if err != nil {
+		return models.WorkloadSimulation{}, err
+	}
+	settings, err := GetSchedulingSettings()
+	if err != nil {
+		return models.WorkloadSimulation{}, err
+	}
+	costs, err := reviewCosts()
+	if err != nil {
+		return models.WorkloadSimulation{}, err
+	}
+
+	simulation := algorithms.SimulateWorkload(cards, algorithms.SimulationConfig{
+		Start:            start,
+		Days:             days,
+		NewCardsPerDay:   newPerDay,
+		DesiredRetention: retention,
+		MaximumInterval:  settings.MaximumInterval,
+		Runs:             simulationRuns,
+		Seed:             simulationSeed,
+		Costs:            costs,
+	})
+	simulation.DeckId = deckId
+	return simulation, nil
+}
+
+// minTimedReviews is how many timed reviews of a kind are needed before their average replaces the default cost
+const minTimedReviews = 20
+
+// reviewCosts returns the time reviews take, measured from the user's timed reviews where there are enough of them.
+// Measured new card costs only cover the first review, not the learning steps that follow it.
+func reviewCosts() (algorithms.ReviewCosts, error) {
+	averages, err := database.AverageReviewTimes()
+	if err != nil {
+		return algorithms.ReviewCosts{}, fmt.Errorf("failed to get review times: %v", err)
+	}
+
+	costs := algorithms.DefaultReviewCosts
+	measured := func(key database.ReviewTimeKey, fallback float64) float64 {
+		if average := averages[key]; average.Reviews >= minTimedReviews {
+			return average.Seconds
+		}
+		return fallback
+	}
+	for grade := algorithms.GradeAgain; grade <= algorithms.GradeEasy; grade++ {
+		costs.LearnSeconds[grade-1] = measured(database.ReviewTimeKey{WasNew: true, State: algorithms.StateNew, Grade: grade}, costs.LearnSeconds[grade-1])
+		costs.ReviewSeconds[grade-1] = measured(database.ReviewTimeKey{State: algorithms.StateReview, Grade: grade}, costs.ReviewSeconds[grade-1])
+	}
+	return costs, nil
+}
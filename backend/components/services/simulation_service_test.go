@@ -0,0 +1,48 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+)
+
+func TestReviewCosts(t *testing.T) {
+	useTestDatabase(t)
+
+	costs, err := reviewCosts()
+	if err != nil {
+		t.Fatalf("Failed to get review costs: %v", err)
+	}
+	if costs != algorithms.DefaultReviewCosts {
+		t.Errorf("Expected the default costs without timed reviews, got %+v", costs)
+	}
+
+	_, cards := createTestCards(t, 1)
+	card := cards[0]
+	for i := 0; i < minTimedReviews; i++ {
+		// First reviews graded Good, averaging 8s
+		logTimedReview(t, card, algorithms.GradeGood, algorithms.StateNew, 6000+4000*(i%2), 1000)
+		// Reviews graded Easy, each capped at a minute
+		logTimedReview(t, card, algorithms.GradeEasy, algorithms.StateReview, 90000, 1000)
+	}
+	// One short of enough reviews graded Again
+	for i := 0; i < minTimedReviews-1; i++ {
+		logTimedReview(t, card, algorithms.GradeAgain, algorithms.StateReview, 1000, 500)
+	}
+	// Learning steps aren't review costs
+	for i := 0; i < minTimedReviews; i++ {
+		logTimedReview(t, card, algorithms.GradeGood, algorithms.StateLearning, 2000, 500)
+	}
+
+	costs, err = reviewCosts()
+	if err != nil {
+		t.Fatalf("Failed to get review costs: %v", err)
+	}
+
+	want := algorithms.DefaultReviewCosts
+	want.LearnSeconds[algorithms.GradeGood-1] = 8
+	want.ReviewSeconds[algorithms.GradeEasy-1] = 60
+	if costs != want {
+		t.Errorf("Expected %+v, got %+v", want, costs)
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+const dateLayout = "2006-01-02"
+
+// maxStatsDays limits how far back daily reviews and how far ahead the forecast go
+const maxStatsDays = 3650
+
+// retentionWindows are the periods true retention is reported over, in study days including today
+var retentionWindows = []struct {
+	label string
+	days  int
+}{
+	{"Today", 1},
+	{"Week", 7},
+	{"Month", 30},
+	{"Year", 365},
+}
+
+// studyDayModifier returns the SQLite date modifier that moves review times onto the calendar date of their
+// study day, given the start of the current study day. Daylight saving changes are taken from today.
+func studyDayModifier(dayStart time.Time) string {
+	_, offset := dayStart.Zone()
+	return fmt.Sprintf("%+d seconds", offset-dayStart.Hour()*3600-dayStart.Minute()*60)
+}
+
+func ratio(part int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// GetRetention returns the true retention of a deck, or of all decks when deckId is 0, over the last day, week, month and year
+func GetRetention(deckId int) ([]models.RetentionWindow, error) {
+	dayStart, err := StudyDayStart(studyClock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	windows := []models.RetentionWindow{}
+	for _, period := range retentionWindows {
+		window, err := database.RetentionSince(deckId, dayStart.AddDate(0, 0, 1-period.days))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get retention: %v", err)
+		}
+		window.Label = period.label
+		window.Days = period.days
+		window.Retention = ratio(window.YoungPassed+window.MaturePassed, window.YoungReviews+window.MatureReviews)
+		window.YoungRetention = ratio(window.YoungPassed, window.YoungReviews)
+		window.MatureRetention = ratio(window.MaturePassed, window.MatureReviews)
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// GetDailyReviews returns the reviews and time spent on each of the last days, oldest first, including days without reviews
+func GetDailyReviews(deckId int, days int) ([]models.DailyReviews, error) {
+	if days < 1 || days > maxStatsDays {
+		return nil, fmt.Errorf("days must be between 1 and %d", maxStatsDays)
+	}
+
+	dayStart, err := StudyDayStart(studyClock.Now())
+	if err != nil {
+		return nil, err
+	}
+	from := dayStart.AddDate(0, 0, 1-days)
+
+	reviewed, err := database.DailyReviewsSince(deckId, from, studyDayModifier(dayStart))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily reviews: %v", err)
+	}
+	byDate := map[string]models.DailyReviews{}
+	for _, day := range reviewed {
+		byDate[day.Date] = day
+	}
+
+	daily := make([]models.DailyReviews, days)
+	for i := range daily {
+		date := from.AddDate(0, 0, i).Format(dateLayout)
+		daily[i] = byDate[date]
+		daily[i].Date = date
+	}
+	return daily, nil
+}
+
+// GetDueForecast returns how many cards fall due on each of the coming days, starting today with overdue cards
+func GetDueForecast(deckId int, days int) ([]models.ForecastDay, error) {
+	if days < 1 || days > maxStatsDays {
+		return nil, fmt.Errorf("days must be between 1 and %d", maxStatsDays)
+	}
+
+	dayStart, err := StudyDayStart(studyClock.Now())
+	if err != nil {
+		return nil, err
+	}
+	counts, err := database.DueForecast(deckId, dayStart, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due forecast: %v", err)
+	}
+
+	forecast := make([]models.ForecastDay, days)
+	for i := range forecast {
+		forecast[i] = models.ForecastDay{Date: dayStart.AddDate(0, 0, i).Format(dateLayout), Due: counts[i]}
+	}
+	return forecast, nil
+}
+
+// GetCardDistributions returns how the studied cards are spread over stability, difficulty and interval
+func GetCardDistributions(deckId int) (models.CardDistributions, error) {
+	distributions, err := database.CardDistributions(deckId)
+	if err != nil {
+		return models.CardDistributions{}, fmt.Errorf("failed to get card distributions: %v", err)
+	}
+	return distributions, nil
+}
+
+// GetStreak returns the current and longest runs of consecutive study days with reviews
+func GetStreak(deckId int) (models.StreakStats, error) {
+	dayStart, err := StudyDayStart(studyClock.Now())
+	if err != nil {
+		return models.StreakStats{}, err
+	}
+
+	runs, err := database.StudyDayRuns(deckId, studyDayModifier(dayStart))
+	if err != nil {
+		return models.StreakStats{}, fmt.Errorf("failed to get study days: %v", err)
+	}
+
+	streak := models.StreakStats{}
+	for _, run := range runs {
+		streak.DaysStudied += run.Days
+		streak.Longest = max(streak.Longest, run.Days)
+	}
+	// The streak isn't broken until a whole study day passes without reviews
+	today := dayStart.Format(dateLayout)
+	yesterday := dayStart.AddDate(0, 0, -1).Format(dateLayout)
+	if len(runs) > 0 && (runs[0].Last == today || runs[0].Last == yesterday) {
+		streak.Current = runs[0].Days
+	}
+	return streak, nil
+}
+
+// GetHeatmap returns the number of reviews on every day of a year, for an activity heatmap
+func GetHeatmap(deckId int, year int) ([]models.HeatmapDay, error) {
+	dayStart, err := StudyDayStart(studyClock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	location := dayStart.Location()
+	from := time.Date(year, time.January, 1, dayStart.Hour(), dayStart.Minute(), 0, 0, location)
+	to := from.AddDate(1, 0, 0)
+	counts, err := database.ReviewCountsByDay(deckId, from, to, studyDayModifier(dayStart))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reviews per day: %v", err)
+	}
+
+	heatmap := []models.HeatmapDay{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateLayout)
+		heatmap = append(heatmap, models.HeatmapDay{Date: date, Reviews: counts[date]})
+	}
+	return heatmap, nil
+}
+
+// minSlowCardReviews is how many passed, timed reviews a card needs before it is judged slow
+const minSlowCardReviews = 3
+
+// GetSlowCards returns up to limit cards of a deck that take longest to answer over their passed reviews.
+// Cards that are slow yet mostly graded Good or Easy are usually worth rewriting or splitting.
+func GetSlowCards(deckId int, limit int) ([]models.SlowCard, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("limit must be at least 1")
+	}
+
+	slow, err := database.SlowCards(deckId, minSlowCardReviews, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get slow cards: %v", err)
+	}
+	return slow, nil
+}
+
+// GetOverviewStats returns the statistics of the overview page: retention, the last 30 days of reviews,
+// the 30 day forecast, card distributions, the streak and this year's heatmap
+func GetOverviewStats(deckId int) (models.OverviewStats, error) {
+	stats := models.OverviewStats{DeckId: deckId}
+
+	var err error
+	if stats.Retention, err = GetRetention(deckId); err != nil {
+		return models.OverviewStats{}, err
+	}
+	if stats.DailyReviews, err = GetDailyReviews(deckId, 30); err != nil {
+		return models.OverviewStats{}, err
+	}
+	if stats.Forecast, err = GetDueForecast(deckId, 30); err != nil {
+		return models.OverviewStats{}, err
+	}
+	if stats.Distributions, err = GetCardDistributions(deckId); err != nil {
+		return models.OverviewStats{}, err
+	}
+	if stats.Streak, err = GetStreak(deckId); err != nil {
+		return models.OverviewStats{}, err
+	}
+
+	dayStart, err := StudyDayStart(studyClock.Now())
+	if err != nil {
+		return models.OverviewStats{}, err
+	}
+	if stats.Heatmap, err = GetHeatmap(deckId, dayStart.Year()); err != nil {
+		return models.OverviewStats{}, err
+	}
+	return stats, nil
+}
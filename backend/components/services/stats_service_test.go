@@ -0,0 +1,238 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/clock"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// logTestReview adds a review to the log as if the card had been reviewed at reviewedAt
+func logTestReview(t *testing.T, card models.FlashcardModel, grade int, state string, intervalDays float64, reviewedAt time.Time) {
+	t.Helper()
+
+	_, err := database.DB.Exec("INSERT INTO review_logs (card_id, deck_id, grade, was_new, state, stability, difficulty, interval_days, reviewed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		card.ID, card.DeckId, grade, state == algorithms.StateNew, state, intervalDays, 5, intervalDays, reviewedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("Failed to log review: %v", err)
+	}
+}
+
+// logTimedReview adds a review to the log that took answerMs to answer, answerSideMs of them with the answer shown
+func logTimedReview(t *testing.T, card models.FlashcardModel, grade int, state string, answerMs int, answerSideMs int) {
+	t.Helper()
+
+	_, err := database.DB.Exec("INSERT INTO review_logs (card_id, deck_id, grade, was_new, state, stability, difficulty, interval_days, answer_ms, answer_side_ms, reviewed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		card.ID, card.DeckId, grade, state == algorithms.StateNew, state, 5, 5, 5, answerMs, answerSideMs, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("Failed to log review: %v", err)
+	}
+}
+
+// seedStudyDays sets up a study day starting at 04:00 in Berlin, with the clock at noon on 10 May, and logs
+// reviews on either side of the day boundaries
+func seedStudyDays(t *testing.T) (database.DeckModel, *time.Location, *clock.Manual) {
+	t.Helper()
+
+	useTestDatabase(t)
+	berlin := useStudyDay(t, "Europe/Berlin", 4)
+	now := useManualClock(t, time.Date(2024, 5, 10, 12, 0, 0, 0, berlin))
+
+	deck, cards := createTestCards(t, 6)
+	at := func(month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, berlin)
+	}
+
+	// A card that became mature on 1 May and was forgotten today
+	logTestReview(t, cards[0], algorithms.GradeGood, algorithms.StateReview, 30, at(5, 1, 10, 0))
+	logTestReview(t, cards[0], algorithms.GradeAgain, algorithms.StateReview, 1, at(5, 10, 5, 0))
+	// Before 04:00 still counts towards the previous study day, even past midnight
+	logTestReview(t, cards[1], algorithms.GradeGood, algorithms.StateReview, 5, at(5, 10, 3, 30))
+	logTestReview(t, cards[2], algorithms.GradeGood, algorithms.StateReview, 5, at(5, 10, 0, 30))
+	logTestReview(t, cards[3], algorithms.GradeGood, algorithms.StateReview, 5, at(5, 9, 3, 59))
+	// The first moment of today
+	logTestReview(t, cards[4], algorithms.GradeHard, algorithms.StateReview, 3, at(5, 10, 4, 0))
+	// Learning reviews don't count towards retention
+	logTestReview(t, cards[5], algorithms.GradeAgain, algorithms.StateLearning, 1.0/1440, at(5, 10, 6, 0))
+
+	return deck, berlin, now
+}
+
+func TestRetentionWindows(t *testing.T) {
+	deck, _, _ := seedStudyDays(t)
+
+	windows, err := GetRetention(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get retention: %v", err)
+	}
+
+	want := []models.RetentionWindow{
+		{Label: "Today", YoungReviews: 1, YoungPassed: 1, MatureReviews: 1, MaturePassed: 0, Retention: 0.5},
+		{Label: "Week", YoungReviews: 4, YoungPassed: 4, MatureReviews: 1, MaturePassed: 0, Retention: 0.8},
+		{Label: "Month", YoungReviews: 5, YoungPassed: 5, MatureReviews: 1, MaturePassed: 0, Retention: 5.0 / 6},
+	}
+	for i, w := range want {
+		got := windows[i]
+		if got.Label != w.Label || got.YoungReviews != w.YoungReviews || got.YoungPassed != w.YoungPassed ||
+			got.MatureReviews != w.MatureReviews || got.MaturePassed != w.MaturePassed || got.Retention != w.Retention {
+			t.Errorf("Expected %+v, got %+v", w, got)
+		}
+	}
+	if windows[0].MatureRetention != 0 || windows[0].YoungRetention != 1 {
+		t.Errorf("Expected today's young retention to be 1 and mature retention 0, got %v and %v", windows[0].YoungRetention, windows[0].MatureRetention)
+	}
+
+	// Other decks' reviews are left out, and deck 0 covers every deck
+	other, err := database.CreateDeck("Other Deck", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create deck: %v", err)
+	}
+	if windows, err := GetRetention(other.ID); err != nil || windows[3].YoungReviews+windows[3].MatureReviews != 0 {
+		t.Errorf("Expected no reviews in another deck, got %+v (%v)", windows, err)
+	}
+	if windows, err := GetRetention(0); err != nil || windows[2].YoungReviews != 5 || windows[2].MatureReviews != 1 {
+		t.Errorf("Expected every deck's reviews for deck 0, got %+v (%v)", windows, err)
+	}
+}
+
+func TestDailyReviewsFollowStudyDays(t *testing.T) {
+	deck, _, _ := seedStudyDays(t)
+
+	daily, err := GetDailyReviews(deck.ID, 3)
+	if err != nil {
+		t.Fatalf("Failed to get daily reviews: %v", err)
+	}
+
+	want := []models.DailyReviews{
+		{Date: "2024-05-08", Reviews: 1},
+		{Date: "2024-05-09", Reviews: 2},
+		{Date: "2024-05-10", Reviews: 3, Learning: 1, Again: 2},
+	}
+	if len(daily) != len(want) {
+		t.Fatalf("Expected %d days, got %+v", len(want), daily)
+	}
+	for i, w := range want {
+		got := daily[i]
+		if got.Date != w.Date || got.Reviews != w.Reviews || got.Learning != w.Learning || got.Again != w.Again {
+			t.Errorf("Expected %+v, got %+v", w, got)
+		}
+	}
+}
+
+func TestStreakFollowsStudyDays(t *testing.T) {
+	deck, berlin, now := seedStudyDays(t)
+
+	cases := []struct {
+		now     time.Time
+		current int
+	}{
+		{time.Date(2024, 5, 10, 12, 0, 0, 0, berlin), 3},
+		// Nothing studied on 11 May yet, but the streak holds until that study day is over
+		{time.Date(2024, 5, 12, 3, 59, 0, 0, berlin), 3},
+		{time.Date(2024, 5, 12, 4, 0, 0, 0, berlin), 0},
+	}
+	for _, tc := range cases {
+		now.Set(tc.now)
+		streak, err := GetStreak(deck.ID)
+		if err != nil {
+			t.Fatalf("Failed to get streak: %v", err)
+		}
+		// 1 May, then 8 to 10 May
+		if streak.Current != tc.current || streak.Longest != 3 || streak.DaysStudied != 4 {
+			t.Errorf("At %v: expected a current streak of %d, longest 3 over 4 days, got %+v", tc.now, tc.current, streak)
+		}
+	}
+}
+
+func TestDueForecastFollowsStudyDays(t *testing.T) {
+	useTestDatabase(t)
+	berlin := useStudyDay(t, "Europe/Berlin", 4)
+	useManualClock(t, time.Date(2024, 5, 10, 12, 0, 0, 0, berlin))
+
+	deck, cards := createTestCards(t, 6)
+	due := []time.Time{
+		// Overdue cards count towards today
+		time.Date(2024, 5, 9, 12, 0, 0, 0, berlin),
+		// So does anything before the next study day starts
+		time.Date(2024, 5, 11, 3, 59, 0, 0, berlin),
+		time.Date(2024, 5, 11, 4, 0, 0, 0, berlin),
+		time.Date(2024, 5, 12, 23, 0, 0, 0, berlin),
+		// Past the forecast
+		time.Date(2024, 5, 13, 4, 0, 0, 0, berlin),
+	}
+	for i, d := range due {
+		if err := database.RescheduleCard(cards[i].ID, algorithms.Reschedule(cards[i], 10), d); err != nil {
+			t.Fatalf("Failed to reschedule card: %v", err)
+		}
+	}
+	// cards[5] is new and isn't forecast
+
+	forecast, err := GetDueForecast(deck.ID, 3)
+	if err != nil {
+		t.Fatalf("Failed to get forecast: %v", err)
+	}
+	want := []models.ForecastDay{
+		{Date: "2024-05-10", Due: 2},
+		{Date: "2024-05-11", Due: 1},
+		{Date: "2024-05-12", Due: 1},
+	}
+	if len(forecast) != len(want) {
+		t.Fatalf("Expected %d days, got %+v", len(want), forecast)
+	}
+	for i := range want {
+		if forecast[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], forecast[i])
+		}
+	}
+}
+
+func TestSlowCards(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, cards := createTestCards(t, 4)
+	// Three passed reviews averaging 10s; the slow Again isn't part of the average but counts against the Good rate
+	logTimedReview(t, cards[0], algorithms.GradeGood, algorithms.StateReview, 8000, 2000)
+	logTimedReview(t, cards[0], algorithms.GradeGood, algorithms.StateReview, 10000, 3000)
+	logTimedReview(t, cards[0], algorithms.GradeHard, algorithms.StateReview, 12000, 4000)
+	logTimedReview(t, cards[0], algorithms.GradeAgain, algorithms.StateReview, 50000, 1000)
+	// Faster
+	for i := 0; i < 3; i++ {
+		logTimedReview(t, cards[1], algorithms.GradeEasy, algorithms.StateReview, 5000, 1000)
+	}
+	// Slowest, but with too few passed reviews to judge
+	logTimedReview(t, cards[2], algorithms.GradeGood, algorithms.StateReview, 30000, 1000)
+	logTimedReview(t, cards[2], algorithms.GradeGood, algorithms.StateReview, 30000, 1000)
+	// Untimed reviews don't count
+	for i := 0; i < 3; i++ {
+		logTestReview(t, cards[3], algorithms.GradeGood, algorithms.StateReview, 5, time.Now())
+	}
+
+	slow, err := GetSlowCards(deck.ID, 10)
+	if err != nil {
+		t.Fatalf("Failed to get slow cards: %v", err)
+	}
+	if len(slow) != 2 || slow[0].Card.ID != cards[0].ID || slow[1].Card.ID != cards[1].ID {
+		t.Fatalf("Expected cards %d and %d, got %+v", cards[0].ID, cards[1].ID, slow)
+	}
+
+	first := slow[0]
+	if first.TimedReviews != 3 || first.AverageAnswerSeconds != 10 || first.AverageAnswerSideSeconds != 3 || first.EasyOrGoodRate != 0.5 {
+		t.Errorf("Expected 3 timed reviews averaging 10s with 3s on the answer and a Good rate of 0.5, got %+v", first)
+	}
+	if first.Card.Front != "Front" || first.Card.DeckId != deck.ID {
+		t.Errorf("Expected the card to be loaded, got %+v", first.Card)
+	}
+	if slow[1].AverageAnswerSeconds != 5 || slow[1].EasyOrGoodRate != 1 {
+		t.Errorf("Expected 5s with a Good rate of 1, got %+v", slow[1])
+	}
+
+	if slow, err := GetSlowCards(deck.ID, 1); err != nil || len(slow) != 1 || slow[0].Card.ID != cards[0].ID {
+		t.Errorf("Expected only the slowest card, got %+v (%v)", slow, err)
+	}
+	if _, err := GetSlowCards(deck.ID, 0); err == nil {
+		t.Errorf("Expected a limit of 0 to be rejected")
+	}
+}
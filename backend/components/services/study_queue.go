@@ -0,0 +1,222 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/clock"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+const (
+	studyTimezoneSetting     = "study_timezone"
+	studyDayStartHourSetting = "study_day_start_hour"
+
+	// Like Anki, the study day rolls over in the early morning so a late session still counts as the same day
+	defaultStudyDayStartHour = 4
+
+	// When nothing else is left, learning cards due within this window are shown early instead of making the user wait
+	learnAheadLimit = 20 * time.Minute
+)
+
+// StudyDaySettings controls when the daily new card and review limits reset
+type StudyDaySettings struct {
+	Timezone  string `json:"timezone"`  // IANA name such as "Europe/Berlin"; empty means the system timezone
+	StartHour int    `json:"startHour"` // hour of the day, 0-23, at which a new study day begins
+}
+
+// GetStudyDaySettings returns the saved study day settings
+func GetStudyDaySettings() (StudyDaySettings, error) {
+	settings := StudyDaySettings{StartHour: defaultStudyDayStartHour}
+
+	timezone, err := database.GetSetting(studyTimezoneSetting)
+	if err != nil {
+		return StudyDaySettings{}, fmt.Errorf("failed to get study timezone: %v", err)
+	}
+	settings.Timezone = timezone
+
+	value, err := database.GetSetting(studyDayStartHourSetting)
+	if err != nil {
+		return StudyDaySettings{}, fmt.Errorf("failed to get study day start: %v", err)
+	}
+	if value != "" {
+		hour, err := strconv.Atoi(value)
+		if err != nil {
+			return StudyDaySettings{}, fmt.Errorf("invalid study day start %q: %v", value, err)
+		}
+		settings.StartHour = hour
+	}
+
+	return settings, nil
+}
+
+// SaveStudyDaySettings validates and saves the study day settings
+func SaveStudyDaySettings(settings StudyDaySettings) error {
+	if _, err := time.LoadLocation(settings.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q: %v", settings.Timezone, err)
+	}
+	if settings.StartHour < 0 || settings.StartHour > 23 {
+		return fmt.Errorf("study day start hour must be between 0 and 23")
+	}
+
+	if err := database.SaveSetting(studyTimezoneSetting, settings.Timezone); err != nil {
+		return fmt.Errorf("failed to save study timezone: %v", err)
+	}
+	if err := database.SaveSetting(studyDayStartHourSetting, strconv.Itoa(settings.StartHour)); err != nil {
+		return fmt.Errorf("failed to save study day start: %v", err)
+	}
+	return nil
+}
+
+// StudyDayStart returns the moment the study day containing now began
+func StudyDayStart(now time.Time) (time.Time, error) {
+	settings, err := GetStudyDaySettings()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	location, err := studyLocation(settings)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := now.In(location)
+	start := time.Date(local.Year(), local.Month(), local.Day(), settings.StartHour, 0, 0, 0, location)
+	if local.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start, nil
+}
+
+// studyLocation returns the timezone study days are counted in
+func studyLocation(settings StudyDaySettings) (*time.Location, error) {
+	if settings.Timezone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q: %v", settings.Timezone, err)
+	}
+	return location, nil
+}
+
+// remainingToday returns how many new cards and reviews a deck may still show today
+func remainingToday(deck database.DeckModel, now time.Time) (int, int, models.StudyQueueCounts, error) {
+	dayStart, err := StudyDayStart(now)
+	if err != nil {
+		return 0, 0, models.StudyQueueCounts{}, err
+	}
+
+	newDone, reviewsDone, err := database.CountReviewsSince(deck.ID, dayStart)
+	if err != nil {
+		return 0, 0, models.StudyQueueCounts{}, fmt.Errorf("failed to count today's reviews: %v", err)
+	}
+
+	counts := models.StudyQueueCounts{
+		NewStudiedToday:  newDone,
+		ReviewsDoneToday: reviewsDone,
+	}
+	return max(deck.NewCardsPerDay-newDone, 0), max(deck.MaxReviewsPerDay-reviewsDone, 0), counts, nil
+}
+
+// BuildStudyQueue returns the cards to study now: cards in a learning step that are due, then due reviews,
+// most overdue first, then new cards, with reviews and new cards capped by what is left of the deck's daily limits
+func BuildStudyQueue(deckId int) ([]models.FlashcardModel, error) {
+	return BuildStudyQueueAt(deckId, studyClock.Now())
+}
+
+// BuildStudyQueueAt returns the study queue as it would be at the given time
+func BuildStudyQueueAt(deckId int, now time.Time) ([]models.FlashcardModel, error) {
+	deck, err := database.Deck(deckId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deck: %v", err)
+	}
+
+	newLeft, reviewsLeft, _, err := remainingToday(deck, now)
+	if err != nil {
+		return nil, err
+	}
+
+	queue, err := database.DueLearningCards(deckId, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get learning cards: %v", err)
+	}
+
+	reviews, err := database.DueReviewCards(deckId, now, reviewsLeft)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due cards: %v", err)
+	}
+	queue = append(queue, reviews...)
+
+	newCards, err := database.NewCards(deckId, now, newLeft)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get new cards: %v", err)
+	}
+	queue = append(queue, newCards...)
+
+	if len(queue) == 0 {
+		queue, err = database.DueLearningCards(deckId, now.Add(learnAheadLimit))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get learning cards: %v", err)
+		}
+	}
+	return rotatePhrasings(deck, queue)
+}
+
+// PreviewStudyQueue returns the study queue as it will be the given number of days from now,
+// assuming nothing is studied in between, with the memory state the cards will have by then
+func PreviewStudyQueue(deckId int, daysAhead int) ([]models.FlashcardModel, error) {
+	if daysAhead < 0 {
+		return nil, fmt.Errorf("days ahead can't be negative")
+	}
+	preview := clock.Offset(studyClock, time.Duration(daysAhead)*24*time.Hour).Now()
+	cards, err := BuildStudyQueueAt(deckId, preview)
+	if err != nil {
+		return nil, err
+	}
+	return WithMemoryStateAt(deckId, cards, preview)
+}
+
+// GetStudyQueueCounts returns how many new cards and reviews are left in a deck today
+func GetStudyQueueCounts(deckId int) (models.StudyQueueCounts, error) {
+	return GetStudyQueueCountsAt(deckId, studyClock.Now())
+}
+
+// GetStudyQueueCountsAt returns how many new cards and reviews are left in a deck on the study day containing now
+func GetStudyQueueCountsAt(deckId int, now time.Time) (models.StudyQueueCounts, error) {
+	deck, err := database.Deck(deckId)
+	if err != nil {
+		return models.StudyQueueCounts{}, fmt.Errorf("failed to get deck: %v", err)
+	}
+
+	newLeft, reviewsLeft, counts, err := remainingToday(deck, now)
+	if err != nil {
+		return models.StudyQueueCounts{}, err
+	}
+
+	newAvailable, dueAvailable, err := database.CountAvailableCards(deckId, now)
+	if err != nil {
+		return models.StudyQueueCounts{}, fmt.Errorf("failed to count due cards: %v", err)
+	}
+
+	learning, err := database.DueLearningCards(deckId, now)
+	if err != nil {
+		return models.StudyQueueCounts{}, fmt.Errorf("failed to count learning cards: %v", err)
+	}
+
+	counts.Learning = len(learning)
+	counts.NewCards = min(newAvailable, newLeft)
+	counts.Reviews = min(dueAvailable, reviewsLeft)
+	return counts, nil
+}
+
+// UpdateDeckLimits validates and saves the daily limits of a deck
+func UpdateDeckLimits(deckId int, newCardsPerDay int, maxReviewsPerDay int) (database.DeckModel, error) {
+	if newCardsPerDay < 0 || maxReviewsPerDay < 0 {
+		return database.DeckModel{}, fmt.Errorf("daily limits can't be negative")
+	}
+
+	return database.UpdateDeckLimits(deckId, newCardsPerDay, maxReviewsPerDay)
+}
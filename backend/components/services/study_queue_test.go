@@ -0,0 +1,196 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+func TestStudyDayStart(t *testing.T) {
+	useTestDatabase(t)
+
+	cases := []struct {
+		timezone  string
+		startHour int
+		now       string
+		want      string
+	}{
+		{"UTC", 4, "2024-05-10T12:00:00Z", "2024-05-10T04:00:00Z"},
+		{"UTC", 4, "2024-05-10T04:00:00Z", "2024-05-10T04:00:00Z"},
+		// Before the start hour still belongs to the previous study day, across midnight and month ends
+		{"UTC", 4, "2024-05-10T03:59:59Z", "2024-05-09T04:00:00Z"},
+		{"UTC", 4, "2024-06-01T00:30:00Z", "2024-05-31T04:00:00Z"},
+		{"UTC", 0, "2024-05-10T00:00:00Z", "2024-05-10T00:00:00Z"},
+		{"UTC", 23, "2024-05-10T22:00:00Z", "2024-05-09T23:00:00Z"},
+		// The hour is local to the study timezone
+		{"Asia/Tokyo", 4, "2024-05-10T18:00:00Z", "2024-05-09T19:00:00Z"},
+		{"Asia/Tokyo", 4, "2024-05-10T20:00:00Z", "2024-05-10T19:00:00Z"},
+		{"America/New_York", 4, "2024-05-10T07:59:00Z", "2024-05-09T08:00:00Z"},
+		// Daylight saving time changes the UTC offset between days
+		{"America/New_York", 4, "2024-03-10T12:00:00Z", "2024-03-10T08:00:00Z"},
+		{"America/New_York", 4, "2024-03-11T07:30:00Z", "2024-03-10T08:00:00Z"},
+		{"America/New_York", 4, "2024-11-03T12:00:00Z", "2024-11-03T09:00:00Z"},
+	}
+
+	for _, tc := range cases {
+		useStudyDay(t, tc.timezone, tc.startHour)
+		now, _ := time.Parse(time.RFC3339, tc.now)
+		want, _ := time.Parse(time.RFC3339, tc.want)
+
+		got, err := StudyDayStart(now)
+		if err != nil {
+			t.Fatalf("Failed to get study day start: %v", err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s at %d:00, now %s: expected the day to start at %s, got %s",
+				tc.timezone, tc.startHour, tc.now, want.Format(time.RFC3339), got.UTC().Format(time.RFC3339))
+		}
+	}
+}
+
+func TestStudyDaySettingsValidation(t *testing.T) {
+	useTestDatabase(t)
+
+	settings, err := GetStudyDaySettings()
+	if err != nil {
+		t.Fatalf("Failed to get study day settings: %v", err)
+	}
+	if settings.StartHour != defaultStudyDayStartHour || settings.Timezone != "" {
+		t.Errorf("Expected the default study day to start at %d:00 in the system timezone, got %+v", defaultStudyDayStartHour, settings)
+	}
+
+	for _, invalid := range []StudyDaySettings{
+		{Timezone: "Nowhere/Special", StartHour: 4},
+		{Timezone: "UTC", StartHour: -1},
+		{Timezone: "UTC", StartHour: 24},
+	} {
+		if err := SaveStudyDaySettings(invalid); err == nil {
+			t.Errorf("Expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+func TestNewCardLimitResetsAtStudyDayStart(t *testing.T) {
+	useTestDatabase(t)
+	location := useStudyDay(t, "Europe/Berlin", 4)
+
+	// Late in the evening, so the session runs past midnight
+	now := useManualClock(t, time.Date(2024, 5, 10, 23, 30, 0, 0, location))
+	deck, _ := createTestCards(t, 5)
+	if _, err := UpdateDeckLimits(deck.ID, 2, 100); err != nil {
+		t.Fatalf("Failed to update limits: %v", err)
+	}
+
+	queue, err := BuildStudyQueue(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to build study queue: %v", err)
+	}
+	if len(queue) != 2 {
+		t.Fatalf("Expected 2 new cards, got %d", len(queue))
+	}
+	for _, card := range queue {
+		if err := ReviewFlashcard(deck.ID, card.ID, algorithms.GradeEasy, models.ReviewTiming{}); err != nil {
+			t.Fatalf("Failed to review card: %v", err)
+		}
+	}
+
+	// After midnight but before the study day starts, the limit is still used up
+	now.Set(time.Date(2024, 5, 11, 3, 59, 0, 0, location))
+	counts, err := GetStudyQueueCounts(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get counts: %v", err)
+	}
+	if counts.NewCards != 0 || counts.NewStudiedToday != 2 {
+		t.Errorf("Expected no new cards left with 2 studied at 03:59, got %+v", counts)
+	}
+	queue, err = BuildStudyQueue(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to build study queue: %v", err)
+	}
+	if len(queue) != 0 {
+		t.Errorf("Expected an empty queue at 03:59, got cards %v", queueIds(queue))
+	}
+
+	// At the start of the new study day the limit resets
+	now.Set(time.Date(2024, 5, 11, 4, 0, 0, 0, location))
+	counts, err = GetStudyQueueCounts(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get counts: %v", err)
+	}
+	if counts.NewCards != 2 || counts.NewStudiedToday != 0 {
+		t.Errorf("Expected 2 new cards with none studied at 04:00, got %+v", counts)
+	}
+}
+
+func TestReviewLimit(t *testing.T) {
+	useTestDatabase(t)
+	location := useStudyDay(t, "UTC", 4)
+	now := useManualClock(t, time.Date(2024, 5, 10, 12, 0, 0, 0, location))
+
+	deck, cards := createTestCards(t, 4)
+	if _, err := UpdateDeckLimits(deck.ID, 0, 2); err != nil {
+		t.Fatalf("Failed to update limits: %v", err)
+	}
+
+	// Three review cards overdue by different amounts, and one new card the limit of 0 keeps out
+	for i, card := range cards[:3] {
+		schedule := algorithms.Reschedule(card, 10)
+		due := now.Now().AddDate(0, 0, -(i + 1))
+		if err := database.RescheduleCard(card.ID, schedule, due); err != nil {
+			t.Fatalf("Failed to reschedule card: %v", err)
+		}
+	}
+
+	queue, err := BuildStudyQueue(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to build study queue: %v", err)
+	}
+	// Most overdue first
+	if ids := queueIds(queue); len(ids) != 2 || ids[0] != cards[2].ID || ids[1] != cards[1].ID {
+		t.Fatalf("Expected the two most overdue cards %v, got %v", []int{cards[2].ID, cards[1].ID}, ids)
+	}
+
+	if err := ReviewFlashcard(deck.ID, cards[2].ID, algorithms.GradeGood, models.ReviewTiming{}); err != nil {
+		t.Fatalf("Failed to review card: %v", err)
+	}
+	counts, err := GetStudyQueueCounts(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get counts: %v", err)
+	}
+	if counts.Reviews != 1 || counts.ReviewsDoneToday != 1 || counts.NewCards != 0 {
+		t.Errorf("Expected 1 review left with 1 done and no new cards, got %+v", counts)
+	}
+
+	// The next study day brings back the full limit
+	now.Set(time.Date(2024, 5, 11, 4, 0, 0, 0, location))
+	counts, err = GetStudyQueueCounts(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get counts: %v", err)
+	}
+	if counts.Reviews != 2 || counts.ReviewsDoneToday != 0 {
+		t.Errorf("Expected 2 reviews with none done on the next day, got %+v", counts)
+	}
+}
+
+func TestUpdateDeckLimitsRejectsNegative(t *testing.T) {
+	useTestDatabase(t)
+	deck, _ := createTestCards(t, 0)
+
+	if _, err := UpdateDeckLimits(deck.ID, -1, 10); err == nil {
+		t.Errorf("Expected a negative new card limit to be rejected")
+	}
+	if _, err := UpdateDeckLimits(deck.ID, 10, -1); err == nil {
+		t.Errorf("Expected a negative review limit to be rejected")
+	}
+
+	updated, err := database.Deck(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get deck: %v", err)
+	}
+	if updated.NewCardsPerDay != database.DefaultNewCardsPerDay || updated.MaxReviewsPerDay != database.DefaultMaxReviewsPerDay {
+		t.Errorf("Expected the default limits to be kept, got %d and %d", updated.NewCardsPerDay, updated.MaxReviewsPerDay)
+	}
+}
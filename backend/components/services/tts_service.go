@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/render"
+	"github.com/jorkle/brightcards/backend/components/tts"
+)
+
+const (
+	TTSProviderSettingKey = "tts_provider"
+	TTSVoiceSettingKey    = "tts_voice"
+	TTSModelSettingKey    = "tts_model"
+)
+
+// GetTTSConfig returns the saved text-to-speech configuration
+func GetTTSConfig() (tts.Config, error) {
+	config := tts.Config{}
+	var err error
+
+	if config.Provider, err = database.GetSetting(TTSProviderSettingKey); err != nil {
+		return tts.Config{}, err
+	}
+	if config.Voice, err = database.GetSetting(TTSVoiceSettingKey); err != nil {
+		return tts.Config{}, err
+	}
+	if config.Model, err = database.GetSetting(TTSModelSettingKey); err != nil {
+		return tts.Config{}, err
+	}
+
+	if config.Provider == "" {
+		config.Provider = tts.ProviderEspeak
+	}
+	return config, nil
+}
+
+// SaveTTSConfig validates and saves the text-to-speech configuration
+func SaveTTSConfig(config tts.Config) error {
+	if _, err := tts.NewProvider(config); err != nil {
+		return err
+	}
+
+	if err := database.SaveSetting(TTSProviderSettingKey, config.Provider); err != nil {
+		return err
+	}
+	if err := database.SaveSetting(TTSVoiceSettingKey, config.Voice); err != nil {
+		return err
+	}
+	return database.SaveSetting(TTSModelSettingKey, config.Model)
+}
+
+// Speak reads text aloud with the configured provider, giving up on synthesizing it after the AI request timeout
+func Speak(ctx context.Context, text string) error {
+	config, err := GetTTSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load text-to-speech settings: %v", err)
+	}
+
+	provider, err := tts.NewProvider(config)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, err := withAITimeout(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	return tts.Speak(ctx, provider, text)
+}
+
+// SpeakCard reads the front or back of a flashcard aloud as it is shown
+func SpeakCard(ctx context.Context, deckId int, cardId int, side string) error {
+	text, err := cardSpeech(deckId, cardId, side)
+	if err != nil {
+		return err
+	}
+	return Speak(ctx, text)
+}
+
+// cardSpeech returns the text to read aloud for one side of a card: the phrasing the study queue shows,
+// without the Markdown, math and media that only make sense on screen
+func cardSpeech(deckId int, cardId int, side string) (string, error) {
+	card, err := displayedCard(deckId, cardId)
+	if err != nil {
+		return "", err
+	}
+
+	front, back := displayText(card)
+	switch side {
+	case "front":
+		return render.PlainText(front)
+	case "back":
+		return render.PlainText(back)
+	default:
+		return "", fmt.Errorf("invalid card side: %s", side)
+	}
+}
+
+// StopSpeaking stops any speech that is playing
+func StopSpeaking() error {
+	return tts.StopSpeaking()
+}
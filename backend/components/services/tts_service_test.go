@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+)
+
+func TestCardSpeech(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, original, _ := createRotatingCard(t, "What is **$x$** in the *variant*?")
+	original.Front = "What is `x` in the **original**? ![diagram](/media/abc.png)"
+	original.Back = "$$x = 1$$\nIt is one."
+	if _, err := database.UpdateCard(original); err != nil {
+		t.Fatalf("Failed to update card: %v", err)
+	}
+
+	if text, err := cardSpeech(deck.ID, original.ID, "front"); err != nil || text != "What is x in the original?" {
+		t.Errorf("Expected the original's front as plain text, got %q (%v)", text, err)
+	}
+	if text, err := cardSpeech(deck.ID, original.ID, "back"); err != nil || text != "It is one." {
+		t.Errorf("Expected the original's back as plain text, got %q (%v)", text, err)
+	}
+
+	// Once the variant's turn comes, its wording is read
+	logTestReview(t, original, algorithms.GradeGood, algorithms.StateNew, 0, time.Now())
+	if text, err := cardSpeech(deck.ID, original.ID, "front"); err != nil || text != "What is in the variant?" {
+		t.Errorf("Expected the variant's front as plain text, got %q (%v)", text, err)
+	}
+
+	if _, err := cardSpeech(deck.ID, original.ID, "side"); err == nil {
+		t.Errorf("Expected an invalid side to be rejected")
+	}
+}
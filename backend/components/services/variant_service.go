@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jorkle/brightcards/backend/components/ai/chat"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+	"github.com/jorkle/brightcards/backend/components/occlusion"
+)
+
+// originalCard returns the card a variant rephrases, or the card itself when it isn't a variant
+func originalCard(ctx context.Context, deckId int, cardId int) (models.FlashcardModel, error) {
+	card, err := database.CardContext(ctx, deckId, cardId)
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to get flashcard: %v", err)
+	}
+	if card.ParentCardId == nil {
+		return card, nil
+	}
+
+	parent, err := database.CardContext(ctx, deckId, *card.ParentCardId)
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to get original flashcard: %v", err)
+	}
+	return parent, nil
+}
+
+// phrasingKey normalizes the wording of a card, so variants differing only in case or spacing count as the same
+func phrasingKey(front string, back string) string {
+	return strings.ToLower(strings.Join(strings.Fields(front), " ")) + "\x00" + strings.ToLower(strings.Join(strings.Fields(back), " "))
+}
+
+// RephraseFlashcardContext asks the AI for new wordings of a card and stores them as variants of the original card.
+// Rephrasing a variant adds to the variants of its original. Wordings the card already has are skipped.
+// It gives up when ctx is done, and the AI request also after the AI request timeout.
+func RephraseFlashcardContext(ctx context.Context, deckId int, cardId int, maxVariations int) ([]models.FlashcardModel, error) {
+	original, err := originalCard(ctx, deckId, cardId)
+	if err != nil {
+		return nil, err
+	}
+	if original.CardType == occlusion.CardType {
+		return nil, fmt.Errorf("image occlusion cards can't be rephrased")
+	}
+
+	deck, err := database.DeckContext(ctx, deckId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deck: %v", err)
+	}
+
+	requestCtx, cancel, err := withAITimeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	rephrasedCards, err := chat.RephraseFlashcardContext(requestCtx, &original, deck.EnableInitialismSwap, maxVariations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rephrase flashcard: %w", err)
+	}
+
+	variants, err := database.CardVariantsContext(ctx, original.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variants: %v", err)
+	}
+	seen := map[string]bool{phrasingKey(original.Front, original.Back): true}
+	for _, variant := range variants {
+		seen[phrasingKey(variant.Front, variant.Back)] = true
+	}
+
+	created := []models.FlashcardModel{}
+	for _, rephrased := range rephrasedCards {
+		key := phrasingKey(rephrased.Front, rephrased.Back)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		card, err := database.CreateCardContext(ctx, models.FlashcardModel{
+			Front:        rephrased.Front,
+			Back:         rephrased.Back,
+			DeckId:       deckId,
+			CardType:     original.CardType,
+			Source:       "rephrased",
+			ParentCardId: &original.ID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rephrased flashcard: %v", err)
+		}
+		created = append(created, card)
+	}
+
+	if len(created) == 0 {
+		return nil, fmt.Errorf("no new rephrased flashcards were generated")
+	}
+	return created, nil
+}
+
+// GetCardVariants returns the rephrasings of a card, or of the card a variant rephrases, oldest first
+func GetCardVariants(deckId int, cardId int) ([]models.FlashcardModel, error) {
+	original, err := originalCard(context.Background(), deckId, cardId)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := database.CardVariants(original.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variants: %v", err)
+	}
+	return variants, nil
+}
+
+// PruneCardVariants deletes all but the newest keep rephrasings of a card and returns the ones left
+func PruneCardVariants(deckId int, cardId int, keep int) ([]models.FlashcardModel, error) {
+	if keep < 0 {
+		return nil, fmt.Errorf("number of variants to keep can't be negative")
+	}
+
+	variants, err := GetCardVariants(deckId, cardId)
+	if err != nil {
+		return nil, err
+	}
+	if len(variants) <= keep {
+		return variants, nil
+	}
+
+	pruned := len(variants) - keep
+	for _, variant := range variants[:pruned] {
+		if err := database.DeleteCard(variant.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete variant %d: %v", variant.ID, err)
+		}
+	}
+	return variants[pruned:], nil
+}
+
+// SetDeckVariantMode sets whether a deck schedules the rephrasings of a card on their own ("separate"),
+// or reviews the original through a different phrasing each time, sharing its schedule ("rotate")
+func SetDeckVariantMode(deckId int, mode string) (database.DeckModel, error) {
+	if mode != database.VariantModeSeparate && mode != database.VariantModeRotate {
+		return database.DeckModel{}, fmt.Errorf("unknown variant mode: %s", mode)
+	}
+	return database.UpdateDeckVariantMode(deckId, mode)
+}
+
+// rotatePhrasings shows each card of a rotating deck through the next of its phrasings, the original first.
+// The phrasing moves on with every review of the original, which holds the shared schedule.
+func rotatePhrasings(deck database.DeckModel, cards []models.FlashcardModel) ([]models.FlashcardModel, error) {
+	if deck.VariantMode != database.VariantModeRotate {
+		return cards, nil
+	}
+
+	for i, card := range cards {
+		shown, err := rotatePhrasing(card)
+		if err != nil {
+			return nil, err
+		}
+		cards[i] = shown
+	}
+	return cards, nil
+}
+
+// rotatePhrasing sets the display wording of a card to the phrasing whose turn it is. The card keeps its own ID,
+// Front and Back, so saving it doesn't write the variant's wording over the original.
+func rotatePhrasing(card models.FlashcardModel) (models.FlashcardModel, error) {
+	variants, err := database.CardVariants(card.ID)
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to get variants: %v", err)
+	}
+	if len(variants) == 0 {
+		return card, nil
+	}
+
+	reviews, err := database.CountCardReviews(card.ID)
+	if err != nil {
+		return models.FlashcardModel{}, fmt.Errorf("failed to count reviews: %v", err)
+	}
+	turn := reviews % (len(variants) + 1)
+	if turn == 0 {
+		return card, nil
+	}
+
+	variant := variants[turn-1]
+	card.VariantId = variant.ID
+	card.DisplayFront = variant.Front
+	card.DisplayBack = variant.Back
+	return card, nil
+}
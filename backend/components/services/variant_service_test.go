@@ -0,0 +1,127 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/models"
+)
+
+// createRotatingCard creates a deck that rotates phrasings, with a card rephrased as each of variants
+func createRotatingCard(t *testing.T, variants ...string) (database.DeckModel, models.FlashcardModel, []models.FlashcardModel) {
+	t.Helper()
+
+	deck, cards := createTestCards(t, 1)
+	deck, err := SetDeckVariantMode(deck.ID, database.VariantModeRotate)
+	if err != nil {
+		t.Fatalf("Failed to set variant mode: %v", err)
+	}
+
+	created := make([]models.FlashcardModel, len(variants))
+	for i, front := range variants {
+		created[i], err = database.CreateCard(models.FlashcardModel{DeckId: deck.ID, Front: front, Back: front + " back", Source: "rephrased", ParentCardId: &cards[0].ID})
+		if err != nil {
+			t.Fatalf("Failed to create variant: %v", err)
+		}
+	}
+	return deck, cards[0], created
+}
+
+// shownCard returns the only card in a deck's study queue
+func shownCard(t *testing.T, deckId int) models.FlashcardModel {
+	t.Helper()
+
+	queue, err := BuildStudyQueue(deckId)
+	if err != nil {
+		t.Fatalf("Failed to build study queue: %v", err)
+	}
+	if len(queue) != 1 {
+		t.Fatalf("Expected one card in the queue, got %v", queueIds(queue))
+	}
+	return queue[0]
+}
+
+func TestRotatePhrasingsTakesTurns(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, original, variants := createRotatingCard(t, "First", "Second")
+
+	// The original, then each variant in the order they were made, and round again
+	want := []models.FlashcardModel{{}, variants[0], variants[1], {}, variants[0]}
+	for reviews, variant := range want {
+		shown := shownCard(t, deck.ID)
+		if shown.ID != original.ID || shown.Front != original.Front || shown.Back != original.Back {
+			t.Fatalf("After %d reviews: expected the original card with its own wording, got %+v", reviews, shown)
+		}
+		if shown.VariantId != variant.ID || shown.DisplayFront != variant.Front || shown.DisplayBack != variant.Back {
+			t.Errorf("After %d reviews: expected variant %d, %q and %q, to be shown, got %d, %q and %q",
+				reviews, variant.ID, variant.Front, variant.Back, shown.VariantId, shown.DisplayFront, shown.DisplayBack)
+		}
+
+		wantFront := original.Front
+		if variant.ID != 0 {
+			wantFront = variant.Front
+		}
+
+		// Rendering the card for review shows the same phrasing
+		rendered, err := RenderFlashcard(deck.ID, shown.ID)
+		if err != nil {
+			t.Fatalf("Failed to render card: %v", err)
+		}
+		if !strings.Contains(rendered.FrontHTML, wantFront) || rendered.ID != original.ID {
+			t.Errorf("After %d reviews: expected %q to be rendered, got %q", reviews, wantFront, rendered.FrontHTML)
+		}
+
+		logTestReview(t, original, algorithms.GradeGood, algorithms.StateNew, 0, time.Now())
+	}
+
+	// Separate decks show every phrasing as it is
+	if _, err := SetDeckVariantMode(deck.ID, database.VariantModeSeparate); err != nil {
+		t.Fatalf("Failed to set variant mode: %v", err)
+	}
+	queue, err := BuildStudyQueue(deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to build study queue: %v", err)
+	}
+	for _, card := range queue {
+		if card.VariantId != 0 || card.DisplayFront != "" {
+			t.Errorf("Expected no display wording in a separate deck, got %+v", card)
+		}
+	}
+}
+
+func TestSavingRotatedCardKeepsOriginalWording(t *testing.T) {
+	useTestDatabase(t)
+
+	deck, original, variants := createRotatingCard(t, "First")
+	logTestReview(t, original, algorithms.GradeGood, algorithms.StateNew, 0, time.Now())
+
+	shown := shownCard(t, deck.ID)
+	if shown.VariantId != variants[0].ID {
+		t.Fatalf("Expected the variant's turn, got %+v", shown)
+	}
+
+	// Editing the back of the card shown saves it on the original, leaving its front and the variant alone
+	shown.Back = "Edited back"
+	if _, err := database.UpdateCard(shown); err != nil {
+		t.Fatalf("Failed to update card: %v", err)
+	}
+
+	saved, err := database.Card(deck.ID, original.ID)
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+	if saved.Front != original.Front || saved.Back != "Edited back" {
+		t.Errorf("Expected the original to be %q and %q, got %q and %q", original.Front, "Edited back", saved.Front, saved.Back)
+	}
+	variant, err := database.Card(deck.ID, variants[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get variant: %v", err)
+	}
+	if variant.Front != variants[0].Front || variant.Back != variants[0].Back {
+		t.Errorf("Expected the variant to be unchanged, got %q and %q", variant.Front, variant.Back)
+	}
+}
@@ -0,0 +1,70 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/jorkle/brightcards/backend/components/audio"
+)
+
+// EspeakProvider synthesizes speech with the espeak-ng command line tool
+type EspeakProvider struct {
+	Voice string
+}
+
+func (e *EspeakProvider) Name() string {
+	return "espeak-" + e.Voice
+}
+
+func (e *EspeakProvider) Synthesize(ctx context.Context, text string) ([]int16, int, error) {
+	args := []string{"--stdout"}
+	if e.Voice != "" {
+		args = append(args, "-v", e.Voice)
+	}
+
+	cmd := exec.CommandContext(ctx, "espeak-ng", args...)
+	cmd.Stdin = bytes.NewBufferString(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("espeak-ng failed: %v: %s", err, stderr.String())
+	}
+
+	return audio.DecodeWAV(output)
+}
+
+// PiperProvider synthesizes speech with the piper command line tool and a local voice model
+type PiperProvider struct {
+	ModelPath string
+}
+
+func (p *PiperProvider) Name() string {
+	return "piper-" + path.Base(p.ModelPath)
+}
+
+func (p *PiperProvider) Synthesize(ctx context.Context, text string) ([]int16, int, error) {
+	outFile, err := os.CreateTemp("", "bcards_tts_*.wav")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	outPath := outFile.Name()
+	outFile.Close()
+	defer os.Remove(outPath)
+
+	cmd := exec.CommandContext(ctx, "piper", "--model", p.ModelPath, "--output_file", outPath)
+	cmd.Stdin = bytes.NewBufferString(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, 0, fmt.Errorf("piper failed: %v: %s", err, stderr.String())
+	}
+
+	return audio.ReadWAV(outPath)
+}
@@ -0,0 +1,93 @@
+package tts
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/jorkle/brightcards/backend/components/ai/usage"
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAI returns raw PCM speech as 24kHz signed 16-bit little-endian mono
+const openAIPCMSampleRate = 24000
+
+var (
+	openaiClient *openai.Client
+	initOnce     sync.Once
+	initialized  bool
+)
+
+// InitTTS initializes OpenAI speech synthesis with the OpenAI API key
+func InitTTS(apiKey string) error {
+	if apiKey == "" {
+		return fmt.Errorf("OpenAI API key cannot be empty")
+	}
+
+	initOnce.Do(func() {
+		openaiClient = openai.NewClient(apiKey)
+		initialized = true
+	})
+	return nil
+}
+
+// OpenAIProvider synthesizes speech with the OpenAI speech API
+type OpenAIProvider struct {
+	Voice string
+	Model string
+}
+
+func (o *OpenAIProvider) voice() openai.SpeechVoice {
+	if o.Voice == "" {
+		return openai.VoiceAlloy
+	}
+	return openai.SpeechVoice(o.Voice)
+}
+
+func (o *OpenAIProvider) model() openai.SpeechModel {
+	if o.Model == "" {
+		return openai.TTSModel1
+	}
+	return openai.SpeechModel(o.Model)
+}
+
+func (o *OpenAIProvider) Name() string {
+	return fmt.Sprintf("openai-%s-%s", o.model(), o.voice())
+}
+
+func (o *OpenAIProvider) Synthesize(ctx context.Context, text string) ([]int16, int, error) {
+	if !initialized {
+		return nil, 0, fmt.Errorf("text-to-speech not initialized, call InitTTS first")
+	}
+
+	if err := usage.Allow(); err != nil {
+		return nil, 0, err
+	}
+
+	req := openai.CreateSpeechRequest{
+		Model:          o.model(),
+		Input:          text,
+		Voice:          o.voice(),
+		ResponseFormat: openai.SpeechResponseFormatPcm,
+	}
+
+	resp, err := openaiClient.CreateSpeech(ctx, req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to synthesize speech: %w", err)
+	}
+	defer resp.Close()
+	usage.Add(usage.Record{Operation: usage.OperationSpeech, Model: string(req.Model), Characters: len([]rune(text))})
+
+	data, err := io.ReadAll(resp)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read synthesized speech: %v", err)
+	}
+
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return samples, openAIPCMSampleRate, nil
+}
@@ -0,0 +1,21 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSynthesizeCancelled(t *testing.T) {
+	if err := InitTTS("test-key"); err != nil {
+		t.Fatalf("Failed to initialize text-to-speech: %v", err)
+	}
+
+	// A cancelled request is reported as cancelled, so it isn't shown as an API failure
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	provider := &OpenAIProvider{}
+	if _, _, err := provider.Synthesize(ctx, "Hello"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the synthesis to be cancelled, got %v", err)
+	}
+}
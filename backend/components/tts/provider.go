@@ -0,0 +1,45 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	ProviderEspeak = "espeak"
+	ProviderPiper  = "piper"
+	ProviderOpenAI = "openai"
+)
+
+// Provider synthesizes speech from text
+type Provider interface {
+	// Name identifies the provider and voice, and is part of the cache key
+	Name() string
+
+	// Synthesize returns mono 16-bit samples and their sample rate, giving up when ctx is done
+	Synthesize(ctx context.Context, text string) ([]int16, int, error)
+}
+
+// Config selects and configures a speech provider
+type Config struct {
+	Provider string `json:"provider"` // ProviderEspeak, ProviderPiper or ProviderOpenAI
+	Voice    string `json:"voice"`    // espeak-ng voice or OpenAI voice name
+	Model    string `json:"model"`    // Piper model path or OpenAI speech model
+}
+
+// NewProvider creates the provider described by the config
+func NewProvider(config Config) (Provider, error) {
+	switch config.Provider {
+	case ProviderEspeak, "":
+		return &EspeakProvider{Voice: config.Voice}, nil
+	case ProviderPiper:
+		if config.Model == "" {
+			return nil, fmt.Errorf("piper requires a voice model path")
+		}
+		return &PiperProvider{ModelPath: config.Model}, nil
+	case ProviderOpenAI:
+		return &OpenAIProvider{Voice: config.Voice, Model: config.Model}, nil
+	default:
+		return nil, fmt.Errorf("unknown text-to-speech provider: %s", config.Provider)
+	}
+}
@@ -0,0 +1,105 @@
+package tts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jorkle/brightcards/backend/components/audio"
+)
+
+// cacheDir returns the directory synthesized speech is cached in
+func cacheDir() (string, error) {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory: %v", err)
+	}
+	dir := path.Join(userCacheDir, "brightcards", "tts")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return dir, nil
+}
+
+// cachePath returns the cache file for the text spoken by the provider
+func cachePath(provider Provider, text string) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(provider.Name() + "\x00" + text))
+	return path.Join(dir, hex.EncodeToString(hash[:])+".wav"), nil
+}
+
+// Synthesize returns speech for the text, using the cache when the same text was spoken before
+func Synthesize(ctx context.Context, provider Provider, text string) ([]int16, int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, 0, fmt.Errorf("nothing to speak")
+	}
+
+	cacheFile, err := cachePath(provider, text)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if _, err := os.Stat(cacheFile); err == nil {
+		samples, sampleRate, err := audio.ReadWAV(cacheFile)
+		if err == nil {
+			return samples, sampleRate, nil
+		}
+		// Fall through and regenerate a damaged cache entry
+	}
+
+	samples, sampleRate, err := provider.Synthesize(ctx, text)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := audio.WriteWAV(cacheFile, samples, sampleRate); err != nil {
+		// Caching is an optimization, so still return the audio
+		os.Remove(cacheFile)
+		println("Warning: failed to cache synthesized speech:", err.Error())
+	}
+
+	return samples, sampleRate, nil
+}
+
+// Speak synthesizes the text and plays it, returning once playback has started. ctx only limits the synthesis.
+func Speak(ctx context.Context, provider Provider, text string) error {
+	samples, sampleRate, err := Synthesize(ctx, provider, text)
+	if err != nil {
+		return err
+	}
+
+	player, err := audio.GetPlayer()
+	if err != nil {
+		return fmt.Errorf("failed to get player: %v", err)
+	}
+
+	return player.Play(samples, sampleRate)
+}
+
+// StopSpeaking stops any speech that is playing
+func StopSpeaking() error {
+	player, err := audio.GetPlayer()
+	if err != nil {
+		return fmt.Errorf("failed to get player: %v", err)
+	}
+
+	player.Stop()
+	return nil
+}
+
+// ClearCache removes all cached speech
+func ClearCache() error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
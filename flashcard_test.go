@@ -1,7 +1,11 @@
 package main
 
 import (
+	"database/sql"
 	"testing"
+
+	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/database"
 )
 
 func TestDeckImpl(t *testing.T) {
@@ -159,6 +163,68 @@ func TestFlashcardImpl(t *testing.T) {
 		}
 	})
 
+	t.Run("Review Flashcard Timed", func(t *testing.T) {
+		createdCard, err := flashcard.CreateFlashcard(testDeck.ID, "Timed Front", "Timed Back", "standard")
+		if err != nil {
+			t.Fatalf("Failed to create flashcard for timed review test: %v", err)
+		}
+
+		// Invalid grades and times are rejected without recording a review
+		invalid := []struct {
+			grade        string
+			answerMs     int
+			answerSideMs int
+		}{
+			{"good", 4000, 1500},
+			{"normal", -1, 0},
+			{"normal", 4000, -1},
+			{"normal", 4000, 5000},
+		}
+		for _, review := range invalid {
+			if err := flashcard.ReviewFlashcardTimed(testDeck.ID, createdCard.ID, review.grade, review.answerMs, review.answerSideMs); err == nil {
+				t.Errorf("Expected %q in %d ms with %d ms on the answer to be rejected", review.grade, review.answerMs, review.answerSideMs)
+			}
+		}
+
+		if err := flashcard.ReviewFlashcardTimed(testDeck.ID, createdCard.ID, "normal", 4000, 1500); err != nil {
+			t.Fatalf("Failed to review flashcard: %v", err)
+		}
+		// An untimed review is stored without a time rather than as an instant answer
+		if err := flashcard.ReviewFlashcard(testDeck.ID, createdCard.ID, "again"); err != nil {
+			t.Fatalf("Failed to review flashcard: %v", err)
+		}
+
+		results, err := database.DB.Query("SELECT grade, answer_ms, answer_side_ms FROM review_logs WHERE card_id = ? ORDER BY id", createdCard.ID)
+		if err != nil {
+			t.Fatalf("Failed to get review log: %v", err)
+		}
+		defer results.Close()
+
+		type loggedReview struct {
+			grade        int
+			answerMs     sql.NullInt64
+			answerSideMs sql.NullInt64
+		}
+		var logged []loggedReview
+		for results.Next() {
+			var review loggedReview
+			if err := results.Scan(&review.grade, &review.answerMs, &review.answerSideMs); err != nil {
+				t.Fatalf("Failed to read review log: %v", err)
+			}
+			logged = append(logged, review)
+		}
+
+		if len(logged) != 2 {
+			t.Fatalf("Expected 2 logged reviews, got %d", len(logged))
+		}
+		if logged[0].grade != algorithms.GradeGood || logged[0].answerMs.Int64 != 4000 || logged[0].answerSideMs.Int64 != 1500 {
+			t.Errorf("Expected a Good review taking 4000 ms with 1500 ms on the answer, got %+v", logged[0])
+		}
+		if logged[1].grade != algorithms.GradeAgain || logged[1].answerMs.Valid || logged[1].answerSideMs.Valid {
+			t.Errorf("Expected an untimed Again review, got %+v", logged[1])
+		}
+	})
+
 	t.Run("Delete Flashcard", func(t *testing.T) {
 		// Create a flashcard to delete
 		createdCard, err := flashcard.CreateFlashcard(testDeck.ID, "Delete Front", "Delete Back", "standard")
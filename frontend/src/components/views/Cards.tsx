@@ -801,8 +801,11 @@ function Cards() {
           )
         );
 
-        // Count successful operations
-        successCount += results.filter(result => result.status === 'fulfilled').length;
+        // Count the variants created
+        successCount += results.reduce(
+          (count, result) => count + (result.status === 'fulfilled' ? result.value.length : 0),
+          0
+        );
       }
 
       // Refresh the cards list
@@ -2,4 +2,4 @@
 // This file is automatically generated. DO NOT EDIT
 import {models} from '../models';
 
-export function RephraseFlashcard(arg1:number,arg2:number,arg3:number):Promise<models.FlashcardModel>;
+export function RephraseFlashcard(arg1:number,arg2:number,arg3:number):Promise<Array<models.FlashcardModel>>;
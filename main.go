@@ -3,15 +3,18 @@ package main
 import (
 	"embed"
 	"errors"
-	"fmt"
 	"os"
 	"time"
 
 	"github.com/jorkle/brightcards/backend/components/ai/chat"
 	"github.com/jorkle/brightcards/backend/components/algorithms"
+	"github.com/jorkle/brightcards/backend/components/audio"
 	"github.com/jorkle/brightcards/backend/components/database"
+	"github.com/jorkle/brightcards/backend/components/media"
 	"github.com/jorkle/brightcards/backend/components/models"
+	"github.com/jorkle/brightcards/backend/components/render"
 	"github.com/jorkle/brightcards/backend/components/services"
+	"github.com/jorkle/brightcards/backend/components/tts"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
@@ -22,19 +25,35 @@ import (
 var assets embed.FS
 
 type FlashcardModel struct {
-	ID             int       `json:"ID"`
-	Front          string    `json:"Front"`
-	Back           string    `json:"Back"`
-	DeckId         int       `json:"DeckId"`
-	CardType       string    `json:"CardType"` // "standard" or "feynman"
-	Source         string    `json:"Source"`   // "manual", "generated", "rephrased", or "unspecified"
-	FSRSDifficulty float64   `json:"FSRSDifficulty"`
-	FSRSStability  float64   `json:"FSRSStability"`
-	DueDate        time.Time `json:"DueDate"`
-	LastReviewed   *string   `json:"LastReviewed,omitempty"`
-	Difficulty     *string   `json:"Difficulty,omitempty"`
-	CreatedAt      string    `json:"CreatedAt"`
-	UpdatedAt      string    `json:"UpdatedAt"`
+	ID             int                   `json:"ID"`
+	Front          string                `json:"Front"`
+	Back           string                `json:"Back"`
+	DeckId         int                   `json:"DeckId"`
+	CardType       string                `json:"CardType"` // "standard" or "feynman"
+	Source         string                `json:"Source"`   // "manual", "generated", "rephrased", or "unspecified"
+	FSRSDifficulty float64               `json:"FSRSDifficulty"`
+	FSRSStability  float64               `json:"FSRSStability"`
+	State          string                `json:"State"`                  // "new", "learning", "review" or "relearning"
+	Step           int                   `json:"Step"`                   // current learning or relearning step
+	EaseFactor     float64               `json:"EaseFactor"`             // SM-2 ease factor
+	Repetitions    int                   `json:"Repetitions"`            // SM-2 successful reviews in a row
+	LeitnerBox     int                   `json:"LeitnerBox"`             // Leitner box, starting at 1
+	IntervalDays   float64               `json:"IntervalDays"`           // interval given at the last review
+	Lapses         int                   `json:"Lapses"`                 // times the card was forgotten after graduating
+	Leech          bool                  `json:"Leech"`                  // forgotten often enough to reach the deck's leech threshold
+	Suspended      bool                  `json:"Suspended"`              // left out of the study queue
+	BuriedUntil    *string               `json:"BuriedUntil,omitempty"`  // left out of the study queue until then, usually the next study day
+	ParentCardId   *int                  `json:"ParentCardId,omitempty"` // the card this one rephrases
+	VariantId      int                   `json:"VariantId,omitempty"`    // in decks that rotate phrasings, the card whose wording is shown
+	DisplayFront   string                `json:"DisplayFront,omitempty"` // the wording of that card shown for review; Front and Back stay the card's own
+	DisplayBack    string                `json:"DisplayBack,omitempty"`
+	DueDate        time.Time             `json:"DueDate"`
+	LastReviewed   *string               `json:"LastReviewed,omitempty"`
+	Difficulty     *string               `json:"Difficulty,omitempty"`
+	Retrievability float64               `json:"Retrievability"`          // chance of recalling the card now, 0 for new cards
+	NextIntervals  []models.NextInterval `json:"NextIntervals,omitempty"` // interval each grade would give if the card were reviewed now
+	CreatedAt      string                `json:"CreatedAt"`
+	UpdatedAt      string                `json:"UpdatedAt"`
 }
 
 type DeckModel struct {
@@ -45,6 +64,16 @@ type DeckModel struct {
 	EnableAutoRephrase   bool    `json:"EnableAutoRephrase"`
 	EnableInitialismSwap bool    `json:"EnableInitialismSwap"`
 	MaxRephrasedCards    int     `json:"MaxRephrasedCards"`
+	TTSAutoPlayFront     bool    `json:"TTSAutoPlayFront"`
+	TTSAutoPlayBack      bool    `json:"TTSAutoPlayBack"`
+	Scheduler            string  `json:"Scheduler"`       // "fsrs", "sm2" or "leitner"
+	LeechThreshold       int     `json:"LeechThreshold"`  // lapses that make a card a leech, 0 to turn detection off
+	LeechAction          string  `json:"LeechAction"`     // "tag", "suspend" or "rewrite"
+	VariantMode          string  `json:"VariantMode"`     // "separate" or "rotate"
+	LearningSteps        string  `json:"LearningSteps"`   // e.g. "1m 10m"
+	RelearningSteps      string  `json:"RelearningSteps"` // e.g. "10m"
+	NewCardsPerDay       int     `json:"NewCardsPerDay"`
+	MaxReviewsPerDay     int     `json:"MaxReviewsPerDay"`
 	CardCount            int     `json:"CardCount"`
 	LastReviewed         *string `json:"LastReviewed,omitempty"`
 	CreatedAt            string  `json:"CreatedAt"`
@@ -52,7 +81,9 @@ type DeckModel struct {
 }
 
 // FeynmanService provides functionality for Feynman flashcards
-type FeynmanService struct{}
+type FeynmanService struct {
+	app *App
+}
 
 // InitFeynmanService initializes the Feynman service with the OpenAI API key
 func (f *FeynmanService) InitFeynmanService(apiKey string) error {
@@ -66,7 +97,31 @@ func (f *FeynmanService) StartRecording() error {
 
 // StopRecordingAndAnalyze stops recording and analyzes the recorded audio
 func (f *FeynmanService) StopRecordingAndAnalyze() (*services.FeynmanAnalysis, error) {
-	return services.StopRecordingAndAnalyze()
+	ctx, cancel := f.app.requestContext()
+	defer cancel()
+	return services.StopRecordingAndAnalyzeContext(ctx)
+}
+
+// PauseRecording pauses the current recording
+func (f *FeynmanService) PauseRecording() error {
+	return services.PauseRecording()
+}
+
+// ResumeRecording resumes a paused recording
+func (f *FeynmanService) ResumeRecording() error {
+	return services.ResumeRecording()
+}
+
+// RecoverRecording restores a recording interrupted by a crash, reporting whether one was found
+func (f *FeynmanService) RecoverRecording() (bool, error) {
+	return services.RecoverRecording()
+}
+
+// AnalyzeLastRecording transcribes and analyzes the most recent recording
+func (f *FeynmanService) AnalyzeLastRecording() (*services.FeynmanAnalysis, error) {
+	ctx, cancel := f.app.requestContext()
+	defer cancel()
+	return services.AnalyzeLastRecordingContext(ctx)
 }
 
 // CleanupRecording cleans up the recorder resources
@@ -74,6 +129,182 @@ func (f *FeynmanService) CleanupRecording() error {
 	return services.CleanupRecording()
 }
 
+// AudioService provides functionality for audio devices and recording storage
+type AudioService struct{}
+
+// ListInputDevices lists the microphones available for recording
+func (a *AudioService) ListInputDevices() ([]audio.CaptureDevice, error) {
+	return services.ListInputDevices()
+}
+
+// GetInputDevice returns the selected microphone id, or an empty string for the system default
+func (a *AudioService) GetInputDevice() (string, error) {
+	return services.GetInputDevice()
+}
+
+// SetInputDevice selects the microphone used for recording
+func (a *AudioService) SetInputDevice(deviceId string) error {
+	return services.SetInputDevice(deviceId)
+}
+
+// GetAudioFormat returns the format recordings are stored in before transcription
+func (a *AudioService) GetAudioFormat() (string, error) {
+	return services.GetAudioFormat()
+}
+
+// SetAudioFormat sets the format recordings are stored in ("flac" or "wav")
+func (a *AudioService) SetAudioFormat(format string) error {
+	return services.SetAudioFormat(format)
+}
+
+// GetMaxRecordingSeconds returns the length after which recordings stop automatically
+func (a *AudioService) GetMaxRecordingSeconds() (int, error) {
+	return services.GetMaxRecordingSeconds()
+}
+
+// SetMaxRecordingSeconds sets the length after which recordings stop automatically, 0 for no limit
+func (a *AudioService) SetMaxRecordingSeconds(seconds int) error {
+	return services.SetMaxRecordingSeconds(seconds)
+}
+
+// TTSService provides text-to-speech playback of flashcards
+type TTSService struct {
+	app *App
+}
+
+// GetTTSConfig returns the text-to-speech provider settings
+func (t *TTSService) GetTTSConfig() (tts.Config, error) {
+	return services.GetTTSConfig()
+}
+
+// SaveTTSConfig saves the text-to-speech provider settings
+func (t *TTSService) SaveTTSConfig(config tts.Config) error {
+	return services.SaveTTSConfig(config)
+}
+
+// SpeakCard reads the "front" or "back" of a flashcard aloud
+func (t *TTSService) SpeakCard(deckId int, cardId int, side string) error {
+	ctx, cancel := t.app.requestContext()
+	defer cancel()
+	return services.SpeakCard(ctx, deckId, cardId, side)
+}
+
+// SpeakText reads arbitrary text aloud
+func (t *TTSService) SpeakText(text string) error {
+	ctx, cancel := t.app.requestContext()
+	defer cancel()
+	return services.Speak(ctx, text)
+}
+
+// StopSpeaking stops any speech that is playing
+func (t *TTSService) StopSpeaking() error {
+	return services.StopSpeaking()
+}
+
+// ClearSpeechCache removes all cached synthesized speech
+func (t *TTSService) ClearSpeechCache() error {
+	return tts.ClearCache()
+}
+
+// MediaService provides functionality for images and audio attached to flashcards
+type MediaService struct{}
+
+// AttachMediaFile attaches an image or audio file to the "front" or "back" of a flashcard
+func (m *MediaService) AttachMediaFile(deckId int, cardId int, side string, filePath string) (models.MediaModel, error) {
+	return services.AttachMediaFile(deckId, cardId, side, filePath)
+}
+
+// AttachMediaData attaches base64 encoded image or audio data to the "front" or "back" of a flashcard
+func (m *MediaService) AttachMediaData(deckId int, cardId int, side string, fileName string, base64Data string) (models.MediaModel, error) {
+	return services.AttachMediaData(deckId, cardId, side, fileName, base64Data)
+}
+
+// ListCardMedia lists the media attached to a flashcard
+func (m *MediaService) ListCardMedia(deckId int, cardId int) ([]models.MediaModel, error) {
+	return services.ListCardMedia(deckId, cardId)
+}
+
+// DeleteMedia removes a media attachment
+func (m *MediaService) DeleteMedia(mediaId int) error {
+	return services.DeleteMedia(mediaId)
+}
+
+// CollectOrphanedMedia deletes media files no longer attached to any flashcard
+func (m *MediaService) CollectOrphanedMedia() (int, error) {
+	return services.CollectOrphanedMedia()
+}
+
+// StatsService provides review statistics for a deck, or for all decks when deckId is 0
+type StatsService struct{}
+
+// GetOverviewStats returns everything the overview page shows
+func (s *StatsService) GetOverviewStats(deckId int) (models.OverviewStats, error) {
+	return services.GetOverviewStats(deckId)
+}
+
+// GetRetention returns the true retention over the last day, week, month and year
+func (s *StatsService) GetRetention(deckId int) ([]models.RetentionWindow, error) {
+	return services.GetRetention(deckId)
+}
+
+// GetDailyReviews returns the reviews and time spent on each of the last days
+func (s *StatsService) GetDailyReviews(deckId int, days int) ([]models.DailyReviews, error) {
+	return services.GetDailyReviews(deckId, days)
+}
+
+// GetDueForecast returns how many cards fall due on each of the coming days, e.g. 30 or 90
+func (s *StatsService) GetDueForecast(deckId int, days int) ([]models.ForecastDay, error) {
+	return services.GetDueForecast(deckId, days)
+}
+
+// GetCardDistributions returns the stability, difficulty and interval distributions of the studied cards
+func (s *StatsService) GetCardDistributions(deckId int) (models.CardDistributions, error) {
+	return services.GetCardDistributions(deckId)
+}
+
+// GetStreak returns the current and longest study streaks
+func (s *StatsService) GetStreak(deckId int) (models.StreakStats, error) {
+	return services.GetStreak(deckId)
+}
+
+// GetHeatmap returns the reviews on every day of a year
+func (s *StatsService) GetHeatmap(deckId int, year int) ([]models.HeatmapDay, error) {
+	return services.GetHeatmap(deckId, year)
+}
+
+// GetSlowCards returns the cards of a deck that take longest to answer even when recalled
+func (s *StatsService) GetSlowCards(deckId int, limit int) ([]models.SlowCard, error) {
+	return services.GetSlowCards(deckId, limit)
+}
+
+// OcclusionService provides functionality for image occlusion cards
+type OcclusionService struct{}
+
+// CreateImageOcclusion creates an image occlusion note from base64 image data, with one flashcard per mask
+func (o *OcclusionService) CreateImageOcclusion(deckId int, fileName string, base64Image string, width int, height int, header string, hideAll bool, masks []models.OcclusionMaskModel) (models.OcclusionNoteModel, error) {
+	return services.CreateImageOcclusion(deckId, fileName, base64Image, width, height, header, hideAll, masks)
+}
+
+// GetImageOcclusion returns an image occlusion note with its masks
+func (o *OcclusionService) GetImageOcclusion(noteId int) (models.OcclusionNoteModel, error) {
+	return services.GetImageOcclusion(noteId)
+}
+
+// UpdateImageOcclusion replaces the masks of an image occlusion note, keeping the schedule of existing masks
+func (o *OcclusionService) UpdateImageOcclusion(noteId int, header string, hideAll bool, masks []models.OcclusionMaskModel) (models.OcclusionNoteModel, error) {
+	return services.UpdateImageOcclusion(noteId, header, hideAll, masks)
+}
+
+// DeleteImageOcclusion deletes an image occlusion note and all of its flashcards
+func (o *OcclusionService) DeleteImageOcclusion(noteId int) error {
+	return services.DeleteImageOcclusion(noteId)
+}
+
+// GetOcclusionView returns the question and answer rendering of an image occlusion flashcard
+func (o *OcclusionService) GetOcclusionView(deckId int, cardId int) (models.OcclusionView, error) {
+	return services.GetOcclusionView(deckId, cardId)
+}
+
 // SettingsService provides functionality for app settings
 type SettingsService struct{}
 
@@ -84,6 +315,11 @@ func (s *SettingsService) SaveOpenAIKey(apiKey string) error {
 		return err
 	}
 
+	// OpenAI speech synthesis doesn't depend on the Feynman service, so set it up on its own
+	if err := tts.InitTTS(apiKey); err != nil {
+		return err
+	}
+
 	// Initialize the Feynman service with the new API key
 	return services.InitFeynmanService(apiKey)
 }
@@ -93,73 +329,153 @@ func (s *SettingsService) GetOpenAIKey() (string, error) {
 	return database.GetOpenAIKey()
 }
 
+// GetStudyDaySettings returns the timezone and hour at which daily limits reset
+func (s *SettingsService) GetStudyDaySettings() (services.StudyDaySettings, error) {
+	return services.GetStudyDaySettings()
+}
+
+// SaveStudyDaySettings saves the timezone and hour at which daily limits reset
+func (s *SettingsService) SaveStudyDaySettings(settings services.StudyDaySettings) error {
+	return services.SaveStudyDaySettings(settings)
+}
+
+// GetTimeoutSettings returns how long AI requests and transcriptions may take
+func (s *SettingsService) GetTimeoutSettings() (services.TimeoutSettings, error) {
+	return services.GetTimeoutSettings()
+}
+
+// SaveTimeoutSettings saves how long AI requests and transcriptions may take
+func (s *SettingsService) SaveTimeoutSettings(settings services.TimeoutSettings) error {
+	return services.SaveTimeoutSettings(settings)
+}
+
+// GetAIMonthlyBudget returns the monthly AI budget in US dollars, 0 when there is no cap
+func (s *SettingsService) GetAIMonthlyBudget() (float64, error) {
+	return services.GetAIMonthlyBudget()
+}
+
+// SaveAIMonthlyBudget sets the monthly AI budget in US dollars; 0 removes the cap
+func (s *SettingsService) SaveAIMonthlyBudget(budget float64) error {
+	return services.SaveAIMonthlyBudget(budget)
+}
+
+// GetAICacheTTL returns how many hours cached AI responses are reused, 0 when the cache is off
+func (s *SettingsService) GetAICacheTTL() (int, error) {
+	return services.GetAICacheTTL()
+}
+
+// SaveAICacheTTL sets how many hours cached AI responses are reused; 0 turns the cache off
+func (s *SettingsService) SaveAICacheTTL(hours int) error {
+	return services.SaveAICacheTTL(hours)
+}
+
+// GetSchedulingSettings returns the interval fuzz and load balancing settings
+func (s *SettingsService) GetSchedulingSettings() (services.SchedulingSettings, error) {
+	return services.GetSchedulingSettings()
+}
+
+// SaveSchedulingSettings saves the interval fuzz and load balancing settings
+func (s *SettingsService) SaveSchedulingSettings(settings services.SchedulingSettings) error {
+	return services.SaveSchedulingSettings(settings)
+}
+
 // AIService provides functionality for AI-powered features
-type AIService struct{}
+type AIService struct {
+	app *App
+}
 
 // GenerateFlashcards generates flashcards from text using the OpenAI API
 func (a *AIService) GenerateFlashcards(inputText string, purpose string, maxCards int) ([]chat.Flashcard, error) {
-	return chat.GenerateFlashcards(inputText, purpose, maxCards)
+	ctx, cancel := a.app.requestContext()
+	defer cancel()
+	return services.GenerateFlashcardsContext(ctx, inputText, purpose, maxCards)
 }
 
-// RephraseService provides functionality for flashcard rephrasing
-type RephraseService struct{}
+// GetAIUsage returns the AI usage and estimated cost of the days from one date to another, written as YYYY-MM-DD
+func (a *AIService) GetAIUsage(from string, to string) (models.AIUsageSummary, error) {
+	return services.GetAIUsage(from, to)
+}
 
-// RephraseFlashcard rephrases a flashcard using AI
-func (r *RephraseService) RephraseFlashcard(deckId int, cardId int, maxVariations int) (models.FlashcardModel, error) {
-	// Get the original flashcard
-	originalCard, err := database.Card(deckId, cardId)
-	if err != nil {
-		return models.FlashcardModel{}, fmt.Errorf("failed to get flashcard: %v", err)
-	}
+// ClearAICache removes the cached AI responses of an operation such as "generate_flashcards",
+// or all of them when it is empty, and returns how many were removed
+func (a *AIService) ClearAICache(operation string) (int, error) {
+	return services.ClearAICache(operation)
+}
 
-	// Get the deck to check if we should use initialism/acronym expansion
-	deck, err := database.Deck(deckId)
-	if err != nil {
-		return models.FlashcardModel{}, fmt.Errorf("failed to get deck: %v", err)
-	}
+// CancelAIRequests cancels the AI requests the UI is waiting on, such as GenerateFlashcards
+func (a *AIService) CancelAIRequests() {
+	services.CancelAIRequests()
+}
 
-	// Call the AI service to rephrase the flashcard, passing the initialism swap flag from deck settings
-	rephrasedCards, err := chat.RephraseFlashcard(&originalCard, deck.EnableInitialismSwap, maxVariations)
-	if err != nil {
-		return models.FlashcardModel{}, fmt.Errorf("failed to rephrase flashcard: %v", err)
-	}
+// EnqueueGenerateFlashcards generates flashcards in the background; the job's progress is sent as "ai:job" events
+func (a *AIService) EnqueueGenerateFlashcards(inputText string, purpose string, maxCards int) (models.AIJobModel, error) {
+	return services.EnqueueGenerateFlashcards(inputText, purpose, maxCards)
+}
 
-	// Make sure we have at least one rephrased card
-	if len(rephrasedCards) == 0 {
-		return models.FlashcardModel{}, fmt.Errorf("no rephrased flashcards were generated")
-	}
+// EnqueueProcessText analyzes a Feynman explanation in the background
+func (a *AIService) EnqueueProcessText(inputText string) (models.AIJobModel, error) {
+	return services.EnqueueProcessText(inputText)
+}
 
-	// Create a new card for the rephrased version
-	newCard := models.FlashcardModel{
-		Front:          rephrasedCards[0].Front,
-		Back:           rephrasedCards[0].Back,
-		DeckId:         deckId,
-		CardType:       originalCard.CardType,
-		Source:         "rephrased",
-		FSRSDifficulty: 0, // Start with default difficulty
-		FSRSStability:  0, // Start with default stability
-	}
+// GetAIJob returns a background AI job, with its JSON result once it has succeeded
+func (a *AIService) GetAIJob(jobId int) (models.AIJobModel, error) {
+	return services.GetAIJob(jobId)
+}
 
-	// Create the new flashcard in the database
-	createdCard, err := database.CreateCard(newCard)
-	if err != nil {
-		return models.FlashcardModel{}, fmt.Errorf("failed to create rephrased flashcard: %v", err)
-	}
+// GetAIJobs returns the most recent background AI jobs
+func (a *AIService) GetAIJobs() ([]models.AIJobModel, error) {
+	return services.GetAIJobs()
+}
+
+// CancelAIJob cancels a background AI job that hasn't finished
+func (a *AIService) CancelAIJob(jobId int) (models.AIJobModel, error) {
+	return services.CancelAIJob(jobId)
+}
+
+// RephraseService provides functionality for flashcard rephrasing
+type RephraseService struct {
+	app *App
+}
+
+// RephraseFlashcard rephrases a flashcard using AI, storing the wordings as variants of the original card,
+// and returns the new variants
+func (r *RephraseService) RephraseFlashcard(deckId int, cardId int, maxVariations int) ([]models.FlashcardModel, error) {
+	ctx, cancel := r.app.requestContext()
+	defer cancel()
+	return services.RephraseFlashcardContext(ctx, deckId, cardId, maxVariations)
+}
+
+// EnqueueRephraseFlashcard rephrases a flashcard in the background; the job's result lists the new variants
+func (r *RephraseService) EnqueueRephraseFlashcard(deckId int, cardId int, maxVariations int) (models.AIJobModel, error) {
+	return services.EnqueueRephraseFlashcard(deckId, cardId, maxVariations)
+}
+
+// GetVariants returns the rephrasings of a flashcard, oldest first
+func (r *RephraseService) GetVariants(deckId int, cardId int) ([]models.FlashcardModel, error) {
+	return services.GetCardVariants(deckId, cardId)
+}
 
-	return createdCard, nil
+// PruneVariants deletes all but the newest keep rephrasings of a flashcard and returns the ones left
+func (r *RephraseService) PruneVariants(deckId int, cardId int, keep int) ([]models.FlashcardModel, error) {
+	return services.PruneCardVariants(deckId, cardId, keep)
 }
 
 func main() {
 	// Create an instance of the app structure
 	app := NewApp()
-	flashcard := &FlashcardImpl{}
+	flashcard := &FlashcardImpl{app: app}
 	cardModel := &FlashcardModel{}
 	deckModel := &DeckModel{}
 	deck := &DeckImpl{}
-	feynmanService := &FeynmanService{}
+	feynmanService := &FeynmanService{app: app}
 	settingsService := &SettingsService{}
-	aiService := &AIService{}
-	rephraseService := &RephraseService{}
+	aiService := &AIService{app: app}
+	rephraseService := &RephraseService{app: app}
+	audioService := &AudioService{}
+	ttsService := &TTSService{app: app}
+	mediaService := &MediaService{}
+	occlusionService := &OcclusionService{}
+	statsService := &StatsService{}
 
 	// Initialize the OpenAI API key from environment variable or database
 	openaiApiKey := os.Getenv("OPENAI_API_KEY")
@@ -173,8 +489,11 @@ func main() {
 		}
 	}
 
-	// Initialize the Feynman service if API key is available
+	// Initialize the Feynman service and OpenAI speech synthesis if API key is available
 	if openaiApiKey != "" {
+		if err := tts.InitTTS(openaiApiKey); err != nil {
+			println("Warning: Failed to initialize text-to-speech:", err.Error())
+		}
 		if err := services.InitFeynmanService(openaiApiKey); err != nil {
 			println("Warning: Failed to initialize Feynman service:", err.Error())
 		} else {
@@ -190,10 +509,12 @@ func main() {
 		Width:  1024,
 		Height: 768,
 		AssetServer: &assetserver.Options{
-			Assets: assets,
+			Assets:  assets,
+			Handler: media.NewHandler(),
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.startup,
+		OnShutdown:       app.shutdown,
 		Bind: []interface{}{
 			app,
 			flashcard,
@@ -204,6 +525,11 @@ func main() {
 			settingsService,
 			aiService,
 			rephraseService,
+			audioService,
+			ttsService,
+			mediaService,
+			occlusionService,
+			statsService,
 		},
 	})
 
@@ -221,15 +547,22 @@ type Deck interface {
 	UpdateDeck(deckId int, name string, description string, purpose string) (deck models.DeckModel, err error)
 	CreateDeckWithRephraseSettings(name string, description string, purpose string, enableAutoRephrase bool, enableInitialismSwap bool, maxRephrasedCards int) (deck models.DeckModel, err error)
 	UpdateDeckWithRephraseSettings(deckId int, name string, description string, purpose string, enableAutoRephrase bool, enableInitialismSwap bool, maxRephrasedCards int) (deck models.DeckModel, err error)
+	UpdateDeckTTSSettings(deckId int, autoPlayFront bool, autoPlayBack bool) (deck models.DeckModel, err error)
+	UpdateDeckLimits(deckId int, newCardsPerDay int, maxReviewsPerDay int) (deck models.DeckModel, err error)
+	UpdateDeckLearningSteps(deckId int, learningSteps string, relearningSteps string) (deck models.DeckModel, err error)
+	GetStudyQueueCounts(deckId int) (models.StudyQueueCounts, error)
+	SimulateWorkload(deckId int, days int, newPerDay int, retention float64) (models.WorkloadSimulation, error)
+	UpdateDeckLeechSettings(deckId int, threshold int, action string) (deck models.DeckModel, err error)
+	GetLeeches(deckId int) ([]models.LeechModel, error)
+	SetDeckScheduler(deckId int, scheduler string) (deck models.DeckModel, err error)
+	SetDeckVariantMode(deckId int, mode string) (deck models.DeckModel, err error)
+	GetSchedulers() []string
 	DeleteDeck(deckId int) error
 	ExportDeck(deckId int, format string) (string, error)
 }
 
-func (d *DeckImpl) GetDeck(deckId int) (models.DeckModel, error) {
-	dbDeck, err := database.Deck(deckId)
-	if err != nil {
-		return models.DeckModel{}, err
-	}
+// toDeckModel converts a deck read from the database into the model returned to the frontend
+func toDeckModel(dbDeck database.DeckModel) models.DeckModel {
 	return models.DeckModel{
 		ID:                   dbDeck.ID,
 		Name:                 dbDeck.Name,
@@ -238,11 +571,29 @@ func (d *DeckImpl) GetDeck(deckId int) (models.DeckModel, error) {
 		EnableAutoRephrase:   dbDeck.EnableAutoRephrase,
 		EnableInitialismSwap: dbDeck.EnableInitialismSwap,
 		MaxRephrasedCards:    dbDeck.MaxRephrasedCards,
+		TTSAutoPlayFront:     dbDeck.TTSAutoPlayFront,
+		TTSAutoPlayBack:      dbDeck.TTSAutoPlayBack,
+		Scheduler:            dbDeck.Scheduler,
+		LeechThreshold:       dbDeck.LeechThreshold,
+		LeechAction:          dbDeck.LeechAction,
+		VariantMode:          dbDeck.VariantMode,
+		LearningSteps:        dbDeck.LearningSteps,
+		RelearningSteps:      dbDeck.RelearningSteps,
+		NewCardsPerDay:       dbDeck.NewCardsPerDay,
+		MaxReviewsPerDay:     dbDeck.MaxReviewsPerDay,
 		CardCount:            dbDeck.CardCount,
 		LastReviewed:         dbDeck.LastReviewed,
 		CreatedAt:            dbDeck.CreatedAt,
 		UpdatedAt:            dbDeck.UpdatedAt,
-	}, nil
+	}
+}
+
+func (d *DeckImpl) GetDeck(deckId int) (models.DeckModel, error) {
+	dbDeck, err := database.Deck(deckId)
+	if err != nil {
+		return models.DeckModel{}, err
+	}
+	return toDeckModel(dbDeck), nil
 }
 
 func (d *DeckImpl) GetAllDecks() ([]models.DeckModel, error) {
@@ -253,19 +604,7 @@ func (d *DeckImpl) GetAllDecks() ([]models.DeckModel, error) {
 
 	decks := make([]models.DeckModel, len(dbDecks))
 	for i, dbDeck := range dbDecks {
-		decks[i] = models.DeckModel{
-			ID:                   dbDeck.ID,
-			Name:                 dbDeck.Name,
-			Description:          dbDeck.Description,
-			Purpose:              dbDeck.Purpose,
-			EnableAutoRephrase:   dbDeck.EnableAutoRephrase,
-			EnableInitialismSwap: dbDeck.EnableInitialismSwap,
-			MaxRephrasedCards:    dbDeck.MaxRephrasedCards,
-			CardCount:            dbDeck.CardCount,
-			LastReviewed:         dbDeck.LastReviewed,
-			CreatedAt:            dbDeck.CreatedAt,
-			UpdatedAt:            dbDeck.UpdatedAt,
-		}
+		decks[i] = toDeckModel(dbDeck)
 	}
 	return decks, nil
 }
@@ -275,19 +614,7 @@ func (d *DeckImpl) CreateDeck(name string, description string, purpose string) (
 	if err != nil {
 		return models.DeckModel{}, err
 	}
-	return models.DeckModel{
-		ID:                   dbDeck.ID,
-		Name:                 dbDeck.Name,
-		Description:          dbDeck.Description,
-		Purpose:              dbDeck.Purpose,
-		EnableAutoRephrase:   dbDeck.EnableAutoRephrase,
-		EnableInitialismSwap: dbDeck.EnableInitialismSwap,
-		MaxRephrasedCards:    dbDeck.MaxRephrasedCards,
-		CardCount:            dbDeck.CardCount,
-		LastReviewed:         dbDeck.LastReviewed,
-		CreatedAt:            dbDeck.CreatedAt,
-		UpdatedAt:            dbDeck.UpdatedAt,
-	}, nil
+	return toDeckModel(dbDeck), nil
 }
 
 func (d *DeckImpl) UpdateDeck(deckId int, name string, description string, purpose string) (models.DeckModel, error) {
@@ -295,19 +622,7 @@ func (d *DeckImpl) UpdateDeck(deckId int, name string, description string, purpo
 	if err != nil {
 		return models.DeckModel{}, err
 	}
-	return models.DeckModel{
-		ID:                   dbDeck.ID,
-		Name:                 dbDeck.Name,
-		Description:          dbDeck.Description,
-		Purpose:              dbDeck.Purpose,
-		EnableAutoRephrase:   dbDeck.EnableAutoRephrase,
-		EnableInitialismSwap: dbDeck.EnableInitialismSwap,
-		MaxRephrasedCards:    dbDeck.MaxRephrasedCards,
-		CardCount:            dbDeck.CardCount,
-		LastReviewed:         dbDeck.LastReviewed,
-		CreatedAt:            dbDeck.CreatedAt,
-		UpdatedAt:            dbDeck.UpdatedAt,
-	}, nil
+	return toDeckModel(dbDeck), nil
 }
 
 func (d *DeckImpl) CreateDeckWithRephraseSettings(name string, description string, purpose string, enableAutoRephrase bool, enableInitialismSwap bool, maxRephrasedCards int) (models.DeckModel, error) {
@@ -315,19 +630,7 @@ func (d *DeckImpl) CreateDeckWithRephraseSettings(name string, description strin
 	if err != nil {
 		return models.DeckModel{}, err
 	}
-	return models.DeckModel{
-		ID:                   dbDeck.ID,
-		Name:                 dbDeck.Name,
-		Description:          dbDeck.Description,
-		Purpose:              dbDeck.Purpose,
-		EnableAutoRephrase:   dbDeck.EnableAutoRephrase,
-		EnableInitialismSwap: dbDeck.EnableInitialismSwap,
-		MaxRephrasedCards:    dbDeck.MaxRephrasedCards,
-		CardCount:            dbDeck.CardCount,
-		LastReviewed:         dbDeck.LastReviewed,
-		CreatedAt:            dbDeck.CreatedAt,
-		UpdatedAt:            dbDeck.UpdatedAt,
-	}, nil
+	return toDeckModel(dbDeck), nil
 }
 
 func (d *DeckImpl) UpdateDeckWithRephraseSettings(deckId int, name string, description string, purpose string, enableAutoRephrase bool, enableInitialismSwap bool, maxRephrasedCards int) (models.DeckModel, error) {
@@ -335,23 +638,86 @@ func (d *DeckImpl) UpdateDeckWithRephraseSettings(deckId int, name string, descr
 	if err != nil {
 		return models.DeckModel{}, err
 	}
-	return models.DeckModel{
-		ID:                   dbDeck.ID,
-		Name:                 dbDeck.Name,
-		Description:          dbDeck.Description,
-		Purpose:              dbDeck.Purpose,
-		EnableAutoRephrase:   dbDeck.EnableAutoRephrase,
-		EnableInitialismSwap: dbDeck.EnableInitialismSwap,
-		MaxRephrasedCards:    dbDeck.MaxRephrasedCards,
-		CardCount:            dbDeck.CardCount,
-		LastReviewed:         dbDeck.LastReviewed,
-		CreatedAt:            dbDeck.CreatedAt,
-		UpdatedAt:            dbDeck.UpdatedAt,
-	}, nil
+	return toDeckModel(dbDeck), nil
+}
+
+func (d *DeckImpl) UpdateDeckTTSSettings(deckId int, autoPlayFront bool, autoPlayBack bool) (models.DeckModel, error) {
+	dbDeck, err := database.UpdateDeckTTSSettings(deckId, autoPlayFront, autoPlayBack)
+	if err != nil {
+		return models.DeckModel{}, err
+	}
+	return toDeckModel(dbDeck), nil
+}
+
+// UpdateDeckLimits sets how many new cards and reviews a deck shows per day
+func (d *DeckImpl) UpdateDeckLimits(deckId int, newCardsPerDay int, maxReviewsPerDay int) (models.DeckModel, error) {
+	dbDeck, err := services.UpdateDeckLimits(deckId, newCardsPerDay, maxReviewsPerDay)
+	if err != nil {
+		return models.DeckModel{}, err
+	}
+	return toDeckModel(dbDeck), nil
+}
+
+// UpdateDeckLearningSteps sets the learning and relearning steps of a deck, such as "1m 10m"
+func (d *DeckImpl) UpdateDeckLearningSteps(deckId int, learningSteps string, relearningSteps string) (models.DeckModel, error) {
+	dbDeck, err := services.UpdateDeckLearningSteps(deckId, learningSteps, relearningSteps)
+	if err != nil {
+		return models.DeckModel{}, err
+	}
+	return toDeckModel(dbDeck), nil
+}
+
+// UpdateDeckLeechSettings sets how many lapses make a card a leech, 0 to turn detection off,
+// and whether leeches are tagged, suspended or rewritten by the AI
+func (d *DeckImpl) UpdateDeckLeechSettings(deckId int, threshold int, action string) (models.DeckModel, error) {
+	dbDeck, err := services.UpdateDeckLeechSettings(deckId, threshold, action)
+	if err != nil {
+		return models.DeckModel{}, err
+	}
+	return toDeckModel(dbDeck), nil
+}
+
+// GetLeeches returns the cards of a deck that keep being forgotten, with any AI rewrite suggested for them
+func (d *DeckImpl) GetLeeches(deckId int) ([]models.LeechModel, error) {
+	return services.GetLeeches(deckId)
+}
+
+// SimulateWorkload projects the daily workload and final retention of a deck for a new card rate and desired retention
+func (d *DeckImpl) SimulateWorkload(deckId int, days int, newPerDay int, retention float64) (models.WorkloadSimulation, error) {
+	return services.SimulateWorkload(deckId, days, newPerDay, retention)
+}
+
+// SetDeckScheduler switches a deck to "fsrs", "sm2" or "leitner", converting the state of its cards
+func (d *DeckImpl) SetDeckScheduler(deckId int, scheduler string) (models.DeckModel, error) {
+	dbDeck, err := services.SetDeckScheduler(deckId, scheduler)
+	if err != nil {
+		return models.DeckModel{}, err
+	}
+	return toDeckModel(dbDeck), nil
+}
+
+// SetDeckVariantMode sets whether rephrasings are scheduled as cards of their own ("separate") or shown in turn
+// in place of the original, sharing its schedule ("rotate")
+func (d *DeckImpl) SetDeckVariantMode(deckId int, mode string) (models.DeckModel, error) {
+	dbDeck, err := services.SetDeckVariantMode(deckId, mode)
+	if err != nil {
+		return models.DeckModel{}, err
+	}
+	return toDeckModel(dbDeck), nil
+}
+
+// GetSchedulers returns the scheduling algorithms a deck can use
+func (d *DeckImpl) GetSchedulers() []string {
+	return algorithms.SchedulerNames()
+}
+
+// GetStudyQueueCounts returns how many new cards and reviews are left in a deck today
+func (d *DeckImpl) GetStudyQueueCounts(deckId int) (models.StudyQueueCounts, error) {
+	return services.GetStudyQueueCounts(deckId)
 }
 
 func (d *DeckImpl) DeleteDeck(deckId int) error {
-	return database.DeleteDeck(deckId)
+	return services.DeleteDeck(deckId)
 }
 
 func (d *DeckImpl) ExportDeck(deckId int, format string) (string, error) {
@@ -362,24 +728,55 @@ type Flashcard interface {
 	GetFlashcard(deckId int, cardId int) (models.FlashcardModel, error)
 	GetAllFlashcards(deckId int) ([]models.FlashcardModel, error)
 	GetDueFlashcards(deckId int) ([]models.FlashcardModel, error)
+	PreviewDueFlashcards(deckId int, daysAhead int) ([]models.FlashcardModel, error)
 	CreateFlashcard(deckId int, front string, back string, cardType string) (models.FlashcardModel, error)
 	UpdateFlashcard(card models.FlashcardModel) (models.FlashcardModel, error)
 	DeleteFlashcard(deckId int, cardId int) (models.FlashcardModel, error)
 	ReviewFlashcard(deckId int, cardId int, grade string) error
+	ReviewFlashcardTimed(deckId int, cardId int, grade string, answerMs int, answerSideMs int) error
+	RequestLeechRewrite(deckId int, cardId int) error
+	AcceptLeechRewrite(deckId int, cardId int) (models.FlashcardModel, error)
+	ClearLeech(deckId int, cardId int) error
+	SuspendFlashcard(deckId int, cardId int, suspended bool) error
+	BuryFlashcard(deckId int, cardId int) error
+	UnburyFlashcard(deckId int, cardId int) error
+	RescheduleFlashcard(deckId int, cardId int, date string) error
+	ResetFlashcard(deckId int, cardId int, resetCounts bool) error
 	UpdateGrading(grade string) error
-	RephraseFlashcard(deckId int, cardId int, maxVariations int) (models.FlashcardModel, error)
+	RephraseFlashcard(deckId int, cardId int, maxVariations int) ([]models.FlashcardModel, error)
+	RenderFlashcard(deckId int, cardId int) (models.RenderedFlashcard, error)
+	RenderFlashcards(deckId int) ([]models.RenderedFlashcard, error)
+	RenderMarkdown(text string) (string, error)
+	GetHighlightCSS() (string, error)
 }
 
 func (f *FlashcardImpl) GetFlashcard(deckId int, cardId int) (models.FlashcardModel, error) {
-	return database.Card(deckId, cardId)
+	card, err := database.Card(deckId, cardId)
+	if err != nil {
+		return models.FlashcardModel{}, err
+	}
+	return services.CardWithMemoryState(card)
 }
 
 func (f *FlashcardImpl) GetAllFlashcards(deckId int) ([]models.FlashcardModel, error) {
-	return database.Cards(deckId)
+	cards, err := database.Cards(deckId)
+	if err != nil {
+		return nil, err
+	}
+	return services.WithMemoryState(deckId, cards)
 }
 
 func (f *FlashcardImpl) GetDueFlashcards(deckId int) ([]models.FlashcardModel, error) {
-	return database.GetDueCards(deckId)
+	cards, err := services.BuildStudyQueue(deckId)
+	if err != nil {
+		return nil, err
+	}
+	return services.WithMemoryState(deckId, cards)
+}
+
+// PreviewDueFlashcards returns the cards that will be due daysAhead days from now, e.g. 1 to study as of tomorrow
+func (f *FlashcardImpl) PreviewDueFlashcards(deckId int, daysAhead int) ([]models.FlashcardModel, error) {
+	return services.PreviewStudyQueue(deckId, daysAhead)
 }
 
 func (f *FlashcardImpl) CreateFlashcard(deckId int, front string, back string, cardType string) (models.FlashcardModel, error) {
@@ -402,25 +799,16 @@ func (f *FlashcardImpl) UpdateFlashcard(card models.FlashcardModel) (models.Flas
 }
 
 func (f *FlashcardImpl) DeleteFlashcard(deckId int, cardId int) (models.FlashcardModel, error) {
-	card, err := database.Card(deckId, cardId)
-	if err != nil {
-		return models.FlashcardModel{}, err
-	}
-
-	err = database.DeleteCard(cardId)
-	if err != nil {
-		return models.FlashcardModel{}, err
-	}
-
-	return card, nil
+	return services.DeleteFlashcard(deckId, cardId)
 }
 
 func (f *FlashcardImpl) ReviewFlashcard(deckId int, cardId int, grade string) error {
-	card, err := database.Card(deckId, cardId)
-	if err != nil {
-		return err
-	}
+	return f.ReviewFlashcardTimed(deckId, cardId, grade, 0, 0)
+}
 
+// ReviewFlashcardTimed grades a card along with the milliseconds taken to answer it, of which answerSideMs
+// were spent with the answer shown
+func (f *FlashcardImpl) ReviewFlashcardTimed(deckId int, cardId int, grade string, answerMs int, answerSideMs int) error {
 	var gradeInt int
 	switch grade {
 	case "again":
@@ -435,71 +823,85 @@ func (f *FlashcardImpl) ReviewFlashcard(deckId int, cardId int, grade string) er
 		return errors.New("invalid grade")
 	}
 
-	// Check if this is the first review for the card
-	if card.FSRSStability == 0 && card.FSRSDifficulty == 0 {
-		// For the first review, get the initial stability and difficulty
-		stability, difficulty := algorithms.DoInitialGrading(card, gradeInt)
+	return services.ReviewFlashcard(deckId, cardId, gradeInt, models.ReviewTiming{AnswerMs: answerMs, AnswerSideMs: answerSideMs})
+}
 
-		// Set the current time as LastReviewed
-		now := time.Now().UTC().Format(time.RFC3339)
-		card.LastReviewed = &now
+// RequestLeechRewrite asks the AI to rewrite a card in the background; the result is listed by GetLeeches
+func (f *FlashcardImpl) RequestLeechRewrite(deckId int, cardId int) error {
+	return services.RequestLeechRewrite(deckId, cardId)
+}
 
-		// Update the card in the database with the new stability, difficulty, and due date
-		return database.ReviewCard(deckId, cardId, stability, difficulty, stability)
-	} else {
-		// For subsequent reviews, use the DoSubsequentGrading function with the card's current state
-		nextInterval, newDifficulty, newStability := algorithms.DoSubsequentGrading(&card, gradeInt)
+// AcceptLeechRewrite replaces a leech's text with its suggested rewrite and returns it to the study queue
+func (f *FlashcardImpl) AcceptLeechRewrite(deckId int, cardId int) (models.FlashcardModel, error) {
+	return services.AcceptLeechRewrite(deckId, cardId)
+}
 
-		// Set the current time as LastReviewed
-		now := time.Now().UTC().Format(time.RFC3339)
-		card.LastReviewed = &now
+// ClearLeech unmarks a leech and returns it to the study queue
+func (f *FlashcardImpl) ClearLeech(deckId int, cardId int) error {
+	return services.ClearLeech(deckId, cardId)
+}
 
-		// Update the card in the database with the new values
-		return database.ReviewCard(deckId, cardId, newStability, newDifficulty, nextInterval)
-	}
+// SuspendFlashcard takes a card out of the study queue, or returns it when suspended is false
+func (f *FlashcardImpl) SuspendFlashcard(deckId int, cardId int, suspended bool) error {
+	return services.SuspendFlashcard(deckId, cardId, suspended)
 }
 
-func (f *FlashcardImpl) UpdateGrading(grade string) error {
-	// This method seems redundant with Review() since we need the deckId and cardId
-	// to identify which card to update. Consider removing this method from the interface
-	// or clarifying its intended use case.
-	return errors.New("UpdateGrading is deprecated, use Review instead")
+// BuryFlashcard hides a card until the next study day
+func (f *FlashcardImpl) BuryFlashcard(deckId int, cardId int) error {
+	return services.BuryFlashcard(deckId, cardId)
 }
 
-func (f *FlashcardImpl) RephraseFlashcard(deckId int, cardId int, maxVariations int) (models.FlashcardModel, error) {
-	// First get the original flashcard
-	originalCard, err := database.Card(deckId, cardId)
-	if err != nil {
-		return models.FlashcardModel{}, fmt.Errorf("failed to get flashcard: %v", err)
-	}
+// UnburyFlashcard returns a buried card to the study queue
+func (f *FlashcardImpl) UnburyFlashcard(deckId int, cardId int) error {
+	return services.UnburyFlashcard(deckId, cardId)
+}
 
-	// Get the deck to check if we should use initialism/acronym expansion
-	deck, err := database.Deck(deckId)
-	if err != nil {
-		return models.FlashcardModel{}, fmt.Errorf("failed to get deck: %v", err)
-	}
+// RescheduleFlashcard makes a card due on a date written as YYYY-MM-DD
+func (f *FlashcardImpl) RescheduleFlashcard(deckId int, cardId int, date string) error {
+	return services.RescheduleFlashcard(deckId, cardId, date)
+}
 
-	// Call the AI service to rephrase the flashcard, passing the initialism swap flag from deck settings
-	rephrasedCards, err := chat.RephraseFlashcard(&originalCard, deck.EnableInitialismSwap, maxVariations)
-	if err != nil {
-		return models.FlashcardModel{}, fmt.Errorf("failed to rephrase flashcard: %v", err)
-	}
+// ResetFlashcard turns a card back into a new card, optionally clearing its lapses and leech flag
+func (f *FlashcardImpl) ResetFlashcard(deckId int, cardId int, resetCounts bool) error {
+	return services.ResetFlashcard(deckId, cardId, resetCounts)
+}
 
-	// Make sure we have at least one rephrased card
-	if len(rephrasedCards) == 0 {
-		return models.FlashcardModel{}, fmt.Errorf("no rephrased flashcards were generated")
-	}
+// RenderFlashcard renders the Markdown on both sides of a flashcard to sanitized HTML
+func (f *FlashcardImpl) RenderFlashcard(deckId int, cardId int) (models.RenderedFlashcard, error) {
+	return services.RenderFlashcard(deckId, cardId)
+}
 
-	// Update the first flashcard in the database and return it
-	// Note: We only update the first card for now
-	updatedCard, err := database.UpdateCard(rephrasedCards[0])
-	if err != nil {
-		return models.FlashcardModel{}, fmt.Errorf("failed to update flashcard: %v", err)
-	}
+// RenderFlashcards renders every flashcard in a deck, for listings
+func (f *FlashcardImpl) RenderFlashcards(deckId int) ([]models.RenderedFlashcard, error) {
+	return services.RenderFlashcards(deckId)
+}
+
+// RenderMarkdown renders Markdown that isn't saved yet, e.g. for a live preview in the editor
+func (f *FlashcardImpl) RenderMarkdown(text string) (string, error) {
+	return render.Markdown(text)
+}
+
+// GetHighlightCSS returns the stylesheet for syntax highlighted code blocks
+func (f *FlashcardImpl) GetHighlightCSS() (string, error) {
+	return render.HighlightCSS()
+}
 
-	return updatedCard, nil
+func (f *FlashcardImpl) UpdateGrading(grade string) error {
+	// This method seems redundant with Review() since we need the deckId and cardId
+	// to identify which card to update. Consider removing this method from the interface
+	// or clarifying its intended use case.
+	return errors.New("UpdateGrading is deprecated, use Review instead")
+}
+
+// RephraseFlashcard adds AI rephrasings of a flashcard as variants of it and returns the new variants
+func (f *FlashcardImpl) RephraseFlashcard(deckId int, cardId int, maxVariations int) ([]models.FlashcardModel, error) {
+	ctx, cancel := f.app.requestContext()
+	defer cancel()
+	return services.RephraseFlashcardContext(ctx, deckId, cardId, maxVariations)
 }
 
-type FlashcardImpl struct{}
+type FlashcardImpl struct {
+	app *App
+}
 
 // Implement other interface methods on DeckImpl similarly